@@ -52,6 +52,20 @@ func main() {
 		fmt.Println(doc)
 		return
 	}
+	if flag.Arg(0) == "import-calibre" {
+		if err := importCalibre(ctx, &app, flag.Args()[1:]); err != nil {
+			logger.Error("failed to import calibre library", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "export-library" {
+		if err := exportLibrary(ctx, &app, flag.Args()[1:]); err != nil {
+			logger.Error("failed to export library", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 	go func() {
 		if err := app.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Error("failed to run app", "error", err)
@@ -62,6 +76,49 @@ func main() {
 	app.Stop(1 * time.Second)
 }
 
+// importCalibre runs the import-calibre subcommand: import-calibre -library <dir> -owner <email>.
+func importCalibre(ctx context.Context, app *api.App, args []string) error {
+	flags := flag.NewFlagSet("import-calibre", flag.ExitOnError)
+	library := flags.String("library", "", "path to the calibre library directory")
+	owner := flags.String("owner", "", "email of the user who receives the books")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *library == "" || *owner == "" {
+		flags.Usage()
+		return errors.New("library and owner are required")
+	}
+	job, err := app.ImportCalibreLibrary(ctx, *owner, *library)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(
+		"import %s %s: %d books, %d imported, %d duplicates, %d failed\n",
+		job.ID, job.Status, job.Total, job.Imported, job.Duplicates, job.Failed,
+	)
+	return nil
+}
+
+// exportLibrary runs the export-library subcommand: export-library -out <file.zip|dir> [-owner <email>].
+func exportLibrary(ctx context.Context, app *api.App, args []string) error {
+	flags := flag.NewFlagSet("export-library", flag.ExitOnError)
+	out := flags.String("out", "", "path of the zip archive or directory to write, a path ending with .zip is an archive")
+	owner := flags.String("owner", "", "email of the user whose library is exported, every user by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		flags.Usage()
+		return errors.New("out is required")
+	}
+	count, err := app.ExportLibrary(ctx, *owner, *out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d books to %s\n", count, *out)
+	return nil
+}
+
 func setupLogger(debug bool) *slog.Logger {
 	lvl := slog.LevelInfo
 	if debug {
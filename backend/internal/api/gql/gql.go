@@ -16,23 +16,64 @@ import (
 type GQL http.Handler
 
 type Args struct {
-	UserService    services2.Users
-	AuthService    services2.Auth
-	BookService    services2.Books
-	Logger         *slog.Logger
-	AuthMiddleware middlewares.Auth
+	UserService         services2.Users
+	AuthService         services2.Auth
+	Throttler           services2.LoginThrottler
+	RolesService        services2.Roles
+	RegistrationService services2.Registration
+	UserAdminService    services2.UserAdmin
+	PasswordResets      services2.PasswordResets
+	AccountDeletion     services2.AccountDeletion
+	Quotas              services2.Quotas
+	BookService         services2.Books
+	Trash               services2.Trash
+	BookMetadata        services2.BookMetadata
+	Imports             services2.Imports
+	LibraryExports      services2.LibraryExports
+	Conversions         services2.BookConversions
+	Deliveries          services2.BookDeliveries
+	Comics              services2.Comics
+	Audiobooks          services2.Audiobooks
+	Progress            services2.BookProgress
+	MetadataLookup      services2.MetadataLookup
+	Duplicates          services2.Duplicates
+	ShareLinks          services2.ShareLinks
+	Households          services2.Households
+	Logger              *slog.Logger
+	AuthMiddleware      middlewares.Auth
 }
 
 func New(args Args, introspection bool) GQL {
 	cfg := graph.Config{
 		Resolvers: &resolvers.Resolver{
-			UsersService: args.UserService,
-			AuthService:  args.AuthService,
-			BooksService: args.BookService,
-			Logger:       args.Logger,
+			UsersService:           args.UserService,
+			AuthService:            args.AuthService,
+			Throttler:              args.Throttler,
+			RolesService:           args.RolesService,
+			RegistrationService:    args.RegistrationService,
+			UserAdminService:       args.UserAdminService,
+			PasswordResetsService:  args.PasswordResets,
+			AccountDeletionService: args.AccountDeletion,
+			QuotasService:          args.Quotas,
+			BooksService:           args.BookService,
+			TrashService:           args.Trash,
+			BookMetadataService:    args.BookMetadata,
+			ImportsService:         args.Imports,
+			LibraryExportsService:  args.LibraryExports,
+			ConversionsService:     args.Conversions,
+			DeliveriesService:      args.Deliveries,
+			ComicsService:          args.Comics,
+			AudiobooksService:      args.Audiobooks,
+			ProgressService:        args.Progress,
+			MetadataLookupService:  args.MetadataLookup,
+			DuplicatesService:      args.Duplicates,
+			ShareLinksService:      args.ShareLinks,
+			HouseholdsService:      args.Households,
+			Logger:                 args.Logger,
 		},
 	}
 	cfg.Directives.Auth = args.AuthMiddleware.GQLDirective
+	cfg.Directives.HasPermission = middlewares.HasPermissionDirective
 	srv := handler.New(graph.NewExecutableSchema(cfg))
 	if introspection {
 		srv.Use(extension.Introspection{})
@@ -0,0 +1,130 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+// SetUserActive is the resolver for the setUserActive field.
+func (r *mutationResolver) SetUserActive(ctx context.Context, userID uuid.UUID, active bool) (*gqlmodel.User, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if user.ID == userID && !active {
+		return nil, errors.New("you cannot deactivate your own account")
+	}
+	updated, err := r.UserAdminService.SetActive(ctx, userID, active)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error("failed to set user active", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(updated), nil
+}
+
+// SetUserAdmin is the resolver for the setUserAdmin field.
+func (r *mutationResolver) SetUserAdmin(ctx context.Context, userID uuid.UUID, admin bool) (*gqlmodel.User, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if user.ID == userID && !admin {
+		return nil, errors.New("you cannot revoke your own admin role")
+	}
+	updated, err := r.UserAdminService.SetAdmin(ctx, userID, admin)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error("failed to set user admin", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(updated), nil
+}
+
+// ForcePasswordReset is the resolver for the forcePasswordReset field.
+func (r *mutationResolver) ForcePasswordReset(ctx context.Context, userID uuid.UUID) (bool, error) {
+	err := r.PasswordResetsService.Force(ctx, userID)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return false, err
+	} else if err != nil {
+		r.Logger.Error("failed to force password reset", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if user.ID == userID {
+		return false, errors.New("you cannot delete your own account")
+	}
+	err := r.UserAdminService.Delete(ctx, userID)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return false, err
+	} else if err != nil {
+		r.Logger.Error("failed to delete user", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// SetUserStorageQuota is the resolver for the setUserStorageQuota field.
+func (r *mutationResolver) SetUserStorageQuota(ctx context.Context, userID uuid.UUID, quota *uint64) (*gqlmodel.StorageUsage, error) {
+	var bytesQuota *int64
+	if quota != nil {
+		value := int64(*quota)
+		bytesQuota = &value
+	}
+	if err := r.QuotasService.SetQuota(ctx, userID, bytesQuota); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, err
+		}
+		r.Logger.Error("failed to set storage quota", "error", err)
+		return nil, errors.New("internal error")
+	}
+	usage, err := r.QuotasService.Usage(ctx, userID)
+	if err != nil {
+		r.Logger.Error("failed to get storage usage", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toStorageUsagePayload(usage), nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, filter *gqlmodel.UsersFilter, limit *uint64, offset *uint64) ([]gqlmodel.UserOverview, error) {
+	usersFilter := entities.UsersFilter{}
+	if filter != nil {
+		usersFilter.Search = valueOr(filter.Search.Value(), "")
+		usersFilter.IsActive = filter.IsActive.Value()
+		usersFilter.IsAdmin = filter.IsAdmin.Value()
+	}
+	users, err := r.UserAdminService.GetMany(ctx, usersFilter, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		r.Logger.Error("failed to get users", "error", err)
+		return nil, errors.New("internal error")
+	}
+	payload := make([]gqlmodel.UserOverview, len(users))
+	for i, user := range users {
+		payload[i] = *toUserOverviewPayload(user)
+	}
+	return payload, nil
+}
+
+// UserOverview is the resolver for the userOverview field.
+func (r *queryResolver) UserOverview(ctx context.Context, userID uuid.UUID) (*gqlmodel.UserOverview, error) {
+	user, err := r.UserAdminService.GetOverview(ctx, userID)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error("failed to get user overview", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserOverviewPayload(user), nil
+}
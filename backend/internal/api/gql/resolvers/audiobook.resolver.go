@@ -0,0 +1,65 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
+)
+
+// UploadAudiobook is the resolver for the uploadAudiobook field.
+func (r *mutationResolver) UploadAudiobook(ctx context.Context, files []graphql.Upload) (*gqlmodel.BookPayload, error) {
+	tracks := make([]services.FileUpload, len(files))
+	for i, file := range files {
+		tracks[i] = services.FileUpload{Name: file.Filename, Size: file.Size, Content: file.File}
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	book, err := r.BooksService.UploadAudiobook(ctx, entities.Book{UploadedBy: user.ID}, tracks)
+	// the audiobook the user already has is returned in place of a copy
+	if err != nil && !errors.Is(err, services.ErrDuplicateBook) {
+		return nil, err
+	}
+	return r.bookPayload(ctx, book)
+}
+
+// SaveBookProgress is the resolver for the saveBookProgress field.
+func (r *mutationResolver) SaveBookProgress(ctx context.Context, input gqlmodel.BookProgressInput) (*gqlmodel.BookProgress, error) {
+	book, err := r.BooksService.GetByID(ctx, input.BookID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.canReadBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	// omitted fields keep their saved values
+	progress, err := r.ProgressService.Get(ctx, user.ID, book.ID)
+	if err != nil && !errors.Is(err, services.ErrBookProgressNotFound) {
+		return nil, err
+	}
+	progress.UserID = user.ID
+	if input.Percentage.IsSet() {
+		progress.Percentage = valueOr(input.Percentage.Value(), 0)
+	}
+	if input.Locator.IsSet() {
+		progress.Locator = valueOr(input.Locator.Value(), "")
+	}
+	if input.Position.IsSet() {
+		progress.Position = time.Duration(valueOr(input.Position.Value(), 0) * float64(time.Second))
+	}
+	progress, err = r.ProgressService.Save(ctx, book, progress)
+	if err != nil {
+		return nil, err
+	}
+	payload := toBookProgressPayload(progress)
+	return &payload, nil
+}
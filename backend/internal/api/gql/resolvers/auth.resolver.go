@@ -8,45 +8,49 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Shelffy/shelffy/internal/api"
 	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
 	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
-	"github.com/Shelffy/shelffy/internal/entities"
-	"github.com/Shelffy/shelffy/internal/repositories"
 	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
 )
 
 // Register is the resolver for the register field.
-func (r *mutationResolver) Register(ctx context.Context, register gqlmodel.RegisterUserInput) (*gqlmodel.User, error) {
-	_, err := r.UsersService.GetByEmail(ctx, register.Email)
-	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
-		r.Logger.Error("failed to get user", "error", err)
-		return nil, errors.New("internal error")
-	} else if err == nil {
-		return nil, errors.New("user with this email already exists")
-	}
-	dbUser, err := r.UsersService.Create(ctx, entities.User{
-		Email:    register.Email,
-		Username: register.Username,
-		Password: register.Password,
-		IsActive: true,
+func (r *mutationResolver) Register(ctx context.Context, register gqlmodel.RegisterUserInput) (bool, error) {
+	_, err := r.RegistrationService.Register(ctx, services.RegisterInput{
+		Email:      register.Email,
+		Username:   register.Username,
+		Password:   register.Password,
+		InviteCode: valueOr(register.InviteCode.Value(), ""),
 	})
-	if err != nil {
-		return nil, errors.New("internal error")
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, services.ErrEmailTaken):
+		// the response must not reveal whether the email is already registered
+		return true, nil
+	case errors.Is(err, services.ErrInviteRequired), errors.Is(err, services.ErrInvalidInvite):
+		return false, err
+	default:
+		return false, errors.New("internal error")
 	}
-	return &gqlmodel.User{
-		ID:        dbUser.ID,
-		Email:     dbUser.Email,
-		IsActive:  dbUser.IsActive,
-		CreatedAt: dbUser.CreatedAt,
-	}, nil
 }
 
 // Login is the resolver for the login field.
 func (r *mutationResolver) Login(ctx context.Context, login gqlmodel.LoginInput) (*gqlmodel.LoginPayload, error) {
 	w := contextvalues.GetResponseWriterOrPanic(ctx)
-	dbUser, session, err := r.AuthService.Login(ctx, login.Email, login.Password)
+	client := contextvalues.GetClientInfo(ctx)
+	dbUser, session, err := r.AuthService.Login(ctx, login.Email, login.Password, client)
+	var throttled services.ThrottledError
+	if errors.As(err, &throttled) {
+		return nil, throttled
+	}
+	if errors.Is(err, services.ErrAccountInactive) {
+		return nil, err
+	}
 	if err != nil && !errors.Is(err, services.ErrInvalidCredentials) {
 		r.Logger.Error("failed to create session", "error", err)
 		return nil, errors.New("internal error")
@@ -61,12 +65,7 @@ func (r *mutationResolver) Login(ctx context.Context, login gqlmodel.LoginInput)
 		HttpOnly: true,
 	})
 	return &gqlmodel.LoginPayload{
-		User: &gqlmodel.User{
-			ID:        dbUser.ID,
-			Email:     dbUser.Email,
-			IsActive:  dbUser.IsActive,
-			CreatedAt: dbUser.CreatedAt,
-		},
+		User: toUserPayload(dbUser),
 	}, nil
 }
 
@@ -86,3 +85,111 @@ func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
 	})
 	return true, nil
 }
+
+// UnlockAccount is the resolver for the unlockAccount field.
+func (r *mutationResolver) UnlockAccount(ctx context.Context, token string) (bool, error) {
+	if err := r.Throttler.UnlockByToken(ctx, token); err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return false, err
+		}
+		r.Logger.Error("failed to unlock account", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// ResetPassword is the resolver for the resetPassword field.
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, password string) (bool, error) {
+	err := r.PasswordResetsService.Reset(ctx, token, password)
+	if errors.Is(err, services.ErrInvalidResetToken) {
+		return false, err
+	} else if err != nil {
+		r.Logger.Error("failed to reset password", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// UnlockUserAccount is the resolver for the unlockUserAccount field.
+func (r *mutationResolver) UnlockUserAccount(ctx context.Context, email string) (bool, error) {
+	if err := r.Throttler.UnlockAccount(ctx, email); err != nil {
+		r.Logger.Error("failed to unlock account", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.AuthService.RevokeSession(ctx, user.ID, id); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return false, err
+		}
+		r.Logger.Error("failed to revoke session", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// RevokeOtherSessions is the resolver for the revokeOtherSessions field.
+func (r *mutationResolver) RevokeOtherSessions(ctx context.Context) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	sessionID := contextvalues.GetSessionIDOrPanic(ctx)
+	if err := r.AuthService.DeactivateByUserID(ctx, user.ID, sessionID); err != nil {
+		r.Logger.Error("failed to revoke sessions", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// MySessions is the resolver for the mySessions field.
+func (r *queryResolver) MySessions(ctx context.Context) ([]gqlmodel.Session, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	currentSessionID := contextvalues.GetSessionIDOrPanic(ctx)
+	dbSessions, err := r.AuthService.GetSessionByUserID(ctx, user.ID)
+	if err != nil {
+		r.Logger.Error("failed to get sessions", "error", err)
+		return nil, errors.New("internal error")
+	}
+	now := time.Now()
+	sessions := make([]gqlmodel.Session, 0, len(dbSessions))
+	for _, session := range dbSessions {
+		if !session.IsActive || session.ExpiresAt.Before(now) {
+			continue
+		}
+		sessions = append(sessions, gqlmodel.Session{
+			ID:         session.PublicID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+	return sessions, nil
+}
+
+// AuthAuditLog is the resolver for the authAuditLog field.
+func (r *queryResolver) AuthAuditLog(ctx context.Context, email string, limit *uint64, offset *uint64) ([]gqlmodel.AuditEntry, error) {
+	dbEntries, err := r.Throttler.AuditLog(ctx, email, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		r.Logger.Error("failed to get audit log", "error", err)
+		return nil, errors.New("internal error")
+	}
+	entries := make([]gqlmodel.AuditEntry, len(dbEntries))
+	for i, entry := range dbEntries {
+		entries[i] = gqlmodel.AuditEntry{
+			ID:        strconv.FormatInt(entry.ID, 10),
+			UserID:    entry.UserID,
+			Email:     entry.Email,
+			IP:        entry.IP,
+			Event:     string(entry.Event),
+			Details:   entry.Details,
+			CreatedAt: entry.CreatedAt,
+		}
+	}
+	return entries, nil
+}
@@ -6,17 +6,144 @@ package resolvers
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	"github.com/Shelffy/shelffy/internal/api/gql/graph"
+	"github.com/Shelffy/shelffy/internal/audio"
+	"github.com/Shelffy/shelffy/internal/comics"
 	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
 	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
 )
 
+// Files is the resolver for the files field.
+func (r *bookPayloadResolver) Files(ctx context.Context, obj *gqlmodel.BookPayload) ([]gqlmodel.BookFilePayload, error) {
+	files, err := r.BooksService.GetFiles(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.BookFilePayload, len(files))
+	for i, file := range files {
+		payload[i] = toBookFilePayload(file, i == 0, obj.URL)
+	}
+	return payload, nil
+}
+
+// Formats is the resolver for the formats field.
+func (r *bookPayloadResolver) Formats(ctx context.Context, obj *gqlmodel.BookPayload) ([]gqlmodel.BookFormatPayload, error) {
+	files, err := r.BooksService.GetFiles(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	conversions, err := r.ConversionsService.GetMany(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	book := entities.Book{ID: obj.ID, Format: entities.BookFormat(obj.Format)}
+	targets := r.ConversionsService.Targets(book)
+	formats := make([]gqlmodel.BookFormatPayload, 0, len(files)+len(targets))
+	for i, file := range files {
+		// the tracks of an audiobook share their format
+		if slices.ContainsFunc(formats, func(format gqlmodel.BookFormatPayload) bool { return format.Format == string(file.Format) }) {
+			continue
+		}
+		file := toBookFilePayload(file, i == 0, obj.URL)
+		formats = append(formats, gqlmodel.BookFormatPayload{
+			Format:   file.Format,
+			Original: true,
+			Status:   bookFormatAvailable,
+			Size:     &file.Size,
+			URL:      file.URL,
+		})
+	}
+	for _, format := range targets {
+		if slices.ContainsFunc(files, func(file entities.BookFile) bool { return file.Format == format }) {
+			continue
+		}
+		conversion := entities.BookConversion{BookID: obj.ID, Format: format}
+		if i := slices.IndexFunc(conversions, func(c entities.BookConversion) bool { return c.Format == format }); i >= 0 {
+			conversion = conversions[i]
+		}
+		formats = append(formats, toBookFormatPayload(conversion, obj.URL))
+	}
+	return formats, nil
+}
+
+// PageCount is the resolver for the pageCount field.
+func (r *bookPayloadResolver) PageCount(ctx context.Context, obj *gqlmodel.BookPayload) (*int, error) {
+	if !comics.IsComic(entities.BookFormat(obj.Format)) {
+		return nil, nil
+	}
+	book, err := r.BooksService.GetByID(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := r.ComicsService.Pages(ctx, book)
+	if errors.Is(err, services.ErrBookPendingScan) || errors.Is(err, services.ErrNotComic) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	count := len(pages)
+	return &count, nil
+}
+
+// Audiobook is the resolver for the audiobook field.
+func (r *bookPayloadResolver) Audiobook(ctx context.Context, obj *gqlmodel.BookPayload) (*gqlmodel.Audiobook, error) {
+	if !audio.IsAudio(entities.BookFormat(obj.Format)) {
+		return nil, nil
+	}
+	book, err := r.BooksService.GetByID(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := r.AudiobooksService.Tracks(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
+	if err != nil {
+		r.Logger.Error("error while building book url", "error", err.Error())
+		return nil, errors.New("internal error")
+	}
+	payload := toAudiobookPayload(tracks, bookURL)
+	return &payload, nil
+}
+
+// Progress is the resolver for the progress field.
+func (r *bookPayloadResolver) Progress(ctx context.Context, obj *gqlmodel.BookPayload) (*gqlmodel.BookProgress, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	progress, err := r.ProgressService.Get(ctx, user.ID, obj.ID)
+	if errors.Is(err, services.ErrBookProgressNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload := toBookProgressPayload(progress)
+	return &payload, nil
+}
+
 // UploadBook is the resolver for the uploadBook field.
 func (r *mutationResolver) UploadBook(ctx context.Context, input *gqlmodel.UploadBookInput) (*gqlmodel.BookPayload, error) {
+	if bookID := input.BookID.Value(); bookID != nil {
+		book, err := r.BooksService.GetByID(ctx, *bookID)
+		if err != nil {
+			return nil, err
+		}
+		if !CanEditBook(ctx, book) {
+			return nil, errors.New("access denied")
+		}
+		if _, err := r.BooksService.AddFile(ctx, book, input.File.Size, input.File.File); err != nil {
+			return nil, err
+		}
+		return r.bookPayload(ctx, book)
+	}
 	user := contextvalues.GetUserOrPanic(ctx)
 	uploadedBook, err := r.BooksService.Upload(
 		ctx,
@@ -27,74 +154,158 @@ func (r *mutationResolver) UploadBook(ctx context.Context, input *gqlmodel.Uploa
 		input.File.Size,
 		input.File.File,
 	)
-	if err != nil {
+	// the book the user already has is returned in place of a copy
+	if err != nil && !errors.Is(err, services.ErrDuplicateBook) {
 		return nil, err
 	}
-	return &gqlmodel.BookPayload{
-		ID:         uploadedBook.ID,
-		Title:      uploadedBook.Title,
-		Hash:       hex.EncodeToString(uploadedBook.Hash[:]),
-		UploadedAt: uploadedBook.UploadedAt,
-		UploadedBy: uploadedBook.UploadedBy,
-	}, nil
+	payload := toBookPayload(uploadedBook, "")
+	return &payload, nil
 }
 
 // DeleteBook is the resolver for the deleteBook field.
 func (r *mutationResolver) DeleteBook(ctx context.Context, input *gqlmodel.BookInput) (bool, error) {
-	panic(fmt.Errorf("not implemented: DeleteBook - deleteBook"))
+	book, err := r.BooksService.GetByID(ctx, input.ID)
+	if err != nil {
+		return false, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	if book.UploadedBy != user.ID && !contextvalues.HasPermission(ctx, entities.PermissionBooksDeleteAny) {
+		return false, errors.New("access denied")
+	}
+	if err := r.BooksService.Delete(ctx, book.ID); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// Book is the resolver for the book field.
-func (r *queryResolver) Book(ctx context.Context, input *gqlmodel.BookInput) (*gqlmodel.BookPayload, error) {
+// UpdateBook is the resolver for the updateBook field.
+func (r *mutationResolver) UpdateBook(ctx context.Context, input gqlmodel.UpdateBookInput) (*gqlmodel.BookPayload, error) {
 	book, err := r.BooksService.GetByID(ctx, input.ID)
 	if err != nil {
 		return nil, err
 	}
+	if !CanEditBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	book, err = r.BookMetadataService.Update(ctx, book.ID, user.ID, input.Version, services.BookMetadataPatch{
+		Title:         optionalValue(input.Title),
+		Authors:       optionalSlice(input.Authors),
+		Description:   optionalValue(input.Description),
+		Language:      optionalValue(input.Language),
+		Publisher:     optionalValue(input.Publisher),
+		PublishedDate: optionalPointer(input.PublishedDate),
+		ISBN:          optionalValue(input.Isbn),
+		Series:        optionalValue(input.Series),
+		SeriesIndex:   optionalPointer(input.SeriesIndex),
+		Tags:          optionalSlice(input.Tags),
+		Identifiers:   optionalIdentifiers(input.Identifiers),
+		Rating:        optionalPointer(input.Rating),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.bookPayload(ctx, book)
+}
+
+// RevertBook is the resolver for the revertBook field.
+func (r *mutationResolver) RevertBook(ctx context.Context, id uuid.UUID, version int, expectedVersion int) (*gqlmodel.BookPayload, error) {
+	book, err := r.BooksService.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanEditBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	book, err = r.BookMetadataService.Revert(ctx, book.ID, user.ID, version, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	return r.bookPayload(ctx, book)
+}
+
+// DeleteBookFile is the resolver for the deleteBookFile field.
+func (r *mutationResolver) DeleteBookFile(ctx context.Context, id uuid.UUID, fileID uuid.UUID) (bool, error) {
+	book, err := r.BooksService.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if !CanEditBook(ctx, book) {
+		return false, errors.New("access denied")
+	}
+	if err := r.BooksService.DeleteFile(ctx, book, fileID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ConvertBook is the resolver for the convertBook field.
+func (r *mutationResolver) ConvertBook(ctx context.Context, id uuid.UUID, format string) (*gqlmodel.BookFormatPayload, error) {
+	book, err := r.BooksService.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if !IsBookOwnerOrAdmin(ctx, book) {
 		return nil, errors.New("access denied")
 	}
+	conversion, err := r.ConversionsService.Request(ctx, book, entities.BookFormat(format), true)
+	if err != nil {
+		return nil, err
+	}
 	bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
 	if err != nil {
 		r.Logger.Error("error while building book url", "error", err.Error())
 		return nil, errors.New("internal error")
 	}
-	return &gqlmodel.BookPayload{
-		ID:         book.ID,
-		Title:      book.Title,
-		Hash:       hex.EncodeToString(book.Hash[:]),
-		UploadedAt: book.UploadedAt,
-		UploadedBy: book.UploadedBy,
-		URL:        bookURL,
-	}, nil
+	payload := toBookFormatPayload(conversion, bookURL)
+	return &payload, nil
+}
+
+// Book is the resolver for the book field.
+func (r *queryResolver) Book(ctx context.Context, input *gqlmodel.BookInput) (*gqlmodel.BookPayload, error) {
+	book, err := r.BooksService.GetByID(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.canReadBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	return r.bookPayload(ctx, book)
 }
 
 // UserBooks is the resolver for the userBooks field.
 func (r *queryResolver) UserBooks(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.BookPayload, error) {
 	user := contextvalues.GetUserOrPanic(ctx)
-	dbBooks, err := r.BooksService.GetManyByUserID(ctx, user.ID, limit, offset)
+	books, err := r.BooksService.GetLibrary(ctx, user.ID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
-	books := make([]gqlmodel.BookPayload, len(dbBooks))
-	for i, book := range dbBooks {
-		bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
-		if err != nil {
-			r.Logger.Error("error while building book url", "error", err.Error())
-			return nil, errors.New("internal error")
-		}
-		books[i] = gqlmodel.BookPayload{
-			ID:         book.ID,
-			Title:      book.Title,
-			Hash:       hex.EncodeToString(book.Hash[:]),
-			UploadedAt: book.UploadedAt,
-			UploadedBy: book.UploadedBy,
-			URL:        bookURL,
-		}
-	}
-	return books, nil
+	return r.booksPayload(ctx, books)
 }
 
 // UserBookTitle is the resolver for the userBookTitle field.
 func (r *queryResolver) UserBookTitle(ctx context.Context, input *gqlmodel.UserBookTitleInput) (*gqlmodel.BookPayload, error) {
 	panic(fmt.Errorf("not implemented: UserBookTitle - userBookTitle"))
 }
+
+// BookHistory is the resolver for the bookHistory field.
+func (r *queryResolver) BookHistory(ctx context.Context, id uuid.UUID, limit *uint64, offset *uint64) ([]gqlmodel.BookMetadataVersion, error) {
+	book, err := r.BooksService.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBookOwnerOrAdmin(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	versions, err := r.BookMetadataService.History(ctx, book.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	return toBookMetadataVersionsPayload(versions), nil
+}
+
+// BookPayload returns graph.BookPayloadResolver implementation.
+func (r *Resolver) BookPayload() graph.BookPayloadResolver { return &bookPayloadResolver{r} }
+
+type bookPayloadResolver struct{ *Resolver }
@@ -0,0 +1,87 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+)
+
+// AddDevice is the resolver for the addDevice field.
+func (r *mutationResolver) AddDevice(ctx context.Context, input gqlmodel.DeviceInput) (*gqlmodel.Device, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	device, err := r.DeliveriesService.AddDevice(ctx, entities.Device{
+		UserID: user.ID,
+		Name:   input.Name,
+		Email:  input.Email,
+		Format: entities.BookFormat(valueOr(input.Format.Value(), "")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload := toDevicePayload(device)
+	return &payload, nil
+}
+
+// RemoveDevice is the resolver for the removeDevice field.
+func (r *mutationResolver) RemoveDevice(ctx context.Context, id uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.DeliveriesService.RemoveDevice(ctx, user.ID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SendBookToDevice is the resolver for the sendBookToDevice field.
+func (r *mutationResolver) SendBookToDevice(ctx context.Context, bookID uuid.UUID, deviceID uuid.UUID) (*gqlmodel.BookDelivery, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.canReadBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	// household members can send the formats the book already has, converting it is up to the owner
+	delivery, err := r.DeliveriesService.Send(ctx, user.ID, book, deviceID, IsBookOwnerOrAdmin(ctx, book))
+	if err != nil {
+		return nil, err
+	}
+	payload := toBookDeliveryPayload(delivery)
+	return &payload, nil
+}
+
+// Devices is the resolver for the devices field.
+func (r *queryResolver) Devices(ctx context.Context) ([]gqlmodel.Device, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	devices, err := r.DeliveriesService.GetDevices(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.Device, len(devices))
+	for i, device := range devices {
+		payload[i] = toDevicePayload(device)
+	}
+	return payload, nil
+}
+
+// BookDeliveries is the resolver for the bookDeliveries field.
+func (r *queryResolver) BookDeliveries(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.BookDelivery, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	deliveries, err := r.DeliveriesService.GetMany(ctx, user.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.BookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		payload[i] = toBookDeliveryPayload(delivery)
+	}
+	return payload, nil
+}
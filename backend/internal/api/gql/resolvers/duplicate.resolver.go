@@ -0,0 +1,68 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/google/uuid"
+)
+
+// MergeDuplicates is the resolver for the mergeDuplicates field.
+func (r *mutationResolver) MergeDuplicates(ctx context.Context, targetID uuid.UUID, bookIds []uuid.UUID) (*gqlmodel.BookPayload, error) {
+	books, err := r.editableBooks(ctx, append([]uuid.UUID{targetID}, bookIds...))
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.DuplicatesService.Merge(ctx, books[0], books[1:])
+	if err != nil {
+		return nil, err
+	}
+	return r.bookPayload(ctx, merged)
+}
+
+// KeepDuplicates is the resolver for the keepDuplicates field.
+func (r *mutationResolver) KeepDuplicates(ctx context.Context, bookIds []uuid.UUID) (bool, error) {
+	books, err := r.editableBooks(ctx, bookIds)
+	if err != nil {
+		return false, err
+	}
+	if err := r.DuplicatesService.KeepBoth(ctx, books); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Duplicates is the resolver for the duplicates field.
+func (r *queryResolver) Duplicates(ctx context.Context) ([]gqlmodel.DuplicateGroup, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	groups, err := r.DuplicatesService.Report(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.DuplicateGroup, len(groups))
+	for i, group := range groups {
+		payload[i] = gqlmodel.DuplicateGroup{
+			Reasons: make([]gqlmodel.DuplicateReason, len(group.Reasons)),
+			Books:   make([]gqlmodel.BookPayload, len(group.Books)),
+		}
+		for j, reason := range group.Reasons {
+			payload[i].Reasons[j] = gqlmodel.DuplicateReason(strings.ToUpper(string(reason)))
+		}
+		for j, book := range group.Books {
+			bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
+			if err != nil {
+				r.Logger.Error("error while building book url", "error", err.Error())
+				return nil, errors.New("internal error")
+			}
+			payload[i].Books[j] = toBookPayload(book, bookURL)
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,62 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// ExportLibrary is the resolver for the exportLibrary field.
+func (r *mutationResolver) ExportLibrary(ctx context.Context, allUsers *bool) (*gqlmodel.LibraryExport, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	userID := &user.ID
+	if valueOr(allUsers, false) {
+		if !contextvalues.HasPermission(ctx, entities.PermissionUsersManage) {
+			return nil, errors.New("access denied")
+		}
+		userID = nil
+	}
+	export, err := r.LibraryExportsService.Queue(ctx, user.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	payload := r.libraryExportPayload(export)
+	return &payload, nil
+}
+
+// LibraryExport is the resolver for the libraryExport field.
+func (r *queryResolver) LibraryExport(ctx context.Context, id uuid.UUID) (*gqlmodel.LibraryExport, error) {
+	export, err := r.LibraryExportsService.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	if export.RequestedBy != user.ID && !contextvalues.HasPermission(ctx, entities.PermissionUsersManage) {
+		return nil, services.ErrLibraryExportNotFound
+	}
+	payload := r.libraryExportPayload(export)
+	return &payload, nil
+}
+
+// LibraryExports is the resolver for the libraryExports field.
+func (r *queryResolver) LibraryExports(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.LibraryExport, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	exports, err := r.LibraryExportsService.GetMany(ctx, user.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.LibraryExport, len(exports))
+	for i, export := range exports {
+		payload[i] = r.libraryExportPayload(export)
+	}
+	return payload, nil
+}
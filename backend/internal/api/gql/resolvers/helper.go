@@ -2,16 +2,259 @@ package resolvers
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
+	"maps"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
 	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
 	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
 	"github.com/google/uuid"
 )
 
+const defaultPageSize = 50
+
+func valueOr[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
 func IsBookOwnerOrAdmin(ctx context.Context, book entities.Book) bool {
 	user := contextvalues.GetUserOrPanic(ctx)
-	return user.IsAdmin || user.ID == book.UploadedBy
+	return user.ID == book.UploadedBy || contextvalues.HasPermission(ctx, entities.PermissionBooksReadAny)
+}
+
+func toBookPayload(book entities.Book, url string) gqlmodel.BookPayload {
+	return gqlmodel.BookPayload{
+		ID:         book.ID,
+		Title:      book.Title,
+		Hash:       hex.EncodeToString(book.Hash[:]),
+		UploadedAt: book.UploadedAt,
+		UploadedBy: book.UploadedBy,
+		URL:        url,
+		Format:     string(book.Format),
+		MimeType:   book.MIMEType,
+		Status:     string(book.Status),
+		DeletedAt:  book.DeletedAt,
+		Metadata:   toBookMetadataPayload(book.Metadata),
+		Version:    book.Version,
+	}
+}
+
+// bookPayload converts the book together with the URL of its content.
+func (r *Resolver) bookPayload(ctx context.Context, book entities.Book) (*gqlmodel.BookPayload, error) {
+	bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
+	if err != nil {
+		r.Logger.Error("error while building book url", "error", err.Error())
+		return nil, errors.New("internal error")
+	}
+	payload := toBookPayload(book, bookURL)
+	if book.CoverPath != "" {
+		coverURL := bookURL + "/cover"
+		payload.CoverURL = &coverURL
+	}
+	return &payload, nil
+}
+
+// bookFormatAvailable is the status of the original format and of formats the book has not been converted to yet.
+const bookFormatAvailable = "available"
+
+// bookFormatURL returns the URL that downloads the book in the format.
+func bookFormatURL(bookURL string, format entities.BookFormat) string {
+	return bookURL + "?format=" + url.QueryEscape(string(format))
+}
+
+// toBookFilePayload converts the file, the primary file is downloaded from the book URL.
+func toBookFilePayload(file entities.BookFile, primary bool, bookURL string) gqlmodel.BookFilePayload {
+	payload := gqlmodel.BookFilePayload{
+		ID:        file.ID,
+		Format:    string(file.Format),
+		MimeType:  file.MIMEType,
+		Size:      uint64(file.Size),
+		Hash:      hex.EncodeToString(file.Hash[:]),
+		Status:    string(file.Status),
+		Primary:   primary,
+		URL:       bookURL,
+		CreatedAt: file.CreatedAt,
+	}
+	if !primary {
+		payload.URL = bookFormatURL(bookURL, file.Format)
+	}
+	return payload
+}
+
+// toBookFormatPayload converts the conversion, a zero status means it has not been requested.
+func toBookFormatPayload(conversion entities.BookConversion, bookURL string) gqlmodel.BookFormatPayload {
+	payload := gqlmodel.BookFormatPayload{
+		Format: string(conversion.Format),
+		Status: string(conversion.Status),
+		URL:    bookFormatURL(bookURL, conversion.Format),
+		Error:  conversion.Error,
+	}
+	if conversion.Status == "" {
+		payload.Status = bookFormatAvailable
+	}
+	if conversion.Status == entities.BookConversionStatusCompleted {
+		size := uint64(conversion.Size)
+		payload.Size = &size
+	}
+	return payload
+}
+
+func toBookMetadataPayload(metadata entities.BookMetadata) *gqlmodel.BookMetadata {
+	return &gqlmodel.BookMetadata{
+		Authors:       metadata.Authors,
+		Description:   metadata.Description,
+		Language:      metadata.Language,
+		Publisher:     metadata.Publisher,
+		PublishedDate: metadata.PublishedDate,
+		Isbn:          metadata.ISBN,
+		Series:        metadata.Series,
+		SeriesIndex:   metadata.SeriesIndex,
+		Tags:          metadata.Tags,
+		Identifiers:   toBookIdentifiersPayload(metadata.Identifiers),
+		Rating:        metadata.Rating,
+	}
+}
+
+// toBookIdentifiersPayload converts the identifiers sorted by scheme, so the order is stable.
+func toBookIdentifiersPayload(identifiers map[string]string) []gqlmodel.BookIdentifier {
+	payload := make([]gqlmodel.BookIdentifier, 0, len(identifiers))
+	for _, scheme := range slices.Sorted(maps.Keys(identifiers)) {
+		payload = append(payload, gqlmodel.BookIdentifier{Scheme: scheme, Value: identifiers[scheme]})
+	}
+	return payload
+}
+
+func optionalIdentifiers(field graphql.Omittable[[]gqlmodel.BookIdentifierInput]) services.Optional[map[string]string] {
+	if !field.IsSet() {
+		return services.Optional[map[string]string]{}
+	}
+	identifiers := make(map[string]string, len(field.Value()))
+	for _, identifier := range field.Value() {
+		identifiers[identifier.Scheme] = identifier.Value
+	}
+	return services.Some(identifiers)
+}
+
+func toBookMetadataVersionsPayload(versions []entities.BookMetadataVersion) []gqlmodel.BookMetadataVersion {
+	payload := make([]gqlmodel.BookMetadataVersion, len(versions))
+	for i, version := range versions {
+		payload[i] = gqlmodel.BookMetadataVersion{
+			Version:       version.Version,
+			Title:         version.Title,
+			Metadata:      toBookMetadataPayload(version.Metadata),
+			ChangedFields: version.ChangedFields,
+			ChangedBy:     version.ChangedBy,
+			ChangedAt:     version.ChangedAt,
+		}
+	}
+	return payload
+}
+
+// optionalValue converts an input field of a non-nullable value, null is treated as omitted.
+func optionalValue[T any](field graphql.Omittable[*T]) services.Optional[T] {
+	if value := field.Value(); field.IsSet() && value != nil {
+		return services.Some(*value)
+	}
+	return services.Optional[T]{}
+}
+
+// optionalPointer converts an input field of a nullable value, null clears the value.
+func optionalPointer[T any](field graphql.Omittable[*T]) services.Optional[*T] {
+	if field.IsSet() {
+		return services.Some(field.Value())
+	}
+	return services.Optional[*T]{}
+}
+
+func optionalSlice[T any](field graphql.Omittable[[]T]) services.Optional[[]T] {
+	if field.IsSet() {
+		return services.Some(field.Value())
+	}
+	return services.Optional[[]T]{}
+}
+
+func CanEditBook(ctx context.Context, book entities.Book) bool {
+	user := contextvalues.GetUserOrPanic(ctx)
+	return user.ID == book.UploadedBy || contextvalues.HasPermission(ctx, entities.PermissionBooksEditAny)
+}
+
+func toUserPayload(user entities.User) *gqlmodel.User {
+	return &gqlmodel.User{
+		ID:                  user.ID,
+		Email:               user.Email,
+		IsActive:            user.IsActive,
+		ApprovalStatus:      string(user.ApprovalStatus),
+		CreatedAt:           user.CreatedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+func toUserOverviewPayload(user entities.UserOverview) *gqlmodel.UserOverview {
+	return &gqlmodel.UserOverview{
+		ID:             user.ID,
+		Email:          user.Email,
+		Username:       user.Username,
+		IsActive:       user.IsActive,
+		IsAdmin:        user.IsAdmin,
+		ApprovalStatus: string(user.ApprovalStatus),
+		CreatedAt:      user.CreatedAt,
+		LastLoginAt:    user.LastLoginAt,
+		BooksCount:     user.BooksCount,
+	}
+}
+
+func toStorageUsagePayload(usage entities.StorageUsage) *gqlmodel.StorageUsage {
+	return &gqlmodel.StorageUsage{
+		Used:      uint64(usage.Used),
+		Limit:     uint64(usage.Limit),
+		BookCount: usage.BookCount,
+	}
+}
+
+func toInvitePayload(invite entities.Invite) *gqlmodel.Invite {
+	return &gqlmodel.Invite{
+		Code:      invite.Code,
+		CreatedBy: invite.CreatedBy,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		IsRevoked: invite.IsRevoked,
+		CreatedAt: invite.CreatedAt,
+	}
+}
+
+func toInvitesPayload(invites []entities.Invite) []gqlmodel.Invite {
+	payload := make([]gqlmodel.Invite, len(invites))
+	for i, invite := range invites {
+		payload[i] = *toInvitePayload(invite)
+	}
+	return payload
+}
+
+func toRolesPayload(roles []entities.Role) []gqlmodel.Role {
+	payload := make([]gqlmodel.Role, len(roles))
+	for i, role := range roles {
+		permissions := make([]string, len(role.Permissions))
+		for j, permission := range role.Permissions {
+			permissions[j] = string(permission)
+		}
+		payload[i] = gqlmodel.Role{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissions,
+		}
+	}
+	return payload
 }
 
 func BuildBookContentURL(baseURL string, bookID uuid.UUID) (string, error) {
@@ -25,3 +268,255 @@ func BuildBookContentURL(baseURL string, bookID uuid.UUID) (string, error) {
 	}
 	return bookURL.String(), nil
 }
+
+// libraryExportPayload converts the export, completed exports get a signed download link.
+func (r *Resolver) libraryExportPayload(export entities.LibraryExport) gqlmodel.LibraryExport {
+	payload := gqlmodel.LibraryExport{
+		ID:         export.ID,
+		UserID:     export.UserID,
+		Status:     string(export.Status),
+		Books:      export.Books,
+		Size:       uint64(export.Size),
+		Error:      export.Error,
+		CreatedAt:  export.CreatedAt,
+		FinishedAt: export.FinishedAt,
+		ExpiresAt:  export.ExpiresAt,
+	}
+	if export.Status == entities.LibraryExportStatusCompleted {
+		// the link is left out when links are disabled or it cannot be built, errors are logged by the service
+		if downloadURL, err := r.LibraryExportsService.DownloadURL(export); err == nil {
+			payload.DownloadURL = &downloadURL
+		}
+	}
+	return payload
+}
+
+func toImportJobPayload(job entities.ImportJob) gqlmodel.ImportJob {
+	return gqlmodel.ImportJob{
+		ID:         job.ID,
+		Source:     string(job.Source),
+		Name:       job.Name,
+		Status:     string(job.Status),
+		Total:      job.Total,
+		Imported:   job.Imported,
+		Duplicates: job.Duplicates,
+		Failed:     job.Failed,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+func toDevicePayload(device entities.Device) gqlmodel.Device {
+	return gqlmodel.Device{
+		ID:        device.ID,
+		Name:      device.Name,
+		Email:     device.Email,
+		Format:    string(device.Format),
+		CreatedAt: device.CreatedAt,
+	}
+}
+
+func toBookDeliveryPayload(delivery entities.BookDelivery) gqlmodel.BookDelivery {
+	return gqlmodel.BookDelivery{
+		ID:        delivery.ID,
+		BookID:    delivery.BookID,
+		DeviceID:  delivery.DeviceID,
+		Format:    string(delivery.Format),
+		Status:    string(delivery.Status),
+		Size:      uint64(delivery.Size),
+		Error:     delivery.Error,
+		CreatedAt: delivery.CreatedAt,
+		UpdatedAt: delivery.UpdatedAt,
+	}
+}
+
+func toAudiobookPayload(tracks []entities.AudioTrack, bookURL string) gqlmodel.Audiobook {
+	payload := gqlmodel.Audiobook{
+		Duration: services.AudiobookDuration(tracks).Seconds(),
+		Tracks:   make([]gqlmodel.AudioTrack, len(tracks)),
+	}
+	for i, track := range tracks {
+		payload.Tracks[i] = gqlmodel.AudioTrack{
+			Number:   track.Number,
+			Title:    track.Title,
+			Duration: track.Duration.Seconds(),
+			URL:      bookURL + "/tracks/" + strconv.Itoa(track.Number),
+		}
+	}
+	chapters := services.AudiobookChapters(tracks)
+	payload.Chapters = make([]gqlmodel.AudiobookChapter, len(chapters))
+	for i, chapter := range chapters {
+		payload.Chapters[i] = gqlmodel.AudiobookChapter{Title: chapter.Title, Start: chapter.Start.Seconds(), Track: chapter.Track}
+	}
+	return payload
+}
+
+func toBookProgressPayload(progress entities.BookProgress) gqlmodel.BookProgress {
+	return gqlmodel.BookProgress{
+		Percentage: progress.Percentage,
+		Locator:    progress.Locator,
+		Position:   progress.Position.Seconds(),
+		UpdatedAt:  progress.UpdatedAt,
+	}
+}
+
+func toMetadataCandidatesPayload(candidates []services.MetadataCandidate) []gqlmodel.MetadataCandidate {
+	payload := make([]gqlmodel.MetadataCandidate, len(candidates))
+	for i, candidate := range candidates {
+		payload[i] = gqlmodel.MetadataCandidate{
+			ID:         candidate.ID,
+			Provider:   candidate.Provider,
+			Confidence: candidate.Confidence,
+			Title:      candidate.Title,
+			Metadata:   toBookMetadataPayload(candidate.Metadata),
+		}
+		if candidate.CoverURL != "" {
+			payload[i].CoverURL = &candidate.CoverURL
+		}
+	}
+	return payload
+}
+
+// editableBooks gets the books in the order of the ids, the current user must be allowed to edit all of them.
+func (r *mutationResolver) editableBooks(ctx context.Context, ids []uuid.UUID) ([]entities.Book, error) {
+	books := make([]entities.Book, len(ids))
+	for i, id := range ids {
+		book, err := r.BooksService.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !CanEditBook(ctx, book) {
+			return nil, errors.New("access denied")
+		}
+		books[i] = book
+	}
+	return books, nil
+}
+
+// BuildShareLinkURL returns the public download link of a share link.
+func BuildShareLinkURL(baseURL string, token string) (string, error) {
+	linkURL, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	linkURL.Path, err = url.JoinPath(linkURL.Path, "/api", "/v1", "/books", "/shared", token)
+	if err != nil {
+		return "", err
+	}
+	return linkURL.String(), nil
+}
+
+func (r *Resolver) shareLinkPayload(ctx context.Context, link entities.ShareLink) (gqlmodel.ShareLink, error) {
+	linkURL, err := BuildShareLinkURL(contextvalues.GetBaseURL(ctx), link.Token)
+	if err != nil {
+		r.Logger.Error("error while building share link url", "error", err.Error())
+		return gqlmodel.ShareLink{}, errors.New("internal error")
+	}
+	return gqlmodel.ShareLink{
+		ID:           link.ID,
+		BookID:       link.BookID,
+		URL:          linkURL,
+		HasPassword:  link.HasPassword(),
+		ExpiresAt:    link.ExpiresAt,
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		IsRevoked:    link.IsRevoked,
+		CreatedAt:    link.CreatedAt,
+	}, nil
+}
+
+// ownShareLink gets the link, the current user must own its book or be an admin.
+func (r *Resolver) ownShareLink(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error) {
+	link, err := r.ShareLinksService.Get(ctx, linkID)
+	if err != nil {
+		return entities.ShareLink{}, err
+	}
+	book, err := r.BooksService.GetByID(ctx, link.BookID)
+	if err != nil {
+		return entities.ShareLink{}, err
+	}
+	if !IsBookOwnerOrAdmin(ctx, book) {
+		return entities.ShareLink{}, errors.New("access denied")
+	}
+	return link, nil
+}
+
+// canReadBook also lets members of the households the book is shared with read it.
+func (r *Resolver) canReadBook(ctx context.Context, book entities.Book) bool {
+	if IsBookOwnerOrAdmin(ctx, book) {
+		return true
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	ok, err := r.HouseholdsService.CanRead(ctx, user.ID, book)
+	return err == nil && ok
+}
+
+func (r *Resolver) booksPayload(ctx context.Context, books []entities.Book) ([]gqlmodel.BookPayload, error) {
+	payload := make([]gqlmodel.BookPayload, len(books))
+	for i, book := range books {
+		bookURL, err := BuildBookContentURL(contextvalues.GetBaseURL(ctx), book.ID)
+		if err != nil {
+			r.Logger.Error("error while building book url", "error", err.Error())
+			return nil, errors.New("internal error")
+		}
+		payload[i] = toBookPayload(book, bookURL)
+	}
+	return payload, nil
+}
+
+func toHouseholdRole(role gqlmodel.HouseholdRole) entities.HouseholdRole {
+	return entities.HouseholdRole(strings.ToLower(string(role)))
+}
+
+func toHouseholdMemberPayload(member entities.HouseholdMember) gqlmodel.HouseholdMember {
+	return gqlmodel.HouseholdMember{
+		UserID:      member.UserID,
+		Email:       member.Email,
+		Role:        gqlmodel.HouseholdRole(strings.ToUpper(string(member.Role))),
+		AllowedTags: member.AllowedTags,
+		JoinedAt:    member.JoinedAt,
+	}
+}
+
+func toHouseholdInvitesPayload(invites []entities.HouseholdInvite) []gqlmodel.HouseholdInvite {
+	payload := make([]gqlmodel.HouseholdInvite, len(invites))
+	for i, invite := range invites {
+		payload[i] = toHouseholdInvitePayload(invite)
+	}
+	return payload
+}
+
+func toHouseholdInvitePayload(invite entities.HouseholdInvite) gqlmodel.HouseholdInvite {
+	return gqlmodel.HouseholdInvite{
+		ID:            invite.ID,
+		HouseholdID:   invite.HouseholdID,
+		HouseholdName: invite.HouseholdName,
+		Email:         invite.Email,
+		Role:          gqlmodel.HouseholdRole(strings.ToUpper(string(invite.Role))),
+		AllowedTags:   invite.AllowedTags,
+		CreatedAt:     invite.CreatedAt,
+	}
+}
+
+// householdsPayload converts the households together with their members.
+func (r *Resolver) householdsPayload(ctx context.Context, households []entities.Household) ([]gqlmodel.Household, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	payload := make([]gqlmodel.Household, len(households))
+	for i, household := range households {
+		members, err := r.HouseholdsService.GetMembers(ctx, user.ID, household.ID)
+		if err != nil {
+			return nil, err
+		}
+		payload[i] = gqlmodel.Household{
+			ID:        household.ID,
+			Name:      household.Name,
+			CreatedAt: household.CreatedAt,
+			Members:   make([]gqlmodel.HouseholdMember, len(members)),
+		}
+		for j, member := range members {
+			payload[i].Members[j] = toHouseholdMemberPayload(member)
+		}
+	}
+	return payload, nil
+}
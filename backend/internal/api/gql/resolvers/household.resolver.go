@@ -0,0 +1,190 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+)
+
+// CreateHousehold is the resolver for the createHousehold field.
+func (r *mutationResolver) CreateHousehold(ctx context.Context, name string) (*gqlmodel.Household, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	household, err := r.HouseholdsService.Create(ctx, user.ID, name)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.householdsPayload(ctx, []entities.Household{household})
+	if err != nil {
+		return nil, err
+	}
+	return &payload[0], nil
+}
+
+// DeleteHousehold is the resolver for the deleteHousehold field.
+func (r *mutationResolver) DeleteHousehold(ctx context.Context, id uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.Delete(ctx, user.ID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// InviteHouseholdMember is the resolver for the inviteHouseholdMember field.
+func (r *mutationResolver) InviteHouseholdMember(ctx context.Context, input gqlmodel.InviteHouseholdMemberInput) (*gqlmodel.HouseholdInvite, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	invite, err := r.HouseholdsService.InviteMember(ctx, user.ID, entities.HouseholdInvite{
+		HouseholdID: input.HouseholdID,
+		Email:       input.Email,
+		Role:        toHouseholdRole(valueOr(input.Role.Value(), gqlmodel.HouseholdRoleMember)),
+		AllowedTags: input.AllowedTags.Value(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload := toHouseholdInvitePayload(invite)
+	return &payload, nil
+}
+
+// AcceptHouseholdInvite is the resolver for the acceptHouseholdInvite field.
+func (r *mutationResolver) AcceptHouseholdInvite(ctx context.Context, id uuid.UUID) (*gqlmodel.Household, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	household, err := r.HouseholdsService.AcceptInvite(ctx, user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.householdsPayload(ctx, []entities.Household{household})
+	if err != nil {
+		return nil, err
+	}
+	return &payload[0], nil
+}
+
+// DeclineHouseholdInvite is the resolver for the declineHouseholdInvite field.
+func (r *mutationResolver) DeclineHouseholdInvite(ctx context.Context, id uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.DeclineInvite(ctx, user.ID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CancelHouseholdInvite is the resolver for the cancelHouseholdInvite field.
+func (r *mutationResolver) CancelHouseholdInvite(ctx context.Context, id uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.CancelInvite(ctx, user.ID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateHouseholdMember is the resolver for the updateHouseholdMember field.
+func (r *mutationResolver) UpdateHouseholdMember(ctx context.Context, input gqlmodel.UpdateHouseholdMemberInput) (*gqlmodel.HouseholdMember, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	member, err := r.HouseholdsService.UpdateMember(ctx, user.ID, entities.HouseholdMember{
+		HouseholdID: input.HouseholdID,
+		UserID:      input.UserID,
+		Role:        toHouseholdRole(input.Role),
+		AllowedTags: input.AllowedTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload := toHouseholdMemberPayload(member)
+	return &payload, nil
+}
+
+// RemoveHouseholdMember is the resolver for the removeHouseholdMember field.
+func (r *mutationResolver) RemoveHouseholdMember(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.RemoveMember(ctx, user.ID, householdID, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ShareBookWithHousehold is the resolver for the shareBookWithHousehold field.
+func (r *mutationResolver) ShareBookWithHousehold(ctx context.Context, bookID uuid.UUID, householdID uuid.UUID) (bool, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return false, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.ShareBook(ctx, user.ID, householdID, book); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnshareBookFromHousehold is the resolver for the unshareBookFromHousehold field.
+func (r *mutationResolver) UnshareBookFromHousehold(ctx context.Context, bookID uuid.UUID, householdID uuid.UUID) (bool, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return false, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	if err := r.HouseholdsService.UnshareBook(ctx, user.ID, householdID, book); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Households is the resolver for the households field.
+func (r *queryResolver) Households(ctx context.Context) ([]gqlmodel.Household, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	households, err := r.HouseholdsService.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return r.householdsPayload(ctx, households)
+}
+
+// HouseholdBooks is the resolver for the householdBooks field.
+func (r *queryResolver) HouseholdBooks(ctx context.Context, householdID uuid.UUID, limit *uint64, offset *uint64) ([]gqlmodel.BookPayload, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	books, err := r.HouseholdsService.GetBooks(ctx, user.ID, householdID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return r.booksPayload(ctx, books)
+}
+
+// BookHouseholds is the resolver for the bookHouseholds field.
+func (r *queryResolver) BookHouseholds(ctx context.Context, bookID uuid.UUID) ([]gqlmodel.Household, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	households, err := r.HouseholdsService.GetByBook(ctx, user.ID, book)
+	if err != nil {
+		return nil, err
+	}
+	return r.householdsPayload(ctx, households)
+}
+
+// HouseholdInvites is the resolver for the householdInvites field.
+func (r *queryResolver) HouseholdInvites(ctx context.Context) ([]gqlmodel.HouseholdInvite, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	invites, err := r.HouseholdsService.GetInvites(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toHouseholdInvitesPayload(invites), nil
+}
+
+// PendingHouseholdInvites is the resolver for the pendingHouseholdInvites field.
+func (r *queryResolver) PendingHouseholdInvites(ctx context.Context, householdID uuid.UUID) ([]gqlmodel.HouseholdInvite, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	invites, err := r.HouseholdsService.GetHouseholdInvites(ctx, user.ID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	return toHouseholdInvitesPayload(invites), nil
+}
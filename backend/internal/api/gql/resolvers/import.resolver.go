@@ -0,0 +1,86 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	"github.com/Shelffy/shelffy/internal/api/gql/graph"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// Items is the resolver for the items field.
+func (r *importJobResolver) Items(ctx context.Context, obj *gqlmodel.ImportJob, limit *uint64, offset *uint64) ([]gqlmodel.ImportItem, error) {
+	items, err := r.ImportsService.GetItems(ctx, obj.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.ImportItem, len(items))
+	for i, item := range items {
+		payload[i] = gqlmodel.ImportItem{
+			Name:      item.Name,
+			Status:    string(item.Status),
+			BookID:    item.BookID,
+			Error:     item.Error,
+			CreatedAt: item.CreatedAt,
+		}
+	}
+	return payload, nil
+}
+
+// ImportCalibreLibrary is the resolver for the importCalibreLibrary field.
+func (r *mutationResolver) ImportCalibreLibrary(ctx context.Context, path string, ownerID *uuid.UUID) (*gqlmodel.ImportJob, error) {
+	owner := contextvalues.GetUserOrPanic(ctx)
+	if ownerID != nil {
+		user, err := r.UsersService.GetByID(ctx, *ownerID)
+		if err != nil {
+			return nil, err
+		}
+		owner = user
+	}
+	job, err := r.ImportsService.QueueCalibreLibrary(ctx, owner.ID, path)
+	if err != nil {
+		return nil, err
+	}
+	payload := toImportJobPayload(job)
+	return &payload, nil
+}
+
+// ImportJob is the resolver for the importJob field.
+func (r *queryResolver) ImportJob(ctx context.Context, id uuid.UUID) (*gqlmodel.ImportJob, error) {
+	job, err := r.ImportsService.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	if job.UserID != user.ID && !contextvalues.HasPermission(ctx, entities.PermissionBooksReadAny) {
+		return nil, services.ErrImportJobNotFound
+	}
+	payload := toImportJobPayload(job)
+	return &payload, nil
+}
+
+// ImportJobs is the resolver for the importJobs field.
+func (r *queryResolver) ImportJobs(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.ImportJob, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	jobs, err := r.ImportsService.GetJobs(ctx, user.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.ImportJob, len(jobs))
+	for i, job := range jobs {
+		payload[i] = toImportJobPayload(job)
+	}
+	return payload, nil
+}
+
+// ImportJob returns graph.ImportJobResolver implementation.
+func (r *Resolver) ImportJob() graph.ImportJobResolver { return &importJobResolver{r} }
+
+type importJobResolver struct{ *Resolver }
@@ -0,0 +1,53 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// ApplyMetadata is the resolver for the applyMetadata field.
+func (r *mutationResolver) ApplyMetadata(ctx context.Context, input gqlmodel.ApplyMetadataInput) (*gqlmodel.BookPayload, error) {
+	book, err := r.BooksService.GetByID(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanEditBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	fields := make([]services.MetadataField, len(input.Fields))
+	for i, field := range input.Fields {
+		fields[i] = services.MetadataField(strings.ToLower(string(field)))
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	book, err = r.MetadataLookupService.Apply(ctx, book, user.ID, input.Version, input.CandidateID, fields)
+	if err != nil {
+		return nil, err
+	}
+	return r.bookPayload(ctx, book)
+}
+
+// SuggestMetadata is the resolver for the suggestMetadata field.
+func (r *queryResolver) SuggestMetadata(ctx context.Context, bookID uuid.UUID) ([]gqlmodel.MetadataCandidate, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanEditBook(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	candidates, err := r.MetadataLookupService.Suggest(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	return toMetadataCandidatesPayload(candidates), nil
+}
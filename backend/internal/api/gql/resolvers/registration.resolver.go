@@ -0,0 +1,123 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// ApproveUser is the resolver for the approveUser field.
+func (r *mutationResolver) ApproveUser(ctx context.Context, userID uuid.UUID) (*gqlmodel.User, error) {
+	user, err := r.RegistrationService.Approve(ctx, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotPending) || errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, err
+		}
+		r.Logger.Error("failed to approve user", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(user), nil
+}
+
+// RejectUser is the resolver for the rejectUser field.
+func (r *mutationResolver) RejectUser(ctx context.Context, userID uuid.UUID) (*gqlmodel.User, error) {
+	user, err := r.RegistrationService.Reject(ctx, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotPending) || errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, err
+		}
+		r.Logger.Error("failed to reject user", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(user), nil
+}
+
+// CreateInvite is the resolver for the createInvite field.
+func (r *mutationResolver) CreateInvite(ctx context.Context, input *gqlmodel.CreateInviteInput) (*gqlmodel.Invite, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	createInput := services.CreateInviteInput{}
+	if input != nil {
+		createInput.MaxUses = valueOr(input.MaxUses.Value(), 0)
+		createInput.ExpiresAt = input.ExpiresAt.Value()
+	}
+	unlimited := contextvalues.HasPermission(ctx, entities.PermissionUsersManage)
+	invite, err := r.RegistrationService.CreateInvite(ctx, user.ID, unlimited, createInput)
+	if err != nil {
+		if errors.Is(err, services.ErrInviteQuotaExceeded) {
+			return nil, err
+		}
+		r.Logger.Error("failed to create invite", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toInvitePayload(invite), nil
+}
+
+// RevokeInvite is the resolver for the revokeInvite field.
+func (r *mutationResolver) RevokeInvite(ctx context.Context, code string) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	invite, err := r.RegistrationService.GetInvite(ctx, code)
+	if errors.Is(err, services.ErrInviteNotFound) {
+		return false, err
+	} else if err != nil {
+		r.Logger.Error("failed to get invite", "error", err)
+		return false, errors.New("internal error")
+	}
+	if invite.CreatedBy != user.ID && !contextvalues.HasPermission(ctx, entities.PermissionUsersManage) {
+		return false, services.ErrInviteNotFound
+	}
+	if err := r.RegistrationService.RevokeInvite(ctx, code); err != nil {
+		r.Logger.Error("failed to revoke invite", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// RegistrationMode is the resolver for the registrationMode field.
+func (r *queryResolver) RegistrationMode(ctx context.Context) (string, error) {
+	return string(r.RegistrationService.Mode()), nil
+}
+
+// PendingUsers is the resolver for the pendingUsers field.
+func (r *queryResolver) PendingUsers(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.User, error) {
+	users, err := r.RegistrationService.GetPendingUsers(ctx, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		r.Logger.Error("failed to get pending users", "error", err)
+		return nil, errors.New("internal error")
+	}
+	payload := make([]gqlmodel.User, len(users))
+	for i, user := range users {
+		payload[i] = *toUserPayload(user)
+	}
+	return payload, nil
+}
+
+// Invites is the resolver for the invites field.
+func (r *queryResolver) Invites(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.Invite, error) {
+	invites, err := r.RegistrationService.GetInvites(ctx, nil, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		r.Logger.Error("failed to get invites", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toInvitesPayload(invites), nil
+}
+
+// MyInvites is the resolver for the myInvites field.
+func (r *queryResolver) MyInvites(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.Invite, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	invites, err := r.RegistrationService.GetInvites(ctx, &user.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		r.Logger.Error("failed to get invites", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toInvitesPayload(invites), nil
+}
@@ -11,8 +11,28 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	UsersService services.Users
-	AuthService  services.Auth
-	BooksService services.Books
-	Logger       *slog.Logger
+	UsersService           services.Users
+	AuthService            services.Auth
+	Throttler              services.LoginThrottler
+	RolesService           services.Roles
+	RegistrationService    services.Registration
+	UserAdminService       services.UserAdmin
+	PasswordResetsService  services.PasswordResets
+	AccountDeletionService services.AccountDeletion
+	QuotasService          services.Quotas
+	BooksService           services.Books
+	TrashService           services.Trash
+	BookMetadataService    services.BookMetadata
+	ImportsService         services.Imports
+	LibraryExportsService  services.LibraryExports
+	ConversionsService     services.BookConversions
+	DeliveriesService      services.BookDeliveries
+	ComicsService          services.Comics
+	AudiobooksService      services.Audiobooks
+	ProgressService        services.BookProgress
+	MetadataLookupService  services.MetadataLookup
+	DuplicatesService      services.Duplicates
+	ShareLinksService      services.ShareLinks
+	HouseholdsService      services.Households
+	Logger                 *slog.Logger
 }
@@ -0,0 +1,72 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// AssignRole is the resolver for the assignRole field.
+func (r *mutationResolver) AssignRole(ctx context.Context, input gqlmodel.RoleAssignmentInput) (bool, error) {
+	if err := r.RolesService.Assign(ctx, input.UserID, input.Role); err != nil {
+		if errors.Is(err, services.ErrRoleNotFound) || errors.Is(err, repositories.ErrUserNotFound) {
+			return false, err
+		}
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// RevokeRole is the resolver for the revokeRole field.
+func (r *mutationResolver) RevokeRole(ctx context.Context, input gqlmodel.RoleAssignmentInput) (bool, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if user.ID == input.UserID && input.Role == entities.RoleAdmin {
+		return false, errors.New("you cannot revoke your own admin role")
+	}
+	if err := r.RolesService.Revoke(ctx, input.UserID, input.Role); err != nil {
+		r.Logger.Error("failed to revoke role", "error", err)
+		return false, errors.New("internal error")
+	}
+	return true, nil
+}
+
+// MyPermissions is the resolver for the myPermissions field.
+func (r *queryResolver) MyPermissions(ctx context.Context) ([]string, error) {
+	permissions := make([]string, 0)
+	for permission := range contextvalues.GetPermissions(ctx) {
+		permissions = append(permissions, string(permission))
+	}
+	slices.Sort(permissions)
+	return permissions, nil
+}
+
+// Roles is the resolver for the roles field.
+func (r *queryResolver) Roles(ctx context.Context) ([]gqlmodel.Role, error) {
+	roles, err := r.RolesService.GetAll(ctx)
+	if err != nil {
+		r.Logger.Error("failed to get roles", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toRolesPayload(roles), nil
+}
+
+// UserRoles is the resolver for the userRoles field.
+func (r *queryResolver) UserRoles(ctx context.Context, userID uuid.UUID) ([]gqlmodel.Role, error) {
+	roles, err := r.RolesService.GetByUserID(ctx, userID)
+	if err != nil {
+		r.Logger.Error("failed to get user roles", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toRolesPayload(roles), nil
+}
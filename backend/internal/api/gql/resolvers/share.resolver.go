@@ -0,0 +1,96 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/google/uuid"
+)
+
+// CreateShareLink is the resolver for the createShareLink field.
+func (r *mutationResolver) CreateShareLink(ctx context.Context, input gqlmodel.CreateShareLinkInput) (*gqlmodel.ShareLink, error) {
+	book, err := r.BooksService.GetByID(ctx, input.BookID)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBookOwnerOrAdmin(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	link, err := r.ShareLinksService.Create(ctx, book.ID, user.ID, services.CreateShareLinkInput{
+		Password:     valueOr(input.Password.Value(), ""),
+		ExpiresAt:    input.ExpiresAt.Value(),
+		MaxDownloads: input.MaxDownloads.Value(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.shareLinkPayload(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// RevokeShareLink is the resolver for the revokeShareLink field.
+func (r *mutationResolver) RevokeShareLink(ctx context.Context, id uuid.UUID) (bool, error) {
+	link, err := r.ownShareLink(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.ShareLinksService.Revoke(ctx, link.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ShareLinks is the resolver for the shareLinks field.
+func (r *queryResolver) ShareLinks(ctx context.Context, bookID uuid.UUID) ([]gqlmodel.ShareLink, error) {
+	book, err := r.BooksService.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBookOwnerOrAdmin(ctx, book) {
+		return nil, errors.New("access denied")
+	}
+	links, err := r.ShareLinksService.GetByBookID(ctx, book.ID)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.ShareLink, len(links))
+	for i, link := range links {
+		if payload[i], err = r.shareLinkPayload(ctx, link); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// ShareLinkAccesses is the resolver for the shareLinkAccesses field.
+func (r *queryResolver) ShareLinkAccesses(ctx context.Context, linkID uuid.UUID, limit *uint64, offset *uint64) ([]gqlmodel.ShareLinkAccess, error) {
+	link, err := r.ownShareLink(ctx, linkID)
+	if err != nil {
+		return nil, err
+	}
+	accesses, err := r.ShareLinksService.GetAccesses(ctx, link.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.ShareLinkAccess, len(accesses))
+	for i, access := range accesses {
+		payload[i] = gqlmodel.ShareLinkAccess{
+			IP:        access.IP,
+			UserAgent: access.UserAgent,
+			Outcome:   string(access.Outcome),
+			CreatedAt: access.CreatedAt,
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,42 @@
+package resolvers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.70
+
+import (
+	"context"
+
+	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+)
+
+// RestoreBook is the resolver for the restoreBook field.
+func (r *mutationResolver) RestoreBook(ctx context.Context, input gqlmodel.BookInput) (*gqlmodel.BookPayload, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	book, err := r.TrashService.Restore(ctx, user.ID, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return r.bookPayload(ctx, book)
+}
+
+// EmptyTrash is the resolver for the emptyTrash field.
+func (r *mutationResolver) EmptyTrash(ctx context.Context) (int, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	return r.TrashService.Empty(ctx, user.ID)
+}
+
+// Trash is the resolver for the trash field.
+func (r *queryResolver) Trash(ctx context.Context, limit *uint64, offset *uint64) ([]gqlmodel.BookPayload, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	books, err := r.TrashService.GetMany(ctx, user.ID, valueOr(limit, defaultPageSize), valueOr(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]gqlmodel.BookPayload, len(books))
+	for i, book := range books {
+		payload[i] = toBookPayload(book, "")
+	}
+	return payload, nil
+}
@@ -6,11 +6,41 @@ package resolvers
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Shelffy/shelffy/internal/api/gql/gqlmodel"
+	"github.com/Shelffy/shelffy/internal/api/gql/graph"
 	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/services"
 )
 
+// ScheduleAccountDeletion is the resolver for the scheduleAccountDeletion field.
+func (r *mutationResolver) ScheduleAccountDeletion(ctx context.Context, password string) (*gqlmodel.User, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	updated, err := r.AccountDeletionService.Schedule(ctx, user.ID, password, contextvalues.GetSessionIDOrPanic(ctx))
+	if errors.Is(err, services.ErrPasswordsNotMatch) || errors.Is(err, services.ErrDeletionAlreadyScheduled) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error("failed to schedule account deletion", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(updated), nil
+}
+
+// CancelAccountDeletion is the resolver for the cancelAccountDeletion field.
+func (r *mutationResolver) CancelAccountDeletion(ctx context.Context) (*gqlmodel.User, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	updated, err := r.AccountDeletionService.Cancel(ctx, user.ID)
+	if errors.Is(err, services.ErrDeletionNotScheduled) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error("failed to cancel account deletion", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toUserPayload(updated), nil
+}
+
 // Me is the resolver for the me field.
 func (r *queryResolver) Me(ctx context.Context) (*gqlmodel.User, error) {
 	user := contextvalues.GetUserOrPanic(ctx)
@@ -18,24 +48,38 @@ func (r *queryResolver) Me(ctx context.Context) (*gqlmodel.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &gqlmodel.User{
-		ID:        dbUser.ID,
-		Email:     dbUser.Email,
-		IsActive:  dbUser.IsActive,
-		CreatedAt: dbUser.CreatedAt,
-	}, nil
+	return toUserPayload(dbUser), nil
 }
 
 // User is the resolver for the user field.
 func (r *queryResolver) User(ctx context.Context, input gqlmodel.UserInput) (*gqlmodel.User, error) {
+	user := contextvalues.GetUserOrPanic(ctx)
+	if user.ID != input.UserID && !contextvalues.HasPermission(ctx, entities.PermissionUsersManage) {
+		return nil, errors.New("access denied")
+	}
 	dbUser, err := r.UsersService.GetByID(ctx, input.UserID)
 	if err != nil {
 		return nil, err
 	}
-	return &gqlmodel.User{
-		ID:        dbUser.ID,
-		Email:     dbUser.Email,
-		IsActive:  dbUser.IsActive,
-		CreatedAt: dbUser.CreatedAt,
-	}, nil
+	return toUserPayload(dbUser), nil
 }
+
+// StorageUsage is the resolver for the storageUsage field.
+func (r *userResolver) StorageUsage(ctx context.Context, obj *gqlmodel.User) (*gqlmodel.StorageUsage, error) {
+	// the field can be requested from the login payload, before the user is put into the context
+	user := contextvalues.GetUser(ctx)
+	if user.ID != obj.ID && !contextvalues.HasPermission(ctx, entities.PermissionUsersManage) {
+		return nil, errors.New("access denied")
+	}
+	usage, err := r.QuotasService.Usage(ctx, obj.ID)
+	if err != nil {
+		r.Logger.Error("failed to get storage usage", "error", err)
+		return nil, errors.New("internal error")
+	}
+	return toStorageUsagePayload(usage), nil
+}
+
+// User returns graph.UserResolver implementation.
+func (r *Resolver) User() graph.UserResolver { return &userResolver{r} }
+
+type userResolver struct{ *Resolver }
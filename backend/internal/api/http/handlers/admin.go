@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/Shelffy/shelffy/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const defaultPageSize = 50
+
+type AdminHandler struct {
+	userAdmin      services.UserAdmin
+	passwordResets services.PasswordResets
+	quotas         services.Quotas
+	logger         *slog.Logger
+}
+
+func NewAdminHandler(
+	userAdmin services.UserAdmin,
+	passwordResets services.PasswordResets,
+	quotas services.Quotas,
+	logger *slog.Logger,
+) AdminHandler {
+	return AdminHandler{
+		userAdmin:      userAdmin,
+		passwordResets: passwordResets,
+		quotas:         quotas,
+		logger:         logger,
+	}
+}
+
+type UserOverviewResponse struct {
+	UserResponse
+	Username       string `json:"username"`
+	IsAdmin        bool   `json:"is_admin"`
+	ApprovalStatus string `json:"approval_status"`
+	LastLoginAt    string `json:"last_login_at,omitempty"`
+	BooksCount     int    `json:"books_count"`
+}
+
+func toUserOverviewResponse(user entities.UserOverview) UserOverviewResponse {
+	resp := UserOverviewResponse{
+		UserResponse:   toUserResponse(user.User),
+		Username:       user.Username,
+		IsAdmin:        user.IsAdmin,
+		ApprovalStatus: string(user.ApprovalStatus),
+		BooksCount:     user.BooksCount,
+	}
+	if user.LastLoginAt != nil {
+		resp.LastLoginAt = user.LastLoginAt.String()
+	}
+	return resp
+}
+
+type StorageUsageResponse struct {
+	Used      int64 `json:"used"`
+	Limit     int64 `json:"limit"`
+	BookCount int   `json:"book_count"`
+}
+
+func toStorageUsageResponse(usage entities.StorageUsage) StorageUsageResponse {
+	return StorageUsageResponse{
+		Used:      usage.Used,
+		Limit:     usage.Limit,
+		BookCount: usage.BookCount,
+	}
+}
+
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func parseUint(value string, fallback uint64) (uint64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// userIDParam parses the user id URL parameter and writes an error response if it is invalid.
+func (h AdminHandler) userIDParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		err = errorResponse("invalid user id", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (h AdminHandler) writeError(err error, action string, w http.ResponseWriter) {
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		err = errorResponse(err.Error(), http.StatusNotFound, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	h.logger.Error("failed to "+action, "error", err)
+	err = errorResponse("something went wrong", http.StatusInternalServerError, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := entities.UsersFilter{Search: query.Get("search")}
+	isActive, activeErr := parseOptionalBool(query.Get("active"))
+	isAdmin, adminErr := parseOptionalBool(query.Get("admin"))
+	limit, limitErr := parseUint(query.Get("limit"), defaultPageSize)
+	offset, offsetErr := parseUint(query.Get("offset"), 0)
+	if err := errors.Join(activeErr, adminErr, limitErr, offsetErr); err != nil {
+		err = errorResponse("invalid query parameters", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	filter.IsActive = isActive
+	filter.IsAdmin = isAdmin
+	users, err := h.userAdmin.GetMany(r.Context(), filter, limit, offset)
+	if err != nil {
+		h.writeError(err, "list users", w)
+		return
+	}
+	payload := make([]UserOverviewResponse, len(users))
+	for i, user := range users {
+		payload[i] = toUserOverviewResponse(user)
+	}
+	err = response(R{"users": payload}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.userAdmin.GetOverview(r.Context(), userID)
+	if err != nil {
+		h.writeError(err, "get user", w)
+		return
+	}
+	err = response(R{"user": toUserOverviewResponse(user)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) setActive(w http.ResponseWriter, r *http.Request, active bool) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if !active && userID == contextvalues.GetUserOrPanic(r.Context()).ID {
+		err := errorResponse("you cannot deactivate your own account", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user, err := h.userAdmin.SetActive(r.Context(), userID, active)
+	if err != nil {
+		h.writeError(err, "set user active", w)
+		return
+	}
+	err = response(R{"user": toUserResponse(user)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	h.setActive(w, r, true)
+}
+
+func (h AdminHandler) Deactivate(w http.ResponseWriter, r *http.Request) {
+	h.setActive(w, r, false)
+}
+
+func (h AdminHandler) setAdmin(w http.ResponseWriter, r *http.Request, admin bool) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if !admin && userID == contextvalues.GetUserOrPanic(r.Context()).ID {
+		err := errorResponse("you cannot revoke your own admin role", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user, err := h.userAdmin.SetAdmin(r.Context(), userID, admin)
+	if err != nil {
+		h.writeError(err, "set user admin", w)
+		return
+	}
+	err = response(R{"user": toUserResponse(user)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) Promote(w http.ResponseWriter, r *http.Request) {
+	h.setAdmin(w, r, true)
+}
+
+func (h AdminHandler) Demote(w http.ResponseWriter, r *http.Request) {
+	h.setAdmin(w, r, false)
+}
+
+func (h AdminHandler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := h.passwordResets.Force(r.Context(), userID); err != nil {
+		h.writeError(err, "force password reset", w)
+		return
+	}
+	err := successResponse("password reset requested", http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if userID == contextvalues.GetUserOrPanic(r.Context()).ID {
+		err := errorResponse("you cannot delete your own account", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	if err := h.userAdmin.Delete(r.Context(), userID); err != nil {
+		h.writeError(err, "delete user", w)
+		return
+	}
+	err := successResponse("user deleted", http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+type SetQuotaRequest struct {
+	// Quota is in bytes, null restores the default quota.
+	Quota *int64 `json:"quota"`
+}
+
+func (h AdminHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+	quotaData, err := getRequestData[SetQuotaRequest](r)
+	if err != nil || (quotaData.Quota != nil && *quotaData.Quota < 0) {
+		err = errorResponse("invalid data provided", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	if err := h.quotas.SetQuota(r.Context(), userID, quotaData.Quota); err != nil {
+		h.writeError(err, "set storage quota", w)
+		return
+	}
+	usage, err := h.quotas.Usage(r.Context(), userID)
+	if err != nil {
+		h.writeError(err, "get storage usage", w)
+		return
+	}
+	err = response(R{"storage_usage": toStorageUsageResponse(usage)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
@@ -4,32 +4,46 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/Shelffy/shelffy/internal/api"
+	"github.com/Shelffy/shelffy/internal/config"
 	"github.com/Shelffy/shelffy/internal/context_values"
-	"github.com/Shelffy/shelffy/internal/entities"
-	"github.com/Shelffy/shelffy/internal/repositories"
 	services2 "github.com/Shelffy/shelffy/internal/services"
-	"github.com/google/uuid"
 )
 
 type AuthHandler struct {
-	authService services2.Auth
-	userService services2.Users
-	logger      *slog.Logger
+	authService  services2.Auth
+	userService  services2.Users
+	throttler    services2.LoginThrottler
+	registration services2.Registration
+	resets       services2.PasswordResets
+	logger       *slog.Logger
 }
 
-func NewAuthHandler(authService services2.Auth, userService services2.Users, logger *slog.Logger) AuthHandler {
+func NewAuthHandler(
+	authService services2.Auth,
+	userService services2.Users,
+	throttler services2.LoginThrottler,
+	registration services2.Registration,
+	resets services2.PasswordResets,
+	logger *slog.Logger,
+) AuthHandler {
 	return AuthHandler{
-		authService: authService,
-		userService: userService,
-		logger:      logger,
+		authService:  authService,
+		userService:  userService,
+		throttler:    throttler,
+		registration: registration,
+		resets:       resets,
+		logger:       logger,
 	}
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	InviteCode string `json:"invite_code,omitempty"`
 }
 
 func (h AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -40,30 +54,26 @@ func (h AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		logResponseWriteError(err, h.logger)
 		return
 	}
-	_, err = h.userService.GetByEmail(r.Context(), registerData.Email)
-	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
-		h.logger.Error("failed to get user", "error", err)
-		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
-		logResponseWriteError(err, h.logger)
-		return
-	} else if err == nil {
-		err = errorResponse("user with this email already exists", http.StatusBadRequest, w)
-		logResponseWriteError(err, h.logger)
-		return
-	}
-	_, err = h.userService.Create(r.Context(), entities.User{
-		ID:       uuid.New(),
-		Email:    registerData.Email,
-		Password: registerData.Password,
-		IsActive: true,
+	_, err = h.registration.Register(r.Context(), services2.RegisterInput{
+		Email:      registerData.Email,
+		Username:   registerData.Username,
+		Password:   registerData.Password,
+		InviteCode: registerData.InviteCode,
 	})
-	if err != nil {
+	switch {
+	case err == nil, errors.Is(err, services2.ErrEmailTaken):
+		// the response must not reveal whether the email is already registered
+		message := "user created"
+		if h.registration.Mode() == config.RegistrationModeApproval {
+			message = "user created, waiting for approval"
+		}
+		err = successResponse(message, http.StatusCreated, w)
+	case errors.Is(err, services2.ErrInviteRequired), errors.Is(err, services2.ErrInvalidInvite):
+		err = errorResponse(err.Error(), http.StatusForbidden, w)
+	default:
 		h.logger.Error("failed to create user", "error", err)
 		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
-		logResponseWriteError(err, h.logger)
-		return
 	}
-	err = successResponse("user created", http.StatusCreated, w)
 	logResponseWriteError(err, h.logger)
 }
 
@@ -80,7 +90,20 @@ func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		logResponseWriteError(err, h.logger)
 		return
 	}
-	dbUser, session, err := h.authService.Login(r.Context(), loginData.Email, loginData.Password)
+	client := contextvalues.GetClientInfo(r.Context())
+	dbUser, session, err := h.authService.Login(r.Context(), loginData.Email, loginData.Password, client)
+	var throttled services2.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+		err = errorResponse(throttled.Cause.Error(), http.StatusTooManyRequests, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	if errors.Is(err, services2.ErrAccountInactive) {
+		err = errorResponse(err.Error(), http.StatusForbidden, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
 	if err != nil && !errors.Is(err, services2.ErrInvalidCredentials) {
 		h.logger.Error("failed to create session", "error", err)
 		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
@@ -128,3 +151,52 @@ func (h AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	err := response(nil, http.StatusOK, w)
 	logResponseWriteError(err, h.logger)
 }
+
+func (h AuthHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		err := errorResponse("token is required", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	if err := h.throttler.UnlockByToken(r.Context(), token); err != nil {
+		if errors.Is(err, services2.ErrInvalidToken) {
+			err = errorResponse(err.Error(), http.StatusBadRequest, w)
+			logResponseWriteError(err, h.logger)
+			return
+		}
+		h.logger.Error("failed to unlock account", "error", err)
+		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	err := successResponse("account unlocked", http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	resetData, err := getRequestData[ResetPasswordRequest](r)
+	if err != nil || resetData.Token == "" || resetData.Password == "" {
+		err = errorResponse("invalid data provided", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	if err := h.resets.Reset(r.Context(), resetData.Token, resetData.Password); err != nil {
+		if errors.Is(err, services2.ErrInvalidResetToken) {
+			err = errorResponse(err.Error(), http.StatusBadRequest, w)
+			logResponseWriteError(err, h.logger)
+			return
+		}
+		h.logger.Error("failed to reset password", "error", err)
+		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	err = successResponse("password changed", http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
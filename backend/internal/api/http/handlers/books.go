@@ -1,36 +1,418 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/Shelffy/shelffy/internal/context_values"
 	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
 	services2 "github.com/Shelffy/shelffy/internal/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 type BooksHandler struct {
-	books   services2.Books
-	storage services2.FileStorage
-	logger  *slog.Logger
+	books       services2.Books
+	storage     services2.FileStorage
+	metadata    services2.BookMetadata
+	conversions services2.BookConversions
+	reader      services2.BookReader
+	comics      services2.Comics
+	audiobooks  services2.Audiobooks
+	progress    services2.BookProgress
+	shares      services2.ShareLinks
+	households  services2.Households
+	logger      *slog.Logger
 }
 
-func NewBooksHandler(booksService services2.Books, storage services2.FileStorage, logger *slog.Logger) BooksHandler {
+func NewBooksHandler(
+	booksService services2.Books,
+	storage services2.FileStorage,
+	metadata services2.BookMetadata,
+	conversions services2.BookConversions,
+	reader services2.BookReader,
+	comics services2.Comics,
+	audiobooks services2.Audiobooks,
+	progress services2.BookProgress,
+	shares services2.ShareLinks,
+	households services2.Households,
+	logger *slog.Logger,
+) BooksHandler {
 	return BooksHandler{
-		books:   booksService,
-		storage: storage,
-		logger:  logger,
+		books:       booksService,
+		storage:     storage,
+		metadata:    metadata,
+		conversions: conversions,
+		reader:      reader,
+		comics:      comics,
+		audiobooks:  audiobooks,
+		progress:    progress,
+		shares:      shares,
+		households:  households,
+		logger:      logger,
+	}
+}
+
+// optional tells an omitted JSON field from one that is set, possibly to null.
+type optional[T any] services2.Optional[T]
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+type UpdateBookRequest struct {
+	Version       int                         `json:"version"`
+	Title         optional[string]            `json:"title"`
+	Authors       optional[[]string]          `json:"authors"`
+	Description   optional[string]            `json:"description"`
+	Language      optional[string]            `json:"language"`
+	Publisher     optional[string]            `json:"publisher"`
+	PublishedDate optional[*time.Time]        `json:"published_date"`
+	ISBN          optional[string]            `json:"isbn"`
+	Series        optional[string]            `json:"series"`
+	SeriesIndex   optional[*float64]          `json:"series_index"`
+	Tags          optional[[]string]          `json:"tags"`
+	Identifiers   optional[map[string]string] `json:"identifiers"`
+	Rating        optional[*int]              `json:"rating"`
+}
+
+type BookFileResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Format    string    `json:"format"`
+	MIMEType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	Hash      string    `json:"hash"`
+	Status    string    `json:"status"`
+	Primary   bool      `json:"primary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toBookFileResponse(file entities.BookFile, primary bool) BookFileResponse {
+	return BookFileResponse{
+		ID:        file.ID,
+		Format:    string(file.Format),
+		MIMEType:  file.MIMEType,
+		Size:      file.Size,
+		Hash:      hex.EncodeToString(file.Hash[:]),
+		Status:    string(file.Status),
+		Primary:   primary,
+		CreatedAt: file.CreatedAt,
+	}
+}
+
+const (
+	// readerCacheControl lets browsers keep the resources of the web reader, they are revalidated with the ETag
+	// of the EPUB file once they expire.
+	readerCacheControl = "private, max-age=86400"
+	// readerContentSecurityPolicy blocks the scripts the sanitizer missed, e.g. in SVG images opened directly.
+	readerContentSecurityPolicy = "script-src 'none'; object-src 'none'; frame-src 'none'"
+)
+
+// conversionRetryAfter is the number of seconds clients wait before downloading a pending conversion again.
+const conversionRetryAfter = 10
+
+type ConversionResponse struct {
+	Format    string    `json:"format"`
+	Status    string    `json:"status"`
+	Size      int64     `json:"size"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toConversionResponse(conversion entities.BookConversion) ConversionResponse {
+	return ConversionResponse{
+		Format:    string(conversion.Format),
+		Status:    string(conversion.Status),
+		Size:      conversion.Size,
+		Error:     conversion.Error,
+		CreatedAt: conversion.CreatedAt,
+		UpdatedAt: conversion.UpdatedAt,
+	}
+}
+
+// AudioTrackResponse and the other audiobook responses give durations and positions in seconds.
+type AudioTrackResponse struct {
+	Number   int     `json:"number"`
+	Title    string  `json:"title"`
+	Duration float64 `json:"duration"`
+}
+
+type AudiobookChapterResponse struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	Track int     `json:"track"`
+}
+
+type BookProgressResponse struct {
+	Percentage float64   `json:"percentage"`
+	Locator    string    `json:"locator"`
+	Position   float64   `json:"position"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func toBookProgressResponse(progress entities.BookProgress) BookProgressResponse {
+	return BookProgressResponse{
+		Percentage: progress.Percentage,
+		Locator:    progress.Locator,
+		Position:   progress.Position.Seconds(),
+		UpdatedAt:  progress.UpdatedAt,
+	}
+}
+
+// SaveBookProgressRequest positions text books by Locator and audiobooks by Position, in seconds.
+type SaveBookProgressRequest struct {
+	Percentage float64 `json:"percentage"`
+	Locator    string  `json:"locator"`
+	Position   float64 `json:"position"`
+}
+
+type RevertBookRequest struct {
+	ExpectedVersion int `json:"expected_version"`
+}
+
+type BookMetadataResponse struct {
+	Authors       []string          `json:"authors"`
+	Description   string            `json:"description"`
+	Language      string            `json:"language"`
+	Publisher     string            `json:"publisher"`
+	PublishedDate *time.Time        `json:"published_date,omitempty"`
+	ISBN          string            `json:"isbn"`
+	Series        string            `json:"series"`
+	SeriesIndex   *float64          `json:"series_index,omitempty"`
+	Tags          []string          `json:"tags"`
+	Identifiers   map[string]string `json:"identifiers"`
+	Rating        *int              `json:"rating,omitempty"`
+}
+
+type BookResponse struct {
+	ID         string               `json:"id"`
+	Title      string               `json:"title"`
+	UploadedBy string               `json:"uploaded_by"`
+	UploadedAt time.Time            `json:"uploaded_at"`
+	Format     string               `json:"format"`
+	Status     string               `json:"status"`
+	Size       int64                `json:"size"`
+	Metadata   BookMetadataResponse `json:"metadata"`
+	Version    int                  `json:"version"`
+}
+
+type BookVersionResponse struct {
+	Version       int                  `json:"version"`
+	Title         string               `json:"title"`
+	Metadata      BookMetadataResponse `json:"metadata"`
+	ChangedFields []string             `json:"changed_fields"`
+	ChangedBy     *uuid.UUID           `json:"changed_by"`
+	ChangedAt     time.Time            `json:"changed_at"`
+}
+
+func toBookMetadataResponse(metadata entities.BookMetadata) BookMetadataResponse {
+	return BookMetadataResponse{
+		Authors:       metadata.Authors,
+		Description:   metadata.Description,
+		Language:      metadata.Language,
+		Publisher:     metadata.Publisher,
+		PublishedDate: metadata.PublishedDate,
+		ISBN:          metadata.ISBN,
+		Series:        metadata.Series,
+		SeriesIndex:   metadata.SeriesIndex,
+		Tags:          metadata.Tags,
+		Identifiers:   metadata.Identifiers,
+		Rating:        metadata.Rating,
+	}
+}
+
+func toBookResponse(book entities.Book) BookResponse {
+	return BookResponse{
+		ID:         book.ID.String(),
+		Title:      book.Title,
+		UploadedBy: book.UploadedBy.String(),
+		UploadedAt: book.UploadedAt,
+		Format:     string(book.Format),
+		Status:     string(book.Status),
+		Size:       book.Size,
+		Metadata:   toBookMetadataResponse(book.Metadata),
+		Version:    book.Version,
 	}
 }
 
 func (h BooksHandler) IsOwnerOrAdmin(ctx context.Context, book entities.Book) bool {
 	user := contextvalues.GetUserOrPanic(ctx)
-	return user.IsAdmin || book.UploadedBy == user.ID
+	return book.UploadedBy == user.ID || contextvalues.HasPermission(ctx, entities.PermissionBooksReadAny)
+}
+
+// canRead also lets members of the households the book is shared with read it.
+func (h BooksHandler) canRead(ctx context.Context, book entities.Book) bool {
+	if h.IsOwnerOrAdmin(ctx, book) {
+		return true
+	}
+	user := contextvalues.GetUserOrPanic(ctx)
+	ok, err := h.households.CanRead(ctx, user.ID, book)
+	return err == nil && ok
+}
+
+func (h BooksHandler) canEdit(ctx context.Context, book entities.Book) bool {
+	user := contextvalues.GetUserOrPanic(ctx)
+	return book.UploadedBy == user.ID || contextvalues.HasPermission(ctx, entities.PermissionBooksEditAny)
+}
+
+// bookParam loads the book from the id URL parameter and checks access to it.
+// It writes an error response and returns false if the book cannot be used.
+func (h BooksHandler) bookParam(w http.ResponseWriter, r *http.Request, allowed func(context.Context, entities.Book) bool) (entities.Book, bool) {
+	bookID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		err = errorResponse("invalid book id", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return entities.Book{}, false
+	}
+	book, err := h.books.GetByID(r.Context(), bookID)
+	if err != nil {
+		h.writeError(err, w)
+		return entities.Book{}, false
+	}
+	if !allowed(r.Context(), book) {
+		err = errorResponse("access denied", http.StatusForbidden, w)
+		logResponseWriteError(err, h.logger)
+		return entities.Book{}, false
+	}
+	return book, true
+}
+
+func (h BooksHandler) writeError(err error, w http.ResponseWriter) {
+	switch {
+	case errors.Is(err, services2.ErrBookNotFound), errors.Is(err, services2.ErrBookVersionNotFound),
+		errors.Is(err, services2.ErrBookFileNotFound), errors.Is(err, services2.ErrReaderResourceNotFound),
+		errors.Is(err, services2.ErrComicPageNotFound), errors.Is(err, services2.ErrAudioTrackNotFound),
+		errors.Is(err, services2.ErrBookProgressNotFound), errors.Is(err, services2.ErrShareLinkNotFound):
+		err = errorResponse(err.Error(), http.StatusNotFound, w)
+	case errors.Is(err, services2.ErrShareLinkUnavailable):
+		err = errorResponse(err.Error(), http.StatusGone, w)
+	case errors.Is(err, services2.ErrSharePasswordRequired), errors.Is(err, services2.ErrInvalidSharePassword):
+		err = errorResponse(err.Error(), http.StatusUnauthorized, w)
+	case errors.Is(err, services2.ErrTooManySharePasswordAttempts):
+		err = errorResponse(err.Error(), http.StatusTooManyRequests, w)
+	case errors.Is(err, services2.ErrBookVersionConflict), errors.Is(err, services2.ErrBookPendingScan):
+		err = errorResponse(err.Error(), http.StatusConflict, w)
+	case errors.Is(err, services2.ErrEmptyTitle), errors.Is(err, services2.ErrInvalidISBN),
+		errors.Is(err, services2.ErrInvalidRating), errors.Is(err, services2.ErrConversionNotSupported),
+		errors.Is(err, services2.ErrInvalidPageWidth), errors.Is(err, services2.ErrInvalidPercentage),
+		errors.Is(err, services2.ErrInvalidPosition), errors.Is(err, services2.ErrInvalidLocator):
+		err = errorResponse(err.Error(), http.StatusBadRequest, w)
+	case errors.Is(err, services2.ErrBookNotReadable), errors.Is(err, services2.ErrNotComic),
+		errors.Is(err, services2.ErrNotAudiobook),
+		errors.Is(err, formats.ErrCorruptFile):
+		err = errorResponse(err.Error(), http.StatusUnprocessableEntity, w)
+	default:
+		err = errorResponse("internal error", http.StatusInternalServerError, w)
+	}
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) Update(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canEdit)
+	if !ok {
+		return
+	}
+	req, err := getRequestData[UpdateBookRequest](r)
+	if err != nil {
+		err = errorResponse("invalid request body", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	book, err = h.metadata.Update(r.Context(), book.ID, user.ID, req.Version, services2.BookMetadataPatch{
+		Title:         services2.Optional[string](req.Title),
+		Authors:       services2.Optional[[]string](req.Authors),
+		Description:   services2.Optional[string](req.Description),
+		Language:      services2.Optional[string](req.Language),
+		Publisher:     services2.Optional[string](req.Publisher),
+		PublishedDate: services2.Optional[*time.Time](req.PublishedDate),
+		ISBN:          services2.Optional[string](req.ISBN),
+		Series:        services2.Optional[string](req.Series),
+		SeriesIndex:   services2.Optional[*float64](req.SeriesIndex),
+		Tags:          services2.Optional[[]string](req.Tags),
+		Identifiers:   services2.Optional[map[string]string](req.Identifiers),
+		Rating:        services2.Optional[*int](req.Rating),
+	})
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"book": toBookResponse(book)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) History(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.IsOwnerOrAdmin)
+	if !ok {
+		return
+	}
+	limit, limitErr := parseUint(r.URL.Query().Get("limit"), defaultPageSize)
+	offset, offsetErr := parseUint(r.URL.Query().Get("offset"), 0)
+	if err := errors.Join(limitErr, offsetErr); err != nil {
+		err = errorResponse("invalid query parameters", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	versions, err := h.metadata.History(r.Context(), book.ID, limit, offset)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	payload := make([]BookVersionResponse, len(versions))
+	for i, version := range versions {
+		payload[i] = BookVersionResponse{
+			Version:       version.Version,
+			Title:         version.Title,
+			Metadata:      toBookMetadataResponse(version.Metadata),
+			ChangedFields: version.ChangedFields,
+			ChangedBy:     version.ChangedBy,
+			ChangedAt:     version.ChangedAt,
+		}
+	}
+	err = response(R{"versions": payload}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canEdit)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		err = errorResponse("invalid version", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	req, err := getRequestData[RevertBookRequest](r)
+	if err != nil {
+		err = errorResponse("invalid request body", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	book, err = h.metadata.Revert(r.Context(), book.ID, user.ID, version, req.ExpectedVersion)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"book": toBookResponse(book)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
 }
 
 func (h BooksHandler) GetContentByID(w http.ResponseWriter, r *http.Request) {
@@ -54,14 +436,70 @@ func (h BooksHandler) GetContentByID(w http.ResponseWriter, r *http.Request) {
 		logResponseWriteError(err, h.logger)
 		return
 	}
-	if !h.IsOwnerOrAdmin(r.Context(), book) {
+	if !h.canRead(r.Context(), book) {
 		err = errorResponse("access denied", http.StatusForbidden, w)
 		logResponseWriteError(err, h.logger)
 		return
 	}
-	contentStream, err := h.storage.Get(r.Context(), book.StoragePath)
+	// household members get the formats the book already has, only the owner or an administrator converts it
+	h.sendContent(w, r, book, h.IsOwnerOrAdmin(r.Context(), book), nil)
+}
+
+// sharePasswordHeader carries the password of a share link, browsers can post it as the password form field instead.
+const sharePasswordHeader = "X-Share-Password"
+
+// GetSharedContent serves the book of a share link. It is authorised by the token of the link instead of a session,
+// a download is counted only when the content is sent. Holders of a link get the formats the book has files for,
+// they cannot start conversions.
+func (h BooksHandler) GetSharedContent(w http.ResponseWriter, r *http.Request) {
+	password := r.Header.Get(sharePasswordHeader)
+	if password == "" && r.Method == http.MethodPost {
+		password = r.PostFormValue("password")
+	}
+	client := contextvalues.GetClientInfo(r.Context())
+	link, err := h.shares.Open(r.Context(), chi.URLParam(r, "token"), password, client)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	book, err := h.books.GetByID(r.Context(), link.BookID)
 	if err != nil {
-		h.logger.Error("failed to get book from storage", "error", err, "path", book.StoragePath)
+		h.writeError(err, w)
+		return
+	}
+	h.sendContent(w, r, book, false, func() bool {
+		if _, err := h.shares.Download(r.Context(), link, client); err != nil {
+			h.writeError(err, w)
+			return false
+		}
+		return true
+	})
+}
+
+// sendContent streams the book in the format of the format query parameter, the format of the book by default.
+// Formats the book has no file for are converted only if convert is set.
+// beforeSend is called once the content is available and stops the download when it returns false,
+// it is expected to write the response then.
+func (h BooksHandler) sendContent(w http.ResponseWriter, r *http.Request, book entities.Book, convert bool, beforeSend func() bool) {
+	if book.Status != entities.BookStatusReady {
+		err := errorResponse(services2.ErrBookPendingScan.Error(), http.StatusConflict, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	format := book.Format
+	if requested := r.URL.Query().Get("format"); requested != "" {
+		format = entities.BookFormat(requested)
+	}
+	storagePath, ok := h.contentPath(w, r, book, format, convert)
+	if !ok {
+		return
+	}
+	if beforeSend != nil && !beforeSend() {
+		return
+	}
+	contentStream, err := h.storage.Get(r.Context(), storagePath)
+	if err != nil {
+		h.logger.Error("failed to get book from storage", "error", err, "path", storagePath)
 		if errors.Is(err, services2.ErrObjectNotFound) {
 			err = errorResponse(err.Error()+"(book content)", http.StatusNotFound, w)
 			logResponseWriteError(err, h.logger)
@@ -71,8 +509,10 @@ func (h BooksHandler) GetContentByID(w http.ResponseWriter, r *http.Request) {
 		logResponseWriteError(err, h.logger)
 		return
 	}
-	w.Header().Set("Content-Disposition", "attachment; filename="+book.Title)
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": book.Title + formats.Extension(format),
+	}))
+	w.Header().Set("Content-Type", formats.MIMEType(format))
 	if _, err = io.Copy(w, contentStream); err != nil {
 		h.logger.Error("failed to write book content to the http writer", "error", err)
 		err = errorResponse("internal error", http.StatusInternalServerError, w)
@@ -81,3 +521,287 @@ func (h BooksHandler) GetContentByID(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// contentPath returns the storage path of the book in the format, which is either one of its files or a conversion.
+func (h BooksHandler) contentPath(w http.ResponseWriter, r *http.Request, book entities.Book, format entities.BookFormat, convert bool) (string, bool) {
+	if format == book.Format {
+		return book.StoragePath, true
+	}
+	files, err := h.books.GetFiles(r.Context(), book.ID)
+	if err != nil {
+		h.writeError(err, w)
+		return "", false
+	}
+	i := slices.IndexFunc(files, func(file entities.BookFile) bool { return file.Format == format })
+	if i < 0 && !convert {
+		err = errorResponse("access denied", http.StatusForbidden, w)
+		logResponseWriteError(err, h.logger)
+		return "", false
+	}
+	if i < 0 {
+		conversion, ok := h.conversion(w, r, book, format)
+		return conversion.StoragePath, ok
+	}
+	if files[i].Status != entities.BookStatusReady {
+		h.writeError(services2.ErrBookPendingScan, w)
+		return "", false
+	}
+	return files[i].StoragePath, true
+}
+
+// conversion returns the completed conversion of the book to the format. It requests the conversion
+// and responds with 202 Accepted while it is in progress, clients are expected to retry the download.
+func (h BooksHandler) conversion(w http.ResponseWriter, r *http.Request, book entities.Book, format entities.BookFormat) (entities.BookConversion, bool) {
+	conversion, err := h.conversions.Request(r.Context(), book, format, false)
+	if err != nil {
+		h.writeError(err, w)
+		return entities.BookConversion{}, false
+	}
+	switch conversion.Status {
+	case entities.BookConversionStatusCompleted:
+		return conversion, true
+	case entities.BookConversionStatusFailed:
+		err = errorResponse("conversion failed: "+conversion.Error, http.StatusUnprocessableEntity, w)
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(conversionRetryAfter))
+		err = response(R{"conversion": toConversionResponse(conversion)}, http.StatusAccepted, w)
+	}
+	logResponseWriteError(err, h.logger)
+	return entities.BookConversion{}, false
+}
+
+func (h BooksHandler) GetFiles(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	files, err := h.books.GetFiles(r.Context(), book.ID)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	payload := make([]BookFileResponse, len(files))
+	for i, file := range files {
+		payload[i] = toBookFileResponse(file, i == 0)
+	}
+	err = response(R{"files": payload}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) GetCover(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	if book.CoverPath == "" {
+		err := errorResponse("book has no cover", http.StatusNotFound, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	cover, err := h.storage.Get(r.Context(), book.CoverPath)
+	if err != nil {
+		h.logger.Error("failed to get cover from storage", "error", err, "path", book.CoverPath)
+		err = errorResponse("internal error", http.StatusInternalServerError, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	defer cover.Close()
+	reader := bufio.NewReader(cover)
+	head, _ := reader.Peek(512)
+	w.Header().Set("Content-Type", http.DetectContentType(head))
+	if _, err := io.Copy(w, reader); err != nil {
+		h.logger.Error("failed to write cover to the http writer", "error", err)
+	}
+}
+
+// setReaderHeaders sets the cache headers of the web reader and reports whether the client has the current version.
+func setReaderHeaders(w http.ResponseWriter, r *http.Request, version string) bool {
+	etag := `"` + version + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", readerCacheControl)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// GetReaderPublication returns the manifest, the reading order and the table of contents of the EPUB file
+// of the book. The hrefs are paths inside the archive, resources are served under /{id}/reader/{href}.
+func (h BooksHandler) GetReaderPublication(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	publication, version, err := h.reader.Open(r.Context(), book)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	if setReaderHeaders(w, r, version) {
+		return
+	}
+	err = response(R{"publication": publication}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) GetReaderResource(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	name, err := url.PathUnescape(chi.URLParam(r, "*"))
+	if err != nil {
+		err = errorResponse("invalid resource path", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	resource, err := h.reader.Resource(r.Context(), book, name)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	defer resource.Content.Close()
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", readerContentSecurityPolicy)
+	if setReaderHeaders(w, r, resource.Version) {
+		return
+	}
+	w.Header().Set("Content-Type", resource.MediaType)
+	w.Header().Set("Content-Length", strconv.FormatInt(resource.Size, 10))
+	if _, err := io.Copy(w, resource.Content); err != nil {
+		h.logger.Error("failed to write book resource to the http writer", "error", err)
+	}
+}
+
+// GetPage returns a page of a comic book, numbered from 1. The optional width query parameter scales the page
+// down to at most that many pixels wide.
+func (h BooksHandler) GetPage(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	n, err := parseUint(chi.URLParam(r, "n"), 0)
+	if err != nil || n == 0 {
+		err = errorResponse("invalid page number", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	width, err := parseUint(r.URL.Query().Get("width"), 0)
+	if err != nil || width > services2.MaxComicPageWidth {
+		h.writeError(services2.ErrInvalidPageWidth, w)
+		return
+	}
+	page, err := h.comics.Page(r.Context(), book, int(n), int(width))
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	defer page.Content.Close()
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if setReaderHeaders(w, r, fmt.Sprintf("%s-%d-%d", hex.EncodeToString(book.Hash[:]), n, width)) {
+		return
+	}
+	w.Header().Set("Content-Type", page.ContentType)
+	if page.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(page.Size, 10))
+	}
+	if _, err := io.Copy(w, page.Content); err != nil {
+		h.logger.Error("failed to write comic page to the http writer", "error", err)
+	}
+}
+
+// GetTracks returns the tracks and the chapters of an audiobook. The audio of a track is served under
+// /{id}/tracks/{number}.
+func (h BooksHandler) GetTracks(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	tracks, err := h.audiobooks.Tracks(r.Context(), book)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	trackPayload := make([]AudioTrackResponse, len(tracks))
+	for i, track := range tracks {
+		trackPayload[i] = AudioTrackResponse{Number: track.Number, Title: track.Title, Duration: track.Duration.Seconds()}
+	}
+	chapters := services2.AudiobookChapters(tracks)
+	chapterPayload := make([]AudiobookChapterResponse, len(chapters))
+	for i, chapter := range chapters {
+		chapterPayload[i] = AudiobookChapterResponse{Title: chapter.Title, Start: chapter.Start.Seconds(), Track: chapter.Track}
+	}
+	err = response(R{
+		"duration": services2.AudiobookDuration(tracks).Seconds(),
+		"tracks":   trackPayload,
+		"chapters": chapterPayload,
+	}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+// GetTrack streams the audio of a track. Range requests are served, so players can seek without
+// downloading the track.
+func (h BooksHandler) GetTrack(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		err = errorResponse("invalid track number", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	track, err := h.audiobooks.Track(r.Context(), book, n)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	defer track.Content.Close()
+	w.Header().Set("Content-Type", track.MIMEType)
+	w.Header().Set("ETag", `"`+track.Version+`"`)
+	w.Header().Set("Cache-Control", readerCacheControl)
+	http.ServeContent(w, r, "", time.Time{}, track.Content)
+}
+
+func (h BooksHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	progress, err := h.progress.Get(r.Context(), user.ID, book.ID)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"progress": toBookProgressResponse(progress)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h BooksHandler) SaveProgress(w http.ResponseWriter, r *http.Request) {
+	book, ok := h.bookParam(w, r, h.canRead)
+	if !ok {
+		return
+	}
+	req, err := getRequestData[SaveBookProgressRequest](r)
+	if err != nil {
+		err = errorResponse("invalid request body", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	progress, err := h.progress.Save(r.Context(), book, entities.BookProgress{
+		UserID:     user.ID,
+		Percentage: req.Percentage,
+		Locator:    req.Locator,
+		Position:   time.Duration(req.Position * float64(time.Second)),
+	})
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"progress": toBookProgressResponse(progress)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
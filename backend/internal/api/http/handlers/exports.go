@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	services2 "github.com/Shelffy/shelffy/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ExportsHandler struct {
+	exports services2.LibraryExports
+	logger  *slog.Logger
+}
+
+func NewExportsHandler(exports services2.LibraryExports, logger *slog.Logger) ExportsHandler {
+	return ExportsHandler{
+		exports: exports,
+		logger:  logger,
+	}
+}
+
+type CreateExportRequest struct {
+	// AllUsers exports the libraries of every user instead of the library of the current user.
+	AllUsers bool `json:"all_users"`
+}
+
+type LibraryExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      *uuid.UUID `json:"user_id"`
+	Status      string     `json:"status"`
+	Books       int        `json:"books"`
+	Size        int64      `json:"size"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (h ExportsHandler) toResponse(export entities.LibraryExport) LibraryExportResponse {
+	payload := LibraryExportResponse{
+		ID:         export.ID,
+		UserID:     export.UserID,
+		Status:     string(export.Status),
+		Books:      export.Books,
+		Size:       export.Size,
+		Error:      export.Error,
+		CreatedAt:  export.CreatedAt,
+		FinishedAt: export.FinishedAt,
+		ExpiresAt:  export.ExpiresAt,
+	}
+	if export.Status == entities.LibraryExportStatusCompleted {
+		// the link is left out when links are disabled or it cannot be built, errors are logged by the service
+		if downloadURL, err := h.exports.DownloadURL(export); err == nil {
+			payload.DownloadURL = downloadURL
+		}
+	}
+	return payload
+}
+
+func (h ExportsHandler) writeError(err error, w http.ResponseWriter) {
+	switch {
+	case errors.Is(err, services2.ErrLibraryExportNotFound):
+		err = errorResponse(err.Error(), http.StatusNotFound, w)
+	case errors.Is(err, services2.ErrLibraryExportNotReady):
+		err = errorResponse(err.Error(), http.StatusConflict, w)
+	case errors.Is(err, services2.ErrInvalidDownloadLink):
+		err = errorResponse(err.Error(), http.StatusForbidden, w)
+	case errors.Is(err, services2.ErrExportQueueFull):
+		err = errorResponse(err.Error(), http.StatusServiceUnavailable, w)
+	default:
+		err = errorResponse("internal error", http.StatusInternalServerError, w)
+	}
+	logResponseWriteError(err, h.logger)
+}
+
+func (h ExportsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	request, err := getRequestData[CreateExportRequest](r)
+	// the body is optional
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = errorResponse("invalid request body", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	userID := &user.ID
+	if request.AllUsers {
+		if !contextvalues.HasPermission(r.Context(), entities.PermissionUsersManage) {
+			err := errorResponse("access denied", http.StatusForbidden, w)
+			logResponseWriteError(err, h.logger)
+			return
+		}
+		userID = nil
+	}
+	export, err := h.exports.Queue(r.Context(), user.ID, userID)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"export": h.toResponse(export)}, http.StatusAccepted, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h ExportsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	exportID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		err = errorResponse("invalid export id", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	export, err := h.exports.Get(r.Context(), exportID)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	if export.RequestedBy != user.ID && !contextvalues.HasPermission(r.Context(), entities.PermissionUsersManage) {
+		h.writeError(services2.ErrLibraryExportNotFound, w)
+		return
+	}
+	err = response(R{"export": h.toResponse(export)}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
+
+// Download serves the archive of an export. It is authorised by the signature of the link instead of a session,
+// so the link can be opened by download managers.
+func (h ExportsHandler) Download(w http.ResponseWriter, r *http.Request) {
+	exportID, idErr := uuid.Parse(chi.URLParam(r, "id"))
+	expires, expiresErr := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if errors.Join(idErr, expiresErr) != nil {
+		h.writeError(services2.ErrInvalidDownloadLink, w)
+		return
+	}
+	export, content, err := h.exports.Download(r.Context(), exportID, expires, r.URL.Query().Get("signature"))
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	defer content.Close()
+	// archives take longer to download than the server timeouts allow
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Warn("cannot clear deadline of export download", "error", err)
+	}
+	fileName := fmt.Sprintf("shelffy-library-%s.zip", export.CreatedAt.Format(time.DateOnly))
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.FormatInt(export.Size, 10))
+	if _, err := io.Copy(w, content); err != nil {
+		h.logger.Error("failed to send library export", "error", err, "export_id", export.ID)
+	}
+}
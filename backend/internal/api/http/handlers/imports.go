@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	contextvalues "github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+	services2 "github.com/Shelffy/shelffy/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ImportsHandler struct {
+	imports services2.Imports
+	logger  *slog.Logger
+}
+
+func NewImportsHandler(imports services2.Imports, logger *slog.Logger) ImportsHandler {
+	return ImportsHandler{
+		imports: imports,
+		logger:  logger,
+	}
+}
+
+type ImportItemResponse struct {
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	BookID    *uuid.UUID `json:"book_id"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ImportJobResponse struct {
+	ID         uuid.UUID            `json:"id"`
+	Source     string               `json:"source"`
+	Name       string               `json:"name"`
+	Status     string               `json:"status"`
+	Total      int                  `json:"total"`
+	Imported   int                  `json:"imported"`
+	Duplicates int                  `json:"duplicates"`
+	Failed     int                  `json:"failed"`
+	Error      string               `json:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	FinishedAt *time.Time           `json:"finished_at"`
+	Items      []ImportItemResponse `json:"items,omitempty"`
+}
+
+func toImportJobResponse(job entities.ImportJob) ImportJobResponse {
+	return ImportJobResponse{
+		ID:         job.ID,
+		Source:     string(job.Source),
+		Name:       job.Name,
+		Status:     string(job.Status),
+		Total:      job.Total,
+		Imported:   job.Imported,
+		Duplicates: job.Duplicates,
+		Failed:     job.Failed,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+func (h ImportsHandler) writeError(err error, w http.ResponseWriter) {
+	switch {
+	case errors.Is(err, services2.ErrImportJobNotFound):
+		err = errorResponse(err.Error(), http.StatusNotFound, w)
+	case errors.Is(err, services2.ErrInvalidArchive), errors.Is(err, services2.ErrEmptyArchive):
+		err = errorResponse(err.Error(), http.StatusBadRequest, w)
+	case errors.Is(err, services2.ErrArchiveTooLarge):
+		err = errorResponse(err.Error(), http.StatusRequestEntityTooLarge, w)
+	case errors.Is(err, services2.ErrImportQueueFull):
+		err = errorResponse(err.Error(), http.StatusServiceUnavailable, w)
+	default:
+		err = errorResponse("internal error", http.StatusInternalServerError, w)
+	}
+	logResponseWriteError(err, h.logger)
+}
+
+// archiveBody returns the uploaded archive without buffering it. The archive is either the "file" part
+// of a multipart form or the whole request body, named by the name query parameter.
+func archiveBody(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, r.URL.Query().Get("name"), nil
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() == "file" {
+			return part, part.FileName(), nil
+		}
+	}
+}
+
+func (h ImportsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !contextvalues.HasPermission(r.Context(), entities.PermissionBooksUpload) {
+		err := errorResponse("access denied", http.StatusForbidden, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	// archives take longer to upload than the server timeouts allow
+	controller := http.NewResponseController(w)
+	if err := errors.Join(controller.SetReadDeadline(time.Time{}), controller.SetWriteDeadline(time.Time{})); err != nil {
+		h.logger.Warn("cannot clear deadlines of archive upload", "error", err)
+	}
+	content, name, err := archiveBody(r)
+	if err != nil {
+		err = errorResponse("invalid request body", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	job, err := h.imports.ImportArchive(r.Context(), user.ID, name, content)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	err = response(R{"job": toImportJobResponse(job)}, http.StatusAccepted, w)
+	logResponseWriteError(err, h.logger)
+}
+
+func (h ImportsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		err = errorResponse("invalid import job id", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	limit, limitErr := parseUint(r.URL.Query().Get("limit"), defaultPageSize)
+	offset, offsetErr := parseUint(r.URL.Query().Get("offset"), 0)
+	if err := errors.Join(limitErr, offsetErr); err != nil {
+		err = errorResponse("invalid query parameters", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	job, err := h.imports.GetJob(r.Context(), jobID)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	if job.UserID != user.ID && !contextvalues.HasPermission(r.Context(), entities.PermissionBooksReadAny) {
+		h.writeError(services2.ErrImportJobNotFound, w)
+		return
+	}
+	items, err := h.imports.GetItems(r.Context(), job.ID, limit, offset)
+	if err != nil {
+		h.writeError(err, w)
+		return
+	}
+	payload := toImportJobResponse(job)
+	payload.Items = make([]ImportItemResponse, len(items))
+	for i, item := range items {
+		payload.Items[i] = ImportItemResponse{
+			Name:      item.Name,
+			Status:    string(item.Status),
+			BookID:    item.BookID,
+			Error:     item.Error,
+			CreatedAt: item.CreatedAt,
+		}
+	}
+	err = response(R{"job": payload}, http.StatusOK, w)
+	logResponseWriteError(err, h.logger)
+}
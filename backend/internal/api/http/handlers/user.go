@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/Shelffy/shelffy/internal/context_values"
 	"github.com/Shelffy/shelffy/internal/entities"
@@ -12,30 +14,41 @@ import (
 )
 
 type UserHandler struct {
-	service services.Users
-	logger  *slog.Logger
+	service  services.Users
+	deletion services.AccountDeletion
+	export   services.AccountExport
+	logger   *slog.Logger
 }
 
 type UserResponse struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	IsActive  bool   `json:"is_active"`
-	CreatedAt string `json:"created_at"`
+	ID                  string     `json:"id"`
+	Email               string     `json:"email"`
+	IsActive            bool       `json:"is_active"`
+	CreatedAt           string     `json:"created_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 func toUserResponse(user entities.User) UserResponse {
 	return UserResponse{
-		ID:        user.ID.String(),
-		Email:     user.Email,
-		IsActive:  user.IsActive,
-		CreatedAt: user.CreatedAt.String(),
+		ID:                  user.ID.String(),
+		Email:               user.Email,
+		IsActive:            user.IsActive,
+		CreatedAt:           user.CreatedAt.String(),
+		DeletionScheduledAt: user.DeletionScheduledAt,
 	}
 }
 
-func NewUserHandler(service services.Users, logger *slog.Logger) UserHandler {
+func NewUserHandler(
+	service services.Users,
+	deletion services.AccountDeletion,
+	export services.AccountExport,
+	logger *slog.Logger,
+) UserHandler {
 	return UserHandler{
-		service: service,
-		logger:  logger,
+		service:  service,
+		deletion: deletion,
+		export:   export,
+		logger:   logger,
 	}
 }
 
@@ -48,6 +61,12 @@ func (h UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		logResponseWriteError(err, h.logger)
 		return
 	}
+	user := contextvalues.GetUserOrPanic(r.Context())
+	if user.ID != userID && !contextvalues.HasPermission(r.Context(), entities.PermissionUsersManage) {
+		err = errorResponse("access denied", http.StatusForbidden, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
 	dbUser, err := h.service.GetByID(r.Context(), userID)
 	if err != nil {
 		h.logger.Error("failed to get user", "error", err)
@@ -64,3 +83,56 @@ func (h UserHandler) Me(w http.ResponseWriter, r *http.Request) {
 	err := response(R{"user": toUserResponse(user)}, http.StatusOK, w)
 	logResponseWriteError(err, h.logger)
 }
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (h UserHandler) ScheduleDeletion(w http.ResponseWriter, r *http.Request) {
+	deleteData, err := getRequestData[DeleteAccountRequest](r)
+	if err != nil {
+		err = errorResponse("invalid data provided", http.StatusBadRequest, w)
+		logResponseWriteError(err, h.logger)
+		return
+	}
+	ctx := r.Context()
+	user := contextvalues.GetUserOrPanic(ctx)
+	updated, err := h.deletion.Schedule(ctx, user.ID, deleteData.Password, contextvalues.GetSessionIDOrPanic(ctx))
+	switch {
+	case errors.Is(err, services.ErrPasswordsNotMatch):
+		err = errorResponse(err.Error(), http.StatusForbidden, w)
+	case errors.Is(err, services.ErrDeletionAlreadyScheduled):
+		err = errorResponse(err.Error(), http.StatusConflict, w)
+	case err != nil:
+		h.logger.Error("failed to schedule account deletion", "error", err)
+		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
+	default:
+		err = response(R{"deletion_scheduled_at": updated.DeletionScheduledAt}, http.StatusAccepted, w)
+	}
+	logResponseWriteError(err, h.logger)
+}
+
+func (h UserHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	user := contextvalues.GetUserOrPanic(r.Context())
+	_, err := h.deletion.Cancel(r.Context(), user.ID)
+	switch {
+	case errors.Is(err, services.ErrDeletionNotScheduled):
+		err = errorResponse(err.Error(), http.StatusConflict, w)
+	case err != nil:
+		h.logger.Error("failed to cancel account deletion", "error", err)
+		err = errorResponse("something went wrong", http.StatusInternalServerError, w)
+	default:
+		err = successResponse("account deletion cancelled", http.StatusOK, w)
+	}
+	logResponseWriteError(err, h.logger)
+}
+
+func (h UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	user := contextvalues.GetUserOrPanic(r.Context())
+	w.Header().Set("Content-Disposition", "attachment; filename=shelffy-export.zip")
+	w.Header().Set("Content-Type", "application/zip")
+	// the archive is streamed, so an error can only be logged once writing has started
+	if err := h.export.Export(r.Context(), user, w); err != nil {
+		h.logger.Error("failed to export account data", "error", err, "user_id", user.ID)
+	}
+}
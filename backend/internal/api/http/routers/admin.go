@@ -0,0 +1,33 @@
+package routers
+
+import (
+	"net/http"
+
+	"github.com/Shelffy/shelffy/internal/api/http/handlers"
+	"github.com/Shelffy/shelffy/internal/api/middlewares"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminRouterArgs struct {
+	Handler        handlers.AdminHandler
+	AuthMiddleware func(http.Handler) http.Handler
+}
+
+func NewAdminRouter(args AdminRouterArgs) *chi.Mux {
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(args.AuthMiddleware, middlewares.RequirePermission(entities.PermissionUsersManage))
+		r.Get("/users", args.Handler.ListUsers)
+		r.Get("/users/{id}", args.Handler.GetUser)
+		r.Post("/users/{id}/activate", args.Handler.Activate)
+		r.Post("/users/{id}/deactivate", args.Handler.Deactivate)
+		r.Post("/users/{id}/admin", args.Handler.Promote)
+		r.Delete("/users/{id}/admin", args.Handler.Demote)
+		r.Post("/users/{id}/password-reset", args.Handler.ForcePasswordReset)
+		r.Put("/users/{id}/quota", args.Handler.SetQuota)
+		r.Delete("/users/{id}", args.Handler.DeleteUser)
+	})
+
+	return router
+}
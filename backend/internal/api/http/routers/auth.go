@@ -16,6 +16,8 @@ func NewAuthRouter(args AuthRouterArgs) *chi.Mux {
 	router := chi.NewRouter()
 	router.Post("/register", args.Handler.Register)
 	router.Post("/login", args.Handler.Login)
+	router.Get("/unlock", args.Handler.Unlock)
+	router.Post("/password-reset", args.Handler.ResetPassword)
 	router.Group(func(r chi.Router) {
 		r.Use(args.AuthMiddleware)
 		r.Post("/logout", args.Handler.Logout)
@@ -14,9 +14,24 @@ type BooksRouterArgs struct {
 
 func NewBooksRouter(args BooksRouterArgs) *chi.Mux {
 	router := chi.NewRouter()
+	// share links work without a session, the token of the link authorises the download
+	router.Get("/shared/{token}", args.Handler.GetSharedContent)
+	router.Post("/shared/{token}", args.Handler.GetSharedContent)
 	router.Group(func(r chi.Router) {
 		r.Use(args.AuthMiddleware)
 		r.Get("/{id}", args.Handler.GetContentByID)
+		r.Patch("/{id}", args.Handler.Update)
+		r.Get("/{id}/cover", args.Handler.GetCover)
+		r.Get("/{id}/files", args.Handler.GetFiles)
+		r.Get("/{id}/reader", args.Handler.GetReaderPublication)
+		r.Get("/{id}/reader/*", args.Handler.GetReaderResource)
+		r.Get("/{id}/pages/{n}", args.Handler.GetPage)
+		r.Get("/{id}/tracks", args.Handler.GetTracks)
+		r.Get("/{id}/tracks/{n}", args.Handler.GetTrack)
+		r.Get("/{id}/progress", args.Handler.GetProgress)
+		r.Put("/{id}/progress", args.Handler.SaveProgress)
+		r.Get("/{id}/history", args.Handler.History)
+		r.Post("/{id}/history/{version}/revert", args.Handler.Revert)
 	})
 
 	return router
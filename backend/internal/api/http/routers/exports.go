@@ -0,0 +1,26 @@
+package routers
+
+import (
+	"net/http"
+
+	"github.com/Shelffy/shelffy/internal/api/http/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+type ExportsRouterArgs struct {
+	Handler        handlers.ExportsHandler
+	AuthMiddleware func(http.Handler) http.Handler
+}
+
+func NewExportsRouter(args ExportsRouterArgs) *chi.Mux {
+	router := chi.NewRouter()
+	// download links are signed, they work without a session
+	router.Get("/{id}/download", args.Handler.Download)
+	router.Group(func(r chi.Router) {
+		r.Use(args.AuthMiddleware)
+		r.Post("/", args.Handler.Create)
+		r.Get("/{id}", args.Handler.Get)
+	})
+
+	return router
+}
@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"net/http"
+
+	"github.com/Shelffy/shelffy/internal/api/http/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+type ImportsRouterArgs struct {
+	Handler        handlers.ImportsHandler
+	AuthMiddleware func(http.Handler) http.Handler
+}
+
+func NewImportsRouter(args ImportsRouterArgs) *chi.Mux {
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(args.AuthMiddleware)
+		r.Post("/", args.Handler.Create)
+		r.Get("/{id}", args.Handler.Get)
+	})
+
+	return router
+}
@@ -1,12 +1,14 @@
 package routers
 
 import (
+	"expvar"
 	"log/slog"
 	"net/http"
 
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/Shelffy/shelffy/internal/api/http/handlers"
 	"github.com/Shelffy/shelffy/internal/api/middlewares"
+	"github.com/Shelffy/shelffy/internal/entities"
 	"github.com/Shelffy/shelffy/internal/services"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -15,7 +17,25 @@ import (
 type RouterArgs struct {
 	UserService    services.Users
 	AuthService    services.Auth
+	RolesService   services.Roles
+	Throttler      services.LoginThrottler
+	Registration   services.Registration
+	UserAdmin      services.UserAdmin
+	PasswordResets services.PasswordResets
+	Deletion       services.AccountDeletion
+	Export         services.AccountExport
+	Quotas         services.Quotas
 	BooksService   services.Books
+	BookMetadata   services.BookMetadata
+	Imports        services.Imports
+	Exports        services.LibraryExports
+	Conversions    services.BookConversions
+	Reader         services.BookReader
+	Comics         services.Comics
+	Audiobooks     services.Audiobooks
+	Progress       services.BookProgress
+	ShareLinks     services.ShareLinks
+	Households     services.Households
 	StorageService services.FileStorage
 	GQLHandler     http.Handler
 	Logger         *slog.Logger
@@ -30,8 +50,14 @@ func NewRouter(args RouterArgs) *chi.Mux {
 		chimiddleware.Recoverer,
 
 		middlewares.BaseURLMiddleware,
+		middlewares.ClientInfo,
 	)
-	authMiddleware := middlewares.NewAuthMiddleware(args.UserService, args.AuthService, args.Logger)
+	authMiddleware := middlewares.NewAuthMiddleware(args.UserService, args.AuthService, args.RolesService, args.Logger)
+	// runtime metrics are only for administrators
+	router.Group(func(r chi.Router) {
+		r.Use(authMiddleware.HTTPHandler, middlewares.RequirePermission(entities.PermissionUsersManage))
+		r.Handle("/debug/vars", expvar.Handler())
+	})
 	router.Route("/api", func(r chi.Router) {
 		if args.GQLHandler != nil {
 			r.Route("/gql", func(r chi.Router) {
@@ -44,21 +70,61 @@ func NewRouter(args RouterArgs) *chi.Mux {
 			r.Mount(
 				"/auth",
 				NewAuthRouter(AuthRouterArgs{
-					Handler:        handlers.NewAuthHandler(args.AuthService, args.UserService, args.Logger),
+					Handler: handlers.NewAuthHandler(
+						args.AuthService,
+						args.UserService,
+						args.Throttler,
+						args.Registration,
+						args.PasswordResets,
+						args.Logger,
+					),
 					AuthMiddleware: authMiddleware.HTTPHandler,
 				}),
 			)
 			r.Mount(
 				"/users",
 				NewUserRouter(UserRouterArgs{
-					Handler:        handlers.NewUserHandler(args.UserService, args.Logger),
+					Handler:        handlers.NewUserHandler(args.UserService, args.Deletion, args.Export, args.Logger),
+					AuthMiddleware: authMiddleware.HTTPHandler,
+				}),
+			)
+			r.Mount(
+				"/admin",
+				NewAdminRouter(AdminRouterArgs{
+					Handler:        handlers.NewAdminHandler(args.UserAdmin, args.PasswordResets, args.Quotas, args.Logger),
 					AuthMiddleware: authMiddleware.HTTPHandler,
 				}),
 			)
 			r.Mount(
 				"/books",
 				NewBooksRouter(BooksRouterArgs{
-					Handler:        handlers.NewBooksHandler(args.BooksService, args.StorageService, args.Logger),
+					Handler: handlers.NewBooksHandler(
+						args.BooksService,
+						args.StorageService,
+						args.BookMetadata,
+						args.Conversions,
+						args.Reader,
+						args.Comics,
+						args.Audiobooks,
+						args.Progress,
+						args.ShareLinks,
+						args.Households,
+						args.Logger,
+					),
+					AuthMiddleware: authMiddleware.HTTPHandler,
+				}),
+			)
+			r.Mount(
+				"/imports",
+				NewImportsRouter(ImportsRouterArgs{
+					Handler:        handlers.NewImportsHandler(args.Imports, args.Logger),
+					AuthMiddleware: authMiddleware.HTTPHandler,
+				}),
+			)
+			r.Mount(
+				"/exports",
+				NewExportsRouter(ExportsRouterArgs{
+					Handler:        handlers.NewExportsHandler(args.Exports, args.Logger),
 					AuthMiddleware: authMiddleware.HTTPHandler,
 				}),
 			)
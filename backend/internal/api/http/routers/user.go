@@ -18,6 +18,9 @@ func NewUserRouter(args UserRouterArgs) *chi.Mux {
 		r.Use(args.AuthMiddleware)
 		r.Get("/{id}", args.Handler.GetByID)
 		r.Get("/me", args.Handler.Me)
+		r.Get("/me/export", args.Handler.Export)
+		r.Post("/me/deletion", args.Handler.ScheduleDeletion)
+		r.Delete("/me/deletion", args.Handler.CancelDeletion)
 	})
 
 	return router
@@ -17,20 +17,24 @@ import (
 const SessionLength = 128
 
 type Auth struct {
-	userService services.Users
-	authService services.Auth
-	logger      *slog.Logger
+	userService  services.Users
+	authService  services.Auth
+	rolesService services.Roles
+	logger       *slog.Logger
 }
 
-func NewAuthMiddleware(userService services.Users, authService services.Auth, logger *slog.Logger) Auth {
+func NewAuthMiddleware(userService services.Users, authService services.Auth, rolesService services.Roles, logger *slog.Logger) Auth {
 	return Auth{
-		userService: userService,
-		authService: authService,
-		logger:      logger,
+		userService:  userService,
+		authService:  authService,
+		rolesService: rolesService,
+		logger:       logger,
 	}
 }
 
-func (a Auth) getSession(r *http.Request) (entities.Session, error) {
+// getSession validates the session from the cookie and refreshes it.
+// The cookie is re-issued when the session ID has been rotated.
+func (a Auth) getSession(w http.ResponseWriter, r *http.Request) (entities.Session, error) {
 	sessionCookie, err := r.Cookie(api.SessionIDCookieName)
 	if err != nil {
 		return entities.NilSession, err
@@ -39,6 +43,19 @@ func (a Auth) getSession(r *http.Request) (entities.Session, error) {
 	if err != nil {
 		return entities.NilSession, err
 	}
+	session, err = a.authService.Refresh(r.Context(), session, contextvalues.GetClientInfo(r.Context()))
+	if err != nil {
+		a.logger.Error("failed to refresh session", "error", err.Error())
+	}
+	if session.ID != sessionCookie.Value {
+		http.SetCookie(w, &http.Cookie{
+			Name:     api.SessionIDCookieName,
+			Value:    session.ID,
+			Path:     "/",
+			Expires:  session.ExpiresAt,
+			HttpOnly: true,
+		})
+	}
 	return session, nil
 }
 
@@ -51,10 +68,20 @@ func (a Auth) setUserToCtx(ctx context.Context, user entities.User) context.Cont
 	return context.WithValue(ctx, contextvalues.UserCtxKey, user)
 }
 
+func (a Auth) setPermissionsToCtx(ctx context.Context, user entities.User) context.Context {
+	permissions, err := a.rolesService.GetPermissions(ctx, user.ID)
+	if err != nil {
+		a.logger.Error("error while trying to get user permissions in auth middleware", "error", err.Error())
+		permissions = entities.Permissions{}
+	}
+	ctx = context.WithValue(ctx, contextvalues.PermissionsCtxKey, permissions)
+	return context.WithValue(ctx, contextvalues.IsAdminCtxKey, user.IsAdmin)
+}
+
 func (a Auth) HTTPHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			session, err := a.getSession(r)
+			session, err := a.getSession(w, r)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				if err := json.NewEncoder(w).Encode(map[string]any{"error": "unauthorized"}); err != nil {
@@ -73,6 +100,7 @@ func (a Auth) HTTPHandler(next http.Handler) http.Handler {
 			}
 			r = r.WithContext(a.setSessionToCtx(r.Context(), session.ID))
 			r = r.WithContext(a.setUserToCtx(r.Context(), user))
+			r = r.WithContext(a.setPermissionsToCtx(r.Context(), user))
 			next.ServeHTTP(w, r)
 		},
 	)
@@ -81,7 +109,7 @@ func (a Auth) HTTPHandler(next http.Handler) http.Handler {
 func (a Auth) GQLHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			session, err := a.getSession(r)
+			session, err := a.getSession(w, r)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -96,6 +124,7 @@ func (a Auth) GQLHandler(next http.Handler) http.Handler {
 			}
 			r = r.WithContext(a.setSessionToCtx(r.Context(), session.ID))
 			r = r.WithContext(a.setUserToCtx(r.Context(), user))
+			r = r.WithContext(a.setPermissionsToCtx(r.Context(), user))
 			next.ServeHTTP(w, r)
 		},
 	)
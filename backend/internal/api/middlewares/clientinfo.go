@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// ClientInfo stores the client address and user agent in the context.
+// It must run after chimiddleware.RealIP, which rewrites r.RemoteAddr from the proxy headers.
+func ClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		ctx := context.WithValue(r.Context(), contextvalues.ClientInfoCtxKey, entities.ClientInfo{
+			IP:        ip,
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
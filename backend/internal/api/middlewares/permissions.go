@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Shelffy/shelffy/internal/context_values"
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// RequirePermission rejects requests of users without the permission.
+// It must be used after the auth middleware.
+func RequirePermission(permission entities.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !contextvalues.HasPermission(r.Context(), permission) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": "access denied"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasPermissionDirective implements the @HasPermission directive.
+func HasPermissionDirective(ctx context.Context, obj any, next graphql.Resolver, perm string) (res any, err error) {
+	if contextvalues.GetSessionID(ctx) == "" {
+		return nil, errors.New("unauthorized")
+	}
+	if !contextvalues.HasPermission(ctx, entities.Permission(perm)) {
+		return nil, errors.New("access denied")
+	}
+	return next(ctx)
+}
@@ -2,15 +2,21 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Shelffy/shelffy/internal/api/gql"
 	"github.com/Shelffy/shelffy/internal/api/http/routers"
 	"github.com/Shelffy/shelffy/internal/config"
+	"github.com/Shelffy/shelffy/internal/converters"
+	"github.com/Shelffy/shelffy/internal/entities"
 	repositories2 "github.com/Shelffy/shelffy/internal/repositories"
 	services2 "github.com/Shelffy/shelffy/internal/services"
 	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
@@ -20,6 +26,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kr/pretty"
 	"github.com/nats-io/nats.go"
@@ -27,39 +34,123 @@ import (
 )
 
 const (
-	defaultSessionLifeTime = 24 * time.Hour * 30
+	defaultSessionLifeTime        = 24 * time.Hour * 30
+	defaultSessionCleanupInterval = time.Hour
+	defaultPasswordResetTTL       = 24 * time.Hour
+	defaultAccountPurgeInterval   = time.Hour
+	defaultTrashPurgeInterval     = time.Hour
+	defaultScannerTimeout         = 2 * time.Minute
+	defaultWatchInterval          = time.Minute
+	defaultExportRetention        = 3 * 24 * time.Hour
+	defaultExportLinkTTL          = time.Hour
+	defaultExportPurgeInterval    = time.Hour
+	defaultConversionTimeout      = 10 * time.Minute
+	defaultMetadataTimeout        = 10 * time.Second
+	defaultMaxCoverSize           = 10 << 20
+	defaultMaxAttachmentSize      = 35 << 20
+	defaultOpenLibraryCoversURL   = "https://covers.openlibrary.org"
+	defaultSecret                 = "secret"
 )
 
+// backgroundJob is a long-running process started together with the HTTP server.
+type backgroundJob struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
 type App struct {
-	ctx            context.Context
-	logger         *slog.Logger
-	router         chi.Router
-	pool           *pgxpool.Pool
-	server         *http.Server
-	nc             *nats.Conn
-	eventProcessor services2.EventsProcessor
+	ctx      context.Context
+	logger   *slog.Logger
+	router   chi.Router
+	pool     *pgxpool.Pool
+	server   *http.Server
+	nc       *nats.Conn
+	jobs     []backgroundJob
+	services appServices
 }
 
 type appRepositories struct {
-	userRepo repositories2.Users
-	authRepo repositories2.Session
-	bookRepo repositories2.Books
+	userRepo         repositories2.Users
+	authRepo         repositories2.Session
+	bookRepo         repositories2.Books
+	throttleRepo     repositories2.LoginThrottle
+	auditRepo        repositories2.AuditLog
+	rolesRepo        repositories2.Roles
+	invitesRepo      repositories2.Invites
+	resetsRepo       repositories2.PasswordResets
+	storageUsageRepo repositories2.StorageUsage
+	bookHistoryRepo  repositories2.BookHistory
+	importsRepo      repositories2.Imports
+	exportsRepo      repositories2.LibraryExports
+	conversionsRepo  repositories2.BookConversions
+	bookFilesRepo    repositories2.BookFiles
+	devicesRepo      repositories2.Devices
+	deliveriesRepo   repositories2.BookDeliveries
+	comicPagesRepo   repositories2.ComicPages
+	audioTracksRepo  repositories2.AudioTracks
+	progressRepo     repositories2.BookProgress
+	duplicatesRepo   repositories2.Duplicates
+	shareLinksRepo   repositories2.ShareLinks
+	householdsRepo   repositories2.Households
 }
 
 func newRepositories(conn *pgxpool.Pool) appRepositories {
 	return appRepositories{
-		userRepo: repositories2.NewUsersPSQLRepository(conn),
-		authRepo: repositories2.NewAuthPSQLRepository(conn),
-		bookRepo: repositories2.NewBooksPSQLRepository(conn),
+		userRepo:         repositories2.NewUsersPSQLRepository(conn),
+		authRepo:         repositories2.NewAuthPSQLRepository(conn),
+		bookRepo:         repositories2.NewBooksPSQLRepository(conn),
+		throttleRepo:     repositories2.NewLoginThrottlePSQLRepository(conn),
+		auditRepo:        repositories2.NewAuditLogPSQLRepository(conn),
+		rolesRepo:        repositories2.NewRolesPSQLRepository(conn),
+		invitesRepo:      repositories2.NewInvitesPSQLRepository(conn),
+		resetsRepo:       repositories2.NewPasswordResetsPSQLRepository(conn),
+		storageUsageRepo: repositories2.NewStorageUsagePSQLRepository(conn),
+		bookHistoryRepo:  repositories2.NewBookHistoryPSQLRepository(conn),
+		importsRepo:      repositories2.NewImportsPSQLRepository(conn),
+		exportsRepo:      repositories2.NewLibraryExportsPSQLRepository(conn),
+		conversionsRepo:  repositories2.NewBookConversionsPSQLRepository(conn),
+		bookFilesRepo:    repositories2.NewBookFilesPSQLRepository(conn),
+		devicesRepo:      repositories2.NewDevicesPSQLRepository(conn),
+		deliveriesRepo:   repositories2.NewBookDeliveriesPSQLRepository(conn),
+		comicPagesRepo:   repositories2.NewComicPagesPSQLRepository(conn),
+		audioTracksRepo:  repositories2.NewAudioTracksPSQLRepository(conn),
+		progressRepo:     repositories2.NewBookProgressPSQLRepository(conn),
+		duplicatesRepo:   repositories2.NewDuplicatesPSQLRepository(conn),
+		shareLinksRepo:   repositories2.NewShareLinksPSQLRepository(conn),
+		householdsRepo:   repositories2.NewHouseholdsPSQLRepository(conn),
 	}
 }
 
 type appServices struct {
 	userService     services2.Users
 	authService     services2.Auth
+	throttler       services2.LoginThrottler
+	rolesService    services2.Roles
+	registration    services2.Registration
+	userAdmin       services2.UserAdmin
+	passwordResets  services2.PasswordResets
+	accountDeletion services2.AccountDeletion
+	accountExport   services2.AccountExport
+	trash           services2.Trash
+	bookMetadata    services2.BookMetadata
+	metadataLookup  services2.MetadataLookup
+	duplicates      services2.Duplicates
+	shareLinks      services2.ShareLinks
+	households      services2.Households
+	imports         services2.Imports
+	libraryExports  services2.LibraryExports
+	conversions     services2.BookConversions
+	deliveries      services2.BookDeliveries
+	scans           services2.BookScans
+	reader          services2.BookReader
+	comics          services2.Comics
+	audiobooks      services2.Audiobooks
+	progress        services2.BookProgress
+	quotas          services2.Quotas
 	bookService     services2.Books
 	storage         services2.FileStorage
 	eventsProcessor services2.EventsProcessor
+	sessionJanitor  services2.SessionJanitor
 }
 
 func newServices(
@@ -74,40 +165,357 @@ func newServices(
 		logger.Warn("session life time is not provided, using default session life time")
 		cfg.Auth.SessionLifeTime = defaultSessionLifeTime
 	}
+	if cfg.Auth.Sessions.CleanupInterval == 0 {
+		logger.Warn("session cleanup interval is not provided, using default interval")
+		cfg.Auth.Sessions.CleanupInterval = defaultSessionCleanupInterval
+	}
+	if cfg.Auth.PasswordResetTTL == 0 {
+		logger.Warn("password reset ttl is not provided, using default ttl")
+		cfg.Auth.PasswordResetTTL = defaultPasswordResetTTL
+	}
+	if cfg.Accounts.PurgeInterval == 0 {
+		logger.Warn("account purge interval is not provided, using default interval")
+		cfg.Accounts.PurgeInterval = defaultAccountPurgeInterval
+	}
+	if cfg.Trash.PurgeInterval == 0 {
+		logger.Warn("trash purge interval is not provided, using default interval")
+		cfg.Trash.PurgeInterval = defaultTrashPurgeInterval
+	}
+	if cfg.Scanner.Address != "" && cfg.Scanner.Timeout == 0 {
+		logger.Warn("scanner timeout is not provided, using default timeout")
+		cfg.Scanner.Timeout = defaultScannerTimeout
+	}
+	if cfg.Imports.WatchDir != "" && cfg.Imports.WatchInterval == 0 {
+		logger.Warn("watch folder interval is not provided, using default interval")
+		cfg.Imports.WatchInterval = defaultWatchInterval
+	}
+	if cfg.Imports.WatchDir != "" && cfg.Imports.WatchOwner == "" {
+		logger.Warn("watch folder owner is not provided, the watch folder is disabled")
+		cfg.Imports.WatchDir = ""
+	}
+	if cfg.Exports.Retention == 0 {
+		logger.Warn("export retention is not provided, using default retention")
+		cfg.Exports.Retention = defaultExportRetention
+	}
+	if cfg.Exports.LinkTTL == 0 {
+		logger.Warn("export link ttl is not provided, using default ttl")
+		cfg.Exports.LinkTTL = defaultExportLinkTTL
+	}
+	if cfg.Exports.PurgeInterval == 0 {
+		logger.Warn("export purge interval is not provided, using default interval")
+		cfg.Exports.PurgeInterval = defaultExportPurgeInterval
+	}
+	if cfg.Conversions.Timeout == 0 {
+		logger.Warn("conversion timeout is not provided, using default timeout")
+		cfg.Conversions.Timeout = defaultConversionTimeout
+	}
+	if cfg.Metadata.OpenLibraryURL != "" && cfg.Metadata.CoversURL == "" {
+		logger.Warn("covers url is not provided, using open library covers")
+		cfg.Metadata.CoversURL = defaultOpenLibraryCoversURL
+	}
+	if cfg.Metadata.Timeout == 0 {
+		logger.Warn("metadata lookup timeout is not provided, using default timeout")
+		cfg.Metadata.Timeout = defaultMetadataTimeout
+	}
+	if cfg.Metadata.MaxCoverSize == 0 {
+		logger.Warn("max cover size is not provided, using default size")
+		cfg.Metadata.MaxCoverSize = defaultMaxCoverSize
+	}
+	if cfg.Deliveries.MaxAttachmentSize <= 0 {
+		logger.Warn("max attachment size is not provided, using default size")
+		cfg.Deliveries.MaxAttachmentSize = defaultMaxAttachmentSize
+	}
 	if cfg.Auth.Secret == "" {
 		logger.Warn("secret is not provided, using default secret")
-		cfg.Auth.Secret = "secret"
+		cfg.Auth.Secret = defaultSecret
+	}
+	// anyone knowing the default secret could forge download links of any export, even instance-wide ones
+	exportsSecret := cfg.Auth.Secret
+	if exportsSecret == defaultSecret {
+		logger.Warn("secret is left at the default, export download links are disabled")
+		exportsSecret = ""
 	}
 	storageService := services2.NewS3Storage(cfg.S3.BooksBucket, s3client)
 	booksEventsPublisher := services2.NewNATSBooksEventPublisher(js)
+	var mailer services2.Mailer
+	if cfg.Mail.Host == "" {
+		logger.Warn("mail host is not provided, emails will only be logged")
+		mailer = services2.NewLogMailer(logger.WithGroup("mailer"))
+	} else {
+		mailer = services2.NewSMTPMailer(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password, cfg.Mail.From)
+	}
+	var scanner services2.Scanner
+	if cfg.Scanner.Address == "" {
+		logger.Warn("scanner address is not provided, uploads will not be scanned for malware")
+		scanner = services2.NewNoopScanner()
+	} else {
+		scanner = services2.NewClamdScanner(cfg.Scanner.Network, cfg.Scanner.Address, cfg.Scanner.Timeout)
+	}
+	var metadataProvider services2.MetadataProvider
+	if cfg.Metadata.OpenLibraryURL == "" {
+		logger.Warn("open library url is not provided, metadata lookups are disabled")
+		metadataProvider = services2.NewNoopMetadataProvider()
+	} else {
+		metadataProvider = services2.NewOpenLibraryProvider(cfg.Metadata.OpenLibraryURL, cfg.Metadata.CoversURL, cfg.Metadata.Timeout)
+	}
+	quotas := services2.NewQuotas(
+		repos.storageUsageRepo,
+		storageService,
+		cfg.Uploads.DefaultQuota,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("quotas_service"),
+	)
+	throttler := services2.NewLoginThrottler(
+		repos.throttleRepo,
+		repos.auditRepo,
+		mailer,
+		cfg.Auth.Throttle,
+		cfg.Server.PublicURL,
+		cfg.Services.AuthServiceTimeout,
+		logger.WithGroup("login_throttler"),
+	)
+	accountDeletion := services2.NewAccountDeletion(
+		repos.userRepo,
+		repos.authRepo,
+		repos.bookRepo,
+		booksEventsPublisher,
+		repos.exportsRepo,
+		storageService,
+		txManager,
+		cfg.Accounts.DeletionGracePeriod,
+		cfg.Accounts.PurgeInterval,
+		cfg.Services.UserServiceTimeout,
+		logger.WithGroup("account_deletion"),
+	)
+	converter := converters.Chain{converters.NewKEPUB(), converters.NewText()}
+	if cfg.Conversions.EbookConvertPath == "" {
+		logger.Warn("ebook-convert path is not provided, books can only be converted from epub to kepub and txt")
+	} else {
+		converter = append(converter, converters.NewEbookConvert(cfg.Conversions.EbookConvertPath))
+	}
+	conversions := services2.NewBookConversions(
+		repos.conversionsRepo,
+		repos.bookRepo,
+		storageService,
+		booksEventsPublisher,
+		converter,
+		cfg.Uploads.TempDir,
+		cfg.Conversions.Timeout,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("book_conversions"),
+	)
+	deliveries := services2.NewBookDeliveries(
+		repos.devicesRepo,
+		repos.deliveriesRepo,
+		repos.bookRepo,
+		repos.bookFilesRepo,
+		conversions,
+		storageService,
+		booksEventsPublisher,
+		mailer,
+		cfg.Deliveries.MaxAttachmentSize,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("book_deliveries"),
+	)
+	scans := services2.NewBookScans(
+		repos.bookRepo,
+		repos.bookFilesRepo,
+		repos.userRepo,
+		storageService,
+		scanner,
+		booksEventsPublisher,
+		txManager,
+		mailer,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("book_scans"),
+	)
+	audiobooks := services2.NewAudiobooks(
+		repos.audioTracksRepo,
+		repos.bookFilesRepo,
+		storageService,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("audiobooks"),
+	)
+	bookService := services2.NewBookService(
+		repos.bookRepo,
+		repos.bookFilesRepo,
+		repos.comicPagesRepo,
+		repos.audioTracksRepo,
+		storageService,
+		cfg.Services.BookServiceTimeout,
+		booksEventsPublisher,
+		txManager,
+		quotas,
+		cfg.Uploads,
+		logger.WithGroup("book_services"),
+	)
+	bookMetadata := services2.NewBookMetadata(
+		repos.bookRepo,
+		repos.bookHistoryRepo,
+		txManager,
+		cfg.Services.BookServiceTimeout,
+		logger.WithGroup("book_metadata"),
+	)
 	return appServices{
+		accountDeletion: accountDeletion,
+		quotas:          quotas,
+		accountExport: services2.NewAccountExport(
+			repos.bookRepo,
+			repos.bookFilesRepo,
+			storageService,
+			logger.WithGroup("account_export"),
+		),
+		trash: services2.NewTrash(
+			repos.bookRepo,
+			repos.bookFilesRepo,
+			booksEventsPublisher,
+			txManager,
+			cfg.Trash.Retention,
+			cfg.Trash.PurgeInterval,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("trash"),
+		),
+		bookMetadata: bookMetadata,
+		metadataLookup: services2.NewMetadataLookup(
+			metadataProvider,
+			bookService,
+			bookMetadata,
+			cfg.Metadata.MaxCoverSize,
+			cfg.Metadata.Timeout,
+			logger.WithGroup("metadata_lookup"),
+		),
 		userService: services2.NewUsers(
 			repos.userRepo,
 			cfg.Services.UserServiceTimeout,
 			logger.WithGroup("user_service"),
 		),
+		throttler: throttler,
+		rolesService: services2.NewRoles(
+			repos.rolesRepo,
+			cfg.Services.UserServiceTimeout,
+			logger.WithGroup("roles_service"),
+		),
+		registration: services2.NewRegistration(
+			repos.userRepo,
+			repos.invitesRepo,
+			txManager,
+			cfg.Registration,
+			cfg.Services.UserServiceTimeout,
+			logger.WithGroup("registration_service"),
+		),
+		userAdmin: services2.NewUserAdmin(
+			repos.userRepo,
+			repos.authRepo,
+			repos.rolesRepo,
+			accountDeletion,
+			cfg.Services.UserServiceTimeout,
+			logger.WithGroup("user_admin_service"),
+		),
+		passwordResets: services2.NewPasswordResets(
+			repos.userRepo,
+			repos.authRepo,
+			repos.resetsRepo,
+			mailer,
+			txManager,
+			cfg.Auth.PasswordResetTTL,
+			cfg.Services.UserServiceTimeout,
+			logger.WithGroup("password_resets_service"),
+		),
 		authService: services2.NewAuth(
 			repos.userRepo,
 			repos.authRepo,
+			throttler,
 			cfg.Services.AuthServiceTimeout,
 			cfg.Auth.SessionLifeTime,
+			cfg.Auth.LastSeenInterval,
+			cfg.Auth.Sessions,
 			logger.WithGroup("auth_service"),
 			cfg.Auth.Secret,
 		),
-		storage: storageService,
-		bookService: services2.NewBookService(
-			repos.bookRepo,
+		storage:     storageService,
+		bookService: bookService,
+		conversions: conversions,
+		deliveries:  deliveries,
+		scans:       scans,
+		reader: services2.NewBookReader(
+			repos.bookFilesRepo,
+			storageService,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("book_reader"),
+		),
+		comics: services2.NewComics(
+			repos.comicPagesRepo,
 			storageService,
+			cfg.Uploads.TempDir,
 			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("comics"),
+		),
+		audiobooks: audiobooks,
+		progress: services2.NewBookProgress(
+			repos.progressRepo,
+			audiobooks,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("book_progress"),
+		),
+		duplicates: services2.NewDuplicates(
+			repos.duplicatesRepo,
+			repos.bookRepo,
 			booksEventsPublisher,
 			txManager,
-			logger.WithGroup("book_services"),
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("duplicates"),
+		),
+		shareLinks: services2.NewShareLinks(
+			repos.shareLinksRepo,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("share_links"),
+		),
+		households: services2.NewHouseholds(
+			repos.householdsRepo,
+			repos.userRepo,
+			repos.bookRepo,
+			txManager,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("households"),
+		),
+		imports: services2.NewImports(
+			repos.importsRepo,
+			repos.userRepo,
+			bookService,
+			cfg.Imports,
+			cfg.Uploads.TempDir,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("imports"),
+		),
+		libraryExports: services2.NewLibraryExports(
+			repos.exportsRepo,
+			repos.bookRepo,
+			repos.bookFilesRepo,
+			repos.userRepo,
+			storageService,
+			cfg.Exports,
+			exportsSecret,
+			cfg.Server.PublicURL,
+			cfg.Uploads.TempDir,
+			cfg.Services.BookServiceTimeout,
+			logger.WithGroup("library_exports"),
 		),
 		eventsProcessor: services2.NewNATSEventProcessor(
 			js,
 			storageService,
+			quotas,
+			scans,
+			conversions,
+			deliveries,
 			logger.WithGroup("events_processor"),
 		),
+		sessionJanitor: services2.NewSessionJanitor(
+			repos.authRepo,
+			cfg.Auth.Sessions.CleanupInterval,
+			cfg.Auth.Sessions.IdleTimeout,
+			cfg.Services.AuthServiceTimeout,
+			logger.WithGroup("session_janitor"),
+		),
 	}
 }
 
@@ -162,10 +570,30 @@ func New(ctx context.Context, config config.Config, logger *slog.Logger) (App, e
 	)
 	graphqlHandler := gql.New(
 		gql.Args{
-			UserService: appServices.userService,
-			AuthService: appServices.authService,
-			BookService: appServices.bookService,
-			Logger:      logger,
+			UserService:         appServices.userService,
+			AuthService:         appServices.authService,
+			Throttler:           appServices.throttler,
+			RolesService:        appServices.rolesService,
+			RegistrationService: appServices.registration,
+			UserAdminService:    appServices.userAdmin,
+			PasswordResets:      appServices.passwordResets,
+			AccountDeletion:     appServices.accountDeletion,
+			Quotas:              appServices.quotas,
+			BookService:         appServices.bookService,
+			Trash:               appServices.trash,
+			BookMetadata:        appServices.bookMetadata,
+			Imports:             appServices.imports,
+			LibraryExports:      appServices.libraryExports,
+			Conversions:         appServices.conversions,
+			Deliveries:          appServices.deliveries,
+			Comics:              appServices.comics,
+			Audiobooks:          appServices.audiobooks,
+			Progress:            appServices.progress,
+			MetadataLookup:      appServices.metadataLookup,
+			Duplicates:          appServices.duplicates,
+			ShareLinks:          appServices.shareLinks,
+			Households:          appServices.households,
+			Logger:              logger,
 		},
 		config.Debug,
 	)
@@ -174,7 +602,25 @@ func New(ctx context.Context, config config.Config, logger *slog.Logger) (App, e
 			GQLHandler:     graphqlHandler,
 			UserService:    appServices.userService,
 			AuthService:    appServices.authService,
+			Throttler:      appServices.throttler,
+			RolesService:   appServices.rolesService,
+			Registration:   appServices.registration,
+			UserAdmin:      appServices.userAdmin,
+			PasswordResets: appServices.passwordResets,
+			Deletion:       appServices.accountDeletion,
+			Export:         appServices.accountExport,
+			Quotas:         appServices.quotas,
 			BooksService:   appServices.bookService,
+			BookMetadata:   appServices.bookMetadata,
+			Imports:        appServices.imports,
+			Exports:        appServices.libraryExports,
+			Conversions:    appServices.conversions,
+			Reader:         appServices.reader,
+			Comics:         appServices.comics,
+			Audiobooks:     appServices.audiobooks,
+			Progress:       appServices.progress,
+			ShareLinks:     appServices.shareLinks,
+			Households:     appServices.households,
 			StorageService: appServices.storage,
 			Logger:         logger,
 		},
@@ -195,19 +641,67 @@ func New(ctx context.Context, config config.Config, logger *slog.Logger) (App, e
 				slog.LevelError,
 			),
 		},
-		eventProcessor: appServices.eventsProcessor,
-		nc:             nc,
+		jobs: []backgroundJob{
+			{name: "event processor", run: appServices.eventsProcessor.Run},
+			{name: "session janitor", run: appServices.sessionJanitor.Run},
+			{name: "account purger", run: appServices.accountDeletion.Run},
+			{name: "trash purger", run: appServices.trash.Run},
+			{name: "importer", run: appServices.imports.Run},
+			{name: "library exporter", run: appServices.libraryExports.Run},
+			{name: "storage backfill", run: appServices.quotas.Backfill},
+			{name: "scan requeuer", run: appServices.scans.Run},
+		},
+		nc:       nc,
+		services: appServices,
 	}, nil
 }
 
+// ImportCalibreLibrary imports the Calibre library in dir into the library of the user with the owner email.
+// It is used by the CLI and returns once the import is finished.
+func (a *App) ImportCalibreLibrary(ctx context.Context, ownerEmail string, dir string) (entities.ImportJob, error) {
+	owner, err := a.services.userService.GetByEmail(ctx, ownerEmail)
+	if err != nil {
+		return entities.ImportJob{}, err
+	}
+	return a.services.imports.ImportCalibreLibrary(ctx, owner.ID, dir)
+}
+
+// ExportLibrary writes the library of the user with the owner email, or of every user when ownerEmail is empty,
+// to out. out is a ZIP archive when it ends with .zip and a directory otherwise.
+// It is used by the CLI and returns the number of exported books.
+func (a *App) ExportLibrary(ctx context.Context, ownerEmail string, out string) (int, error) {
+	var userID *uuid.UUID
+	if ownerEmail != "" {
+		owner, err := a.services.userService.GetByEmail(ctx, ownerEmail)
+		if err != nil {
+			return 0, err
+		}
+		userID = &owner.ID
+	}
+	if !strings.EqualFold(filepath.Ext(out), ".zip") {
+		return a.services.libraryExports.WriteDir(ctx, userID, out)
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	count, err := a.services.libraryExports.WriteZip(ctx, userID, file)
+	if err := errors.Join(err, file.Close()); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
 func (a *App) Run() error {
 	a.LogRoutes()
 	a.logger.Info(fmt.Sprintf("listening port %s", a.server.Addr))
-	go func() {
-		if err := a.eventProcessor.Run(a.ctx); err != nil {
-			a.logger.Error("event processor running error", "error", err)
-		}
-	}()
+	for _, job := range a.jobs {
+		go func() {
+			if err := job.run(a.ctx); err != nil {
+				a.logger.Error(job.name+" running error", "error", err)
+			}
+		}()
+	}
 	return a.server.ListenAndServe()
 }
 
@@ -231,15 +725,17 @@ func (a *App) Stop(timeout time.Duration) {
 	c, cancel := context.WithTimeout(a.ctx, timeout)
 	defer cancel()
 	var wg sync.WaitGroup
-	wg.Go(func() {
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
 		if err := a.server.Shutdown(c); err != nil {
 			a.logger.Error("failed to shutdown server", "error", err)
 		} else {
 			a.logger.Info("server stopped")
 		}
-		wg.Done()
-	})
-	wg.Go(func() {
+	}()
+	go func() {
+		defer wg.Done()
 		ready := make(chan struct{})
 		go func() {
 			a.pool.Close()
@@ -251,15 +747,14 @@ func (a *App) Stop(timeout time.Duration) {
 		case <-ready:
 			a.logger.Info("db connection closed")
 		}
-		wg.Done()
-	})
-	wg.Go(func() {
+	}()
+	go func() {
+		defer wg.Done()
 		if err := a.nc.Drain(); err != nil {
 			a.logger.Error("failed to drain NATS", "error", err)
 		} else {
 			a.logger.Info("NATS stopped")
 		}
-		wg.Done()
-	})
+	}()
 	wg.Wait()
 }
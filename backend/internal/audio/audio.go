@@ -0,0 +1,70 @@
+// Package audio reads the duration, the chapter markers and the tags of audiobook tracks:
+// MP4 audio (M4B and M4A) and MP3.
+package audio
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+var (
+	ErrNotAudio = errors.New("not an audio file")
+	ErrInvalid  = errors.New("invalid audio file")
+)
+
+// maxChapters limits the chapter markers read from a track, real audiobooks have a few hundred at most.
+const maxChapters = 10_000
+
+// Info describes a track. Album is the title of the audiobook the track belongs to,
+// Artists are its authors or narrators as tagged.
+type Info struct {
+	Duration time.Duration
+	Title    string
+	Album    string
+	Artists  []string
+	Chapters []entities.AudioChapter
+}
+
+// IsAudio reports whether books in the format are audiobooks.
+func IsAudio(format entities.BookFormat) bool {
+	return format == entities.BookFormatM4B || format == entities.BookFormatMP3
+}
+
+// Probe reads the track. Only the headers and the tags are read, not the audio.
+func Probe(format entities.BookFormat, r io.ReaderAt, size int64) (Info, error) {
+	var info Info
+	var err error
+	switch format {
+	case entities.BookFormatM4B:
+		info, err = probeMP4(r, size)
+	case entities.BookFormatMP3:
+		info, err = probeMP3(r, size)
+	default:
+		return Info{}, ErrNotAudio
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	slices.SortStableFunc(info.Chapters, func(a, b entities.AudioChapter) int { return cmp.Compare(a.Start, b.Start) })
+	// markers past the end come from broken tags
+	info.Chapters = slices.DeleteFunc(info.Chapters, func(chapter entities.AudioChapter) bool {
+		return chapter.Start < 0 || info.Duration > 0 && chapter.Start >= info.Duration
+	})
+	return info, nil
+}
+
+// addArtists adds the artists of a tag, several artists are separated by commas or slashes.
+func (i *Info) addArtists(tag string) {
+	for _, artist := range strings.FieldsFunc(tag, func(r rune) bool { return r == ',' || r == '/' || r == 0 }) {
+		artist = strings.TrimSpace(artist)
+		if artist != "" && !slices.ContainsFunc(i.Artists, func(a string) bool { return strings.EqualFold(a, artist) }) {
+			i.Artists = append(i.Artists, artist)
+		}
+	}
+}
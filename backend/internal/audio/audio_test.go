@@ -0,0 +1,38 @@
+package audio
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+func FuzzProbe(f *testing.F) {
+	f.Add(newM4B())
+	f.Add(newMP3(nil, xingFrame(100), 256))
+	f.Add(newMP3(id3Tag(
+		id3Text("TIT2", "Track 1"),
+		id3Text("TPE1", "Author/Narrator"),
+		id3Chapter("ch1", 0, time.Second, "Intro"),
+	), mp3Frame, 256))
+	f.Fuzz(func(t *testing.T, content []byte) {
+		for _, format := range []entities.BookFormat{entities.BookFormatM4B, entities.BookFormatMP3} {
+			info, err := Probe(format, bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				continue
+			}
+			if info.Duration < 0 {
+				t.Errorf("%s: Duration = %v", format, info.Duration)
+			}
+			if len(info.Chapters) > maxChapters {
+				t.Errorf("%s: %d chapters, want at most %d", format, len(info.Chapters), maxChapters)
+			}
+			if !slices.IsSortedFunc(info.Chapters, func(a, b entities.AudioChapter) int { return cmp.Compare(a.Start, b.Start) }) {
+				t.Errorf("%s: chapters are not sorted: %+v", format, info.Chapters)
+			}
+		}
+	})
+}
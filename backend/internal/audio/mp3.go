@@ -0,0 +1,313 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+const (
+	id3HeaderSize = 10
+	// maxID3Size limits the tag read into memory, embedded cover images make it a few megabytes at most.
+	maxID3Size = 32 << 20
+	// frameSearchLength is how far past the tag the first MPEG frame is looked for, encoders may leave padding.
+	frameSearchLength = 64 << 10
+	id3v1Size         = 128
+)
+
+var (
+	id3Magic   = []byte("ID3")
+	id3v1Magic = []byte("TAG")
+)
+
+// bitrates in kbit/s by MPEG version (1 or 2 and 2.5) and layer, indexed by the bitrate bits of the frame header.
+var bitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// sampleRates in Hz by MPEG version 1, 2 and 2.5.
+var sampleRates = [3][3]int{{44100, 48000, 32000}, {22050, 24000, 16000}, {11025, 12000, 8000}}
+
+// frameHeader is the header of an MPEG audio frame.
+type frameHeader struct {
+	// version is 1, 2 or 3 for MPEG 2.5
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	mono       bool
+}
+
+// IsFrameHeader reports whether header starts with a valid MPEG audio frame header,
+// MP3 files without an ID3 tag are recognised by it.
+func IsFrameHeader(header []byte) bool {
+	_, ok := parseFrameHeader(header)
+	return ok
+}
+
+func parseFrameHeader(header []byte) (frameHeader, bool) {
+	if len(header) < 4 || header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return frameHeader{}, false
+	}
+	h := frameHeader{}
+	switch (header[1] >> 3) & 3 {
+	case 3:
+		h.version = 1
+	case 2:
+		h.version = 2
+	case 0:
+		h.version = 3
+	default:
+		return frameHeader{}, false
+	}
+	layerBits := (header[1] >> 1) & 3
+	if layerBits == 0 {
+		return frameHeader{}, false
+	}
+	h.layer = int(4 - layerBits)
+	bitrateIndex, rateIndex := int(header[2]>>4), int((header[2]>>2)&3)
+	if bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return frameHeader{}, false
+	}
+	h.bitrate = bitrates[min(h.version, 2)-1][h.layer-1][bitrateIndex] * 1000
+	h.sampleRate = sampleRates[h.version-1][rateIndex]
+	h.mono = header[3]>>6 == 3
+	return h, true
+}
+
+// samplesPerFrame is the number of samples each frame decodes to.
+func (h frameHeader) samplesPerFrame() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+// vbrFrames reads the frame count of the Xing or VBRI header variable bitrate encoders put in the first frame.
+func (h frameHeader) vbrFrames(frame []byte) (int, bool) {
+	xingOffset := 4 + 32
+	switch {
+	case h.version == 1 && h.mono, h.version != 1 && !h.mono:
+		xingOffset = 4 + 17
+	case h.version != 1 && h.mono:
+		xingOffset = 4 + 9
+	}
+	if len(frame) >= xingOffset+12 {
+		tag := string(frame[xingOffset : xingOffset+4])
+		flags := binary.BigEndian.Uint32(frame[xingOffset+4:])
+		if (tag == "Xing" || tag == "Info") && flags&1 != 0 {
+			return int(binary.BigEndian.Uint32(frame[xingOffset+8:])), true
+		}
+	}
+	const vbriOffset = 4 + 32
+	if len(frame) >= vbriOffset+18 && string(frame[vbriOffset:vbriOffset+4]) == "VBRI" {
+		return int(binary.BigEndian.Uint32(frame[vbriOffset+14:])), true
+	}
+	return 0, false
+}
+
+func probeMP3(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{Artists: make([]string, 0), Chapters: make([]entities.AudioChapter, 0)}
+	audioStart := int64(0)
+	header := make([]byte, id3HeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	var tagLength time.Duration
+	if bytes.HasPrefix(header, id3Magic) {
+		tagSize := int64(syncsafe(header[6:10])) + id3HeaderSize
+		if header[5]&0x10 != 0 {
+			// footer
+			tagSize += id3HeaderSize
+		}
+		if tagSize > size {
+			return Info{}, fmt.Errorf("%w: ID3 tag overflows the file", ErrInvalid)
+		}
+		audioStart = tagSize
+		if tagSize <= maxID3Size {
+			tag := make([]byte, tagSize)
+			if _, err := r.ReadAt(tag, 0); err != nil {
+				return Info{}, err
+			}
+			tagLength = readID3(tag, &info)
+		}
+	}
+	frameStart, first, frame, err := findFrame(r, audioStart, size)
+	if err != nil {
+		return Info{}, err
+	}
+	audioEnd := size
+	trailer := make([]byte, 3)
+	if size-id3v1Size > frameStart {
+		if _, err := r.ReadAt(trailer, size-id3v1Size); err == nil && bytes.Equal(trailer, id3v1Magic) {
+			audioEnd -= id3v1Size
+		}
+	}
+	switch frames, ok := first.vbrFrames(frame); {
+	case ok && frames > 0:
+		samples := int64(frames) * int64(first.samplesPerFrame())
+		info.Duration = time.Duration(samples) * time.Second / time.Duration(first.sampleRate)
+	case tagLength > 0:
+		info.Duration = tagLength
+	default:
+		// constant bitrate
+		info.Duration = time.Duration(audioEnd-frameStart) * 8 * time.Second / time.Duration(first.bitrate)
+	}
+	return info, nil
+}
+
+// findFrame finds the first MPEG frame at or after offset and returns its offset, header and leading bytes.
+func findFrame(r io.ReaderAt, offset, size int64) (int64, frameHeader, []byte, error) {
+	buf := make([]byte, min(frameSearchLength, size-offset))
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return 0, frameHeader{}, nil, err
+	}
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if h, ok := parseFrameHeader(buf[i:]); ok {
+			return offset + int64(i), h, buf[i:], nil
+		}
+	}
+	return 0, frameHeader{}, nil, fmt.Errorf("%w: no MPEG audio frame", ErrInvalid)
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// readID3 reads the ID3v2.3 and v2.4 frames of the tag and returns the length of the track in the TLEN frame.
+// ID3v2.2 tags are skipped, they predate chapters.
+func readID3(tag []byte, info *Info) time.Duration {
+	version, flags := tag[3], tag[5]
+	if version != 3 && version != 4 {
+		return 0
+	}
+	body := tag[id3HeaderSize:]
+	if flags&0x80 != 0 {
+		// unsynchronisation inserts a zero byte after every 0xff
+		body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		extended := int(binary.BigEndian.Uint32(body)) + 4
+		if version == 4 {
+			extended = int(syncsafe(body))
+		}
+		if extended > len(body) {
+			return 0
+		}
+		body = body[extended:]
+	}
+	var length time.Duration
+	readID3Frames(body, version, func(id string, data []byte) {
+		switch id {
+		case "TIT2":
+			info.Title = decodeText(data)
+		case "TALB":
+			info.Album = decodeText(data)
+		case "TPE1", "TPE2", "TCOM":
+			if id == "TPE1" || len(info.Artists) == 0 {
+				info.addArtists(decodeText(data))
+			}
+		case "TLEN":
+			if ms, err := strconv.ParseInt(decodeText(data), 10, 64); err == nil && ms > 0 {
+				length = time.Duration(ms) * time.Millisecond
+			}
+		case "CHAP":
+			if chapter, ok := parseCHAP(data, version); ok && len(info.Chapters) < maxChapters {
+				info.Chapters = append(info.Chapters, chapter)
+			}
+		}
+	})
+	return length
+}
+
+// readID3Frames calls visit with the id and the content of each frame, up to the padding.
+func readID3Frames(body []byte, version byte, visit func(id string, data []byte)) {
+	for len(body) >= 10 && body[0] != 0 {
+		id := string(body[:4])
+		size := int(binary.BigEndian.Uint32(body[4:]))
+		if version == 4 {
+			size = int(syncsafe(body[4:]))
+		}
+		if size < 0 || 10+size > len(body) {
+			return
+		}
+		visit(id, body[10:10+size])
+		body = body[10+size:]
+	}
+}
+
+// parseCHAP reads a chapter frame: an element id, the start and end times in milliseconds,
+// the byte offsets nobody uses and the subframes with the title.
+func parseCHAP(data []byte, version byte) (entities.AudioChapter, bool) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 || len(data) < end+1+16 {
+		return entities.AudioChapter{}, false
+	}
+	times := data[end+1:]
+	chapter := entities.AudioChapter{
+		Start: time.Duration(binary.BigEndian.Uint32(times)) * time.Millisecond,
+	}
+	readID3Frames(times[16:], version, func(id string, data []byte) {
+		if id == "TIT2" {
+			chapter.Title = decodeText(data)
+		}
+	})
+	return chapter, true
+}
+
+// decodeText decodes a text frame by its encoding byte: ISO-8859-1, UTF-16 with a BOM, UTF-16BE or UTF-8.
+// Frames with several values keep them separated by NUL characters.
+func decodeText(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	encoding, text := data[0], data[1:]
+	var decoded string
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+		}
+		decoded = string(runes)
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(text) >= 2 && encoding == 1 {
+			bigEndian = text[0] == 0xfe && text[1] == 0xff
+			text = text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(text[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(text[i:]))
+			}
+		}
+		decoded = string(utf16.Decode(units))
+	default:
+		decoded = string(text)
+	}
+	return strings.TrimSpace(strings.TrimRight(decoded, "\x00"))
+}
@@ -0,0 +1,229 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// mp3Frame is the header of an MPEG 1 layer III frame of 128 kbit/s at 44.1 kHz in stereo.
+var mp3Frame = []byte{0xff, 0xfb, 0x90, 0x00}
+
+// id3Frame is an ID3v2.3 frame, its size is not syncsafe.
+func id3Frame(id string, data ...[]byte) []byte {
+	content := bytes.Join(data, nil)
+	frame := append([]byte(id), binary.BigEndian.AppendUint32(nil, uint32(len(content)))...)
+	return append(append(frame, 0, 0), content...)
+}
+
+func id3Text(id, text string) []byte {
+	return id3Frame(id, []byte{3}, []byte(text))
+}
+
+func id3Chapter(element string, start, end time.Duration, title string) []byte {
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times, uint32(start.Milliseconds()))
+	binary.BigEndian.PutUint32(times[4:], uint32(end.Milliseconds()))
+	return id3Frame("CHAP", []byte(element+"\x00"), times, id3Text("TIT2", title))
+}
+
+// id3Tag is an ID3v2.3 tag holding the frames followed by some padding.
+func id3Tag(frames ...[]byte) []byte {
+	body := append(bytes.Join(frames, nil), make([]byte, 16)...)
+	size := len(body)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body...)
+}
+
+// newMP3 returns the tag followed by audio of length bytes starting with the first frame.
+func newMP3(tag []byte, first []byte, length int) []byte {
+	audio := make([]byte, length)
+	copy(audio, first)
+	return append(slices.Clone(tag), audio...)
+}
+
+// xingFrame is a first frame with a Xing header counting frames frames.
+func xingFrame(frames uint32) []byte {
+	frame := append(slices.Clone(mp3Frame), make([]byte, 32)...)
+	frame = append(frame, "Xing"...)
+	frame = binary.BigEndian.AppendUint32(frame, 1)
+	return binary.BigEndian.AppendUint32(frame, frames)
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    frameHeader
+		samples int
+		wantOK  bool
+	}{
+		{
+			name:    "mpeg 1 layer III",
+			header:  mp3Frame,
+			want:    frameHeader{version: 1, layer: 3, bitrate: 128_000, sampleRate: 44100},
+			samples: 1152,
+			wantOK:  true,
+		},
+		{
+			name:    "mpeg 2 layer III mono",
+			header:  []byte{0xff, 0xf3, 0x90, 0xc0},
+			want:    frameHeader{version: 2, layer: 3, bitrate: 80_000, sampleRate: 22050, mono: true},
+			samples: 576,
+			wantOK:  true,
+		},
+		{
+			name:    "mpeg 2.5 layer III",
+			header:  []byte{0xff, 0xe3, 0x10, 0x00},
+			want:    frameHeader{version: 3, layer: 3, bitrate: 8_000, sampleRate: 11025},
+			samples: 576,
+			wantOK:  true,
+		},
+		{
+			name:    "mpeg 1 layer I",
+			header:  []byte{0xff, 0xff, 0x10, 0x00},
+			want:    frameHeader{version: 1, layer: 1, bitrate: 32_000, sampleRate: 44100},
+			samples: 384,
+			wantOK:  true,
+		},
+		{name: "no sync", header: []byte{0xff, 0x7b, 0x90, 0x00}},
+		{name: "reserved version", header: []byte{0xff, 0xeb, 0x90, 0x00}},
+		{name: "reserved layer", header: []byte{0xff, 0xf9, 0x90, 0x00}},
+		{name: "free bitrate", header: []byte{0xff, 0xfb, 0x00, 0x00}},
+		{name: "bad bitrate", header: []byte{0xff, 0xfb, 0xf0, 0x00}},
+		{name: "reserved sample rate", header: []byte{0xff, 0xfb, 0x9c, 0x00}},
+		{name: "truncated", header: mp3Frame[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseFrameHeader(tt.header)
+			if ok != tt.wantOK {
+				t.Fatalf("parseFrameHeader() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("parseFrameHeader() = %+v, want %+v", got, tt.want)
+			}
+			if ok && got.samplesPerFrame() != tt.samples {
+				t.Errorf("samplesPerFrame() = %d, want %d", got.samplesPerFrame(), tt.samples)
+			}
+		})
+	}
+}
+
+func TestProbeMP3Duration(t *testing.T) {
+	vbri := append(slices.Clone(mp3Frame), make([]byte, 32)...)
+	vbri = append(vbri, "VBRI"...)
+	vbri = binary.BigEndian.AppendUint32(append(vbri, make([]byte, 10)...), 200)
+	xing := xingFrame(100)
+	tests := []struct {
+		name    string
+		content []byte
+		want    time.Duration
+	}{
+		// 16000 bytes at 128 kbit/s
+		{name: "constant bitrate", content: newMP3(nil, mp3Frame, 16000), want: time.Second},
+		{
+			name:    "constant bitrate with an ID3v1 tag",
+			content: append(newMP3(nil, mp3Frame, 16000), append([]byte("TAG"), make([]byte, id3v1Size-3)...)...),
+			want:    time.Second,
+		},
+		{name: "padding before the first frame", content: newMP3(nil, append(make([]byte, 100), mp3Frame...), 16100), want: time.Second},
+		{name: "xing", content: newMP3(nil, xing, 4000), want: 100 * 1152 * time.Second / 44100},
+		{name: "vbri", content: newMP3(nil, vbri, 4000), want: 200 * 1152 * time.Second / 44100},
+		{name: "xing wins over tlen", content: newMP3(id3Tag(id3Text("TLEN", "60000")), xing, 4000), want: 100 * 1152 * time.Second / 44100},
+		{name: "tlen", content: newMP3(id3Tag(id3Text("TLEN", "60000")), mp3Frame, 4000), want: time.Minute},
+		{name: "invalid tlen", content: newMP3(id3Tag(id3Text("TLEN", "-5")), mp3Frame, 16000), want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(entities.BookFormatMP3, bytes.NewReader(tt.content), int64(len(tt.content)))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if info.Duration != tt.want {
+				t.Errorf("Duration = %v, want %v", info.Duration, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMP3Tags(t *testing.T) {
+	tag := id3Tag(
+		id3Text("TIT2", "Track 1"),
+		id3Text("TALB", "The Book"),
+		id3Text("TPE2", "Band"),
+		id3Text("TPE1", "Author/Narrator"),
+		id3Text("TLEN", "60000"),
+		id3Chapter("ch2", 30*time.Second, time.Minute, "Chapter 1"),
+		id3Chapter("ch1", 0, 30*time.Second, "Intro"),
+		id3Chapter("ch3", 2*time.Minute, 3*time.Minute, "Past the end"),
+		// frames after a truncated one are skipped
+		id3Frame("TXXX", []byte{3})[:8],
+	)
+	content := newMP3(tag, mp3Frame, 4000)
+	info, err := Probe(entities.BookFormatMP3, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Title != "Track 1" || info.Album != "The Book" {
+		t.Errorf("Title, Album = %q, %q, want %q, %q", info.Title, info.Album, "Track 1", "The Book")
+	}
+	if want := []string{"Band", "Author", "Narrator"}; !slices.Equal(info.Artists, want) {
+		t.Errorf("Artists = %q, want %q", info.Artists, want)
+	}
+	want := []entities.AudioChapter{{Title: "Intro", Start: 0}, {Title: "Chapter 1", Start: 30 * time.Second}}
+	if !slices.Equal(info.Chapters, want) {
+		t.Errorf("Chapters = %+v, want %+v", info.Chapters, want)
+	}
+}
+
+func TestProbeMP3Invalid(t *testing.T) {
+	tag := id3Tag(id3Text("TIT2", "Track 1"))
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "empty", content: nil},
+		{name: "no frame", content: make([]byte, 4096)},
+		{name: "tag without audio", content: tag},
+		{name: "truncated tag", content: tag[:len(tag)-4]},
+		{name: "tag overflowing the file", content: newMP3([]byte("ID3\x03\x00\x00\x7f\x7f\x7f\x7f"), mp3Frame, 4000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Probe(entities.BookFormatMP3, bytes.NewReader(tt.content), int64(len(tt.content)))
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Probe() error = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "latin-1", data: []byte("\x00Caf\xe9 "), want: "Café"},
+		{name: "utf-16 little endian", data: []byte("\x01\xff\xfeA\x00\xe9\x00"), want: "Aé"},
+		{name: "utf-16 big endian", data: []byte("\x01\xfe\xff\x00A\x00\xe9"), want: "Aé"},
+		{name: "utf-16be", data: []byte("\x02\x00A\x00\xe9"), want: "Aé"},
+		{name: "utf-8", data: []byte("\x03Café\x00"), want: "Café"},
+		{name: "several values", data: []byte("\x03A\x00B\x00"), want: "A\x00B"},
+		{name: "odd utf-16", data: []byte("\x02\x00A\x00"), want: "A"},
+		{name: "empty", data: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeText(tt.data); got != tt.want {
+				t.Errorf("decodeText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
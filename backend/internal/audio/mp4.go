@@ -0,0 +1,409 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// maxMoovSize limits the metadata box read into memory. Its sample tables grow with the length of the track,
+// a day of AAC audio takes a few tens of megabytes.
+const maxMoovSize = 128 << 20
+
+// box is an MP4 box, data is its content without the header.
+type box struct {
+	typ  string
+	data []byte
+}
+
+// children splits the content of a container box into its boxes.
+func children(data []byte) ([]box, error) {
+	boxes := make([]box, 0)
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated box header", ErrInvalid)
+		}
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		typ := string(data[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: truncated box header", ErrInvalid)
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: box %q overflows its parent", ErrInvalid, typ)
+		}
+		boxes = append(boxes, box{typ: typ, data: data[header:size]})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// child returns the first box of the type among the children of data, following the path of types.
+func child(data []byte, path ...string) (box, bool) {
+	current := box{data: data}
+	for _, typ := range path {
+		boxes, err := children(current.data)
+		if err != nil {
+			return box{}, false
+		}
+		found := false
+		for _, b := range boxes {
+			if b.typ == typ {
+				current, found = b, true
+				break
+			}
+		}
+		if !found {
+			return box{}, false
+		}
+	}
+	return current, true
+}
+
+// readMoov finds the top level moov box, it can come before or after the audio.
+func readMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		typ := string(header[4:8])
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+		}
+		if boxSize < headerSize || boxSize > size-offset {
+			return nil, fmt.Errorf("%w: box %q overflows the file", ErrInvalid, typ)
+		}
+		if typ == "moov" {
+			if boxSize-headerSize > maxMoovSize {
+				return nil, fmt.Errorf("%w: moov box is too large", ErrInvalid)
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := r.ReadAt(moov, offset+headerSize); err != nil {
+				return nil, err
+			}
+			return moov, nil
+		}
+		offset += boxSize
+	}
+	return nil, fmt.Errorf("%w: no moov box", ErrInvalid)
+}
+
+func probeMP4(r io.ReaderAt, size int64) (Info, error) {
+	moov, err := readMoov(r, size)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{Artists: make([]string, 0), Chapters: make([]entities.AudioChapter, 0)}
+	if mvhd, ok := child(moov, "mvhd"); ok {
+		timescale, duration := parseTimes(mvhd.data)
+		info.Duration = scale(duration, timescale)
+	}
+	if udta, ok := child(moov, "udta"); ok {
+		readTags(udta.data, &info)
+		if chpl, ok := child(udta.data, "chpl"); ok {
+			info.Chapters = parseCHPL(chpl.data)
+		}
+	}
+	// the chapter track of QuickTime is preferred to the Nero chapters when a file has both,
+	// it is what Apple players show
+	if chapters, err := readChapterTrack(r, moov); err == nil && len(chapters) > 0 {
+		info.Chapters = chapters
+	}
+	return info, nil
+}
+
+// parseTimes reads the timescale and the duration of a mvhd or mdhd box.
+func parseTimes(data []byte) (uint32, uint64) {
+	if len(data) < 4 {
+		return 0, 0
+	}
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0
+		}
+		return binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint64(data[24:])
+	}
+	if len(data) < 20 {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint32(data[12:]), uint64(binary.BigEndian.Uint32(data[16:]))
+}
+
+// scale converts a value in units of the timescale, values too large for a time.Duration are unknown like 0.
+func scale(value uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	seconds, rest := value/uint64(timescale), value%uint64(timescale)
+	if seconds >= uint64(math.MaxInt64/time.Second) {
+		return 0
+	}
+	return time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(timescale)
+}
+
+// parseCHPL reads the Nero chapter list, its start times are in units of 100 nanoseconds.
+func parseCHPL(data []byte) []entities.AudioChapter {
+	chapters := make([]entities.AudioChapter, 0)
+	if len(data) < 5 {
+		return chapters
+	}
+	pos := 4
+	if data[0] == 1 {
+		pos += 4
+	}
+	if pos >= len(data) {
+		return chapters
+	}
+	count := int(data[pos])
+	pos++
+	for range count {
+		if pos+9 > len(data) {
+			break
+		}
+		start := binary.BigEndian.Uint64(data[pos:])
+		length := int(data[pos+8])
+		pos += 9
+		if pos+length > len(data) {
+			break
+		}
+		chapters = append(chapters, entities.AudioChapter{
+			Title: strings.TrimSpace(string(data[pos : pos+length])),
+			Start: time.Duration(start * 100),
+		})
+		pos += length
+	}
+	return chapters
+}
+
+// readTags reads the iTunes tags of udta/meta/ilst.
+func readTags(udta []byte, info *Info) {
+	meta, ok := child(udta, "meta")
+	if !ok {
+		return
+	}
+	data := meta.data
+	// meta is a full box in iTunes files and a plain one in QuickTime files
+	if len(data) >= 8 && string(data[4:8]) != "hdlr" {
+		data = data[4:]
+	}
+	ilst, ok := child(data, "ilst")
+	if !ok {
+		return
+	}
+	items, err := children(ilst.data)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		value, ok := child(item.data, "data")
+		// the value follows its type and locale
+		if !ok || len(value.data) < 8 {
+			continue
+		}
+		text := strings.TrimSpace(string(value.data[8:]))
+		switch item.typ {
+		case "\xa9nam":
+			info.Title = text
+		case "\xa9alb":
+			info.Album = text
+		case "\xa9ART", "aART":
+			info.addArtists(text)
+		}
+	}
+}
+
+// track is a trak box with the parts needed to read the chapter track.
+type track struct {
+	id       uint32
+	chapters []uint32
+	data     []byte
+}
+
+// readChapterTrack reads the QuickTime chapters: a text track referenced by the chap reference of the audio track,
+// each of its samples is the title of a chapter starting at the time of the sample.
+func readChapterTrack(r io.ReaderAt, moov []byte) ([]entities.AudioChapter, error) {
+	boxes, err := children(moov)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make(map[uint32]track)
+	var chapterIDs []uint32
+	for _, b := range boxes {
+		if b.typ != "trak" {
+			continue
+		}
+		t := track{data: b.data}
+		if tkhd, ok := child(b.data, "tkhd"); ok && len(tkhd.data) >= 24 {
+			if tkhd.data[0] == 1 {
+				t.id = binary.BigEndian.Uint32(tkhd.data[20:])
+			} else {
+				t.id = binary.BigEndian.Uint32(tkhd.data[12:])
+			}
+		}
+		if chap, ok := child(b.data, "tref", "chap"); ok {
+			for i := 0; i+4 <= len(chap.data); i += 4 {
+				t.chapters = append(t.chapters, binary.BigEndian.Uint32(chap.data[i:]))
+			}
+			chapterIDs = append(chapterIDs, t.chapters...)
+		}
+		tracks[t.id] = t
+	}
+	for _, id := range chapterIDs {
+		if t, ok := tracks[id]; ok {
+			return readTextSamples(r, t.data)
+		}
+	}
+	return nil, nil
+}
+
+func readTextSamples(r io.ReaderAt, trak []byte) ([]entities.AudioChapter, error) {
+	mdhd, ok := child(trak, "mdia", "mdhd")
+	if !ok {
+		return nil, fmt.Errorf("%w: chapter track has no mdhd box", ErrInvalid)
+	}
+	timescale, _ := parseTimes(mdhd.data)
+	stbl, ok := child(trak, "mdia", "minf", "stbl")
+	if !ok {
+		return nil, fmt.Errorf("%w: chapter track has no sample table", ErrInvalid)
+	}
+	offsets, sizes, err := sampleOffsets(stbl.data)
+	if err != nil {
+		return nil, err
+	}
+	starts := sampleStarts(stbl.data, len(offsets))
+	chapters := make([]entities.AudioChapter, 0, len(offsets))
+	for i := range min(len(offsets), len(starts), maxChapters) {
+		title, err := readTextSample(r, offsets[i], sizes[i])
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, entities.AudioChapter{Title: title, Start: scale(starts[i], timescale)})
+	}
+	return chapters, nil
+}
+
+// readTextSample reads a QuickTime text sample: the length of the text followed by the text in UTF-8 or UTF-16.
+func readTextSample(r io.ReaderAt, offset int64, size uint32) (string, error) {
+	if size < 2 {
+		return "", nil
+	}
+	sample := make([]byte, min(size, 1024))
+	if _, err := r.ReadAt(sample, offset); err != nil {
+		return "", err
+	}
+	length := min(int(binary.BigEndian.Uint16(sample)), len(sample)-2)
+	text := sample[2 : 2+length]
+	if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+		units := make([]uint16, 0, len(text)/2)
+		for i := 2; i+1 < len(text); i += 2 {
+			units = append(units, binary.BigEndian.Uint16(text[i:]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(units))), nil
+	}
+	return strings.TrimSpace(string(text)), nil
+}
+
+// sampleOffsets computes the file offsets and the sizes of the samples from the sample to chunk,
+// chunk offset and sample size tables.
+func sampleOffsets(stbl []byte) ([]int64, []uint32, error) {
+	chunkOffsets := make([]int64, 0)
+	if stco, ok := child(stbl, "stco"); ok {
+		for _, v := range tableEntries(stco.data, 4) {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(v)))
+		}
+	} else if co64, ok := child(stbl, "co64"); ok {
+		for _, v := range tableEntries(co64.data, 8) {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(v)))
+		}
+	}
+	stsz, ok := child(stbl, "stsz")
+	if !ok || len(stsz.data) < 12 {
+		return nil, nil, fmt.Errorf("%w: no sample size table", ErrInvalid)
+	}
+	fixedSize := binary.BigEndian.Uint32(stsz.data[4:])
+	count := min(int(binary.BigEndian.Uint32(stsz.data[8:])), maxChapters)
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		sizes[i] = fixedSize
+		if fixedSize == 0 && 12+4*i+4 <= len(stsz.data) {
+			sizes[i] = binary.BigEndian.Uint32(stsz.data[12+4*i:])
+		}
+	}
+	stsc, ok := child(stbl, "stsc")
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no sample to chunk table", ErrInvalid)
+	}
+	runs := tableEntries(stsc.data, 12)
+	offsets := make([]int64, 0, count)
+	for chunk := range chunkOffsets {
+		perChunk := uint32(0)
+		for _, run := range runs {
+			if int(binary.BigEndian.Uint32(run))-1 > chunk {
+				break
+			}
+			perChunk = binary.BigEndian.Uint32(run[4:])
+		}
+		offset := chunkOffsets[chunk]
+		for range perChunk {
+			if len(offsets) == count {
+				return offsets, sizes, nil
+			}
+			offsets = append(offsets, offset)
+			offset += int64(sizes[len(offsets)-1])
+		}
+	}
+	return offsets, sizes[:len(offsets)], nil
+}
+
+// sampleStarts computes the start times of the samples from the time to sample table.
+func sampleStarts(stbl []byte, count int) []uint64 {
+	starts := make([]uint64, 0, count)
+	stts, ok := child(stbl, "stts")
+	if !ok {
+		return starts
+	}
+	var t uint64
+	for _, run := range tableEntries(stts.data, 8) {
+		samples, delta := binary.BigEndian.Uint32(run), binary.BigEndian.Uint32(run[4:])
+		for range samples {
+			if len(starts) == count {
+				return starts
+			}
+			starts = append(starts, t)
+			t += uint64(delta)
+		}
+	}
+	return starts
+}
+
+// tableEntries splits the entries of a full box that holds a table with an entry count.
+func tableEntries(data []byte, entrySize int) [][]byte {
+	if len(data) < 8 {
+		return nil
+	}
+	count := min(int(binary.BigEndian.Uint32(data[4:])), (len(data)-8)/entrySize)
+	entries := make([][]byte, count)
+	for i := range entries {
+		entries[i] = data[8+i*entrySize : 8+(i+1)*entrySize]
+	}
+	return entries
+}
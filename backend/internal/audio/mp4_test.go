@@ -0,0 +1,341 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+func mp4Box(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(data)))
+	copy(header[4:], typ)
+	return append(header, data...)
+}
+
+// mp4LargeBox writes the size of the box in the 64-bit field that follows the type.
+func mp4LargeBox(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint32(header, 1)
+	copy(header[4:], typ)
+	binary.BigEndian.PutUint64(header[8:], uint64(16+len(data)))
+	return append(header, data...)
+}
+
+// mp4Table is the content of a full box holding a table of 32-bit entries.
+func mp4Table(entries ...uint32) []byte {
+	data := make([]byte, 8+4*len(entries))
+	binary.BigEndian.PutUint32(data[4:], uint32(len(entries)))
+	for i, entry := range entries {
+		binary.BigEndian.PutUint32(data[8+4*i:], entry)
+	}
+	return data
+}
+
+// oversizedCount makes the table claim the largest possible number of entries.
+func oversizedCount(table []byte) []byte {
+	binary.BigEndian.PutUint32(table[4:], 0xffffffff)
+	return table
+}
+
+// mp4Sizes is the content of a stsz box, sizes are only listed when the samples have no fixed size.
+func mp4Sizes(fixed uint32, count uint32, sizes ...uint32) []byte {
+	data := make([]byte, 12, 12+4*len(sizes))
+	binary.BigEndian.PutUint32(data[4:], fixed)
+	binary.BigEndian.PutUint32(data[8:], count)
+	for _, size := range sizes {
+		data = binary.BigEndian.AppendUint32(data, size)
+	}
+	return data
+}
+
+// mp4Times is the content of a version 0 mvhd or mdhd box.
+func mp4Times(timescale, duration uint32) []byte {
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint32(data[12:], timescale)
+	binary.BigEndian.PutUint32(data[16:], duration)
+	return data
+}
+
+func mp4Track(id uint32, content ...[]byte) []byte {
+	tkhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(tkhd[12:], id)
+	return mp4Box("trak", append([][]byte{mp4Box("tkhd", tkhd)}, content...)...)
+}
+
+func mp4Tag(typ, value string) []byte {
+	return mp4Box(typ, mp4Box("data", make([]byte, 8), []byte(value)))
+}
+
+// newM4B returns a track of 90 seconds with iTunes tags, Nero chapters and a QuickTime chapter track.
+// The titles of the chapter track are stored in mdat right after ftyp.
+func newM4B() []byte {
+	ftyp := mp4Box("ftyp", []byte("M4B "), make([]byte, 4), []byte("isom"))
+	samples := [][]byte{[]byte("\x00\x05Intro"), []byte("\x00\x09Chapter 1"), []byte("\x00\x04Late")}
+	mdat := mp4Box("mdat", bytes.Join(samples, nil))
+	offset := uint32(len(ftyp) + 8)
+	sizes := make([]uint32, len(samples))
+	for i, sample := range samples {
+		sizes[i] = uint32(len(sample))
+	}
+	// one chunk of two samples followed by a chunk of one
+	stco := mp4Box("stco", mp4Table(offset, offset+sizes[0]+sizes[1]))
+	stsc := mp4Box("stsc", mp4Table(1, 2, 1, 2, 1, 1))
+	stsz := mp4Box("stsz", mp4Sizes(0, uint32(len(sizes)), sizes...))
+	// samples last 30, 90 and 1 seconds, so the last chapter starts past the end of the track
+	stts := mp4Box("stts", mp4Table(1, 30_000, 1, 90_000, 1, 1_000))
+	textTrack := mp4Track(2, mp4Box("mdia",
+		mp4Box("mdhd", mp4Times(1000, 90_000)),
+		mp4Box("minf", mp4Box("stbl", stts, stsc, stsz, stco)),
+	))
+	audioTrack := mp4Track(1, mp4Box("tref", mp4Box("chap", binary.BigEndian.AppendUint32(nil, 2))))
+
+	chpl := []byte{1, 0, 0, 0, 0, 0, 0, 0, 1}
+	chpl = binary.BigEndian.AppendUint64(chpl, 0)
+	chpl = append(chpl, byte(len("Nero")))
+	chpl = append(chpl, "Nero"...)
+	udta := mp4Box("udta",
+		mp4Box("meta", make([]byte, 4), mp4Box("ilst",
+			mp4Tag("\xa9nam", "Track 1"),
+			mp4Tag("\xa9alb", "The Book"),
+			mp4Tag("\xa9ART", "Author, Narrator"),
+		)),
+		mp4Box("chpl", chpl),
+	)
+	moov := mp4Box("moov", mp4Box("mvhd", mp4Times(1000, 90_000)), audioTrack, textTrack, udta)
+	return slices.Concat(ftyp, mdat, moov)
+}
+
+func TestChildren(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []box
+		wantErr bool
+	}{
+		{name: "empty", data: nil, want: []box{}},
+		{
+			name: "boxes",
+			data: slices.Concat(mp4Box("free"), mp4Box("mvhd", []byte("abcd"))),
+			want: []box{{typ: "free", data: []byte{}}, {typ: "mvhd", data: []byte("abcd")}},
+		},
+		{
+			name: "64-bit size",
+			data: slices.Concat(mp4LargeBox("mdat", []byte("audio")), mp4Box("free")),
+			want: []box{{typ: "mdat", data: []byte("audio")}, {typ: "free", data: []byte{}}},
+		},
+		{
+			name: "zero size extends to the end",
+			data: slices.Concat(mp4Box("free"), []byte("\x00\x00\x00\x00mdat"), []byte("audio")),
+			want: []box{{typ: "free", data: []byte{}}, {typ: "mdat", data: []byte("audio")}},
+		},
+		{name: "truncated header", data: slices.Concat(mp4Box("free"), []byte("\x00\x00\x00")), wantErr: true},
+		{name: "truncated 64-bit header", data: mp4LargeBox("mdat")[:12], wantErr: true},
+		{name: "size smaller than the header", data: []byte("\x00\x00\x00\x04free"), wantErr: true},
+		{name: "64-bit size smaller than the header", data: []byte("\x00\x00\x00\x01mdat\x00\x00\x00\x00\x00\x00\x00\x08"), wantErr: true},
+		{name: "size overflowing the parent", data: mp4Box("mvhd", []byte("abcd"))[:10], wantErr: true},
+		{name: "64-bit size overflowing the parent", data: []byte("\x00\x00\x00\x01mdat\xff\xff\xff\xff\xff\xff\xff\xff"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := children(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("children() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("children() error = %v, want %v", err, ErrInvalid)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b box) bool { return a.typ == b.typ && bytes.Equal(a.data, b.data) }) {
+				t.Errorf("children() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// sparseReader reads the content and zeros past it up to size, to stand in for large files.
+type sparseReader struct {
+	content []byte
+	size    int64
+}
+
+func (r sparseReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	clear(p)
+	if off < int64(len(r.content)) {
+		copy(p, r.content[off:])
+	}
+	if n := r.size - off; int64(len(p)) > n {
+		return int(n), io.EOF
+	}
+	return len(p), nil
+}
+
+func TestReadMoov(t *testing.T) {
+	moov := mp4Box("moov", mp4Box("mvhd", mp4Times(1000, 90_000)))
+	largeMoov := binary.BigEndian.AppendUint64([]byte("\x00\x00\x00\x01moov"), maxMoovSize+32)
+	tests := []struct {
+		name    string
+		content []byte
+		// size is the size of the file when it is larger than the content
+		size    int64
+		want    []byte
+		wantErr bool
+	}{
+		{name: "moov first", content: slices.Concat(moov, mp4Box("mdat", []byte("audio"))), want: moov[8:]},
+		{name: "moov after the audio", content: slices.Concat(mp4Box("ftyp", []byte("M4B ")), mp4Box("mdat", []byte("audio")), moov), want: moov[8:]},
+		{name: "moov after a 64-bit box", content: slices.Concat(mp4LargeBox("mdat", []byte("audio")), moov), want: moov[8:]},
+		{name: "64-bit moov", content: mp4LargeBox("moov", moov[8:]), want: moov[8:]},
+		{name: "moov up to the end", content: slices.Concat([]byte("\x00\x00\x00\x00moov"), moov[8:]), want: moov[8:]},
+		{name: "no moov", content: slices.Concat(mp4Box("ftyp", []byte("M4B ")), mp4Box("mdat")), wantErr: true},
+		{name: "truncated moov", content: moov[:len(moov)-4], wantErr: true},
+		{name: "box overflowing the file", content: slices.Concat(mp4Box("mdat", make([]byte, 64))[:32], moov), wantErr: true},
+		{name: "64-bit size overflowing the file", content: slices.Concat([]byte("\x00\x00\x00\x01mdat\x7f\xff\xff\xff\xff\xff\xff\xff"), moov), wantErr: true},
+		{name: "negative 64-bit size", content: slices.Concat([]byte("\x00\x00\x00\x01mdat\xff\xff\xff\xff\xff\xff\xff\xf0"), moov), wantErr: true},
+		{name: "moov larger than the limit", content: largeMoov, size: maxMoovSize + 32, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := max(tt.size, int64(len(tt.content)))
+			got, err := readMoov(sparseReader{content: tt.content, size: size}, size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readMoov() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("readMoov() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleOffsets(t *testing.T) {
+	// chunks 1 and 2 hold two samples each, chunk 3 holds one
+	stsc := mp4Box("stsc", mp4Table(1, 2, 1, 3, 1, 1))
+	stco := mp4Box("stco", mp4Table(100, 200, 300))
+	stsz := mp4Box("stsz", mp4Sizes(0, 5, 10, 20, 30, 40, 50))
+	co64 := mp4Box("co64", []byte{0, 0, 0, 0, 0, 0, 0, 1}, binary.BigEndian.AppendUint64(nil, 1<<40))
+	tests := []struct {
+		name        string
+		stbl        []byte
+		wantOffsets []int64
+		wantSizes   []uint32
+		wantErr     bool
+	}{
+		{
+			name:        "chunks",
+			stbl:        slices.Concat(stsc, stco, stsz),
+			wantOffsets: []int64{100, 110, 200, 230, 300},
+			wantSizes:   []uint32{10, 20, 30, 40, 50},
+		},
+		{
+			name:        "fixed sample size",
+			stbl:        slices.Concat(stsc, stco, mp4Box("stsz", mp4Sizes(8, 4))),
+			wantOffsets: []int64{100, 108, 200, 208},
+			wantSizes:   []uint32{8, 8, 8, 8},
+		},
+		{
+			name:        "64-bit chunk offsets",
+			stbl:        slices.Concat(mp4Box("stsc", mp4Table(1, 1, 1, 1)), co64, mp4Box("stsz", mp4Sizes(0, 1, 7))),
+			wantOffsets: []int64{1 << 40},
+			wantSizes:   []uint32{7},
+		},
+		{
+			name:        "fewer chunks than samples",
+			stbl:        slices.Concat(mp4Box("stsc", mp4Table(1, 1, 1, 1)), mp4Box("stco", mp4Table(100, 200)), stsz),
+			wantOffsets: []int64{100, 200},
+			wantSizes:   []uint32{10, 20},
+		},
+		{
+			// the counts claim more entries than the boxes hold, stsz claims more samples than chapters are read
+			name: "oversized tables",
+			stbl: slices.Concat(
+				mp4Box("stsc", oversizedCount(mp4Table(1, 0xffffffff, 1))),
+				mp4Box("stco", oversizedCount(mp4Table(100))),
+				mp4Box("stsz", mp4Sizes(0, 0xffffffff)),
+			),
+			wantOffsets: slices.Repeat([]int64{100}, maxChapters),
+			wantSizes:   make([]uint32, maxChapters),
+		},
+		{name: "no sample sizes", stbl: slices.Concat(stsc, stco), wantErr: true},
+		{name: "truncated sample sizes", stbl: slices.Concat(stsc, stco, mp4Box("stsz", make([]byte, 8))), wantErr: true},
+		{name: "no sample to chunk table", stbl: slices.Concat(stco, stsz), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offsets, sizes, err := sampleOffsets(tt.stbl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sampleOffsets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(offsets, tt.wantOffsets) {
+				t.Errorf("sampleOffsets() offsets = %v, want %v", offsets, tt.wantOffsets)
+			}
+			if !slices.Equal(sizes, tt.wantSizes) {
+				t.Errorf("sampleOffsets() sizes = %v, want %v", sizes, tt.wantSizes)
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     uint64
+		timescale uint32
+		want      time.Duration
+	}{
+		{name: "seconds", value: 90_000, timescale: 1000, want: 90 * time.Second},
+		{name: "fraction", value: 1, timescale: 3, want: time.Second / 3},
+		{name: "no timescale", value: 90_000, timescale: 0, want: 0},
+		{name: "longest", value: uint64(math.MaxInt64/time.Second) - 1, timescale: 1, want: (math.MaxInt64/time.Second - 1) * time.Second},
+		{name: "too long", value: math.MaxUint64, timescale: 1000, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scale(tt.value, tt.timescale); got != tt.want {
+				t.Errorf("scale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMP4(t *testing.T) {
+	content := newM4B()
+	info, err := Probe(entities.BookFormatM4B, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Duration != 90*time.Second {
+		t.Errorf("Duration = %v, want %v", info.Duration, 90*time.Second)
+	}
+	if info.Title != "Track 1" || info.Album != "The Book" {
+		t.Errorf("Title, Album = %q, %q, want %q, %q", info.Title, info.Album, "Track 1", "The Book")
+	}
+	if want := []string{"Author", "Narrator"}; !slices.Equal(info.Artists, want) {
+		t.Errorf("Artists = %q, want %q", info.Artists, want)
+	}
+	// the chapter track wins over the Nero chapters, the chapter past the end is dropped
+	want := []entities.AudioChapter{{Title: "Intro", Start: 0}, {Title: "Chapter 1", Start: 30 * time.Second}}
+	if !slices.Equal(info.Chapters, want) {
+		t.Errorf("Chapters = %+v, want %+v", info.Chapters, want)
+	}
+}
+
+func TestProbeMP4Truncated(t *testing.T) {
+	content := newM4B()
+	for _, size := range []int{0, 7, 20, len(content) / 2, len(content) - 1} {
+		_, err := Probe(entities.BookFormatM4B, bytes.NewReader(content[:size]), int64(size))
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Probe() of %d bytes error = %v, want %v", size, err, ErrInvalid)
+		}
+	}
+}
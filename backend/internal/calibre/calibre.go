@@ -0,0 +1,239 @@
+// Package calibre reads Calibre libraries: the metadata.db SQLite database and the author/title folder tree,
+// and writes books in the same folder tree with metadata.opf sidecars.
+package calibre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	metadataFile = "metadata.db"
+	// CoverFile and OPFFile are the names of the sidecar files in the folder of a book.
+	CoverFile = "cover.jpg"
+	OPFFile   = "metadata.opf"
+)
+
+var (
+	ErrNotALibrary = errors.New("directory is not a calibre library")
+)
+
+// Book is a book of a Calibre library.
+type Book struct {
+	ID            int64
+	Title         string
+	Authors       []string
+	Series        string
+	SeriesIndex   *float64
+	Tags          []string
+	Identifiers   map[string]string
+	Rating        *int
+	Publisher     string
+	PublishedDate *time.Time
+	Language      string
+	Description   string
+	// Files maps lower case formats such as "epub" to the file paths relative to the library directory.
+	Files map[string]string
+	// CoverPath is relative to the library directory, empty when the book has no cover.
+	CoverPath string
+}
+
+// Calibre stores ratings as half stars from 0 to 10, Book.Rating counts whole stars from 1 to 5.
+func starsFromRating(rating int) int {
+	return min((rating+1)/2, 5)
+}
+
+func ratingFromStars(stars int) int {
+	return stars * 2
+}
+
+// Library is an open Calibre library. The database is opened read-only.
+type Library struct {
+	dir string
+	db  *sql.DB
+}
+
+func Open(dir string) (*Library, error) {
+	dbPath := filepath.Join(dir, metadataFile)
+	if info, err := os.Stat(dbPath); err != nil || !info.Mode().IsRegular() {
+		return nil, ErrNotALibrary
+	}
+	dsn := url.URL{Scheme: "file", Path: dbPath, RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %w", ErrNotALibrary, err)
+	}
+	return &Library{dir: dir, db: db}, nil
+}
+
+func (l *Library) Close() error {
+	return l.db.Close()
+}
+
+// Path returns the absolute path of a file of the library.
+func (l *Library) Path(relative string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(relative))
+}
+
+// Books returns all books of the library ordered by their Calibre id.
+func (l *Library) Books(ctx context.Context) ([]Book, error) {
+	books, err := l.books(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*Book, len(books))
+	for i := range books {
+		byID[books[i].ID] = &books[i]
+	}
+	err = l.eachRow(ctx, `
+SELECT l.book, a.name
+FROM books_authors_link l JOIN authors a ON a.id = l.author
+ORDER BY l.book, l.id`, func(book *Book, values []string) {
+		// calibre stores commas in author names as pipes
+		book.Authors = append(book.Authors, strings.ReplaceAll(values[0], "|", ","))
+	}, byID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read authors: %w", err)
+	}
+	err = l.eachRow(ctx, `
+SELECT l.book, t.name
+FROM books_tags_link l JOIN tags t ON t.id = l.tag
+ORDER BY l.book, t.name`, func(book *Book, values []string) {
+		book.Tags = append(book.Tags, values[0])
+	}, byID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tags: %w", err)
+	}
+	err = l.eachRow(ctx, `SELECT book, type, val FROM identifiers`, func(book *Book, values []string) {
+		book.Identifiers[values[0]] = values[1]
+	}, byID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read identifiers: %w", err)
+	}
+	err = l.eachRow(ctx, `SELECT d.book, d.format, d.name, b.path FROM data d JOIN books b ON b.id = d.book`, func(book *Book, values []string) {
+		format := strings.ToLower(values[0])
+		name := values[1] + "." + format
+		// names come from the database, files outside of the library are ignored
+		if isLocal(values[2]) && path.Base(name) == name {
+			book.Files[format] = path.Join(values[2], name)
+		}
+	}, byID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read formats: %w", err)
+	}
+	return books, nil
+}
+
+func (l *Library) books(ctx context.Context) ([]Book, error) {
+	rows, err := l.db.QueryContext(ctx, `
+SELECT b.id, b.title, b.path, b.has_cover, b.series_index, COALESCE(strftime('%Y-%m-%d', b.pubdate), ''),
+	COALESCE((SELECT s.name FROM books_series_link l JOIN series s ON s.id = l.series WHERE l.book = b.id), ''),
+	COALESCE((SELECT p.name FROM books_publishers_link l JOIN publishers p ON p.id = l.publisher WHERE l.book = b.id), ''),
+	COALESCE((SELECT r.rating FROM books_ratings_link l JOIN ratings r ON r.id = l.rating WHERE l.book = b.id), 0),
+	COALESCE((SELECT g.lang_code FROM books_languages_link l JOIN languages g ON g.id = l.lang_code
+		WHERE l.book = b.id ORDER BY l.item_order LIMIT 1), ''),
+	COALESCE((SELECT c.text FROM comments c WHERE c.book = b.id), ''),
+	COALESCE(b.isbn, '')
+FROM books b
+ORDER BY b.id`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read books: %w", err)
+	}
+	defer rows.Close()
+	books := make([]Book, 0)
+	for rows.Next() {
+		var (
+			book        Book
+			bookPath    string
+			hasCover    bool
+			seriesIndex float64
+			pubdate     string
+			rating      int
+			comment     string
+			isbn        string
+		)
+		err := rows.Scan(
+			&book.ID, &book.Title, &bookPath, &hasCover, &seriesIndex, &pubdate,
+			&book.Series, &book.Publisher, &rating, &book.Language, &comment, &isbn,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read books: %w", err)
+		}
+		book.Identifiers = make(map[string]string)
+		book.Files = make(map[string]string)
+		if isbn != "" {
+			book.Identifiers["isbn"] = isbn
+		}
+		if book.Series != "" {
+			book.SeriesIndex = &seriesIndex
+		}
+		book.PublishedDate = parsePubdate(pubdate)
+		if rating > 0 {
+			stars := starsFromRating(rating)
+			book.Rating = &stars
+		}
+		book.Description = htmlToText(comment)
+		if hasCover && isLocal(bookPath) {
+			book.CoverPath = path.Join(bookPath, CoverFile)
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// eachRow calls fn with the columns following the book id of every row that belongs to a known book.
+func (l *Library) eachRow(ctx context.Context, query string, fn func(book *Book, values []string), books map[int64]*Book) error {
+	rows, err := l.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	var bookID int64
+	values := make([]string, len(columns)-1)
+	dest := make([]any, len(columns))
+	dest[0] = &bookID
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if book, ok := books[bookID]; ok {
+			fn(book, values)
+		}
+	}
+	return rows.Err()
+}
+
+// isLocal reports whether the slash separated path stays within the library directory.
+func isLocal(relative string) bool {
+	return filepath.IsLocal(filepath.FromSlash(relative))
+}
+
+// parsePubdate returns nil for the placeholder date calibre uses for unknown dates.
+func parsePubdate(value string) *time.Time {
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil || date.Year() <= 101 {
+		return nil
+	}
+	return &date
+}
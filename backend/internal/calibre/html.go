@@ -0,0 +1,41 @@
+package calibre
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	blockEndRe  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6])>`)
+	tagRe       = regexp.MustCompile(`<[^>]*>`)
+	blankLineRe = regexp.MustCompile(`\n\s*\n\s*`)
+)
+
+// htmlToText converts calibre comments, which are HTML, to plain text with a paragraph per line.
+func htmlToText(value string) string {
+	value = blockEndRe.ReplaceAllString(value, "\n")
+	value = tagRe.ReplaceAllString(value, "")
+	value = html.UnescapeString(value)
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	value = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLineRe.ReplaceAllString(value, "\n"))
+}
+
+// textToHTML converts plain text to calibre comments with a paragraph per line.
+func textToHTML(value string) string {
+	var builder strings.Builder
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		builder.WriteString("<p>")
+		builder.WriteString(html.EscapeString(line))
+		builder.WriteString("</p>")
+	}
+	return builder.String()
+}
@@ -0,0 +1,163 @@
+package calibre
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pathLimit is the maximum length of the author and title parts of book folders and file names in runes.
+const pathLimit = 100
+
+type opfPackage struct {
+	XMLName          xml.Name    `xml:"package"`
+	Namespace        string      `xml:"xmlns,attr"`
+	Version          string      `xml:"version,attr"`
+	UniqueIdentifier string      `xml:"unique-identifier,attr"`
+	Metadata         opfMetadata `xml:"metadata"`
+	Guide            *opfGuide   `xml:"guide"`
+}
+
+type opfMetadata struct {
+	DCNamespace  string          `xml:"xmlns:dc,attr"`
+	OPFNamespace string          `xml:"xmlns:opf,attr"`
+	Identifiers  []opfIdentifier `xml:"dc:identifier"`
+	Title        string          `xml:"dc:title"`
+	Creators     []opfCreator    `xml:"dc:creator"`
+	Date         string          `xml:"dc:date,omitempty"`
+	Description  string          `xml:"dc:description,omitempty"`
+	Publisher    string          `xml:"dc:publisher,omitempty"`
+	Language     string          `xml:"dc:language,omitempty"`
+	Subjects     []string        `xml:"dc:subject"`
+	Meta         []opfMeta       `xml:"meta"`
+}
+
+type opfIdentifier struct {
+	ID     string `xml:"id,attr,omitempty"`
+	Scheme string `xml:"opf:scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type opfCreator struct {
+	Role  string `xml:"opf:role,attr"`
+	Value string `xml:",chardata"`
+}
+
+type opfMeta struct {
+	Name    string `xml:"name,attr"`
+	Content string `xml:"content,attr"`
+}
+
+type opfGuide struct {
+	References []opfReference `xml:"reference"`
+}
+
+type opfReference struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
+}
+
+// WriteOPF writes the metadata of the book as a Calibre metadata.opf file.
+// The cover is referenced when the book has a CoverPath, it is expected next to the OPF file.
+func WriteOPF(w io.Writer, book Book) error {
+	metadata := opfMetadata{
+		DCNamespace:  "http://purl.org/dc/elements/1.1/",
+		OPFNamespace: "http://www.idpf.org/2007/opf",
+		Identifiers: []opfIdentifier{
+			{ID: "calibre_id", Scheme: "calibre", Value: strconv.FormatInt(book.ID, 10)},
+		},
+		Title:       book.Title,
+		Description: textToHTML(book.Description),
+		Publisher:   book.Publisher,
+		Language:    book.Language,
+		Subjects:    book.Tags,
+	}
+	for _, scheme := range slices.Sorted(maps.Keys(book.Identifiers)) {
+		metadata.Identifiers = append(metadata.Identifiers, opfIdentifier{
+			Scheme: strings.ToUpper(scheme),
+			Value:  book.Identifiers[scheme],
+		})
+	}
+	for _, author := range book.Authors {
+		metadata.Creators = append(metadata.Creators, opfCreator{Role: "aut", Value: author})
+	}
+	if book.PublishedDate != nil {
+		metadata.Date = book.PublishedDate.UTC().Format("2006-01-02T15:04:05+00:00")
+	}
+	if book.Series != "" {
+		metadata.Meta = append(metadata.Meta, opfMeta{Name: "calibre:series", Content: book.Series})
+		if book.SeriesIndex != nil {
+			index := strconv.FormatFloat(*book.SeriesIndex, 'f', -1, 64)
+			metadata.Meta = append(metadata.Meta, opfMeta{Name: "calibre:series_index", Content: index})
+		}
+	}
+	if book.Rating != nil {
+		metadata.Meta = append(metadata.Meta, opfMeta{Name: "calibre:rating", Content: strconv.Itoa(ratingFromStars(*book.Rating))})
+	}
+	pkg := opfPackage{
+		Namespace:        "http://www.idpf.org/2007/opf",
+		Version:          "2.0",
+		UniqueIdentifier: "calibre_id",
+		Metadata:         metadata,
+	}
+	if book.CoverPath != "" {
+		pkg.Guide = &opfGuide{References: []opfReference{{Type: "cover", Title: "Cover", Href: CoverFile}}}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "    ")
+	if err := encoder.Encode(pkg); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// BookDir returns the slash separated folder of the book in a Calibre library: "Author/Title (id)".
+func BookDir(book Book) string {
+	return path.Join(sanitizeName(firstAuthor(book)), fmt.Sprintf("%s (%d)", sanitizeName(book.Title), book.ID))
+}
+
+// FileName returns the name of the book file in its folder: "Title - Author.format".
+// The extension is left out when the format is empty.
+func FileName(book Book, format string) string {
+	name := fmt.Sprintf("%s - %s", sanitizeName(book.Title), sanitizeName(firstAuthor(book)))
+	if format == "" {
+		return name
+	}
+	return name + "." + format
+}
+
+func firstAuthor(book Book) string {
+	if len(book.Authors) == 0 {
+		return ""
+	}
+	return book.Authors[0]
+}
+
+// sanitizeName makes the value safe to use as a file name on common file systems, the way calibre does.
+func sanitizeName(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, value)
+	if runes := []rune(value); len(runes) > pathLimit {
+		value = string(runes[:pathLimit])
+	}
+	value = strings.Trim(value, " .")
+	if value == "" {
+		return "Unknown"
+	}
+	return value
+}
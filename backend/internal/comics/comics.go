@@ -0,0 +1,187 @@
+// Package comics reads the pages and the ComicInfo.xml metadata of comic book archives:
+// CBZ (zip), CBR (rar) and CB7 (7z).
+package comics
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/natsort"
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+const (
+	comicInfoName = "comicinfo.xml"
+	// maxComicInfoSize limits how much of ComicInfo.xml is read, it is a few kilobytes in practice.
+	maxComicInfoSize = 1 << 20
+)
+
+var (
+	ErrNotComic     = errors.New("not a comic book archive")
+	ErrInvalid      = errors.New("invalid comic book archive")
+	ErrPageNotFound = errors.New("page not found")
+)
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".avif"}
+
+// Page is an image in the archive. Name is the path of the image inside the archive.
+type Page struct {
+	Name string
+	Size int64
+}
+
+// Index lists the pages of an archive in reading order. Info is nil when the archive has no ComicInfo.xml.
+type Index struct {
+	Pages []Page
+	Info  *Info
+}
+
+// IsComic reports whether books in the format are comic book archives.
+func IsComic(format entities.BookFormat) bool {
+	switch format {
+	case entities.BookFormatCBZ, entities.BookFormatCBR, entities.BookFormatCB7:
+		return true
+	}
+	return false
+}
+
+// entry is a file of an archive of any kind.
+type entry struct {
+	name string
+	size int64
+	dir  bool
+	open func() (io.ReadCloser, error)
+}
+
+// ReadIndex lists the pages of the archive and reads its ComicInfo.xml. RAR archives are read from start to end.
+func ReadIndex(format entities.BookFormat, r io.ReaderAt, size int64) (Index, error) {
+	index := Index{Pages: make([]Page, 0)}
+	visit := func(e entry) error {
+		switch {
+		case e.dir || isHidden(e.name):
+		case strings.EqualFold(path.Base(e.name), comicInfoName) && index.Info == nil:
+			info, err := readInfo(e)
+			if err != nil {
+				// pages are still readable without the metadata
+				return nil
+			}
+			index.Info = &info
+		case isImage(e.name):
+			index.Pages = append(index.Pages, Page{Name: e.name, Size: e.size})
+		}
+		return nil
+	}
+	if err := walk(format, r, size, visit); err != nil {
+		return Index{}, err
+	}
+	slices.SortFunc(index.Pages, func(a, b Page) int { return natsort.Compare(a.Name, b.Name) })
+	return index, nil
+}
+
+// OpenPage opens the image at name in the archive. RAR archives are read up to the image.
+func OpenPage(format entities.BookFormat, r io.ReaderAt, size int64, name string) (io.ReadCloser, error) {
+	if format == entities.BookFormatCBR {
+		return OpenRARPage(io.NewSectionReader(r, 0, size), name)
+	}
+	var page io.ReadCloser
+	err := walk(format, r, size, func(e entry) error {
+		if page != nil || e.dir || e.name != name {
+			return nil
+		}
+		var err error
+		page, err = e.open()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page == nil {
+		return nil, ErrPageNotFound
+	}
+	return page, nil
+}
+
+// OpenRARPage reads the RAR archive from r up to the image at name. RAR archives can be solid,
+// so the files before the image are decompressed as well, the caller should stream r rather than seek in it.
+func OpenRARPage(r io.Reader, name string) (io.ReadCloser, error) {
+	archive, err := rardecode.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, ErrPageNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		if !header.IsDir && header.Name == name {
+			return io.NopCloser(archive), nil
+		}
+	}
+}
+
+func walk(format entities.BookFormat, r io.ReaderAt, size int64, visit func(entry) error) error {
+	switch format {
+	case entities.BookFormatCBZ:
+		archive, err := zip.NewReader(r, size)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		for _, file := range archive.File {
+			err := visit(entry{name: file.Name, size: int64(file.UncompressedSize64), dir: file.FileInfo().IsDir(), open: file.Open})
+			if err != nil {
+				return err
+			}
+		}
+	case entities.BookFormatCB7:
+		archive, err := sevenzip.NewReader(r, size)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		for _, file := range archive.File {
+			err := visit(entry{name: file.Name, size: int64(file.UncompressedSize), dir: file.FileInfo().IsDir(), open: file.Open})
+			if err != nil {
+				return err
+			}
+		}
+	case entities.BookFormatCBR:
+		archive, err := rardecode.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		for {
+			header, err := archive.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalid, err)
+			}
+			open := func() (io.ReadCloser, error) { return io.NopCloser(archive), nil }
+			if err := visit(entry{name: header.Name, size: header.UnPackedSize, dir: header.IsDir, open: open}); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrNotComic
+	}
+	return nil
+}
+
+func isImage(name string) bool {
+	return slices.Contains(imageExtensions, strings.ToLower(path.Ext(name)))
+}
+
+// isHidden skips the metadata of macOS and other dot files that some archivers add.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
@@ -0,0 +1,178 @@
+package comics
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// newCBZ returns an archive of the files in the order given, names ending with a slash are directories.
+func newCBZ(t *testing.T, files map[string]string, order ...string) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for _, name := range order {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("cannot create zip entry: %v", err)
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if _, err := io.WriteString(f, files[name]); err != nil {
+			t.Fatalf("cannot write zip entry: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("cannot close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func pageNames(pages []Page) []string {
+	names := make([]string, len(pages))
+	for i, page := range pages {
+		names[i] = page.Name
+	}
+	return names
+}
+
+func TestReadIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		comicInfo string
+		want      []string
+		wantInfo  *Info
+	}{
+		{
+			name:  "natural order",
+			files: []string{"page10.jpg", "page2.jpg", "page1.jpg", "page11.jpg"},
+			want:  []string{"page1.jpg", "page2.jpg", "page10.jpg", "page11.jpg"},
+		},
+		{
+			name:  "chapter folders",
+			files: []string{"Chapter 10/", "Chapter 10/01.png", "Chapter 9/", "Chapter 9/02.png", "Chapter 9/01.png"},
+			want:  []string{"Chapter 9/01.png", "Chapter 9/02.png", "Chapter 10/01.png"},
+		},
+		{
+			name: "non-image entries",
+			files: []string{
+				"002.JPEG", "readme.txt", "Thumbs.db", "001.webp", "scans/", "credits.nfo",
+				"__MACOSX/._001.webp", ".DS_Store", "scans/.hidden.png", "003.avif", "jpg",
+			},
+			want: []string{"001.webp", "002.JPEG", "003.avif"},
+		},
+		{
+			name:      "comic info",
+			files:     []string{"2.png", "ComicInfo.xml", "1.png"},
+			comicInfo: "<ComicInfo><Title>Issue</Title><Series>Series</Series><Number>3</Number></ComicInfo>",
+			want:      []string{"1.png", "2.png"},
+			wantInfo:  &Info{Title: "Issue", Series: "Series", Number: "3"},
+		},
+		{
+			// the pages are readable without the metadata
+			name:      "broken comic info",
+			files:     []string{"1.png", "comicinfo.XML"},
+			comicInfo: "<ComicInfo><Title>Issue",
+			want:      []string{"1.png"},
+		},
+		{name: "no pages", files: []string{"readme.txt"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(tt.files))
+			for _, name := range tt.files {
+				files[name] = "image " + name
+				if strings.EqualFold(name, comicInfoName) {
+					files[name] = tt.comicInfo
+				}
+			}
+			content := newCBZ(t, files, tt.files...)
+
+			index, err := ReadIndex(entities.BookFormatCBZ, bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				t.Fatalf("ReadIndex() error = %v", err)
+			}
+			if got := pageNames(index.Pages); !slices.Equal(got, tt.want) {
+				t.Errorf("pages = %q, want %q", got, tt.want)
+			}
+			for _, page := range index.Pages {
+				if page.Size != int64(len(files[page.Name])) {
+					t.Errorf("size of %q = %d, want %d", page.Name, page.Size, len(files[page.Name]))
+				}
+			}
+			switch {
+			case tt.wantInfo == nil && index.Info != nil:
+				t.Errorf("Info = %+v, want nil", index.Info)
+			case tt.wantInfo != nil && (index.Info == nil || *index.Info != *tt.wantInfo):
+				t.Errorf("Info = %+v, want %+v", index.Info, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestReadIndexInvalid(t *testing.T) {
+	content := newCBZ(t, map[string]string{"1.png": "image"}, "1.png")
+	tests := []struct {
+		name    string
+		format  entities.BookFormat
+		content []byte
+		wantErr error
+	}{
+		{name: "truncated cbz", format: entities.BookFormatCBZ, content: content[:len(content)-10], wantErr: ErrInvalid},
+		{name: "cbz that is not a zip", format: entities.BookFormatCBZ, content: []byte("Rar!\x1a\x07\x00"), wantErr: ErrInvalid},
+		{name: "cbr that is not a rar", format: entities.BookFormatCBR, content: content, wantErr: ErrInvalid},
+		{name: "cb7 that is not a 7z", format: entities.BookFormatCB7, content: content, wantErr: ErrInvalid},
+		{name: "not a comic", format: entities.BookFormatEPUB, content: content, wantErr: ErrNotComic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadIndex(tt.format, bytes.NewReader(tt.content), int64(len(tt.content)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadIndex() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenPage(t *testing.T) {
+	files := map[string]string{"pages/": "", "pages/1.png": "first", "pages/2.png": "second"}
+	content := newCBZ(t, files, "pages/", "pages/1.png", "pages/2.png")
+	tests := []struct {
+		name    string
+		page    string
+		want    string
+		wantErr error
+	}{
+		{name: "page", page: "pages/2.png", want: "second"},
+		{name: "missing page", page: "pages/3.png", wantErr: ErrPageNotFound},
+		{name: "directory", page: "pages/", wantErr: ErrPageNotFound},
+		{name: "base name only", page: "2.png", wantErr: ErrPageNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := OpenPage(entities.BookFormatCBZ, bytes.NewReader(content), int64(len(content)), tt.page)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OpenPage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer page.Close()
+			got, err := io.ReadAll(page)
+			if err != nil {
+				t.Fatalf("cannot read page: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("page = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
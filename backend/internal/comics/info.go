@@ -0,0 +1,78 @@
+package comics
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// Info is the ComicInfo.xml of an archive in the schema of ComicRack.
+type Info struct {
+	Title       string `xml:"Title"`
+	Series      string `xml:"Series"`
+	Number      string `xml:"Number"`
+	Volume      string `xml:"Volume"`
+	Summary     string `xml:"Summary"`
+	Year        int    `xml:"Year"`
+	Month       int    `xml:"Month"`
+	Day         int    `xml:"Day"`
+	Writer      string `xml:"Writer"`
+	Publisher   string `xml:"Publisher"`
+	Genre       string `xml:"Genre"`
+	Tags        string `xml:"Tags"`
+	LanguageISO string `xml:"LanguageISO"`
+	PageCount   int    `xml:"PageCount"`
+}
+
+func readInfo(e entry) (Info, error) {
+	content, err := e.open()
+	if err != nil {
+		return Info{}, err
+	}
+	defer content.Close()
+	var info Info
+	decoder := xml.NewDecoder(io.LimitReader(content, maxComicInfoSize))
+	decoder.Strict = false
+	if err := decoder.Decode(&info); err != nil {
+		return Info{}, fmt.Errorf("%w: ComicInfo.xml: %w", ErrInvalid, err)
+	}
+	return info, nil
+}
+
+// Metadata maps the fields of the ComicInfo.xml onto book metadata. The issue number becomes the series index,
+// the writers become the authors, and the genres and tags become the tags.
+func (i Info) Metadata() entities.BookMetadata {
+	metadata := entities.BookMetadata{
+		Authors:     splitList(i.Writer),
+		Description: strings.TrimSpace(i.Summary),
+		Language:    strings.TrimSpace(i.LanguageISO),
+		Publisher:   strings.TrimSpace(i.Publisher),
+		Series:      strings.TrimSpace(i.Series),
+		Tags:        append(splitList(i.Genre), splitList(i.Tags)...),
+	}
+	if number, err := strconv.ParseFloat(strings.TrimSpace(i.Number), 64); err == nil {
+		metadata.SeriesIndex = &number
+	}
+	if i.Year > 0 {
+		month, day := min(max(i.Month, 1), 12), min(max(i.Day, 1), 31)
+		published := time.Date(i.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		metadata.PublishedDate = &published
+	}
+	return metadata
+}
+
+// splitList splits the comma separated lists ComicInfo.xml uses for people and tags.
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
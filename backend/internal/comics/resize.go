@@ -0,0 +1,44 @@
+package comics
+
+import (
+	"bytes"
+	"image"
+	// decoders of the page formats, the resized pages are encoded as JPEG or PNG
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxResizePixels keeps huge scans from being decoded into memory, they are served as they are.
+	maxResizePixels = 100_000_000
+	jpegQuality     = 85
+)
+
+// Resize scales the image down to width pixels keeping its aspect ratio. It reports false and leaves the image
+// alone when it is not wider than width, is too large to decode or its format cannot be decoded.
+// PNG and GIF images are encoded as PNG to keep their transparency, the others as JPEG.
+func Resize(content []byte, width int) ([]byte, string, bool) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width <= width || config.Width*config.Height > maxResizePixels {
+		return nil, "", false
+	}
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", false
+	}
+	height := max(config.Height*width/config.Width, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	buf := bytes.Buffer{}
+	if format == "png" || format == "gif" {
+		err = png.Encode(&buf, dst)
+		return buf.Bytes(), "image/png", err == nil
+	}
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+	return buf.Bytes(), "image/jpeg", err == nil
+}
@@ -14,6 +14,8 @@ const (
 	ResponseWriterAccess = "c-response-writer-access"
 	BaseURLCtxKey        = "c-base-url"
 	IsAdminCtxKey        = "c-is-admin"
+	ClientInfoCtxKey     = "c-client-info"
+	PermissionsCtxKey    = "c-permissions"
 )
 
 func GetUser(ctx context.Context) entities.User {
@@ -78,5 +80,26 @@ func GetRequestID(ctx context.Context) string {
 }
 
 func GetIsAdmin(ctx context.Context) bool {
-	return ctx.Value(IsAdminCtxKey).(bool)
+	value, ok := ctx.Value(IsAdminCtxKey).(bool)
+	return ok && value
+}
+
+func GetPermissions(ctx context.Context) entities.Permissions {
+	value, ok := ctx.Value(PermissionsCtxKey).(entities.Permissions)
+	if !ok {
+		return entities.Permissions{}
+	}
+	return value
+}
+
+func HasPermission(ctx context.Context, permission entities.Permission) bool {
+	return GetPermissions(ctx).Has(permission)
+}
+
+func GetClientInfo(ctx context.Context) entities.ClientInfo {
+	value, ok := ctx.Value(ClientInfoCtxKey).(entities.ClientInfo)
+	if !ok {
+		return entities.ClientInfo{}
+	}
+	return value
 }
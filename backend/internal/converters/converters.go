@@ -0,0 +1,65 @@
+// Package converters converts book files between formats.
+// EPUB is converted to KEPUB and plain text in Go, other conversions need an external tool such as calibre's ebook-convert.
+package converters
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+var (
+	ErrUnsupportedConversion = errors.New("conversion between these formats is not supported")
+)
+
+// Converter converts book files. Files are passed by path, their names end with the extension of their format.
+type Converter interface {
+	// Supports reports whether the converter can convert from one format to another.
+	Supports(from, to entities.BookFormat) bool
+	Convert(ctx context.Context, from, to entities.BookFormat, src, dst string) error
+}
+
+// Chain tries the converters in order and uses the first one that supports the conversion.
+type Chain []Converter
+
+func (c Chain) Supports(from, to entities.BookFormat) bool {
+	return slices.ContainsFunc(c, func(converter Converter) bool {
+		return converter.Supports(from, to)
+	})
+}
+
+func (c Chain) Convert(ctx context.Context, from, to entities.BookFormat, src, dst string) error {
+	for _, converter := range c {
+		if converter.Supports(from, to) {
+			return converter.Convert(ctx, from, to, src, dst)
+		}
+	}
+	return ErrUnsupportedConversion
+}
+
+// targetFormats are the formats books can be converted to.
+var targetFormats = []entities.BookFormat{
+	entities.BookFormatEPUB,
+	entities.BookFormatKEPUB,
+	entities.BookFormatMOBI,
+	entities.BookFormatAZW3,
+	entities.BookFormatTXT,
+}
+
+// Targets returns the formats the converter can convert a book in the given format to.
+func Targets(converter Converter, from entities.BookFormat) []entities.BookFormat {
+	targets := make([]entities.BookFormat, 0, len(targetFormats))
+	for _, to := range targetFormats {
+		if to != from && converter.Supports(from, to) {
+			targets = append(targets, to)
+		}
+	}
+	return targets
+}
+
+// TargetFormats returns every format books can be converted to.
+func TargetFormats() []entities.BookFormat {
+	return slices.Clone(targetFormats)
+}
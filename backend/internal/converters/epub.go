@@ -0,0 +1,124 @@
+package converters
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	epubContainerPath = "META-INF/container.xml"
+	// maxPackageSize limits how much of container.xml and the package document is read.
+	maxPackageSize = 4 << 20
+)
+
+var (
+	errInvalidEPUB = errors.New("invalid epub")
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// epubBook is an open EPUB file.
+type epubBook struct {
+	archive *zip.ReadCloser
+	files   map[string]*zip.File
+	// documents are the XHTML content documents by their path in the archive.
+	documents map[string]bool
+	// spine is the reading order of the content documents.
+	spine []string
+}
+
+func openEPUB(src string) (*epubBook, error) {
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidEPUB, err)
+	}
+	book := &epubBook{
+		archive:   archive,
+		files:     make(map[string]*zip.File, len(archive.File)),
+		documents: make(map[string]bool),
+	}
+	for _, file := range archive.File {
+		book.files[file.Name] = file
+	}
+	if err := book.readPackage(); err != nil {
+		archive.Close()
+		return nil, err
+	}
+	return book, nil
+}
+
+func (b *epubBook) Close() error {
+	return b.archive.Close()
+}
+
+func (b *epubBook) readXML(name string, v any) error {
+	file, ok := b.files[name]
+	if !ok {
+		return fmt.Errorf("%w: missing %s", errInvalidEPUB, name)
+	}
+	content, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEPUB, err)
+	}
+	defer content.Close()
+	decoder := xml.NewDecoder(io.LimitReader(content, maxPackageSize))
+	decoder.Strict = false
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %w", errInvalidEPUB, name, err)
+	}
+	return nil
+}
+
+func (b *epubBook) readPackage() error {
+	var container epubContainer
+	if err := b.readXML(epubContainerPath, &container); err != nil {
+		return err
+	}
+	if len(container.Rootfiles) == 0 {
+		return fmt.Errorf("%w: no rootfile in %s", errInvalidEPUB, epubContainerPath)
+	}
+	packagePath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := b.readXML(packagePath, &pkg); err != nil {
+		return err
+	}
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Join(path.Dir(packagePath), href)
+		hrefs[item.ID] = name
+		if item.MediaType == "application/xhtml+xml" || strings.HasSuffix(item.MediaType, "/html") {
+			b.documents[name] = true
+		}
+	}
+	for _, itemref := range pkg.Spine {
+		if name, ok := hrefs[itemref.IDRef]; ok && b.documents[name] {
+			b.spine = append(b.spine, name)
+		}
+	}
+	return nil
+}
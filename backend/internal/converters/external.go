@@ -0,0 +1,59 @@
+package converters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// maxToolOutput is how much of the output of a failed tool ends up in the error.
+const maxToolOutput = 512
+
+// ebookConvert runs calibre's ebook-convert, which picks the formats by the extensions of the file names.
+type ebookConvert struct {
+	binary string
+}
+
+func NewEbookConvert(binary string) Converter {
+	return ebookConvert{binary: binary}
+}
+
+var (
+	ebookConvertInputs = []entities.BookFormat{
+		entities.BookFormatEPUB,
+		entities.BookFormatMOBI,
+		entities.BookFormatAZW3,
+		entities.BookFormatFB2,
+		entities.BookFormatPDF,
+	}
+	ebookConvertOutputs = []entities.BookFormat{
+		entities.BookFormatEPUB,
+		entities.BookFormatMOBI,
+		entities.BookFormatAZW3,
+		entities.BookFormatTXT,
+	}
+)
+
+func (ebookConvert) Supports(from, to entities.BookFormat) bool {
+	return from != to && slices.Contains(ebookConvertInputs, from) && slices.Contains(ebookConvertOutputs, to)
+}
+
+func (c ebookConvert) Convert(ctx context.Context, from, to entities.BookFormat, src, dst string) error {
+	if !c.Supports(from, to) {
+		return ErrUnsupportedConversion
+	}
+	output, err := exec.CommandContext(ctx, c.binary, src, dst).CombinedOutput()
+	if err != nil {
+		output = bytes.TrimSpace(output)
+		if len(output) > maxToolOutput {
+			output = output[len(output)-maxToolOutput:]
+		}
+		return fmt.Errorf("ebook-convert failed: %w: %s", err, strings.ToValidUTF8(string(output), ""))
+	}
+	return nil
+}
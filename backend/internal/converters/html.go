@@ -0,0 +1,70 @@
+package converters
+
+import (
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// blockElements start a new paragraph. Text outside of them belongs to the paragraph before.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "blockquote": true, "pre": true, "dd": true, "dt": true, "td": true, "th": true,
+	"section": true, "article": true, "header": true, "footer": true, "figcaption": true, "br": true, "hr": true,
+}
+
+// hiddenElements hold text that is not part of the content.
+var hiddenElements = map[string]bool{
+	"script": true, "style": true, "head": true,
+}
+
+// xhtmlVisitor receives the tokens of a content document. Raw is the token as it appears in the document.
+type xhtmlVisitor interface {
+	// element is called for start, end and self-closing tags.
+	element(z *html.Tokenizer, name string, tokenType html.TokenType) error
+	// text is called for character data in the body outside of hidden elements.
+	text(z *html.Tokenizer) error
+	// other is called for every other token.
+	other(z *html.Tokenizer) error
+}
+
+// walkXHTML tokenizes the document without building a tree, so the tokens can be copied byte for byte.
+func walkXHTML(r io.Reader, visitor xhtmlVisitor) error {
+	z := html.NewTokenizer(r)
+	inBody := false
+	hidden := 0
+	for {
+		tokenType := z.Next()
+		var err error
+		switch tokenType {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			nameBytes, _ := z.TagName()
+			name := string(nameBytes)
+			switch {
+			case name == "body":
+				inBody = tokenType == html.StartTagToken
+			case hiddenElements[name] && tokenType == html.StartTagToken:
+				hidden++
+			case hiddenElements[name] && tokenType == html.EndTagToken:
+				hidden = max(hidden-1, 0)
+			}
+			err = visitor.element(z, name, tokenType)
+		case html.TextToken:
+			if inBody && hidden == 0 {
+				err = visitor.text(z)
+			} else {
+				err = visitor.other(z)
+			}
+		default:
+			err = visitor.other(z)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
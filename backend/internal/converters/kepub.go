@@ -0,0 +1,139 @@
+package converters
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"golang.org/x/net/html"
+)
+
+// sentenceRe splits text into sentences, keeping the punctuation and following whitespace with the sentence.
+var sentenceRe = regexp.MustCompile(`[^.!?…]*[.!?…]+['"”’)\]]*\s*|[^.!?…]+$`)
+
+// kepubConverter turns an EPUB into a KEPUB the way kepubify does: every sentence of the content documents
+// is wrapped in a koboSpan, which Kobo readers need for reading statistics, highlights and page turns,
+// and the body is wrapped in the book-columns and book-inner divs.
+type kepubConverter struct{}
+
+func NewKEPUB() Converter {
+	return kepubConverter{}
+}
+
+func (kepubConverter) Supports(from, to entities.BookFormat) bool {
+	return from == entities.BookFormatEPUB && to == entities.BookFormatKEPUB
+}
+
+func (c kepubConverter) Convert(ctx context.Context, from, to entities.BookFormat, src, dst string) error {
+	if !c.Supports(from, to) {
+		return ErrUnsupportedConversion
+	}
+	book, err := openEPUB(src)
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(out)
+	err = c.write(ctx, book, archive)
+	return errors.Join(err, archive.Close(), out.Close())
+}
+
+// write copies the archive entries in their order, so the stored mimetype entry stays first.
+func (kepubConverter) write(ctx context.Context, book *epubBook, archive *zip.Writer) error {
+	for _, file := range book.archive.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !book.documents[file.Name] {
+			if err := archive.Copy(file); err != nil {
+				return err
+			}
+			continue
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: file.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		content, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidEPUB, err)
+		}
+		err = walkXHTML(content, &koboSpans{w: entry})
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("cannot convert %s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// koboSpans copies a content document and numbers its sentences as kobo.<paragraph>.<sentence>.
+type koboSpans struct {
+	w         io.Writer
+	paragraph int
+	sentence  int
+}
+
+func (k *koboSpans) element(z *html.Tokenizer, name string, tokenType html.TokenType) error {
+	if name == "body" && tokenType == html.EndTagToken {
+		if _, err := io.WriteString(k.w, "</div></div>"); err != nil {
+			return err
+		}
+	}
+	if _, err := k.w.Write(z.Raw()); err != nil {
+		return err
+	}
+	if name == "body" && tokenType == html.StartTagToken {
+		if _, err := io.WriteString(k.w, `<div id="book-columns"><div id="book-inner">`); err != nil {
+			return err
+		}
+	}
+	if blockElements[name] && tokenType != html.EndTagToken {
+		k.paragraph++
+		k.sentence = 0
+	}
+	return nil
+}
+
+func (k *koboSpans) text(z *html.Tokenizer) error {
+	// the raw text is still escaped, entities contain no sentence punctuation so they are never split
+	raw := string(z.Raw())
+	if strings.TrimSpace(raw) == "" {
+		_, err := io.WriteString(k.w, raw)
+		return err
+	}
+	k.paragraph = max(k.paragraph, 1)
+	for _, sentence := range sentenceRe.FindAllString(raw, -1) {
+		if strings.TrimSpace(sentence) == "" {
+			if _, err := io.WriteString(k.w, sentence); err != nil {
+				return err
+			}
+			continue
+		}
+		k.sentence++
+		_, err := fmt.Fprintf(k.w, `<span class="koboSpan" id="kobo.%d.%d">%s</span>`, k.paragraph, k.sentence, sentence)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *koboSpans) other(z *html.Tokenizer) error {
+	_, err := k.w.Write(z.Raw())
+	return err
+}
@@ -0,0 +1,97 @@
+package converters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"golang.org/x/net/html"
+)
+
+// textConverter extracts the text of an EPUB in reading order with a blank line between paragraphs.
+type textConverter struct{}
+
+func NewText() Converter {
+	return textConverter{}
+}
+
+func (textConverter) Supports(from, to entities.BookFormat) bool {
+	return from == entities.BookFormatEPUB && to == entities.BookFormatTXT
+}
+
+func (c textConverter) Convert(ctx context.Context, from, to entities.BookFormat, src, dst string) error {
+	if !c.Supports(from, to) {
+		return ErrUnsupportedConversion
+	}
+	book, err := openEPUB(src)
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	err = c.write(ctx, book, w)
+	return errors.Join(err, w.Flush(), out.Close())
+}
+
+func (textConverter) write(ctx context.Context, book *epubBook, w io.Writer) error {
+	for _, name := range book.spine {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := book.files[name].Open()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidEPUB, err)
+		}
+		paragraphs := &plainText{w: w}
+		err = walkXHTML(content, paragraphs)
+		content.Close()
+		if err == nil {
+			err = paragraphs.flush()
+		}
+		if err != nil {
+			return fmt.Errorf("cannot convert %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// plainText collects the text of a paragraph and writes it with collapsed whitespace when the paragraph ends.
+type plainText struct {
+	w         io.Writer
+	paragraph strings.Builder
+}
+
+func (p *plainText) flush() error {
+	text := strings.Join(strings.Fields(p.paragraph.String()), " ")
+	p.paragraph.Reset()
+	if text == "" {
+		return nil
+	}
+	_, err := io.WriteString(p.w, text+"\n\n")
+	return err
+}
+
+func (p *plainText) element(_ *html.Tokenizer, name string, _ html.TokenType) error {
+	if blockElements[name] {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *plainText) text(z *html.Tokenizer) error {
+	p.paragraph.Write(z.Text())
+	return nil
+}
+
+func (p *plainText) other(*html.Tokenizer) error {
+	return nil
+}
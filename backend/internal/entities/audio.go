@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AudioTrack is an audio file of an audiobook. Tracks are numbered from 1 in playing order.
+type AudioTrack struct {
+	FileID   uuid.UUID
+	BookID   uuid.UUID
+	Number   int
+	Title    string
+	Duration time.Duration
+	// Chapters are the chapter markers of the track, Start is relative to the start of the track.
+	Chapters []AudioChapter
+}
+
+type AudioChapter struct {
+	Title string
+	Start time.Duration
+}
+
+// BookProgress is how far a user has got in a book. Text books are positioned by Locator,
+// audiobooks by Position, the time from the start of the first track.
+type BookProgress struct {
+	UserID uuid.UUID
+	BookID uuid.UUID
+	// Percentage is the share of the book behind the position, from 0 to 1.
+	Percentage float64
+	// Locator is the position in the terms of the reader, an EPUB CFI or a page number.
+	Locator   string
+	Position  time.Duration
+	UpdatedAt time.Time
+}
@@ -7,10 +7,71 @@ import (
 )
 
 type Session struct {
-	ID        string
-	UserID    uuid.UUID
-	IsActive  bool
-	ExpiresAt time.Time
+	ID string
+	// PublicID identifies the session in APIs, ID is a secret and must never be exposed.
+	PublicID   uuid.UUID
+	UserID     uuid.UUID
+	IsActive   bool
+	ExpiresAt  time.Time
+	UserAgent  string
+	IP         string
+	DeviceName string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	RotatedAt  time.Time
+	// PreviousID is the ID the session had before the last rotation.
+	// It is accepted for a short grace period so that concurrent requests do not fail.
+	PreviousID string
 }
 
 var NilSession = Session{}
+
+// ClientInfo describes the client that sent a request.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type LockoutKind string
+
+const (
+	LockoutKindAccount LockoutKind = "account"
+	LockoutKindIP      LockoutKind = "ip"
+)
+
+type Lockout struct {
+	Kind        LockoutKind
+	Key         string
+	LockedUntil time.Time
+	UnlockToken string
+	CreatedAt   time.Time
+}
+
+type AuditEvent string
+
+const (
+	AuditEventLoginSucceeded  AuditEvent = "login_succeeded"
+	AuditEventLoginFailed     AuditEvent = "login_failed"
+	AuditEventLoginThrottled  AuditEvent = "login_throttled"
+	AuditEventAccountLocked   AuditEvent = "account_locked"
+	AuditEventIPLocked        AuditEvent = "ip_locked"
+	AuditEventAccountUnlocked AuditEvent = "account_unlocked"
+)
+
+type AuditEntry struct {
+	ID        int64
+	UserID    *uuid.UUID
+	Email     string
+	IP        string
+	Event     AuditEvent
+	Details   string
+	CreatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -8,6 +8,8 @@ import (
 
 type BookHash [256 / 8]byte
 
+// Book is a title in the library. A book has a file per format, StoragePath, Hash, Size, Format,
+// MIMEType and Status describe its primary file, the one it was uploaded with.
 type Book struct {
 	ID          uuid.UUID
 	Title       string
@@ -15,4 +17,124 @@ type Book struct {
 	Hash        BookHash
 	UploadedBy  uuid.UUID
 	UploadedAt  time.Time
+	// Size is the size of the primary file in bytes.
+	Size     int64
+	Format   BookFormat
+	MIMEType string
+	Status   BookStatus
+	// DeletedAt is set while the book is in the trash.
+	DeletedAt *time.Time
+	Metadata  BookMetadata
+	// Version is incremented on every metadata change and guards against concurrent edits.
+	Version int
+	// CoverPath is the storage path of the cover image, empty when the book has no cover.
+	CoverPath string
+}
+
+// BookMetadata is the descriptive information about a book that users can edit.
+type BookMetadata struct {
+	Authors       []string
+	Description   string
+	Language      string
+	Publisher     string
+	PublishedDate *time.Time
+	ISBN          string
+	Series        string
+	SeriesIndex   *float64
+	Tags          []string
+	// Identifiers maps identifier schemes such as "goodreads" or "amazon" to the identifiers of the book.
+	Identifiers map[string]string
+	// Rating is from 1 to 5 stars, nil when the book is not rated.
+	Rating *int
+}
+
+// BookMetadataVersion is the state of the book metadata after a change.
+// ChangedBy is nil when the user who made the change has been deleted.
+type BookMetadataVersion struct {
+	BookID        uuid.UUID
+	Version       int
+	Title         string
+	Metadata      BookMetadata
+	ChangedFields []string
+	ChangedBy     *uuid.UUID
+	ChangedAt     time.Time
+}
+
+// StorageUsage describes how much storage a user occupies. Limit is 0 when the storage is unlimited.
+type StorageUsage struct {
+	Used      int64
+	Limit     int64
+	BookCount int
+}
+
+// UnsizedFile is a book file stored before sizes were recorded.
+type UnsizedFile struct {
+	FileID      uuid.UUID
+	UserID      uuid.UUID
+	StoragePath string
+}
+
+// BookFormat is the file format of a book detected on upload.
+type BookFormat string
+
+const (
+	BookFormatEPUB BookFormat = "epub"
+	BookFormatPDF  BookFormat = "pdf"
+	BookFormatFB2  BookFormat = "fb2"
+	BookFormatMOBI BookFormat = "mobi"
+	BookFormatAZW3 BookFormat = "azw3"
+	BookFormatCBZ  BookFormat = "cbz"
+	BookFormatCBR  BookFormat = "cbr"
+	BookFormatCB7  BookFormat = "cb7"
+	// BookFormatM4B and BookFormatMP3 are the tracks of audiobooks, a book can have several files in them.
+	BookFormatM4B BookFormat = "m4b"
+	BookFormatMP3 BookFormat = "mp3"
+	// BookFormatKEPUB and BookFormatTXT are only produced by conversions.
+	BookFormatKEPUB BookFormat = "kepub"
+	BookFormatTXT   BookFormat = "txt"
+)
+
+// BookFile is a file of a book. A book has at most one file per format.
+type BookFile struct {
+	ID          uuid.UUID
+	BookID      uuid.UUID
+	Format      BookFormat
+	MIMEType    string
+	Size        int64
+	Hash        BookHash
+	StoragePath string
+	Status      BookStatus
+	CreatedAt   time.Time
+}
+
+// BookStatus tells whether the book can be downloaded.
+// New uploads wait for the malware scan and are not available until it finds them clean.
+type BookStatus string
+
+const (
+	BookStatusPendingScan BookStatus = "pending_scan"
+	BookStatusReady       BookStatus = "ready"
+	// BookStatusScanFailed is set when the scan could not be run after all retries, the file stays unavailable.
+	BookStatusScanFailed BookStatus = "scan_failed"
+)
+
+type BookConversionStatus string
+
+const (
+	BookConversionStatusPending   BookConversionStatus = "pending"
+	BookConversionStatusCompleted BookConversionStatus = "completed"
+	BookConversionStatusFailed    BookConversionStatus = "failed"
+)
+
+// BookConversion is a copy of a book converted to another format.
+// The converted file is kept at StoragePath once the conversion is completed.
+type BookConversion struct {
+	BookID      uuid.UUID
+	Format      BookFormat
+	Status      BookConversionStatus
+	StoragePath string
+	Size        int64
+	Error       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
@@ -0,0 +1,12 @@
+package entities
+
+import "github.com/google/uuid"
+
+// ComicPage is an image of a comic book archive. Pages are numbered from 1 in reading order,
+// Name is the path of the image inside the archive of the primary file.
+type ComicPage struct {
+	BookID uuid.UUID
+	Number int
+	Name   string
+	Size   int64
+}
@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device is an e-mail address of a reading device, such as the Send to Kindle address of a Kindle.
+// Books are converted to Format before they are sent to it.
+type Device struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Email     string
+	Format    BookFormat
+	CreatedAt time.Time
+}
+
+type BookDeliveryStatus string
+
+const (
+	BookDeliveryStatusPending BookDeliveryStatus = "pending"
+	BookDeliveryStatusSent    BookDeliveryStatus = "sent"
+	BookDeliveryStatusFailed  BookDeliveryStatus = "failed"
+)
+
+// BookDelivery is a book sent to a device by e-mail. Size is the size of the attachment once it is sent.
+type BookDelivery struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	BookID    uuid.UUID
+	DeviceID  uuid.UUID
+	Format    BookFormat
+	Status    BookDeliveryStatus
+	Size      int64
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
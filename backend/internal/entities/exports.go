@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LibraryExportStatus string
+
+const (
+	LibraryExportStatusPending   LibraryExportStatus = "pending"
+	LibraryExportStatusRunning   LibraryExportStatus = "running"
+	LibraryExportStatusCompleted LibraryExportStatus = "completed"
+	LibraryExportStatusFailed    LibraryExportStatus = "failed"
+)
+
+// LibraryExport packages books in the layout of a Calibre library.
+// UserID is the user whose library is exported, the whole instance is exported when it is nil.
+// The archive is kept in the storage at StoragePath until ExpiresAt.
+type LibraryExport struct {
+	ID          uuid.UUID
+	RequestedBy uuid.UUID
+	UserID      *uuid.UUID
+	Status      LibraryExportStatus
+	Books       int
+	Size        int64
+	StoragePath string
+	Error       string
+	CreatedAt   time.Time
+	FinishedAt  *time.Time
+	ExpiresAt   *time.Time
+}
@@ -0,0 +1,48 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Household is a group of users, such as a family, that read the books its members share with it.
+// It is managed by its members with the owner role.
+type Household struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
+}
+
+type HouseholdRole string
+
+const (
+	// HouseholdRoleOwner manages the household and its members.
+	HouseholdRoleOwner  HouseholdRole = "owner"
+	HouseholdRoleMember HouseholdRole = "member"
+)
+
+// HouseholdMember is a user in a household. When AllowedTags is not empty the member only sees
+// the shared books that have one of the tags, such as children for the kids of a family.
+// Tags are compared regardless of case. Email is the email of the user.
+type HouseholdMember struct {
+	HouseholdID uuid.UUID
+	UserID      uuid.UUID
+	Email       string
+	Role        HouseholdRole
+	AllowedTags []string
+	JoinedAt    time.Time
+}
+
+// HouseholdInvite invites whoever owns the email to a household, the member is added with Role and
+// AllowedTags once the invite is accepted. Email is normalized and does not have to be registered.
+type HouseholdInvite struct {
+	ID            uuid.UUID
+	HouseholdID   uuid.UUID
+	HouseholdName string
+	Email         string
+	Role          HouseholdRole
+	AllowedTags   []string
+	InvitedBy     uuid.UUID
+	CreatedAt     time.Time
+}
@@ -0,0 +1,61 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportSource string
+
+const (
+	ImportSourceArchive     ImportSource = "archive"
+	ImportSourceWatchFolder ImportSource = "watch_folder"
+	ImportSourceCalibre     ImportSource = "calibre"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportJobStatusPending   ImportJobStatus = "pending"
+	ImportJobStatusRunning   ImportJobStatus = "running"
+	ImportJobStatusCompleted ImportJobStatus = "completed"
+	ImportJobStatusFailed    ImportJobStatus = "failed"
+)
+
+type ImportItemStatus string
+
+const (
+	ImportItemStatusImported ImportItemStatus = "imported"
+	// ImportItemStatusDuplicate is set when the user already has a book with the same content.
+	ImportItemStatusDuplicate ImportItemStatus = "duplicate"
+	ImportItemStatusFailed    ImportItemStatus = "failed"
+)
+
+// ImportJob imports a batch of files into the library of a user.
+// The counters are updated as the files are processed.
+type ImportJob struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Source     ImportSource
+	Name       string
+	Status     ImportJobStatus
+	Total      int
+	Imported   int
+	Duplicates int
+	Failed     int
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// ImportItem is the outcome of importing a single file.
+// BookID is the created book, or the existing one for duplicates.
+type ImportItem struct {
+	JobID     uuid.UUID
+	Name      string
+	Status    ImportItemStatus
+	BookID    *uuid.UUID
+	Error     string
+	CreatedAt time.Time
+}
@@ -0,0 +1,21 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Invite struct {
+	Code      string
+	CreatedBy uuid.UUID
+	MaxUses   int
+	Uses      int
+	ExpiresAt *time.Time
+	IsRevoked bool
+	CreatedAt time.Time
+}
+
+func (i Invite) IsUsable(now time.Time) bool {
+	return !i.IsRevoked && i.Uses < i.MaxUses && (i.ExpiresAt == nil || i.ExpiresAt.After(now))
+}
@@ -0,0 +1,44 @@
+package entities
+
+import "time"
+
+type Permission string
+
+const (
+	PermissionBooksUpload    Permission = "books:upload"
+	PermissionBooksReadAny   Permission = "books:read:any"
+	PermissionBooksDeleteAny Permission = "books:delete:any"
+	PermissionBooksEditAny   Permission = "books:edit:any"
+	PermissionUsersManage    Permission = "users:manage"
+	PermissionLibraryShare   Permission = "library:share"
+	PermissionInvitesCreate  Permission = "invites:create"
+)
+
+const (
+	RoleAdmin = "admin"
+	// RoleUser is granted to every new user.
+	RoleUser = "user"
+)
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []Permission
+	CreatedAt   time.Time
+}
+
+// Permissions is a set of permissions granted to a user through their roles.
+type Permissions map[Permission]struct{}
+
+func NewPermissions(permissions ...Permission) Permissions {
+	set := make(Permissions, len(permissions))
+	for _, p := range permissions {
+		set[p] = struct{}{}
+	}
+	return set
+}
+
+func (p Permissions) Has(permission Permission) bool {
+	_, ok := p[permission]
+	return ok
+}
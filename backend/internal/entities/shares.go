@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink gives access to the content of a book to anyone who has the token, without an account.
+// PasswordHash is the bcrypt hash of the password of the link, empty when the link has none.
+type ShareLink struct {
+	ID           uuid.UUID
+	Token        string
+	BookID       uuid.UUID
+	CreatedBy    uuid.UUID
+	PasswordHash string
+	ExpiresAt    *time.Time
+	// MaxDownloads is nil when the number of downloads is unlimited.
+	MaxDownloads *int
+	Downloads    int
+	IsRevoked    bool
+	CreatedAt    time.Time
+}
+
+func (l ShareLink) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+func (l ShareLink) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(now)
+}
+
+func (l ShareLink) IsExhausted() bool {
+	return l.MaxDownloads != nil && l.Downloads >= *l.MaxDownloads
+}
+
+type ShareLinkAccessOutcome string
+
+const (
+	ShareLinkAccessDownloaded    ShareLinkAccessOutcome = "downloaded"
+	ShareLinkAccessWrongPassword ShareLinkAccessOutcome = "wrong_password"
+	ShareLinkAccessExpired       ShareLinkAccessOutcome = "expired"
+	ShareLinkAccessExhausted     ShareLinkAccessOutcome = "exhausted"
+	ShareLinkAccessRevoked       ShareLinkAccessOutcome = "revoked"
+)
+
+// ShareLinkAccess is an attempt to download a book through a share link.
+type ShareLinkAccess struct {
+	ID        uuid.UUID
+	LinkID    uuid.UUID
+	IP        string
+	UserAgent string
+	Outcome   ShareLinkAccessOutcome
+	CreatedAt time.Time
+}
@@ -6,12 +6,39 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApprovalStatus string
+
+const (
+	ApprovalStatusPending  ApprovalStatus = "pending"
+	ApprovalStatusApproved ApprovalStatus = "approved"
+	ApprovalStatusRejected ApprovalStatus = "rejected"
+)
+
 type User struct {
-	ID        uuid.UUID `json:"id,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email,omitempty"`
-	Password  string    `json:"password,omitempty"`
-	IsActive  bool      `json:"is_active,omitempty"`
-	IsAdmin   bool      `json:"is_admin,omitempty"`
+	ID             uuid.UUID      `json:"id,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Username       string         `json:"username"`
+	Email          string         `json:"email,omitempty"`
+	Password       string         `json:"password,omitempty"`
+	IsActive       bool           `json:"is_active,omitempty"`
+	IsAdmin        bool           `json:"is_admin,omitempty"`
+	ApprovalStatus ApprovalStatus `json:"approval_status,omitempty"`
+	InviteCode     string         `json:"invite_code,omitempty"`
+	LastLoginAt    *time.Time     `json:"last_login_at,omitempty"`
+	// DeletionScheduledAt is set when the user has requested the deletion of the account.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// UserOverview is a user with the statistics shown to administrators.
+type UserOverview struct {
+	User
+	BooksCount int
+}
+
+// UsersFilter narrows down user listings. Nil fields are not applied.
+type UsersFilter struct {
+	// Search matches a part of the email or the username.
+	Search   string
+	IsActive *bool
+	IsAdmin  *bool
 }
@@ -0,0 +1,244 @@
+// Package epub reads the package document, the reading order and the table of contents of EPUB files
+// to serve them to the web reader one resource at a time.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	containerPath = "META-INF/container.xml"
+	// maxDocumentSize limits how much of container.xml, the package document and the navigation documents is read.
+	maxDocumentSize = 4 << 20
+	// XHTMLMediaType is the media type of content documents, they are sanitized before they are served.
+	XHTMLMediaType = "application/xhtml+xml"
+	ncxMediaType   = "application/x-dtbncx+xml"
+)
+
+var (
+	ErrInvalid          = errors.New("invalid epub")
+	ErrResourceNotFound = errors.New("resource not found")
+)
+
+// Item is a resource listed in the manifest. Href is the path of the resource inside the archive.
+type Item struct {
+	ID         string `json:"id"`
+	Href       string `json:"href"`
+	MediaType  string `json:"media_type"`
+	Properties string `json:"properties,omitempty"`
+}
+
+// SpineItem is a content document in the reading order. Documents that are not linear are only reached by links.
+type SpineItem struct {
+	ID     string `json:"id"`
+	Href   string `json:"href"`
+	Linear bool   `json:"linear"`
+}
+
+// TOCEntry is an entry of the table of contents. Href is a path inside the archive, possibly with a fragment.
+type TOCEntry struct {
+	Title    string     `json:"title"`
+	Href     string     `json:"href"`
+	Children []TOCEntry `json:"children"`
+}
+
+// Publication describes an EPUB file.
+type Publication struct {
+	Title    string      `json:"title"`
+	Language string      `json:"language"`
+	Manifest []Item      `json:"manifest"`
+	Spine    []SpineItem `json:"spine"`
+	TOC      []TOCEntry  `json:"toc"`
+}
+
+// Book is an open EPUB file. Only the entries that are asked for are read from the underlying reader.
+type Book struct {
+	Publication
+	files map[string]*zip.File
+	// items are the manifest items by their path in the archive.
+	items map[string]Item
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageDocument struct {
+	Title    []string `xml:"metadata>title"`
+	Language []string `xml:"metadata>language"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		TOC      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef  string `xml:"idref,attr"`
+			Linear string `xml:"linear,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// Open reads the package document and the table of contents of the EPUB file.
+func Open(r io.ReaderAt, size int64) (*Book, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	book := &Book{
+		files: make(map[string]*zip.File, len(archive.File)),
+		items: make(map[string]Item),
+	}
+	for _, file := range archive.File {
+		book.files[file.Name] = file
+	}
+	if err := book.readPackage(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func (b *Book) readXML(name string, v any) error {
+	content, err := b.open(name)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	decoder := xml.NewDecoder(io.LimitReader(content, maxDocumentSize))
+	decoder.Strict = false
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalid, name, err)
+	}
+	return nil
+}
+
+func (b *Book) open(name string) (io.ReadCloser, error) {
+	file, ok := b.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalid, name)
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return content, nil
+}
+
+func (b *Book) readPackage() error {
+	var c container
+	if err := b.readXML(containerPath, &c); err != nil {
+		return err
+	}
+	if len(c.Rootfiles) == 0 {
+		return fmt.Errorf("%w: no rootfile in %s", ErrInvalid, containerPath)
+	}
+	packagePath := c.Rootfiles[0].FullPath
+	var pkg packageDocument
+	if err := b.readXML(packagePath, &pkg); err != nil {
+		return err
+	}
+	if len(pkg.Title) > 0 {
+		b.Title = strings.TrimSpace(pkg.Title[0])
+	}
+	if len(pkg.Language) > 0 {
+		b.Language = strings.TrimSpace(pkg.Language[0])
+	}
+	byID := make(map[string]Item, len(pkg.Manifest))
+	b.Manifest = make([]Item, 0, len(pkg.Manifest))
+	for _, entry := range pkg.Manifest {
+		href, ok := resolve(packagePath, entry.Href)
+		if !ok {
+			continue
+		}
+		item := Item{ID: entry.ID, Href: href, MediaType: entry.MediaType, Properties: entry.Properties}
+		b.Manifest = append(b.Manifest, item)
+		b.items[href] = item
+		byID[item.ID] = item
+	}
+	b.Spine = make([]SpineItem, 0, len(pkg.Spine.Itemrefs))
+	for _, itemref := range pkg.Spine.Itemrefs {
+		if item, ok := byID[itemref.IDRef]; ok {
+			b.Spine = append(b.Spine, SpineItem{ID: item.ID, Href: item.Href, Linear: itemref.Linear != "no"})
+		}
+	}
+	b.TOC = b.readTOC(byID[pkg.Spine.TOC])
+	return nil
+}
+
+// readTOC prefers the navigation document of EPUB 3 and falls back to the NCX of EPUB 2.
+// A missing or broken table of contents is not an error, the reader still has the spine.
+func (b *Book) readTOC(ncx Item) []TOCEntry {
+	for _, item := range b.Manifest {
+		if !hasProperty(item.Properties, "nav") {
+			continue
+		}
+		if toc, err := b.readNav(item.Href); err == nil && len(toc) > 0 {
+			return toc
+		}
+	}
+	if ncx.Href == "" {
+		for _, item := range b.Manifest {
+			if item.MediaType == ncxMediaType {
+				ncx = item
+				break
+			}
+		}
+	}
+	if ncx.Href != "" {
+		if toc, err := b.readNCX(ncx.Href); err == nil {
+			return toc
+		}
+	}
+	return []TOCEntry{}
+}
+
+// Resource returns the archive entry and the manifest item of the resource. Files missing from the manifest,
+// such as the package document itself, are not served.
+func (b *Book) Resource(name string) (*zip.File, Item, error) {
+	item, ok := b.items[name]
+	if !ok {
+		return nil, Item{}, ErrResourceNotFound
+	}
+	file, ok := b.files[name]
+	if !ok {
+		return nil, Item{}, ErrResourceNotFound
+	}
+	return file, item, nil
+}
+
+// resolve returns the path inside the archive of the href found in the document at base.
+// The fragment is kept, hrefs pointing outside of the archive are rejected.
+func resolve(base string, href string) (string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.Scheme != "" || ref.Host != "" {
+		return "", false
+	}
+	name := path.Dir(base) + "/" + ref.Path
+	if strings.HasPrefix(ref.Path, "/") {
+		name = ref.Path
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if ref.Path == "" {
+		name = base
+	}
+	if ref.Fragment != "" {
+		name += "#" + ref.Fragment
+	}
+	return name, name != ""
+}
+
+func hasProperty(properties string, property string) bool {
+	return slices.Contains(strings.Fields(properties), property)
+}
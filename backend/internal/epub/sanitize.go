@@ -0,0 +1,133 @@
+package epub
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// removedElements are dropped, together with their content unless they are void elements.
+// The value tells whether the element has content.
+var removedElements = map[string]bool{
+	"script": true, "iframe": true, "frameset": true, "object": true, "applet": true,
+	"embed": false, "frame": false, "base": false,
+}
+
+// urlAttributes hold links that must not run scripts.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "xlink:href": true, "action": true, "formaction": true, "data": true, "poster": true,
+}
+
+// Sanitize copies the content document without scripts, embedded frames and objects, event handler attributes
+// and javascript: links. The other tokens are copied byte for byte, so the markup stays valid XHTML.
+func Sanitize(w io.Writer, r io.Reader) error {
+	z := html.NewTokenizer(r)
+	// removed counts the open removed elements, their content is skipped.
+	removed := 0
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		}
+		// the tokenizer treats the content of script and style as raw text up to the end tag,
+		// which never comes for the self-closing tags of XHTML
+		if tokenType == html.SelfClosingTagToken {
+			z.NextIsNotRawText()
+		}
+		// TagAttr lowercases the attribute names in place, so the raw token is copied before it is inspected
+		raw := bytes.Clone(z.Raw())
+		switch tokenType {
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			nameBytes, hasAttr := z.TagName()
+			name := string(nameBytes)
+			if hasContent, ok := removedElements[localName(name)]; ok {
+				switch {
+				case !hasContent:
+				case tokenType == html.StartTagToken:
+					removed++
+				case tokenType == html.EndTagToken:
+					removed = max(removed-1, 0)
+				}
+				continue
+			}
+			if removed > 0 {
+				continue
+			}
+			if tokenType != html.EndTagToken && hasAttr {
+				if cleaned, changed := sanitizeTag(z, string(raw), tokenType); changed {
+					raw = []byte(cleaned)
+				}
+			}
+		default:
+			if removed > 0 {
+				continue
+			}
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// sanitizeTag returns the tag without the unsafe attributes and whether any was dropped.
+func sanitizeTag(z *html.Tokenizer, raw string, tokenType html.TokenType) (string, bool) {
+	// the tag name is taken from the raw token to keep its case, e.g. for SVG elements
+	end := strings.IndexAny(raw, " \t\r\n\f/>")
+	if end < 0 {
+		return raw, false
+	}
+	sb := strings.Builder{}
+	sb.WriteString(raw[:end])
+	changed := false
+	for more := true; more; {
+		var key, val []byte
+		key, val, more = z.TagAttr()
+		if !safeAttribute(string(key), string(val)) {
+			changed = true
+			continue
+		}
+		sb.WriteString(" ")
+		sb.Write(key)
+		sb.WriteString(`="`)
+		sb.WriteString(template.HTMLEscapeString(string(val)))
+		sb.WriteString(`"`)
+	}
+	if tokenType == html.SelfClosingTagToken {
+		sb.WriteString("/")
+	}
+	sb.WriteString(">")
+	return sb.String(), changed
+}
+
+func safeAttribute(key string, val string) bool {
+	if strings.HasPrefix(localName(key), "on") {
+		return false
+	}
+	if urlAttributes[key] {
+		// browsers ignore whitespace and control characters in the scheme
+		scheme := strings.Map(func(r rune) rune {
+			if r <= ' ' {
+				return -1
+			}
+			return r
+		}, strings.ToLower(val))
+		if strings.HasPrefix(scheme, "javascript:") || strings.HasPrefix(scheme, "vbscript:") {
+			return false
+		}
+	}
+	return !(key == "http-equiv" && strings.EqualFold(strings.TrimSpace(val), "refresh"))
+}
+
+// localName strips the namespace prefix, such as svg: in svg:script.
+func localName(name string) string {
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
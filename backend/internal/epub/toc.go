@@ -0,0 +1,130 @@
+package epub
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type ncxDocument struct {
+	NavMap []ncxNavPoint `xml:"navMap>navPoint"`
+}
+
+type ncxNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []ncxNavPoint `xml:"navPoint"`
+}
+
+func (b *Book) readNCX(name string) ([]TOCEntry, error) {
+	var ncx ncxDocument
+	if err := b.readXML(name, &ncx); err != nil {
+		return nil, err
+	}
+	return ncxEntries(name, ncx.NavMap), nil
+}
+
+func ncxEntries(base string, points []ncxNavPoint) []TOCEntry {
+	entries := make([]TOCEntry, 0, len(points))
+	for _, point := range points {
+		href, _ := resolve(base, point.Content.Src)
+		entries = append(entries, TOCEntry{
+			Title:    collapseSpaces(point.Label),
+			Href:     href,
+			Children: ncxEntries(base, point.Children),
+		})
+	}
+	return entries
+}
+
+// readNav reads the toc nav element of an EPUB 3 navigation document.
+func (b *Book) readNav(name string) ([]TOCEntry, error) {
+	content, err := b.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	doc, err := html.Parse(io.LimitReader(content, maxDocumentSize))
+	if err != nil {
+		return nil, err
+	}
+	nav := findNode(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Nav && hasProperty(attr(n, "epub:type"), "toc")
+	})
+	if nav == nil {
+		return nil, nil
+	}
+	list := findNode(nav, func(n *html.Node) bool { return n.DataAtom == atom.Ol })
+	if list == nil {
+		return nil, nil
+	}
+	return navEntries(name, list), nil
+}
+
+// navEntries reads the li elements of the ol, each one holds a link or a heading and an optional nested ol.
+func navEntries(base string, list *html.Node) []TOCEntry {
+	entries := make([]TOCEntry, 0)
+	for li := list.FirstChild; li != nil; li = li.NextSibling {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		entry := TOCEntry{Children: []TOCEntry{}}
+		for child := li.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.A:
+				entry.Href, _ = resolve(base, attr(child, "href"))
+				entry.Title = collapseSpaces(text(child))
+			case atom.Span:
+				entry.Title = collapseSpaces(text(child))
+			case atom.Ol:
+				entry.Children = navEntries(base, child)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findNode(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func text(n *html.Node) string {
+	sb := strings.Builder{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
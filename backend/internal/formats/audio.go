@@ -0,0 +1,48 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/Shelffy/shelffy/internal/audio"
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+var (
+	ftypMagic = []byte("ftyp")
+	id3Magic  = []byte("ID3")
+	// mp4AudioBrands are the brands of MP4 files that hold only audio, M4A tracks are stored as M4B.
+	mp4AudioBrands = []string{"M4B ", "M4A ", "M4P "}
+)
+
+// isMP4Audio checks the major and the compatible brands of the ftyp box that opens MP4 files.
+func isMP4Audio(header []byte) bool {
+	if len(header) < 16 || !bytes.Equal(header[4:8], ftypMagic) {
+		return false
+	}
+	end := min(int(binary.BigEndian.Uint32(header)), len(header))
+	for i := 8; i+4 <= end; i += 4 {
+		// the minor version follows the major brand
+		if i == 12 {
+			continue
+		}
+		if slices.Contains(mp4AudioBrands, string(header[i:i+4])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMP3(header []byte) bool {
+	return bytes.HasPrefix(header, id3Magic) || audio.IsFrameHeader(header)
+}
+
+// validateAudio reads the headers and the tags of the track.
+func validateAudio(format entities.BookFormat, r io.ReaderAt, size int64) error {
+	if _, err := audio.Probe(format, r, size); err != nil {
+		return corrupt(format, err.Error())
+	}
+	return nil
+}
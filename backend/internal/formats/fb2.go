@@ -0,0 +1,72 @@
+package formats
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+const fb2RootElement = "FictionBook"
+
+// asciiReader replaces non-ASCII bytes so documents in legacy encodings such as windows-1251,
+// which are common for FB2, can be checked without decoding them. Only the markup matters here.
+type asciiReader struct {
+	r io.Reader
+}
+
+func (a asciiReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	for i, b := range p[:n] {
+		if b >= 0x80 {
+			p[i] = '?'
+		}
+	}
+	return n, err
+}
+
+// validateFB2 checks that the document is well-formed XML with a FictionBook root containing a body.
+func validateFB2(r io.ReaderAt, size int64) error {
+	decoder := xml.NewDecoder(io.NewSectionReader(r, 0, size))
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") {
+			return input, nil
+		}
+		return asciiReader{r: input}, nil
+	}
+	depth := 0
+	hasRoot, hasBody := false, false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return corrupt(entities.BookFormatFB2, err.Error())
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if t.Name.Local != fb2RootElement {
+					return ErrUnsupportedFormat
+				}
+				hasRoot = true
+			} else if depth == 1 && t.Name.Local == "body" {
+				hasBody = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if !hasRoot {
+		return corrupt(entities.BookFormatFB2, "missing "+fb2RootElement+" element")
+	}
+	if !hasBody {
+		return corrupt(entities.BookFormatFB2, "missing body element")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package formats detects and validates the file formats of uploaded books and audiobook tracks.
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported book format")
+	ErrCorruptFile       = errors.New("corrupt book file")
+)
+
+// headerLength is the number of leading bytes read to recognise a format.
+const headerLength = 128
+
+var mimeTypes = map[entities.BookFormat]string{
+	entities.BookFormatEPUB:  "application/epub+zip",
+	entities.BookFormatPDF:   "application/pdf",
+	entities.BookFormatFB2:   "application/x-fictionbook+xml",
+	entities.BookFormatMOBI:  "application/x-mobipocket-ebook",
+	entities.BookFormatAZW3:  "application/vnd.amazon.ebook",
+	entities.BookFormatCBZ:   "application/vnd.comicbook+zip",
+	entities.BookFormatCBR:   "application/vnd.comicbook-rar",
+	entities.BookFormatCB7:   "application/x-cb7",
+	entities.BookFormatM4B:   "audio/mp4",
+	entities.BookFormatMP3:   "audio/mpeg",
+	entities.BookFormatKEPUB: "application/kepub+zip",
+	entities.BookFormatTXT:   "text/plain; charset=utf-8",
+}
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	pdfMagic      = []byte("%PDF-")
+	rar4Magic     = []byte("Rar!\x1a\x07\x00")
+	rar5Magic     = []byte("Rar!\x1a\x07\x01\x00")
+	sevenZipMagic = []byte("7z\xbc\xaf\x27\x1c")
+	utf8BOM       = []byte("\xef\xbb\xbf")
+	xmlPrefix     = []byte("<?xml")
+	fb2RootTag    = []byte("<FictionBook")
+)
+
+// MIMEType returns the MIME type of the format or application/octet-stream if the format is unknown.
+func MIMEType(format entities.BookFormat) string {
+	if mimeType, ok := mimeTypes[format]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// Known reports whether the format is one of the formats books can be stored or converted in.
+func Known(format entities.BookFormat) bool {
+	_, ok := mimeTypes[format]
+	return ok
+}
+
+// Extension returns the file name extension of the format including the leading dot.
+func Extension(format entities.BookFormat) string {
+	switch format {
+	case "":
+		return ""
+	case entities.BookFormatKEPUB:
+		// Kobo readers only pick up KEPUB files with the double extension
+		return ".kepub.epub"
+	}
+	return "." + string(format)
+}
+
+func corrupt(format entities.BookFormat, reason string) error {
+	return fmt.Errorf("%w: %s: %s", ErrCorruptFile, format, reason)
+}
+
+// Detect recognises the format of the file by its magic bytes and validates its structure.
+// It returns ErrUnsupportedFormat if the format is not recognised
+// and an error wrapping ErrCorruptFile if the file is damaged.
+func Detect(r io.ReaderAt, size int64) (entities.BookFormat, error) {
+	header := make([]byte, min(size, headerLength))
+	if _, err := r.ReadAt(header, 0); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		return detectZIP(r, size)
+	case bytes.HasPrefix(header, pdfMagic):
+		return entities.BookFormatPDF, validatePDF(r, size)
+	case bytes.HasPrefix(header, rar4Magic), bytes.HasPrefix(header, rar5Magic):
+		return entities.BookFormatCBR, nil
+	case bytes.HasPrefix(header, sevenZipMagic):
+		return entities.BookFormatCB7, validate7z(r, size)
+	case isMP4Audio(header):
+		return entities.BookFormatM4B, validateAudio(entities.BookFormatM4B, r, size)
+	case isMP3(header):
+		return entities.BookFormatMP3, validateAudio(entities.BookFormatMP3, r, size)
+	case isPDB(header):
+		return detectMOBI(r, size)
+	case looksLikeXML(header):
+		return entities.BookFormatFB2, validateFB2(r, size)
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func looksLikeXML(header []byte) bool {
+	header = bytes.TrimPrefix(header, utf8BOM)
+	header = bytes.TrimLeft(header, " \t\r\n")
+	return bytes.HasPrefix(header, xmlPrefix) || bytes.HasPrefix(header, fb2RootTag)
+}
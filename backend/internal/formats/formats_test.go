@@ -0,0 +1,240 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+// zipFile is an entry of a test archive.
+type zipFile struct {
+	name    string
+	content string
+}
+
+func newZIP(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.Create(file.name)
+		if err != nil {
+			t.Fatalf("cannot create zip entry: %v", err)
+		}
+		if _, err := f.Write([]byte(file.content)); err != nil {
+			t.Fatalf("cannot write zip entry: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("cannot close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const testContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// newPDF returns a minimal PDF whose startxref points at xrefOffset, or at the xref table when it is negative.
+func newPDF(xrefOffset int) []byte {
+	body := "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n"
+	if xrefOffset < 0 {
+		xrefOffset = len(body)
+	}
+	return []byte(fmt.Sprintf("%sxref\n0 1\n0000000000 65535 f \ntrailer\n<< /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", body, xrefOffset))
+}
+
+// newPDB returns a Palm database with a single record holding a MOBI header of the version.
+// The record list claims records entries and the record starts at recordOffset.
+func newPDB(records uint16, recordOffset uint32, magic string, version uint32) []byte {
+	header := make([]byte, pdbHeaderLength)
+	copy(header, "Test Book")
+	copy(header[pdbTypeOffset:], mobiTypeCreator)
+	binary.BigEndian.PutUint16(header[pdbRecordsOffset:], records)
+	list := make([]byte, pdbRecordInfoSize+2)
+	binary.BigEndian.PutUint32(list, recordOffset)
+	record := make([]byte, mobiHeaderOffset+mobiHeaderLength)
+	copy(record[mobiHeaderOffset:], magic)
+	binary.BigEndian.PutUint32(record[mobiHeaderOffset+20:], version)
+	return append(append(header, list...), record...)
+}
+
+func mp4Box(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(data)))
+	copy(header[4:], typ)
+	return append(header, data...)
+}
+
+// newMP4 returns an MP4 file of the major brand with a moov box holding a movie header of 90 seconds.
+func newMP4(brand string) []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 90_000)
+	ftyp := mp4Box("ftyp", []byte(brand), make([]byte, 4), []byte("isom"))
+	return append(ftyp, mp4Box("moov", mp4Box("mvhd", mvhd))...)
+}
+
+// mp3Frame is the header of an MPEG 1 layer III frame of 128 kbit/s at 44.1 kHz.
+var mp3Frame = []byte{0xff, 0xfb, 0x90, 0x00}
+
+func newMP3(tag []byte) []byte {
+	return append(append(tag, mp3Frame...), make([]byte, 4096)...)
+}
+
+func TestDetect(t *testing.T) {
+	epub := newZIP(t,
+		zipFile{"mimetype", epubMIMEType},
+		zipFile{epubContainerPath, testContainer},
+		zipFile{"OEBPS/content.opf", "<package/>"},
+		zipFile{"OEBPS/cover.jpg", "jpeg"},
+	)
+	pdf := newPDF(-1)
+	overflowingID3 := []byte("ID3\x03\x00\x00\x00\x00\x7f\x7f")
+	tests := []struct {
+		name    string
+		content []byte
+		want    entities.BookFormat
+		wantErr error
+	}{
+		{name: "epub", content: epub, want: entities.BookFormatEPUB},
+		{
+			name: "epub with a padded mimetype",
+			content: newZIP(t,
+				zipFile{"mimetype", epubMIMEType + "\n"},
+				zipFile{epubContainerPath, testContainer},
+				zipFile{"OEBPS/content.opf", "<package/>"},
+			),
+			want: entities.BookFormatEPUB,
+		},
+		{
+			name:    "epub without container",
+			content: newZIP(t, zipFile{"mimetype", epubMIMEType}, zipFile{"OEBPS/content.opf", "<package/>"}),
+			want:    entities.BookFormatEPUB,
+			wantErr: ErrCorruptFile,
+		},
+		{
+			name:    "epub without package document",
+			content: newZIP(t, zipFile{"mimetype", epubMIMEType}, zipFile{epubContainerPath, testContainer}),
+			want:    entities.BookFormatEPUB,
+			wantErr: ErrCorruptFile,
+		},
+		{
+			name:    "epub with invalid container",
+			content: newZIP(t, zipFile{"mimetype", epubMIMEType}, zipFile{epubContainerPath, "<container><rootfiles>"}),
+			want:    entities.BookFormatEPUB,
+			wantErr: ErrCorruptFile,
+		},
+		{name: "truncated epub", content: epub[:len(epub)-30], wantErr: ErrCorruptFile},
+		{
+			name:    "cbz",
+			content: newZIP(t, zipFile{"ComicInfo.xml", "<ComicInfo/>"}, zipFile{"01/Page 1.PNG", "png"}),
+			want:    entities.BookFormatCBZ,
+		},
+		{
+			// only the EPUB mimetype makes an EPUB, other archives with images are comics
+			name:    "cbz with another mimetype",
+			content: newZIP(t, zipFile{"mimetype", "application/zip"}, zipFile{"001.webp", "webp"}),
+			want:    entities.BookFormatCBZ,
+		},
+		{
+			name:    "zip without images",
+			content: newZIP(t, zipFile{"readme.txt", "text"}, zipFile{"notes.doc", "doc"}),
+			wantErr: ErrUnsupportedFormat,
+		},
+		{name: "pdf", content: pdf, want: entities.BookFormatPDF},
+		{
+			name:    "pdf with a cross-reference stream",
+			content: []byte("%PDF-1.5\n12 0 obj\n<< /Type /XRef >>\nstream\nendstream\nendobj\nstartxref\n9\n%%EOF"),
+			want:    entities.BookFormatPDF,
+		},
+		{name: "truncated pdf", content: pdf[:len(pdf)-20], want: entities.BookFormatPDF, wantErr: ErrCorruptFile},
+		{name: "pdf with a wrong startxref", content: newPDF(3), want: entities.BookFormatPDF, wantErr: ErrCorruptFile},
+		{name: "pdf with startxref past the end", content: newPDF(1 << 20), want: entities.BookFormatPDF, wantErr: ErrCorruptFile},
+		{name: "pdf header only", content: []byte("%PDF-"), want: entities.BookFormatPDF, wantErr: ErrCorruptFile},
+		{name: "rar4", content: append([]byte("Rar!\x1a\x07\x00"), make([]byte, 32)...), want: entities.BookFormatCBR},
+		{name: "rar5", content: append([]byte("Rar!\x1a\x07\x01\x00"), make([]byte, 32)...), want: entities.BookFormatCBR},
+		{name: "truncated 7z", content: []byte("7z\xbc\xaf\x27\x1c\x00\x04"), want: entities.BookFormatCB7, wantErr: ErrCorruptFile},
+		{name: "m4b", content: newMP4("M4B "), want: entities.BookFormatM4B},
+		{name: "m4a", content: newMP4("M4A "), want: entities.BookFormatM4B},
+		{name: "mp4 video", content: newMP4("isom")[:24], wantErr: ErrUnsupportedFormat},
+		{name: "m4b without moov", content: newMP4("M4B ")[:20], want: entities.BookFormatM4B, wantErr: ErrCorruptFile},
+		{name: "mp3", content: newMP3(nil), want: entities.BookFormatMP3},
+		{name: "mp3 with id3", content: newMP3([]byte("ID3\x03\x00\x00\x00\x00\x00\x00")), want: entities.BookFormatMP3},
+		{name: "mp3 with an overflowing id3 tag", content: newMP3(overflowingID3), want: entities.BookFormatMP3, wantErr: ErrCorruptFile},
+		{name: "id3 without audio", content: []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), want: entities.BookFormatMP3, wantErr: ErrCorruptFile},
+		{name: "mobi", content: newPDB(1, pdbHeaderLength+pdbRecordInfoSize+2, "MOBI", 6), want: entities.BookFormatMOBI},
+		{name: "azw3", content: newPDB(1, pdbHeaderLength+pdbRecordInfoSize+2, "MOBI", 8), want: entities.BookFormatAZW3},
+		{name: "mobi without records", content: newPDB(0, 0, "MOBI", 6), wantErr: ErrCorruptFile},
+		{name: "mobi with a truncated record list", content: newPDB(500, 0, "MOBI", 6), wantErr: ErrCorruptFile},
+		{name: "mobi with a record past the end", content: newPDB(1, 1<<20, "MOBI", 6), wantErr: ErrCorruptFile},
+		{name: "palm database of another kind", content: newPDB(1, pdbHeaderLength+pdbRecordInfoSize+2, "TEXt", 6), wantErr: ErrCorruptFile},
+		{
+			name:    "fb2",
+			content: []byte(`<?xml version="1.0" encoding="utf-8"?><FictionBook><description/><body><p>Text</p></body></FictionBook>`),
+			want:    entities.BookFormatFB2,
+		},
+		{
+			name:    "fb2 in windows-1251",
+			content: []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"windows-1251\"?>\n<FictionBook><body><p>\xcf\xf0\xe8\xe2\xe5\xf2</p></body></FictionBook>"),
+			want:    entities.BookFormatFB2,
+		},
+		{name: "fb2 without declaration", content: []byte("<FictionBook><body/></FictionBook>"), want: entities.BookFormatFB2},
+		{
+			name:    "fb2 without body",
+			content: []byte(`<?xml version="1.0"?><FictionBook><description/></FictionBook>`),
+			want:    entities.BookFormatFB2,
+			wantErr: ErrCorruptFile,
+		},
+		{
+			name:    "truncated fb2",
+			content: []byte(`<?xml version="1.0"?><FictionBook><body><p>Te`),
+			want:    entities.BookFormatFB2,
+			wantErr: ErrCorruptFile,
+		},
+		{
+			name:    "xml of another kind",
+			content: []byte(`<?xml version="1.0"?><html><body/></html>`),
+			want:    entities.BookFormatFB2,
+			wantErr: ErrUnsupportedFormat,
+		},
+		{name: "text", content: []byte("Chapter 1\n\nIt was a dark and stormy night."), wantErr: ErrUnsupportedFormat},
+		{name: "empty", content: nil, wantErr: ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(bytes.NewReader(tt.content), int64(len(tt.content)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Detect() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		format entities.BookFormat
+		want   string
+	}{
+		{format: entities.BookFormatEPUB, want: ".epub"},
+		{format: entities.BookFormatKEPUB, want: ".kepub.epub"},
+		{format: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Extension(tt.format); got != tt.want {
+			t.Errorf("Extension(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+const (
+	// pdbHeaderLength is the length of the Palm database header, the record list follows it.
+	pdbHeaderLength   = 78
+	pdbTypeOffset     = 60
+	pdbRecordsOffset  = 76
+	pdbRecordInfoSize = 8
+	// mobiHeaderOffset is where the MOBI header starts in the first record, after the PalmDOC header.
+	mobiHeaderOffset = 16
+	mobiHeaderLength = 24
+	// kf8Version is the MOBI file version of KF8 books, which are sold as AZW3.
+	kf8Version = 8
+)
+
+var (
+	mobiTypeCreator = []byte("BOOKMOBI")
+	mobiMagic       = []byte("MOBI")
+)
+
+func isPDB(header []byte) bool {
+	return len(header) >= pdbHeaderLength && bytes.Equal(header[pdbTypeOffset:pdbTypeOffset+len(mobiTypeCreator)], mobiTypeCreator)
+}
+
+// detectMOBI validates the record list of the Palm database and tells MOBI from KF8 by the MOBI header version.
+func detectMOBI(r io.ReaderAt, size int64) (entities.BookFormat, error) {
+	header := make([]byte, pdbHeaderLength)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return "", corrupt(entities.BookFormatMOBI, err.Error())
+	}
+	recordsCount := int64(binary.BigEndian.Uint16(header[pdbRecordsOffset:]))
+	if recordsCount == 0 {
+		return "", corrupt(entities.BookFormatMOBI, "no records")
+	}
+	records := make([]byte, recordsCount*pdbRecordInfoSize)
+	if pdbHeaderLength+int64(len(records)) > size {
+		return "", corrupt(entities.BookFormatMOBI, "truncated record list")
+	}
+	if _, err := r.ReadAt(records, pdbHeaderLength); err != nil {
+		return "", corrupt(entities.BookFormatMOBI, err.Error())
+	}
+	previous := int64(0)
+	for i := range recordsCount {
+		offset := int64(binary.BigEndian.Uint32(records[i*pdbRecordInfoSize:]))
+		if offset < previous || offset >= size {
+			return "", corrupt(entities.BookFormatMOBI, "invalid record offset")
+		}
+		previous = offset
+	}
+	firstRecord := int64(binary.BigEndian.Uint32(records))
+	mobiHeader := make([]byte, mobiHeaderLength)
+	if _, err := r.ReadAt(mobiHeader, firstRecord+mobiHeaderOffset); err != nil {
+		return "", corrupt(entities.BookFormatMOBI, "truncated MOBI header")
+	}
+	if !bytes.HasPrefix(mobiHeader, mobiMagic) {
+		return "", corrupt(entities.BookFormatMOBI, "missing MOBI header")
+	}
+	if binary.BigEndian.Uint32(mobiHeader[20:]) >= kf8Version {
+		return entities.BookFormatAZW3, nil
+	}
+	return entities.BookFormatMOBI, nil
+}
@@ -0,0 +1,52 @@
+package formats
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+const (
+	// pdfTrailerLength is how far from the end of the file the trailer is looked for.
+	// The specification puts %%EOF within the last 1024 bytes.
+	pdfTrailerLength = 1024
+	pdfXRefLookSize  = 32
+)
+
+var (
+	pdfEOFMarker  = []byte("%%EOF")
+	pdfStartXRef  = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+	pdfXRefTable  = []byte("xref")
+	pdfXRefStream = regexp.MustCompile(`^\s*\d+\s+\d+\s+obj`)
+)
+
+// validatePDF checks that the file has a trailer and that startxref points at a cross-reference table or stream.
+func validatePDF(r io.ReaderAt, size int64) error {
+	trailerStart := max(size-pdfTrailerLength, 0)
+	trailer := make([]byte, size-trailerStart)
+	if _, err := r.ReadAt(trailer, trailerStart); err != nil && err != io.EOF {
+		return corrupt(entities.BookFormatPDF, err.Error())
+	}
+	if !bytes.Contains(trailer, pdfEOFMarker) {
+		return corrupt(entities.BookFormatPDF, "missing %%EOF marker")
+	}
+	matches := pdfStartXRef.FindAllSubmatch(trailer, -1)
+	if len(matches) == 0 {
+		return corrupt(entities.BookFormatPDF, "missing startxref")
+	}
+	offset, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || offset >= size {
+		return corrupt(entities.BookFormatPDF, "startxref points outside of the file")
+	}
+	xref := make([]byte, min(pdfXRefLookSize, size-offset))
+	if _, err := r.ReadAt(xref, offset); err != nil && err != io.EOF {
+		return corrupt(entities.BookFormatPDF, err.Error())
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(xref, " \t\r\n"), pdfXRefTable) && !pdfXRefStream.Match(xref) {
+		return corrupt(entities.BookFormatPDF, "startxref does not point at a cross-reference section")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package formats
+
+import (
+	"io"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/bodgit/sevenzip"
+)
+
+// validate7z reads the headers of the 7z archive, which list its files.
+func validate7z(r io.ReaderAt, size int64) error {
+	if _, err := sevenzip.NewReader(r, size); err != nil {
+		return corrupt(entities.BookFormatCB7, err.Error())
+	}
+	return nil
+}
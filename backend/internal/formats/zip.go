@@ -0,0 +1,92 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+)
+
+const (
+	epubMIMEType      = "application/epub+zip"
+	epubContainerPath = "META-INF/container.xml"
+	// maxContainerSize limits how much of container.xml is read, it is a few hundred bytes in practice.
+	maxContainerSize = 1 << 20
+)
+
+var comicImageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp"}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// detectZIP tells an EPUB from a CBZ by the mimetype entry and validates the archive.
+func detectZIP(r io.ReaderAt, size int64) (entities.BookFormat, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCorruptFile, err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	if mimetype, ok := files["mimetype"]; ok {
+		content, err := readZIPFile(mimetype, int64(len(epubMIMEType)+2))
+		if err != nil {
+			return "", corrupt(entities.BookFormatEPUB, "cannot read mimetype: "+err.Error())
+		}
+		if string(bytes.TrimSpace(content)) == epubMIMEType {
+			return entities.BookFormatEPUB, validateEPUB(files)
+		}
+	}
+	for _, file := range archive.File {
+		ext := strings.ToLower(path.Ext(file.Name))
+		for _, imageExt := range comicImageExtensions {
+			if ext == imageExt {
+				return entities.BookFormatCBZ, nil
+			}
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func validateEPUB(files map[string]*zip.File) error {
+	containerFile, ok := files[epubContainerPath]
+	if !ok {
+		return corrupt(entities.BookFormatEPUB, "missing "+epubContainerPath)
+	}
+	content, err := readZIPFile(containerFile, maxContainerSize)
+	if err != nil {
+		return corrupt(entities.BookFormatEPUB, "cannot read "+epubContainerPath+": "+err.Error())
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(content, &container); err != nil {
+		return corrupt(entities.BookFormatEPUB, "invalid "+epubContainerPath+": "+err.Error())
+	}
+	if len(container.Rootfiles) == 0 {
+		return corrupt(entities.BookFormatEPUB, "no rootfile in "+epubContainerPath)
+	}
+	for _, rootfile := range container.Rootfiles {
+		if _, ok := files[rootfile.FullPath]; !ok {
+			return corrupt(entities.BookFormatEPUB, "missing package document "+rootfile.FullPath)
+		}
+	}
+	return nil
+}
+
+// readZIPFile reads at most limit bytes of the file.
+func readZIPFile(file *zip.File, limit int64) ([]byte, error) {
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(io.LimitReader(content, limit))
+}
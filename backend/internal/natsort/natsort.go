@@ -0,0 +1,49 @@
+// Package natsort compares file names in natural order.
+package natsort
+
+import "strings"
+
+// Compare orders the names the way people number files, so page2 comes before page10.
+// Letters are compared ignoring ASCII case.
+func Compare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			numA, restA := splitNumber(a)
+			numB, restB := splitNumber(b)
+			trimmedA, trimmedB := strings.TrimLeft(numA, "0"), strings.TrimLeft(numB, "0")
+			if c := len(trimmedA) - len(trimmedB); c != 0 {
+				return c
+			}
+			if c := strings.Compare(trimmedA, trimmedB); c != 0 {
+				return c
+			}
+			a, b = restA, restB
+			continue
+		}
+		ca, cb := lowerByte(a[0]), lowerByte(b[0])
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lowerByte(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func splitNumber(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
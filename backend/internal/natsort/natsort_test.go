@@ -0,0 +1,46 @@
+package natsort
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		// want is the sign of the result
+		want int
+	}{
+		{a: "page2.jpg", b: "page10.jpg", want: -1},
+		{a: "page10.jpg", b: "page2.jpg", want: 1},
+		{a: "page2.jpg", b: "page2.jpg", want: 0},
+		{a: "Page2.JPG", b: "page2.jpg", want: 0},
+		{a: "page002.jpg", b: "page10.jpg", want: -1},
+		{a: "page01.jpg", b: "page1.jpg", want: 0},
+		{a: "page0.jpg", b: "page00.jpg", want: 0},
+		{a: "1/10.jpg", b: "2/1.jpg", want: -1},
+		{a: "chapter 9/1.jpg", b: "chapter 10/1.jpg", want: -1},
+		{a: "v1c2", b: "v1c10", want: -1},
+		{a: "page", b: "page1", want: -1},
+		{a: "", b: "a", want: -1},
+		{a: "a", b: "B", want: -1},
+		{a: "9.jpg", b: "a.jpg", want: -1},
+		// numbers longer than any integer type
+		{a: "99999999999999999999999.jpg", b: "100000000000000000000000.jpg", want: -1},
+	}
+	for _, tt := range tests {
+		if got := cmp.Compare(Compare(tt.a, tt.b), 0); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareSortsPages(t *testing.T) {
+	want := []string{"cover.jpg", "page1.jpg", "page2.jpg", "page9.jpg", "page10.jpg", "page11.jpg", "page100.jpg"}
+	names := []string{"page10.jpg", "page2.jpg", "cover.jpg", "page100.jpg", "page1.jpg", "page11.jpg", "page9.jpg"}
+	slices.SortFunc(names, Compare)
+	if !slices.Equal(names, want) {
+		t.Errorf("sorted = %q, want %q", names, want)
+	}
+}
@@ -13,10 +13,22 @@ import (
 )
 
 type Books struct {
-	ID         uuid.UUID `sql:"primary_key"`
-	Title      string
-	UploadedBy uuid.UUID
-	UploadedAt *time.Time
-	Hash       []byte
-	Path       string
+	ID            uuid.UUID `sql:"primary_key"`
+	Title         string
+	UploadedBy    uuid.UUID
+	UploadedAt    *time.Time
+	DeletedAt     *time.Time
+	Authors       string
+	Description   string
+	Language      string
+	Publisher     string
+	PublishedDate *time.Time
+	Isbn          string
+	Series        string
+	SeriesIndex   *float64
+	Tags          string
+	Version       int32
+	Identifiers   string
+	Rating        *int16
+	CoverPath     string
 }
@@ -17,12 +17,24 @@ type booksTable struct {
 	postgres.Table
 
 	// Columns
-	ID         postgres.ColumnString
-	Title      postgres.ColumnString
-	UploadedBy postgres.ColumnString
-	UploadedAt postgres.ColumnTimestamp
-	Hash       postgres.ColumnBytea
-	Path       postgres.ColumnString
+	ID            postgres.ColumnString
+	Title         postgres.ColumnString
+	UploadedBy    postgres.ColumnString
+	UploadedAt    postgres.ColumnTimestamp
+	DeletedAt     postgres.ColumnTimestamp
+	Authors       postgres.ColumnString
+	Description   postgres.ColumnString
+	Language      postgres.ColumnString
+	Publisher     postgres.ColumnString
+	PublishedDate postgres.ColumnDate
+	Isbn          postgres.ColumnString
+	Series        postgres.ColumnString
+	SeriesIndex   postgres.ColumnFloat
+	Tags          postgres.ColumnString
+	Version       postgres.ColumnInteger
+	Identifiers   postgres.ColumnString
+	Rating        postgres.ColumnInteger
+	CoverPath     postgres.ColumnString
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -64,27 +76,51 @@ func newBooksTable(schemaName, tableName, alias string) *BooksTable {
 
 func newBooksTableImpl(schemaName, tableName, alias string) booksTable {
 	var (
-		IDColumn         = postgres.StringColumn("id")
-		TitleColumn      = postgres.StringColumn("title")
-		UploadedByColumn = postgres.StringColumn("uploaded_by")
-		UploadedAtColumn = postgres.TimestampColumn("uploaded_at")
-		HashColumn       = postgres.ByteaColumn("hash")
-		PathColumn       = postgres.StringColumn("path")
-		allColumns       = postgres.ColumnList{IDColumn, TitleColumn, UploadedByColumn, UploadedAtColumn, HashColumn, PathColumn}
-		mutableColumns   = postgres.ColumnList{TitleColumn, UploadedByColumn, UploadedAtColumn, HashColumn, PathColumn}
-		defaultColumns   = postgres.ColumnList{TitleColumn, UploadedAtColumn}
+		IDColumn            = postgres.StringColumn("id")
+		TitleColumn         = postgres.StringColumn("title")
+		UploadedByColumn    = postgres.StringColumn("uploaded_by")
+		UploadedAtColumn    = postgres.TimestampColumn("uploaded_at")
+		DeletedAtColumn     = postgres.TimestampColumn("deleted_at")
+		AuthorsColumn       = postgres.StringColumn("authors")
+		DescriptionColumn   = postgres.StringColumn("description")
+		LanguageColumn      = postgres.StringColumn("language")
+		PublisherColumn     = postgres.StringColumn("publisher")
+		PublishedDateColumn = postgres.DateColumn("published_date")
+		IsbnColumn          = postgres.StringColumn("isbn")
+		SeriesColumn        = postgres.StringColumn("series")
+		SeriesIndexColumn   = postgres.FloatColumn("series_index")
+		TagsColumn          = postgres.StringColumn("tags")
+		VersionColumn       = postgres.IntegerColumn("version")
+		IdentifiersColumn   = postgres.StringColumn("identifiers")
+		RatingColumn        = postgres.IntegerColumn("rating")
+		CoverPathColumn     = postgres.StringColumn("cover_path")
+		allColumns          = postgres.ColumnList{IDColumn, TitleColumn, UploadedByColumn, UploadedAtColumn, DeletedAtColumn, AuthorsColumn, DescriptionColumn, LanguageColumn, PublisherColumn, PublishedDateColumn, IsbnColumn, SeriesColumn, SeriesIndexColumn, TagsColumn, VersionColumn, IdentifiersColumn, RatingColumn, CoverPathColumn}
+		mutableColumns      = postgres.ColumnList{TitleColumn, UploadedByColumn, UploadedAtColumn, DeletedAtColumn, AuthorsColumn, DescriptionColumn, LanguageColumn, PublisherColumn, PublishedDateColumn, IsbnColumn, SeriesColumn, SeriesIndexColumn, TagsColumn, VersionColumn, IdentifiersColumn, RatingColumn, CoverPathColumn}
+		defaultColumns      = postgres.ColumnList{TitleColumn, UploadedAtColumn, AuthorsColumn, DescriptionColumn, LanguageColumn, PublisherColumn, IsbnColumn, SeriesColumn, TagsColumn, VersionColumn, IdentifiersColumn, CoverPathColumn}
 	)
 
 	return booksTable{
 		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
-		ID:         IDColumn,
-		Title:      TitleColumn,
-		UploadedBy: UploadedByColumn,
-		UploadedAt: UploadedAtColumn,
-		Hash:       HashColumn,
-		Path:       PathColumn,
+		ID:            IDColumn,
+		Title:         TitleColumn,
+		UploadedBy:    UploadedByColumn,
+		UploadedAt:    UploadedAtColumn,
+		DeletedAt:     DeletedAtColumn,
+		Authors:       AuthorsColumn,
+		Description:   DescriptionColumn,
+		Language:      LanguageColumn,
+		Publisher:     PublisherColumn,
+		PublishedDate: PublishedDateColumn,
+		Isbn:          IsbnColumn,
+		Series:        SeriesColumn,
+		SeriesIndex:   SeriesIndexColumn,
+		Tags:          TagsColumn,
+		Version:       VersionColumn,
+		Identifiers:   IdentifiersColumn,
+		Rating:        RatingColumn,
+		CoverPath:     CoverPathColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAudioTrackExists = errors.New("the file is already a track of the book")
+
+type AudioTracks interface {
+	// Create appends the track to the book, its number follows the last track of the book.
+	// It returns ErrAudioTrackExists when the file already is a track.
+	Create(ctx context.Context, track entities.AudioTrack) (entities.AudioTrack, error)
+	// GetByBookID returns the tracks of the book in playing order.
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.AudioTrack, error)
+}
+
+const audioTrackColumns = `file_id, book_id, number, title, duration, chapters`
+
+// audioChapterRow is a chapter in the chapters column, Start is in milliseconds.
+type audioChapterRow struct {
+	Title string `json:"title"`
+	Start int64  `json:"start"`
+}
+
+type postgresAudioTracksRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAudioTracksPSQLRepository(pool *pgxpool.Pool) AudioTracks {
+	return postgresAudioTracksRepository{pool: pool}
+}
+
+func scanAudioTrack(row scannable) (entities.AudioTrack, error) {
+	track := entities.AudioTrack{}
+	var duration int64
+	var chapters []audioChapterRow
+	if err := row.Scan(&track.FileID, &track.BookID, &track.Number, &track.Title, &duration, &chapters); err != nil {
+		return entities.AudioTrack{}, err
+	}
+	track.Duration = time.Duration(duration) * time.Millisecond
+	track.Chapters = make([]entities.AudioChapter, len(chapters))
+	for i, chapter := range chapters {
+		track.Chapters[i] = entities.AudioChapter{Title: chapter.Title, Start: time.Duration(chapter.Start) * time.Millisecond}
+	}
+	return track, nil
+}
+
+func (r postgresAudioTracksRepository) Create(ctx context.Context, track entities.AudioTrack) (entities.AudioTrack, error) {
+	query := `
+INSERT INTO audio_tracks (file_id, book_id, number, title, duration, chapters)
+VALUES ($1, $2, (SELECT COALESCE(MAX(number), 0) + 1 FROM audio_tracks WHERE book_id = $2), $3, $4, $5)
+RETURNING ` + audioTrackColumns
+	chapters := make([]audioChapterRow, len(track.Chapters))
+	for i, chapter := range track.Chapters {
+		chapters[i] = audioChapterRow{Title: chapter.Title, Start: chapter.Start.Milliseconds()}
+	}
+	encoded, err := json.Marshal(chapters)
+	if err != nil {
+		return entities.AudioTrack{}, err
+	}
+	created, err := scanAudioTrack(r.pool.QueryRow(
+		ctx,
+		query,
+		track.FileID, track.BookID, track.Title, track.Duration.Milliseconds(), encoded,
+	))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return entities.AudioTrack{}, ErrAudioTrackExists
+		case pgForeignKeyViolation:
+			return entities.AudioTrack{}, ErrBookFileNotFound
+		}
+	}
+	return created, err
+}
+
+func (r postgresAudioTracksRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.AudioTrack, error) {
+	query := `SELECT ` + audioTrackColumns + ` FROM audio_tracks WHERE book_id = $1 ORDER BY number`
+	rows, err := r.pool.Query(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tracks := make([]entities.AudioTrack, 0)
+	for rows.Next() {
+		track, err := scanAudioTrack(rows)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
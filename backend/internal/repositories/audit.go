@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditLog interface {
+	Create(ctx context.Context, entry entities.AuditEntry) error
+	GetByEmail(ctx context.Context, email string, limit, offset uint64) ([]entities.AuditEntry, error)
+}
+
+type postgresAuditLogRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewAuditLogPSQLRepository(conn *pgxpool.Pool) AuditLog {
+	return postgresAuditLogRepository{conn: conn}
+}
+
+func (r postgresAuditLogRepository) Create(ctx context.Context, entry entities.AuditEntry) error {
+	query := `
+INSERT INTO auth_audit_log (user_id, email, ip, event, details)
+VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.conn.Exec(ctx, query, entry.UserID, entry.Email, entry.IP, entry.Event, entry.Details)
+	return err
+}
+
+func (r postgresAuditLogRepository) GetByEmail(ctx context.Context, email string, limit, offset uint64) ([]entities.AuditEntry, error) {
+	query := `
+SELECT id, user_id, email, ip, event, details, created_at
+FROM auth_audit_log
+WHERE email = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	rows, err := r.conn.Query(ctx, query, email, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]entities.AuditEntry, 0)
+	for rows.Next() {
+		entry := entities.AuditEntry{}
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Email, &entry.IP, &entry.Event, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -2,23 +2,37 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/Shelffy/shelffy/internal/entities"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
 type Session interface {
 	Create(ctx context.Context, session entities.Session) (entities.Session, error)
 	GetByID(ctx context.Context, id string) (entities.Session, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Session, error)
+	Touch(ctx context.Context, id string, ip string, lastSeenAt time.Time) error
+	Rotate(ctx context.Context, id string, newID string) (entities.Session, error)
+	DeleteStale(ctx context.Context, lastSeenBefore time.Time) (int64, error)
+	CountActive(ctx context.Context, lastSeenAfter time.Time) (int64, error)
 	Deactivate(ctx context.Context, id string) error
+	DeactivateByPublicID(ctx context.Context, userID uuid.UUID, publicID uuid.UUID) error
 	DeactivateByUserID(ctx context.Context, userID uuid.UUID, exceptSessionIDs ...string) error
 	DeleteSession(ctx context.Context, id string) error
 	DeleteSessionsByUserID(ctx context.Context, userID uuid.UUID, except ...string) error
 }
 
+const sessionColumns = `id, public_id, user_id, is_active, expires_at, user_agent, ip, device_name, created_at, last_seen_at, rotated_at, COALESCE(previous_id, '')`
+
 type postgresSessionRepository struct {
 	conn *pgxpool.Pool
 }
@@ -31,33 +45,61 @@ func NewAuthPSQLRepository(conn *pgxpool.Pool) Session {
 
 func (r postgresSessionRepository) scanSessionRow(row scannable) (entities.Session, error) {
 	session := entities.Session{}
-	err := row.Scan(&session.ID, &session.UserID, &session.IsActive, &session.ExpiresAt)
+	err := row.Scan(
+		&session.ID,
+		&session.PublicID,
+		&session.UserID,
+		&session.IsActive,
+		&session.ExpiresAt,
+		&session.UserAgent,
+		&session.IP,
+		&session.DeviceName,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.RotatedAt,
+		&session.PreviousID,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return session, ErrSessionNotFound
+	}
 	return session, err
 }
 
 func (r postgresSessionRepository) Create(ctx context.Context, session entities.Session) (entities.Session, error) {
 	query := `
-INSERT INTO sessions (id, user_id, is_active, expires_at)
-VALUES ($1, $2, $3, $4)
-RETURNING id, user_id, is_active, expires_at;`
-	row := r.conn.QueryRow(ctx, query, session.ID, session.UserID, session.IsActive, session.ExpiresAt)
+INSERT INTO sessions (id, user_id, is_active, expires_at, user_agent, ip, device_name)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + sessionColumns
+	row := r.conn.QueryRow(
+		ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.IsActive,
+		session.ExpiresAt,
+		session.UserAgent,
+		session.IP,
+		session.DeviceName,
+	)
 	return r.scanSessionRow(row)
 }
 
+// GetByID also finds sessions by their ID before the last rotation, callers must check the grace period.
 func (r postgresSessionRepository) GetByID(ctx context.Context, id string) (entities.Session, error) {
 	query := `
-SELECT id, user_id , is_active, expires_at
+SELECT ` + sessionColumns + `
 FROM sessions
-WHERE id = $1`
+WHERE id = $1 OR previous_id = $1`
 	row := r.conn.QueryRow(ctx, query, id)
 	return r.scanSessionRow(row)
 }
 
 func (r postgresSessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Session, error) {
 	query := `
-SELECT id, user_id, is_active, expires_at
+SELECT ` + sessionColumns + `
 FROM sessions
-WHERE user_id = $1`
+WHERE user_id = $1
+ORDER BY last_seen_at DESC`
 	rows, err := r.conn.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
@@ -78,7 +120,7 @@ func (r postgresSessionRepository) Update(ctx context.Context, id string, fieldV
 	builder := sq.Update("sessions").
 		SetMap(fieldValue).
 		Where(sq.Eq{"id": id}).
-		Suffix("RETURNING id, user_id, is_active, expires_at").
+		Suffix("RETURNING " + sessionColumns).
 		PlaceholderFormat(sq.Dollar)
 	query, args, err := builder.ToSql()
 	if err != nil {
@@ -88,17 +130,71 @@ func (r postgresSessionRepository) Update(ctx context.Context, id string, fieldV
 	return r.scanSessionRow(row)
 }
 
+func (r postgresSessionRepository) Touch(ctx context.Context, id string, ip string, lastSeenAt time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = $2, ip = $3 WHERE id = $1`
+	_, err := r.conn.Exec(ctx, query, id, lastSeenAt, ip)
+	return err
+}
+
+func (r postgresSessionRepository) Rotate(ctx context.Context, id string, newID string) (entities.Session, error) {
+	query := `
+UPDATE sessions
+SET previous_id = id, id = $2, rotated_at = NOW()
+WHERE id = $1
+RETURNING ` + sessionColumns
+	return r.scanSessionRow(r.conn.QueryRow(ctx, query, id, newID))
+}
+
+func (r postgresSessionRepository) DeleteStale(ctx context.Context, lastSeenBefore time.Time) (int64, error) {
+	query := `
+DELETE FROM sessions
+WHERE is_active = false OR expires_at < NOW() OR last_seen_at < $1`
+	tag, err := r.conn.Exec(ctx, query, lastSeenBefore)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r postgresSessionRepository) CountActive(ctx context.Context, lastSeenAfter time.Time) (int64, error) {
+	query := `
+SELECT COUNT(*)
+FROM sessions
+WHERE is_active = true AND expires_at > NOW() AND last_seen_at > $1`
+	var count int64
+	err := r.conn.QueryRow(ctx, query, lastSeenAfter).Scan(&count)
+	return count, err
+}
+
 func (r postgresSessionRepository) Deactivate(ctx context.Context, id string) error {
 	query := `UPDATE sessions SET is_active = false WHERE id = $1`
 	_, err := r.conn.Exec(ctx, query, id)
 	return err
 }
 
+func (r postgresSessionRepository) DeactivateByPublicID(ctx context.Context, userID uuid.UUID, publicID uuid.UUID) error {
+	query := `
+UPDATE sessions
+SET is_active = false
+WHERE user_id = $1 AND public_id = $2
+RETURNING id`
+	var id string
+	err := r.conn.QueryRow(ctx, query, userID, publicID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
 func (r postgresSessionRepository) DeactivateByUserID(ctx context.Context, userID uuid.UUID, exceptSessionIDs ...string) error {
 	builder := `
 UPDATE sessions
 SET is_active = false
-WHERE user_id = $1 AND id NOT IN ($2)`
+WHERE user_id = $1 AND NOT (id = ANY($2))`
+	if exceptSessionIDs == nil {
+		// nil is sent as NULL and NOT (id = ANY(NULL)) matches nothing
+		exceptSessionIDs = []string{}
+	}
 	_, err := r.conn.Exec(ctx, builder, userID, exceptSessionIDs)
 	return err
 }
@@ -114,7 +210,10 @@ WHERE id = $1`
 func (r postgresSessionRepository) DeleteSessionsByUserID(ctx context.Context, userID uuid.UUID, except ...string) error {
 	query := `
 DELETE FROM sessions
-WHERE user_id = $1 AND id NOT IN ($2)`
+WHERE user_id = $1 AND NOT (id = ANY($2))`
+	if except == nil {
+		except = []string{}
+	}
 	_, err := r.conn.Exec(ctx, query, userID, except)
 	return err
 }
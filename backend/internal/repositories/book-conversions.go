@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrBookConversionNotFound = errors.New("book conversion not found")
+)
+
+type BookConversions interface {
+	// Queue creates a pending conversion of the book unless one exists. A failed conversion is reset to pending
+	// when retryFailed is set. queued reports whether the returned conversion was created or reset.
+	Queue(ctx context.Context, bookID uuid.UUID, format entities.BookFormat, retryFailed bool) (conversion entities.BookConversion, queued bool, err error)
+	Get(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) (entities.BookConversion, error)
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.BookConversion, error)
+	Complete(ctx context.Context, bookID uuid.UUID, format entities.BookFormat, storagePath string, size int64) error
+	Fail(ctx context.Context, bookID uuid.UUID, format entities.BookFormat, reason string) error
+}
+
+const bookConversionColumns = `book_id, format, status, storage_path, size, error, created_at, updated_at`
+
+type postgresBookConversionsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBookConversionsPSQLRepository(pool *pgxpool.Pool) BookConversions {
+	return postgresBookConversionsRepository{pool: pool}
+}
+
+func scanBookConversion(row scannable) (entities.BookConversion, error) {
+	conversion := entities.BookConversion{}
+	err := row.Scan(
+		&conversion.BookID, &conversion.Format, &conversion.Status, &conversion.StoragePath,
+		&conversion.Size, &conversion.Error, &conversion.CreatedAt, &conversion.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.BookConversion{}, ErrBookConversionNotFound
+	}
+	return conversion, err
+}
+
+func (r postgresBookConversionsRepository) Queue(
+	ctx context.Context,
+	bookID uuid.UUID,
+	format entities.BookFormat,
+	retryFailed bool,
+) (entities.BookConversion, bool, error) {
+	query := `
+INSERT INTO book_conversions (book_id, format, status)
+VALUES ($1, $2, 'pending')
+ON CONFLICT (book_id, format) DO UPDATE
+SET status = 'pending', error = '', updated_at = NOW()
+WHERE book_conversions.status = 'failed' AND $3
+RETURNING ` + bookConversionColumns
+	conversion, err := scanBookConversion(r.pool.QueryRow(ctx, query, bookID, format, retryFailed))
+	if errors.Is(err, ErrBookConversionNotFound) {
+		// the conversion exists and was left as it is
+		conversion, err = r.Get(ctx, bookID, format)
+		return conversion, false, err
+	}
+	return conversion, err == nil, err
+}
+
+func (r postgresBookConversionsRepository) Get(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) (entities.BookConversion, error) {
+	query := `SELECT ` + bookConversionColumns + ` FROM book_conversions WHERE book_id = $1 AND format = $2`
+	return scanBookConversion(r.pool.QueryRow(ctx, query, bookID, format))
+}
+
+func (r postgresBookConversionsRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.BookConversion, error) {
+	query := `SELECT ` + bookConversionColumns + ` FROM book_conversions WHERE book_id = $1 ORDER BY format`
+	rows, err := r.pool.Query(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conversions := make([]entities.BookConversion, 0)
+	for rows.Next() {
+		conversion, err := scanBookConversion(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversions = append(conversions, conversion)
+	}
+	return conversions, rows.Err()
+}
+
+func (r postgresBookConversionsRepository) Complete(
+	ctx context.Context,
+	bookID uuid.UUID,
+	format entities.BookFormat,
+	storagePath string,
+	size int64,
+) error {
+	query := `
+UPDATE book_conversions
+SET status = 'completed', storage_path = $3, size = $4, error = '', updated_at = NOW()
+WHERE book_id = $1 AND format = $2`
+	tag, err := r.pool.Exec(ctx, query, bookID, format, storagePath, size)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookConversionNotFound
+	}
+	return nil
+}
+
+func (r postgresBookConversionsRepository) Fail(ctx context.Context, bookID uuid.UUID, format entities.BookFormat, reason string) error {
+	query := `
+UPDATE book_conversions
+SET status = 'failed', error = $3, updated_at = NOW()
+WHERE book_id = $1 AND format = $2`
+	tag, err := r.pool.Exec(ctx, query, bookID, format, reason)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookConversionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrBookDeliveryNotFound = errors.New("book delivery not found")
+)
+
+type BookDeliveries interface {
+	Create(ctx context.Context, delivery entities.BookDelivery) (entities.BookDelivery, error)
+	GetByID(ctx context.Context, deliveryID uuid.UUID) (entities.BookDelivery, error)
+	// GetManyByUserID returns the deliveries of the user, newest first.
+	GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.BookDelivery, error)
+	MarkSent(ctx context.Context, deliveryID uuid.UUID, size int64) error
+	Fail(ctx context.Context, deliveryID uuid.UUID, reason string) error
+}
+
+const bookDeliveryColumns = `id, user_id, book_id, device_id, format, status, size, error, created_at, updated_at`
+
+type postgresBookDeliveriesRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBookDeliveriesPSQLRepository(pool *pgxpool.Pool) BookDeliveries {
+	return postgresBookDeliveriesRepository{pool: pool}
+}
+
+func scanBookDelivery(row scannable) (entities.BookDelivery, error) {
+	delivery := entities.BookDelivery{}
+	err := row.Scan(
+		&delivery.ID, &delivery.UserID, &delivery.BookID, &delivery.DeviceID, &delivery.Format, &delivery.Status,
+		&delivery.Size, &delivery.Error, &delivery.CreatedAt, &delivery.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.BookDelivery{}, ErrBookDeliveryNotFound
+	}
+	return delivery, err
+}
+
+func (r postgresBookDeliveriesRepository) Create(ctx context.Context, delivery entities.BookDelivery) (entities.BookDelivery, error) {
+	query := `
+INSERT INTO book_deliveries (id, user_id, book_id, device_id, format, status)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING ` + bookDeliveryColumns
+	return scanBookDelivery(r.pool.QueryRow(
+		ctx,
+		query,
+		delivery.ID, delivery.UserID, delivery.BookID, delivery.DeviceID, delivery.Format, delivery.Status,
+	))
+}
+
+func (r postgresBookDeliveriesRepository) GetByID(ctx context.Context, deliveryID uuid.UUID) (entities.BookDelivery, error) {
+	query := `SELECT ` + bookDeliveryColumns + ` FROM book_deliveries WHERE id = $1`
+	return scanBookDelivery(r.pool.QueryRow(ctx, query, deliveryID))
+}
+
+func (r postgresBookDeliveriesRepository) GetManyByUserID(
+	ctx context.Context,
+	userID uuid.UUID,
+	limit, offset uint64,
+) ([]entities.BookDelivery, error) {
+	query := `
+SELECT ` + bookDeliveryColumns + `
+FROM book_deliveries
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make([]entities.BookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanBookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r postgresBookDeliveriesRepository) MarkSent(ctx context.Context, deliveryID uuid.UUID, size int64) error {
+	query := `
+UPDATE book_deliveries
+SET status = 'sent', size = $2, error = '', updated_at = NOW()
+WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, deliveryID, size)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookDeliveryNotFound
+	}
+	return nil
+}
+
+func (r postgresBookDeliveriesRepository) Fail(ctx context.Context, deliveryID uuid.UUID, reason string) error {
+	query := `
+UPDATE book_deliveries
+SET status = 'failed', error = $2, updated_at = NOW()
+WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, deliveryID, reason)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookDeliveryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrBookFileNotFound = errors.New("book file not found")
+	ErrBookFileExists   = errors.New("the book already has a file in this format")
+)
+
+const pgUniqueViolation = "23505"
+
+type BookFiles interface {
+	// Create adds a file to the book. It returns ErrBookFileExists when the book has a file in the format.
+	Create(ctx context.Context, file entities.BookFile) (entities.BookFile, error)
+	GetByID(ctx context.Context, fileID uuid.UUID) (entities.BookFile, error)
+	// GetByBookID returns the files of the book, the primary file first.
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error)
+	SetStatus(ctx context.Context, fileID uuid.UUID, status entities.BookStatus) error
+	// FailPendingScans marks the files of the book that still wait for the scan as failed.
+	FailPendingScans(ctx context.Context, bookID uuid.UUID) error
+	// GetBooksPendingScan returns the books with files waiting for the scan since before the time,
+	// ordered by id and starting after the given id. Books in the trash are skipped.
+	GetBooksPendingScan(ctx context.Context, before time.Time, after uuid.UUID, limit uint64) ([]uuid.UUID, error)
+	Delete(ctx context.Context, fileID uuid.UUID) error
+}
+
+const bookFileColumns = `id, book_id, format, mime_type, size, hash, path, status, created_at`
+
+type postgresBookFilesRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewBookFilesPSQLRepository(pool *pgxpool.Pool) BookFiles {
+	return postgresBookFilesRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func scanBookFile(row scannable) (entities.BookFile, error) {
+	file := entities.BookFile{}
+	var hash []byte
+	err := row.Scan(
+		&file.ID, &file.BookID, &file.Format, &file.MIMEType, &file.Size, &hash, &file.StoragePath,
+		&file.Status, &file.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.BookFile{}, ErrBookFileNotFound
+	}
+	copy(file.Hash[:], hash)
+	return file, err
+}
+
+func collectBookFiles(rows pgx.Rows) ([]entities.BookFile, error) {
+	defer rows.Close()
+	files := make([]entities.BookFile, 0, 1)
+	for rows.Next() {
+		file, err := scanBookFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func (r postgresBookFilesRepository) Create(ctx context.Context, file entities.BookFile) (entities.BookFile, error) {
+	query := `
+INSERT INTO book_files (id, book_id, format, mime_type, size, hash, path, status)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING ` + bookFileColumns
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	created, err := scanBookFile(conn.QueryRow(
+		ctx,
+		query,
+		file.ID, file.BookID, file.Format, file.MIMEType, file.Size, file.Hash[:], file.StoragePath, file.Status,
+	))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return entities.BookFile{}, ErrBookFileExists
+		case pgForeignKeyViolation:
+			return entities.BookFile{}, ErrBookNotFound
+		}
+	}
+	return created, err
+}
+
+func (r postgresBookFilesRepository) GetByID(ctx context.Context, fileID uuid.UUID) (entities.BookFile, error) {
+	query := `SELECT ` + bookFileColumns + ` FROM book_files WHERE id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanBookFile(conn.QueryRow(ctx, query, fileID))
+}
+
+func (r postgresBookFilesRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error) {
+	query := `SELECT ` + bookFileColumns + ` FROM book_files WHERE book_id = $1 ORDER BY created_at, id`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	return collectBookFiles(rows)
+}
+
+func (r postgresBookFilesRepository) SetStatus(ctx context.Context, fileID uuid.UUID, status entities.BookStatus) error {
+	query := `UPDATE book_files SET status = $2 WHERE id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, query, fileID, status)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookFileNotFound
+	}
+	return nil
+}
+
+func (r postgresBookFilesRepository) FailPendingScans(ctx context.Context, bookID uuid.UUID) error {
+	query := `UPDATE book_files SET status = $2 WHERE book_id = $1 AND status = $3`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(ctx, query, bookID, entities.BookStatusScanFailed, entities.BookStatusPendingScan)
+	return err
+}
+
+func (r postgresBookFilesRepository) GetBooksPendingScan(
+	ctx context.Context,
+	before time.Time,
+	after uuid.UUID,
+	limit uint64,
+) ([]uuid.UUID, error) {
+	query := `
+SELECT DISTINCT book_files.book_id
+FROM book_files
+JOIN books ON books.id = book_files.book_id
+WHERE book_files.status = $1 AND book_files.created_at < $2 AND books.deleted_at IS NULL AND book_files.book_id > $3
+ORDER BY book_files.book_id
+LIMIT $4`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, entities.BookStatusPendingScan, before, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+func (r postgresBookFilesRepository) Delete(ctx context.Context, fileID uuid.UUID) error {
+	query := `DELETE FROM book_files WHERE id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, query, fileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookFileNotFound
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrBookVersionNotFound = errors.New("book version not found")
+)
+
+type BookHistory interface {
+	// Add records the version. A version that is already recorded is left as is.
+	Add(ctx context.Context, version entities.BookMetadataVersion) error
+	Get(ctx context.Context, bookID uuid.UUID, version int) (entities.BookMetadataVersion, error)
+	// GetMany returns the versions of the book, newest first.
+	GetMany(ctx context.Context, bookID uuid.UUID, limit, offset uint64) ([]entities.BookMetadataVersion, error)
+}
+
+const bookHistoryColumns = `book_id, version, title, metadata, changed_fields, changed_by, changed_at`
+
+// metadataRecord is how entities.BookMetadata is stored in the metadata JSONB column.
+type metadataRecord struct {
+	Authors       []string          `json:"authors"`
+	Description   string            `json:"description"`
+	Language      string            `json:"language"`
+	Publisher     string            `json:"publisher"`
+	PublishedDate *time.Time        `json:"published_date"`
+	ISBN          string            `json:"isbn"`
+	Series        string            `json:"series"`
+	SeriesIndex   *float64          `json:"series_index"`
+	Tags          []string          `json:"tags"`
+	Identifiers   map[string]string `json:"identifiers,omitempty"`
+	Rating        *int              `json:"rating,omitempty"`
+}
+
+type postgresBookHistoryRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewBookHistoryPSQLRepository(pool *pgxpool.Pool) BookHistory {
+	return postgresBookHistoryRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func scanBookHistoryRow(row scannable) (entities.BookMetadataVersion, error) {
+	version := entities.BookMetadataVersion{}
+	var record metadataRecord
+	err := row.Scan(&version.BookID, &version.Version, &version.Title, &record, &version.ChangedFields, &version.ChangedBy, &version.ChangedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.BookMetadataVersion{}, ErrBookVersionNotFound
+	}
+	version.Metadata = entities.BookMetadata(record)
+	return version, err
+}
+
+func (r postgresBookHistoryRepository) Add(ctx context.Context, version entities.BookMetadataVersion) error {
+	query := `
+INSERT INTO book_metadata_history (book_id, version, title, metadata, changed_fields, changed_by, changed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (book_id, version) DO NOTHING`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(
+		ctx,
+		query,
+		version.BookID,
+		version.Version,
+		version.Title,
+		metadataRecord(version.Metadata),
+		nonNilStrings(version.ChangedFields),
+		version.ChangedBy,
+		version.ChangedAt,
+	)
+	return err
+}
+
+func (r postgresBookHistoryRepository) Get(ctx context.Context, bookID uuid.UUID, version int) (entities.BookMetadataVersion, error) {
+	query := `SELECT ` + bookHistoryColumns + ` FROM book_metadata_history WHERE book_id = $1 AND version = $2`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanBookHistoryRow(conn.QueryRow(ctx, query, bookID, version))
+}
+
+func (r postgresBookHistoryRepository) GetMany(ctx context.Context, bookID uuid.UUID, limit, offset uint64) ([]entities.BookMetadataVersion, error) {
+	query := `
+SELECT ` + bookHistoryColumns + `
+FROM book_metadata_history
+WHERE book_id = $1
+ORDER BY version DESC
+LIMIT $2 OFFSET $3`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, bookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make([]entities.BookMetadataVersion, 0)
+	for rows.Next() {
+		version, err := scanBookHistoryRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrBookProgressNotFound = errors.New("book progress not found")
+
+type BookProgress interface {
+	Get(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.BookProgress, error)
+	// Save stores the progress of the user in the book in place of the previous one.
+	Save(ctx context.Context, progress entities.BookProgress) (entities.BookProgress, error)
+}
+
+const bookProgressColumns = `user_id, book_id, percentage, locator, position, updated_at`
+
+type postgresBookProgressRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBookProgressPSQLRepository(pool *pgxpool.Pool) BookProgress {
+	return postgresBookProgressRepository{pool: pool}
+}
+
+func scanBookProgress(row scannable) (entities.BookProgress, error) {
+	progress := entities.BookProgress{}
+	var position int64
+	err := row.Scan(&progress.UserID, &progress.BookID, &progress.Percentage, &progress.Locator, &position, &progress.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.BookProgress{}, ErrBookProgressNotFound
+	}
+	progress.Position = time.Duration(position) * time.Millisecond
+	return progress, err
+}
+
+func (r postgresBookProgressRepository) Get(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.BookProgress, error) {
+	query := `SELECT ` + bookProgressColumns + ` FROM book_progress WHERE user_id = $1 AND book_id = $2`
+	return scanBookProgress(r.pool.QueryRow(ctx, query, userID, bookID))
+}
+
+func (r postgresBookProgressRepository) Save(ctx context.Context, progress entities.BookProgress) (entities.BookProgress, error) {
+	query := `
+INSERT INTO book_progress (user_id, book_id, percentage, locator, position, updated_at)
+VALUES ($1, $2, $3, $4, $5, NOW())
+ON CONFLICT (user_id, book_id) DO UPDATE
+SET percentage = excluded.percentage, locator = excluded.locator, position = excluded.position, updated_at = NOW()
+RETURNING ` + bookProgressColumns
+	saved, err := scanBookProgress(r.pool.QueryRow(
+		ctx,
+		query,
+		progress.UserID, progress.BookID, progress.Percentage, progress.Locator, progress.Position.Milliseconds(),
+	))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		return entities.BookProgress{}, ErrBookNotFound
+	}
+	return saved, err
+}
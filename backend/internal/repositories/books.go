@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/Shelffy/shelffy/internal/entities"
@@ -15,48 +16,122 @@ import (
 )
 
 var (
-	ErrBookNotFound = fmt.Errorf("user book not found")
+	ErrBookNotFound        = fmt.Errorf("user book not found")
+	ErrBookVersionConflict = errors.New("book version conflict")
 )
 
 type Books interface {
+	// Create creates the book together with its primary file.
 	Create(ctx context.Context, book entities.Book) (entities.Book, error)
 
-	Delete(ctx context.Context, bookID uuid.UUID) error
+	// Delete deletes the book and returns its files, their content has to be removed from the storage.
+	Delete(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error)
 	GetByID(ctx context.Context, bookID uuid.UUID) (entities.Book, error)
 	GetByTitleAndUserID(ctx context.Context, title string, userID uuid.UUID) (entities.Book, error)
+	// GetByHash returns the books that have a file with the hash.
 	GetByHash(ctx context.Context, hash entities.BookHash) ([]entities.Book, error)
 	GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+	// GetLibrary returns the books of the user and the books the user can read in their households, oldest first.
+	GetLibrary(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+	// GetManyByHousehold returns the books shared with the household that the user can read, oldest first.
+	GetManyByHousehold(ctx context.Context, householdID uuid.UUID, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+
+	// SoftDelete moves the book to the trash. Books in the trash are hidden from the getters above.
+	SoftDelete(ctx context.Context, bookID uuid.UUID) error
+	// Restore takes the book of the user out of the trash.
+	Restore(ctx context.Context, bookID uuid.UUID, userID uuid.UUID) (entities.Book, error)
+	GetTrash(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+	// GetDeletedBefore returns books that were moved to the trash before the given time.
+	GetDeletedBefore(ctx context.Context, before time.Time, limit uint64) ([]entities.Book, error)
+	// UpdateMetadata stores the title and metadata and increments the version.
+	// It returns ErrBookVersionConflict when the book is no longer at expectedVersion.
+	UpdateMetadata(ctx context.Context, bookID uuid.UUID, expectedVersion int, title string, metadata entities.BookMetadata) (entities.Book, error)
+	SetCover(ctx context.Context, bookID uuid.UUID, coverPath string) error
 }
 
+// bookColumns are selected from booksWithPrimaryFile, the file columns come from the primary file.
+const bookColumns = `books.id, primary_file.hash, uploaded_by, uploaded_at, primary_file.path, title,
+primary_file.size, primary_file.format, primary_file.mime_type, primary_file.status, deleted_at,
+authors, description, language, publisher, published_date, isbn, series, series_index, tags, version,
+identifiers, rating, cover_path`
+
+// booksWithPrimaryFile joins books with their oldest file. Statements that modify books select
+// bookColumns from it by naming their CTE books.
+const booksWithPrimaryFile = `books JOIN LATERAL (
+	SELECT hash, path, size, format, mime_type, status
+	FROM book_files
+	WHERE book_files.book_id = books.id
+	ORDER BY created_at, id
+	LIMIT 1
+) AS primary_file ON TRUE`
+
 func entityBookToModel(book entities.Book) model.Books {
 	return model.Books{
 		ID:         book.ID,
 		Title:      book.Title,
 		UploadedBy: book.UploadedBy,
 		UploadedAt: &book.UploadedAt,
-		Hash:       book.Hash[:],
-		Path:       book.StoragePath,
+		DeletedAt:  book.DeletedAt,
+		Version:    int32(book.Version),
+		CoverPath:  book.CoverPath,
 	}
 }
 
 func bookModelToEntity(book model.Books) entities.Book {
-	var hash entities.BookHash
-	for i, b := range book.Hash {
-		hash[i] = b
-	}
 	return entities.Book{
-		ID:          book.ID,
-		Title:       book.Title,
-		StoragePath: book.Path,
-		Hash:        hash,
-		UploadedBy:  book.UploadedBy,
-		UploadedAt:  *book.UploadedAt,
+		ID:         book.ID,
+		Title:      book.Title,
+		UploadedBy: book.UploadedBy,
+		UploadedAt: *book.UploadedAt,
+		DeletedAt:  book.DeletedAt,
+		Version:    int(book.Version),
+		CoverPath:  book.CoverPath,
+	}
+}
+
+// scanBook scans a row selected with bookColumns.
+// Array columns are scanned into the entity directly as the generated model keeps them as strings,
+// the primary file columns are not part of the model.
+func scanBook(row scannable) (entities.Book, error) {
+	var book model.Books
+	var metadata entities.BookMetadata
+	var file entities.BookFile
+	var hash []byte
+	err := row.Scan(
+		&book.ID, &hash, &book.UploadedBy, &book.UploadedAt, &file.StoragePath, &book.Title, &file.Size,
+		&file.Format, &file.MIMEType, &file.Status, &book.DeletedAt,
+		&metadata.Authors, &metadata.Description, &metadata.Language, &metadata.Publisher, &metadata.PublishedDate,
+		&metadata.ISBN, &metadata.Series, &metadata.SeriesIndex, &metadata.Tags, &book.Version,
+		&metadata.Identifiers, &metadata.Rating, &book.CoverPath,
+	)
+	if err != nil {
+		return entities.Book{}, err
+	}
+	entity := bookModelToEntity(book)
+	entity.Metadata = metadata
+	entity.StoragePath = file.StoragePath
+	copy(entity.Hash[:], hash)
+	entity.Size = file.Size
+	entity.Format = file.Format
+	entity.MIMEType = file.MIMEType
+	entity.Status = file.Status
+	return entity, nil
+}
+
+// nonNilStrings keeps NOT NULL array columns from receiving NULL.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
 	}
+	return values
 }
 
-func scanIntoBookModel(row scannable) (book model.Books, err error) {
-	err = row.Scan(&book.ID, &book.Hash, &book.UploadedBy, &book.UploadedAt, &book.Path, &book.Title)
-	return
+// nonNilMap keeps NOT NULL JSONB columns from receiving NULL.
+func nonNilMap(values map[string]string) map[string]string {
+	if values == nil {
+		return map[string]string{}
+	}
+	return values
 }
 
 type postgresBooksRepository struct {
@@ -73,58 +148,105 @@ func NewBooksPSQLRepository(pool *pgxpool.Pool) Books {
 
 func (r postgresBooksRepository) Create(ctx context.Context, bookToCreate entities.Book) (entities.Book, error) {
 	book := entityBookToModel(bookToCreate)
-	sql := `INSERT INTO books(id, hash, uploaded_by, path, title)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, hash, uploaded_by, uploaded_at, path, title`
-
-	b, err := scanIntoBookModel(r.pool.QueryRow(ctx, sql, book.ID, book.Hash, book.UploadedBy, book.Path, book.Title))
-	if err != nil {
-		return entities.Book{}, err
-	}
-	return bookModelToEntity(b), nil
+	metadata := bookToCreate.Metadata
+	// the primary file is returned by its CTE as the lateral join does not see rows inserted by the statement
+	sql := `
+WITH books AS (
+	INSERT INTO books(id, uploaded_by, title,
+	authors, description, language, publisher, published_date, isbn, series, series_index, tags, identifiers, rating)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	RETURNING *
+), primary_file AS (
+	INSERT INTO book_files(id, book_id, format, mime_type, size, hash, path, status)
+	VALUES ($15, $1, $16, $17, $18, $19, $20, $21)
+	RETURNING hash, path, size, format, mime_type, status
+)
+SELECT ` + bookColumns + `
+FROM books, primary_file`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanBook(conn.QueryRow(
+		ctx,
+		sql,
+		book.ID, book.UploadedBy, book.Title,
+		nonNilStrings(metadata.Authors), metadata.Description, metadata.Language, metadata.Publisher, metadata.PublishedDate,
+		metadata.ISBN, metadata.Series, metadata.SeriesIndex, nonNilStrings(metadata.Tags),
+		nonNilMap(metadata.Identifiers), metadata.Rating,
+		uuid.New(), bookToCreate.Format, bookToCreate.MIMEType, bookToCreate.Size, bookToCreate.Hash[:],
+		bookToCreate.StoragePath, bookToCreate.Status,
+	))
 }
 
-func (r postgresBooksRepository) Delete(ctx context.Context, bookID uuid.UUID) error {
-	sql := `DELETE FROM books WHERE id = $1`
+func (r postgresBooksRepository) Delete(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error) {
+	sql := `DELETE FROM book_files WHERE book_id = $1 RETURNING ` + bookFileColumns
 	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
-	_, err := conn.Exec(ctx, sql, bookID)
-	return err
+	rows, err := conn.Query(ctx, sql, bookID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := collectBookFiles(rows)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, `DELETE FROM books WHERE id = $1`, bookID); err != nil {
+		return nil, err
+	}
+	return files, nil
 }
 
 func (r postgresBooksRepository) GetByID(ctx context.Context, bookID uuid.UUID) (entities.Book, error) {
 	sql := `
-SELECT id, hash, uploaded_by, uploaded_at, path, title
-FROM books
-WHERE id = $1`
-	book, err := scanIntoBookModel(r.pool.QueryRow(ctx, sql, bookID))
+SELECT ` + bookColumns + `
+FROM ` + booksWithPrimaryFile + `
+WHERE books.id = $1 AND deleted_at IS NULL`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	book, err := scanBook(conn.QueryRow(ctx, sql, bookID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entities.Book{}, ErrBookNotFound
 		}
 		return entities.Book{}, err
 	}
-	return bookModelToEntity(book), nil
+	return book, nil
 
 }
 
 func (r postgresBooksRepository) GetByTitleAndUserID(ctx context.Context, title string, userID uuid.UUID) (entities.Book, error) {
 	sql := `
-SELECT id, hash, uploaded_by, uploaded_at, path, title
-FROM books
-WHERE title = $1 AND uploaded_by = $2`
-	book, err := scanIntoBookModel(r.pool.QueryRow(ctx, sql, title, userID))
+SELECT ` + bookColumns + `
+FROM ` + booksWithPrimaryFile + `
+WHERE title = $1 AND uploaded_by = $2 AND deleted_at IS NULL`
+	book, err := scanBook(r.pool.QueryRow(ctx, sql, title, userID))
 	if err != nil {
 		return entities.Book{}, err
 	}
-	return bookModelToEntity(book), nil
+	return book, nil
 }
 
 func (r postgresBooksRepository) GetByHash(ctx context.Context, hash entities.BookHash) ([]entities.Book, error) {
-	sql := `
-SELECT id, hash, uploaded_by, uploaded_at, path, title
-FROM books
-WHERE hash = $1`
-	rows, err := r.pool.Query(ctx, sql, hash)
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where("EXISTS (SELECT 1 FROM book_files WHERE book_files.book_id = books.id AND book_files.hash = ?)", hash[:]).
+		Where("deleted_at IS NULL").
+		OrderBy("uploaded_at")
+	return r.queryMany(ctx, builder)
+}
+
+func (r postgresBooksRepository) GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where("uploaded_by = ? AND deleted_at IS NULL", userID).
+		PlaceholderFormat(sq.Dollar)
+	if limit != nil {
+		builder = builder.Limit(*limit)
+	}
+	if offset != nil {
+		builder = builder.Offset(*offset)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrBookNotFound
@@ -133,44 +255,163 @@ WHERE hash = $1`
 	}
 	books := make([]entities.Book, 0, 1)
 	for rows.Next() {
-		book, err := scanIntoBookModel(rows)
+		book, err := scanBook(rows)
 		if err != nil {
 			return nil, err
 		}
-		books = append(books, bookModelToEntity(book))
+		books = append(books, book)
 	}
 	return books, nil
 }
 
-func (r postgresBooksRepository) GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
-	builder := sq.Select("id", "hash", "uploaded_by", "uploaded_at", "path", "title").
-		From("books").
-		Where("uploaded_by = ?", userID).
-		PlaceholderFormat(sq.Dollar)
+func (r postgresBooksRepository) SoftDelete(ctx context.Context, bookID uuid.UUID) error {
+	sql := `UPDATE books SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, sql, bookID, time.Now())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookNotFound
+	}
+	return nil
+}
+
+func (r postgresBooksRepository) Restore(ctx context.Context, bookID uuid.UUID, userID uuid.UUID) (entities.Book, error) {
+	sql := `
+WITH books AS (
+	UPDATE books SET deleted_at = NULL
+	WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NOT NULL
+	RETURNING *
+)
+SELECT ` + bookColumns + `
+FROM ` + booksWithPrimaryFile
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	book, err := scanBook(conn.QueryRow(ctx, sql, bookID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entities.Book{}, ErrBookNotFound
+		}
+		return entities.Book{}, err
+	}
+	return book, nil
+}
+
+func (r postgresBooksRepository) GetLibrary(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where(sq.Or{sq.Eq{"uploaded_by": userID}, sq.Expr(visibleInHousehold, userID, nil, nil)}).
+		Where("deleted_at IS NULL").
+		OrderBy("uploaded_at", "books.id")
 	if limit != nil {
 		builder = builder.Limit(*limit)
 	}
 	if offset != nil {
-		builder = builder.Limit(*offset)
+		builder = builder.Offset(*offset)
 	}
-	sql, args, err := builder.ToSql()
+	return r.queryMany(ctx, builder)
+}
+
+func (r postgresBooksRepository) GetManyByHousehold(
+	ctx context.Context,
+	householdID uuid.UUID,
+	userID uuid.UUID,
+	limit, offset *uint64,
+) ([]entities.Book, error) {
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where(visibleInHousehold, userID, householdID, householdID).
+		Where("deleted_at IS NULL").
+		OrderBy("uploaded_at", "books.id")
+	if limit != nil {
+		builder = builder.Limit(*limit)
+	}
+	if offset != nil {
+		builder = builder.Offset(*offset)
+	}
+	return r.queryMany(ctx, builder)
+}
+
+func (r postgresBooksRepository) queryMany(ctx context.Context, builder sq.SelectBuilder) ([]entities.Book, error) {
+	sql, args, err := builder.PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return nil, err
 	}
-	rows, err := r.pool.Query(ctx, sql, args...)
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, sql, args...)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrBookNotFound
-		}
 		return nil, err
 	}
-	books := make([]entities.Book, 0, 1)
+	defer rows.Close()
+	books := make([]entities.Book, 0)
 	for rows.Next() {
-		book, err := scanIntoBookModel(rows)
+		book, err := scanBook(rows)
 		if err != nil {
 			return nil, err
 		}
-		books = append(books, bookModelToEntity(book))
+		books = append(books, book)
 	}
-	return books, nil
+	return books, rows.Err()
+}
+
+func (r postgresBooksRepository) GetTrash(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where("uploaded_by = ? AND deleted_at IS NOT NULL", userID).
+		OrderBy("deleted_at DESC")
+	if limit != nil {
+		builder = builder.Limit(*limit)
+	}
+	if offset != nil {
+		builder = builder.Offset(*offset)
+	}
+	return r.queryMany(ctx, builder)
+}
+
+func (r postgresBooksRepository) GetDeletedBefore(ctx context.Context, before time.Time, limit uint64) ([]entities.Book, error) {
+	builder := sq.Select(bookColumns).
+		From(booksWithPrimaryFile).
+		Where("deleted_at < ?", before).
+		OrderBy("deleted_at").
+		Limit(limit)
+	return r.queryMany(ctx, builder)
+}
+
+func (r postgresBooksRepository) UpdateMetadata(ctx context.Context, bookID uuid.UUID, expectedVersion int, title string, metadata entities.BookMetadata) (entities.Book, error) {
+	sql := `
+WITH books AS (
+	UPDATE books SET
+		title = $3, authors = $4, description = $5, language = $6, publisher = $7, published_date = $8,
+		isbn = $9, series = $10, series_index = $11, tags = $12, identifiers = $13, rating = $14, version = version + 1
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	RETURNING *
+)
+SELECT ` + bookColumns + `
+FROM ` + booksWithPrimaryFile
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	book, err := scanBook(conn.QueryRow(
+		ctx,
+		sql,
+		bookID, expectedVersion,
+		title, nonNilStrings(metadata.Authors), metadata.Description, metadata.Language, metadata.Publisher, metadata.PublishedDate,
+		metadata.ISBN, metadata.Series, metadata.SeriesIndex, nonNilStrings(metadata.Tags),
+		nonNilMap(metadata.Identifiers), metadata.Rating,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Book{}, ErrBookVersionConflict
+	}
+	return book, err
+}
+
+func (r postgresBooksRepository) SetCover(ctx context.Context, bookID uuid.UUID, coverPath string) error {
+	sql := `UPDATE books SET cover_path = $2 WHERE id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, sql, bookID, coverPath)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookNotFound
+	}
+	return nil
 }
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ComicPages interface {
+	// GetByBookID returns the pages of the book in reading order, none when the book has not been indexed.
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ComicPage, error)
+	// Replace stores the page index of the book in place of the previous one.
+	Replace(ctx context.Context, bookID uuid.UUID, pages []entities.ComicPage) error
+}
+
+type postgresComicPagesRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewComicPagesPSQLRepository(pool *pgxpool.Pool) ComicPages {
+	return postgresComicPagesRepository{pool: pool}
+}
+
+func (r postgresComicPagesRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ComicPage, error) {
+	query := `SELECT book_id, number, name, size FROM comic_pages WHERE book_id = $1 ORDER BY number`
+	rows, err := r.pool.Query(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pages := make([]entities.ComicPage, 0)
+	for rows.Next() {
+		page := entities.ComicPage{}
+		if err := rows.Scan(&page.BookID, &page.Number, &page.Name, &page.Size); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+func (r postgresComicPagesRepository) Replace(ctx context.Context, bookID uuid.UUID, pages []entities.ComicPage) error {
+	// the pages past the new end are deleted, the others are overwritten
+	query := `
+WITH trimmed AS (
+	DELETE FROM comic_pages WHERE book_id = $1 AND number > cardinality($2::INTEGER[])
+)
+INSERT INTO comic_pages (book_id, number, name, size)
+SELECT $1, page.number, page.name, page.size
+FROM unnest($2::INTEGER[], $3::TEXT[], $4::BIGINT[]) AS page (number, name, size)
+ON CONFLICT (book_id, number) DO UPDATE SET name = excluded.name, size = excluded.size`
+	numbers := make([]int32, len(pages))
+	names := make([]string, len(pages))
+	sizes := make([]int64, len(pages))
+	for i, page := range pages {
+		numbers[i] = int32(page.Number)
+		names[i] = page.Name
+		sizes[i] = page.Size
+	}
+	_, err := r.pool.Exec(ctx, query, bookID, numbers, names, sizes)
+	return err
+}
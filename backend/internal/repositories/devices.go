@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrDeviceExists   = errors.New("a device with this email already exists")
+)
+
+type Devices interface {
+	// Create returns ErrDeviceExists when the user has a device with the same email.
+	Create(ctx context.Context, device entities.Device) (entities.Device, error)
+	GetByID(ctx context.Context, deviceID uuid.UUID) (entities.Device, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Device, error)
+	// Delete deletes the device of the user together with its deliveries.
+	Delete(ctx context.Context, deviceID uuid.UUID, userID uuid.UUID) error
+}
+
+const deviceColumns = `id, user_id, name, email, format, created_at`
+
+type postgresDevicesRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewDevicesPSQLRepository(pool *pgxpool.Pool) Devices {
+	return postgresDevicesRepository{pool: pool}
+}
+
+func scanDevice(row scannable) (entities.Device, error) {
+	device := entities.Device{}
+	err := row.Scan(&device.ID, &device.UserID, &device.Name, &device.Email, &device.Format, &device.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Device{}, ErrDeviceNotFound
+	}
+	return device, err
+}
+
+func (r postgresDevicesRepository) Create(ctx context.Context, device entities.Device) (entities.Device, error) {
+	query := `
+INSERT INTO devices (id, user_id, name, email, format)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING ` + deviceColumns
+	created, err := scanDevice(r.pool.QueryRow(ctx, query, device.ID, device.UserID, device.Name, device.Email, device.Format))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return entities.Device{}, ErrDeviceExists
+	}
+	return created, err
+}
+
+func (r postgresDevicesRepository) GetByID(ctx context.Context, deviceID uuid.UUID) (entities.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE id = $1`
+	return scanDevice(r.pool.QueryRow(ctx, query, deviceID))
+}
+
+func (r postgresDevicesRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := make([]entities.Device, 0)
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r postgresDevicesRepository) Delete(ctx context.Context, deviceID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM devices WHERE id = $1 AND user_id = $2`
+	tag, err := r.pool.Exec(ctx, query, deviceID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Duplicates interface {
+	// Dismiss records that the two books are not duplicates of each other.
+	Dismiss(ctx context.Context, bookID uuid.UUID, otherBookID uuid.UUID) error
+	// GetDismissed returns the dismissed pairs of books of the user.
+	GetDismissed(ctx context.Context, userID uuid.UUID) ([][2]uuid.UUID, error)
+	// Merge moves the files, the tracks and the reading data of the source book to the target book.
+	// Files in a format the target already has stay with the source, audio files also when the target has audio.
+	Merge(ctx context.Context, targetID uuid.UUID, sourceID uuid.UUID) error
+}
+
+type postgresDuplicatesRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewDuplicatesPSQLRepository(pool *pgxpool.Pool) Duplicates {
+	return postgresDuplicatesRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func (r postgresDuplicatesRepository) Dismiss(ctx context.Context, bookID uuid.UUID, otherBookID uuid.UUID) error {
+	// pairs are stored once, the smaller id first
+	if bytes.Compare(bookID[:], otherBookID[:]) > 0 {
+		bookID, otherBookID = otherBookID, bookID
+	}
+	sql := `
+INSERT INTO book_duplicate_dismissals (book_id, other_book_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(ctx, sql, bookID, otherBookID)
+	return err
+}
+
+func (r postgresDuplicatesRepository) GetDismissed(ctx context.Context, userID uuid.UUID) ([][2]uuid.UUID, error) {
+	sql := `
+SELECT d.book_id, d.other_book_id
+FROM book_duplicate_dismissals AS d
+JOIN books ON books.id = d.book_id
+WHERE books.uploaded_by = $1`
+	rows, err := r.pool.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) ([2]uuid.UUID, error) {
+		var pair [2]uuid.UUID
+		err := row.Scan(&pair[0], &pair[1])
+		return pair, err
+	})
+}
+
+func (r postgresDuplicatesRepository) Merge(ctx context.Context, targetID uuid.UUID, sourceID uuid.UUID) error {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	// the moved files become the newest files of the target, so its primary file stays the same
+	files := `
+WITH moved AS (
+    UPDATE book_files
+    SET book_id = $1, created_at = NOW()
+    WHERE book_id = $2
+      AND format NOT IN (SELECT format FROM book_files WHERE book_id = $1)
+      AND NOT (
+        format IN ('m4b', 'mp3')
+        AND EXISTS (SELECT 1 FROM book_files WHERE book_id = $1 AND format IN ('m4b', 'mp3'))
+      )
+    RETURNING id
+)
+UPDATE audio_tracks
+SET book_id = $1, number = number + (SELECT COALESCE(MAX(number), 0) FROM audio_tracks WHERE book_id = $1)
+WHERE file_id IN (SELECT id FROM moved)`
+	if _, err := conn.Exec(ctx, files, targetID, sourceID); err != nil {
+		return err
+	}
+	// readers keep the position they have in the target book
+	progress := `
+UPDATE book_progress
+SET book_id = $1
+WHERE book_id = $2
+  AND user_id NOT IN (SELECT user_id FROM book_progress WHERE book_id = $1)`
+	if _, err := conn.Exec(ctx, progress, targetID, sourceID); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, `UPDATE book_deliveries SET book_id = $1 WHERE book_id = $2`, targetID, sourceID); err != nil {
+		return err
+	}
+	_, err := conn.Exec(ctx, `UPDATE import_items SET book_id = $1 WHERE book_id = $2`, targetID, sourceID)
+	return err
+}
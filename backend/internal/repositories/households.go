@@ -0,0 +1,400 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrHouseholdNotFound       = errors.New("household not found")
+	ErrHouseholdMemberNotFound = errors.New("household member not found")
+	ErrHouseholdMemberExists   = errors.New("the user is already a member of the household")
+	ErrHouseholdBookNotFound   = errors.New("the book is not shared with the household")
+	ErrHouseholdInviteNotFound = errors.New("household invite not found")
+)
+
+// visibleInHousehold is the condition for a book of booksWithPrimaryFile shared with a household of the user,
+// the book must have one of the allowed tags of the member when the member has any.
+// The first argument is the user id, the second one restricts the households and is NULL for all of them.
+const visibleInHousehold = `EXISTS (
+	SELECT 1
+	FROM household_books
+	JOIN household_members ON household_members.household_id = household_books.household_id
+	WHERE household_books.book_id = books.id
+	  AND household_members.user_id = ?
+	  AND (?::uuid IS NULL OR household_books.household_id = ?)
+	  AND (
+	    cardinality(household_members.allowed_tags) = 0
+	    OR household_members.allowed_tags && ARRAY(SELECT lower(tag) FROM unnest(books.tags) AS tag)
+	  )
+)`
+
+type Households interface {
+	Create(ctx context.Context, household entities.Household) (entities.Household, error)
+	GetByID(ctx context.Context, householdID uuid.UUID) (entities.Household, error)
+	// GetByUserID returns the households the user is a member of.
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Household, error)
+	// GetByBookID returns the households the book is shared with.
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.Household, error)
+	Delete(ctx context.Context, householdID uuid.UUID) error
+
+	// AddMember returns ErrHouseholdMemberExists when the user is already a member.
+	AddMember(ctx context.Context, member entities.HouseholdMember) error
+	GetMember(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) (entities.HouseholdMember, error)
+	GetMembers(ctx context.Context, householdID uuid.UUID) ([]entities.HouseholdMember, error)
+	UpdateMember(ctx context.Context, member entities.HouseholdMember) error
+	// RemoveMember removes the member and unshares the books of the member from the household.
+	RemoveMember(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) error
+	CountOwners(ctx context.Context, householdID uuid.UUID) (int, error)
+	// HasMemberWithEmail tells if a member of the household has the email, regardless of case.
+	HasMemberWithEmail(ctx context.Context, householdID uuid.UUID, email string) (bool, error)
+
+	// SaveInvite creates the invite or replaces the pending invite of the email to the household.
+	SaveInvite(ctx context.Context, invite entities.HouseholdInvite) (entities.HouseholdInvite, error)
+	GetInvite(ctx context.Context, inviteID uuid.UUID) (entities.HouseholdInvite, error)
+	// GetInvitesByEmail returns the pending invites of the email, oldest first.
+	GetInvitesByEmail(ctx context.Context, email string) ([]entities.HouseholdInvite, error)
+	// GetInvitesByHousehold returns the pending invites of the household, oldest first.
+	GetInvitesByHousehold(ctx context.Context, householdID uuid.UUID) ([]entities.HouseholdInvite, error)
+	DeleteInvite(ctx context.Context, inviteID uuid.UUID) error
+
+	ShareBook(ctx context.Context, householdID uuid.UUID, bookID uuid.UUID) error
+	UnshareBook(ctx context.Context, householdID uuid.UUID, bookID uuid.UUID) error
+	// CanRead tells if the book is shared with a household of the user and passes the tag restrictions of the user.
+	CanRead(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (bool, error)
+}
+
+type postgresHouseholdsRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewHouseholdsPSQLRepository(pool *pgxpool.Pool) Households {
+	return postgresHouseholdsRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func scanHousehold(row scannable) (entities.Household, error) {
+	household := entities.Household{}
+	err := row.Scan(&household.ID, &household.Name, &household.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Household{}, ErrHouseholdNotFound
+	}
+	return household, err
+}
+
+func scanHouseholdMember(row scannable) (entities.HouseholdMember, error) {
+	member := entities.HouseholdMember{}
+	err := row.Scan(&member.HouseholdID, &member.UserID, &member.Email, &member.Role, &member.AllowedTags, &member.JoinedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.HouseholdMember{}, ErrHouseholdMemberNotFound
+	}
+	return member, err
+}
+
+func scanHouseholdInvite(row scannable) (entities.HouseholdInvite, error) {
+	invite := entities.HouseholdInvite{}
+	err := row.Scan(
+		&invite.ID, &invite.HouseholdID, &invite.HouseholdName, &invite.Email,
+		&invite.Role, &invite.AllowedTags, &invite.InvitedBy, &invite.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.HouseholdInvite{}, ErrHouseholdInviteNotFound
+	}
+	return invite, err
+}
+
+func (r postgresHouseholdsRepository) queryHouseholds(ctx context.Context, query string, args ...any) ([]entities.Household, error) {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	households := make([]entities.Household, 0)
+	for rows.Next() {
+		household, err := scanHousehold(rows)
+		if err != nil {
+			return nil, err
+		}
+		households = append(households, household)
+	}
+	return households, rows.Err()
+}
+
+func (r postgresHouseholdsRepository) Create(ctx context.Context, household entities.Household) (entities.Household, error) {
+	query := `
+INSERT INTO households (id, name)
+VALUES ($1, $2)
+RETURNING id, name, created_at`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanHousehold(conn.QueryRow(ctx, query, household.ID, household.Name))
+}
+
+func (r postgresHouseholdsRepository) GetByID(ctx context.Context, householdID uuid.UUID) (entities.Household, error) {
+	query := `SELECT id, name, created_at FROM households WHERE id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanHousehold(conn.QueryRow(ctx, query, householdID))
+}
+
+func (r postgresHouseholdsRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Household, error) {
+	query := `
+SELECT households.id, households.name, households.created_at
+FROM households
+JOIN household_members ON household_members.household_id = households.id
+WHERE household_members.user_id = $1
+ORDER BY households.created_at`
+	return r.queryHouseholds(ctx, query, userID)
+}
+
+func (r postgresHouseholdsRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.Household, error) {
+	query := `
+SELECT households.id, households.name, households.created_at
+FROM households
+JOIN household_books ON household_books.household_id = households.id
+WHERE household_books.book_id = $1
+ORDER BY households.created_at`
+	return r.queryHouseholds(ctx, query, bookID)
+}
+
+func (r postgresHouseholdsRepository) Delete(ctx context.Context, householdID uuid.UUID) error {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, `DELETE FROM households WHERE id = $1`, householdID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHouseholdNotFound
+	}
+	return nil
+}
+
+func (r postgresHouseholdsRepository) AddMember(ctx context.Context, member entities.HouseholdMember) error {
+	query := `
+INSERT INTO household_members (household_id, user_id, role, allowed_tags)
+VALUES ($1, $2, $3, $4)`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(ctx, query, member.HouseholdID, member.UserID, member.Role, member.AllowedTags)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrHouseholdMemberExists
+	}
+	return err
+}
+
+const householdMemberQuery = `
+SELECT household_members.household_id, household_members.user_id, users.email,
+       household_members.role, household_members.allowed_tags, household_members.joined_at
+FROM household_members
+JOIN users ON users.id = household_members.user_id`
+
+func (r postgresHouseholdsRepository) GetMember(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) (entities.HouseholdMember, error) {
+	query := householdMemberQuery + `
+WHERE household_members.household_id = $1 AND household_members.user_id = $2`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanHouseholdMember(conn.QueryRow(ctx, query, householdID, userID))
+}
+
+func (r postgresHouseholdsRepository) GetMembers(ctx context.Context, householdID uuid.UUID) ([]entities.HouseholdMember, error) {
+	query := householdMemberQuery + `
+WHERE household_members.household_id = $1
+ORDER BY household_members.joined_at`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]entities.HouseholdMember, 0)
+	for rows.Next() {
+		member, err := scanHouseholdMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r postgresHouseholdsRepository) UpdateMember(ctx context.Context, member entities.HouseholdMember) error {
+	query := `
+UPDATE household_members
+SET role = $3, allowed_tags = $4
+WHERE household_id = $1 AND user_id = $2`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, query, member.HouseholdID, member.UserID, member.Role, member.AllowedTags)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHouseholdMemberNotFound
+	}
+	return nil
+}
+
+func (r postgresHouseholdsRepository) RemoveMember(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) error {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	unshare := `
+DELETE FROM household_books
+USING books
+WHERE books.id = household_books.book_id AND household_books.household_id = $1 AND books.uploaded_by = $2`
+	if _, err := conn.Exec(ctx, unshare, householdID, userID); err != nil {
+		return err
+	}
+	tag, err := conn.Exec(ctx, `DELETE FROM household_members WHERE household_id = $1 AND user_id = $2`, householdID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHouseholdMemberNotFound
+	}
+	return nil
+}
+
+func (r postgresHouseholdsRepository) CountOwners(ctx context.Context, householdID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM household_members WHERE household_id = $1 AND role = $2`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	var count int
+	err := conn.QueryRow(ctx, query, householdID, entities.HouseholdRoleOwner).Scan(&count)
+	return count, err
+}
+
+func (r postgresHouseholdsRepository) HasMemberWithEmail(ctx context.Context, householdID uuid.UUID, email string) (bool, error) {
+	query := `
+SELECT EXISTS (
+	SELECT 1
+	FROM household_members
+	JOIN users ON users.id = household_members.user_id
+	WHERE household_members.household_id = $1 AND lower(users.email) = lower($2)
+)`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	var exists bool
+	err := conn.QueryRow(ctx, query, householdID, email).Scan(&exists)
+	return exists, err
+}
+
+const householdInviteQuery = `
+SELECT household_invites.id, household_invites.household_id, households.name, household_invites.email,
+       household_invites.role, household_invites.allowed_tags, household_invites.invited_by, household_invites.created_at
+FROM household_invites
+JOIN households ON households.id = household_invites.household_id`
+
+func (r postgresHouseholdsRepository) queryHouseholdInvites(ctx context.Context, query string, args ...any) ([]entities.HouseholdInvite, error) {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invites := make([]entities.HouseholdInvite, 0)
+	for rows.Next() {
+		invite, err := scanHouseholdInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+func (r postgresHouseholdsRepository) SaveInvite(ctx context.Context, invite entities.HouseholdInvite) (entities.HouseholdInvite, error) {
+	query := `
+INSERT INTO household_invites (id, household_id, email, role, allowed_tags, invited_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (household_id, email) DO UPDATE
+SET role = excluded.role, allowed_tags = excluded.allowed_tags, invited_by = excluded.invited_by, created_at = NOW()
+RETURNING id`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	var inviteID uuid.UUID
+	err := conn.QueryRow(
+		ctx, query, invite.ID, invite.HouseholdID, invite.Email, invite.Role, invite.AllowedTags, invite.InvitedBy,
+	).Scan(&inviteID)
+	if err != nil {
+		return entities.HouseholdInvite{}, err
+	}
+	return r.GetInvite(ctx, inviteID)
+}
+
+func (r postgresHouseholdsRepository) GetInvite(ctx context.Context, inviteID uuid.UUID) (entities.HouseholdInvite, error) {
+	query := householdInviteQuery + `
+WHERE household_invites.id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanHouseholdInvite(conn.QueryRow(ctx, query, inviteID))
+}
+
+func (r postgresHouseholdsRepository) GetInvitesByEmail(ctx context.Context, email string) ([]entities.HouseholdInvite, error) {
+	query := householdInviteQuery + `
+WHERE household_invites.email = $1
+ORDER BY household_invites.created_at`
+	return r.queryHouseholdInvites(ctx, query, email)
+}
+
+func (r postgresHouseholdsRepository) GetInvitesByHousehold(ctx context.Context, householdID uuid.UUID) ([]entities.HouseholdInvite, error) {
+	query := householdInviteQuery + `
+WHERE household_invites.household_id = $1
+ORDER BY household_invites.created_at`
+	return r.queryHouseholdInvites(ctx, query, householdID)
+}
+
+func (r postgresHouseholdsRepository) DeleteInvite(ctx context.Context, inviteID uuid.UUID) error {
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, `DELETE FROM household_invites WHERE id = $1`, inviteID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHouseholdInviteNotFound
+	}
+	return nil
+}
+
+func (r postgresHouseholdsRepository) ShareBook(ctx context.Context, householdID uuid.UUID, bookID uuid.UUID) error {
+	query := `
+INSERT INTO household_books (household_id, book_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(ctx, query, householdID, bookID)
+	return err
+}
+
+func (r postgresHouseholdsRepository) UnshareBook(ctx context.Context, householdID uuid.UUID, bookID uuid.UUID) error {
+	query := `DELETE FROM household_books WHERE household_id = $1 AND book_id = $2`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	tag, err := conn.Exec(ctx, query, householdID, bookID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHouseholdBookNotFound
+	}
+	return nil
+}
+
+func (r postgresHouseholdsRepository) CanRead(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (bool, error) {
+	query, args, err := sq.Select("1").
+		From("books").
+		Where("books.id = ?", bookID).
+		Where(visibleInHousehold, userID, nil, nil).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	var one int
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
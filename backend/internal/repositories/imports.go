@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrImportJobNotFound = errors.New("import job not found")
+)
+
+type Imports interface {
+	Create(ctx context.Context, job entities.ImportJob) (entities.ImportJob, error)
+	GetByID(ctx context.Context, jobID uuid.UUID) (entities.ImportJob, error)
+	// GetManyByUserID returns the jobs of the user, newest first.
+	GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.ImportJob, error)
+	// SetStatus sets the status of the job, finished_at is set for completed and failed jobs.
+	SetStatus(ctx context.Context, jobID uuid.UUID, status entities.ImportJobStatus, reason string) error
+	// AddItem records the outcome of a file and updates the counters of its job.
+	AddItem(ctx context.Context, item entities.ImportItem) error
+	GetItems(ctx context.Context, jobID uuid.UUID, limit, offset uint64) ([]entities.ImportItem, error)
+	// FailUnfinished marks pending and running jobs as failed and returns how many were marked.
+	FailUnfinished(ctx context.Context, reason string) (int64, error)
+}
+
+const importJobColumns = `id, user_id, source, name, status, total, imported, duplicates, failed, error, created_at, finished_at`
+
+type postgresImportsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewImportsPSQLRepository(pool *pgxpool.Pool) Imports {
+	return postgresImportsRepository{pool: pool}
+}
+
+func scanImportJob(row scannable) (entities.ImportJob, error) {
+	job := entities.ImportJob{}
+	err := row.Scan(
+		&job.ID, &job.UserID, &job.Source, &job.Name, &job.Status, &job.Total,
+		&job.Imported, &job.Duplicates, &job.Failed, &job.Error, &job.CreatedAt, &job.FinishedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.ImportJob{}, ErrImportJobNotFound
+	}
+	return job, err
+}
+
+func (r postgresImportsRepository) Create(ctx context.Context, job entities.ImportJob) (entities.ImportJob, error) {
+	query := `
+INSERT INTO import_jobs (id, user_id, source, name, status, total)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING ` + importJobColumns
+	return scanImportJob(r.pool.QueryRow(ctx, query, job.ID, job.UserID, job.Source, job.Name, job.Status, job.Total))
+}
+
+func (r postgresImportsRepository) GetByID(ctx context.Context, jobID uuid.UUID) (entities.ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM import_jobs WHERE id = $1`
+	return scanImportJob(r.pool.QueryRow(ctx, query, jobID))
+}
+
+func (r postgresImportsRepository) GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.ImportJob, error) {
+	query := `
+SELECT ` + importJobColumns + `
+FROM import_jobs
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := make([]entities.ImportJob, 0)
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r postgresImportsRepository) SetStatus(ctx context.Context, jobID uuid.UUID, status entities.ImportJobStatus, reason string) error {
+	query := `
+UPDATE import_jobs
+SET status = $2,
+    error = $3,
+    finished_at = CASE WHEN $2 IN ('completed', 'failed') THEN NOW() END
+WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, jobID, status, reason)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrImportJobNotFound
+	}
+	return nil
+}
+
+func (r postgresImportsRepository) AddItem(ctx context.Context, item entities.ImportItem) error {
+	query := `
+WITH item AS (
+    INSERT INTO import_items (job_id, name, status, book_id, error)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING status
+)
+UPDATE import_jobs
+SET imported = imported + (item.status = 'imported')::int,
+    duplicates = duplicates + (item.status = 'duplicate')::int,
+    failed = failed + (item.status = 'failed')::int
+FROM item
+WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, item.JobID, item.Name, item.Status, item.BookID, item.Error)
+	return err
+}
+
+func (r postgresImportsRepository) GetItems(ctx context.Context, jobID uuid.UUID, limit, offset uint64) ([]entities.ImportItem, error) {
+	query := `
+SELECT job_id, name, status, book_id, error, created_at
+FROM import_items
+WHERE job_id = $1
+ORDER BY created_at, name
+LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, jobID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]entities.ImportItem, 0)
+	for rows.Next() {
+		item := entities.ImportItem{}
+		if err := rows.Scan(&item.JobID, &item.Name, &item.Status, &item.BookID, &item.Error, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r postgresImportsRepository) FailUnfinished(ctx context.Context, reason string) (int64, error) {
+	query := `
+UPDATE import_jobs
+SET status = 'failed', error = $1, finished_at = NOW()
+WHERE status IN ('pending', 'running')`
+	tag, err := r.pool.Exec(ctx, query, reason)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+)
+
+type Invites interface {
+	Create(ctx context.Context, invite entities.Invite) (entities.Invite, error)
+	GetByCode(ctx context.Context, code string) (entities.Invite, error)
+	GetMany(ctx context.Context, createdBy *uuid.UUID, limit, offset uint64) ([]entities.Invite, error)
+	CountActiveByCreator(ctx context.Context, createdBy uuid.UUID) (int, error)
+	// Use atomically consumes one use of a usable invite.
+	Use(ctx context.Context, code string) (entities.Invite, error)
+	Revoke(ctx context.Context, code string) error
+}
+
+const inviteColumns = `code, created_by, max_uses, uses, expires_at, is_revoked, created_at`
+
+type postgresInvitesRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewInvitesPSQLRepository(pool *pgxpool.Pool) Invites {
+	return postgresInvitesRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func scanInviteRow(row scannable) (entities.Invite, error) {
+	invite := entities.Invite{}
+	err := row.Scan(
+		&invite.Code,
+		&invite.CreatedBy,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&invite.IsRevoked,
+		&invite.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Invite{}, ErrInviteNotFound
+	}
+	return invite, err
+}
+
+func (r postgresInvitesRepository) Create(ctx context.Context, invite entities.Invite) (entities.Invite, error) {
+	query := `
+INSERT INTO invites (code, created_by, max_uses, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING ` + inviteColumns
+	row := r.pool.QueryRow(ctx, query, invite.Code, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt)
+	return scanInviteRow(row)
+}
+
+func (r postgresInvitesRepository) GetByCode(ctx context.Context, code string) (entities.Invite, error) {
+	query := `SELECT ` + inviteColumns + ` FROM invites WHERE code = $1`
+	return scanInviteRow(r.pool.QueryRow(ctx, query, code))
+}
+
+func (r postgresInvitesRepository) GetMany(ctx context.Context, createdBy *uuid.UUID, limit, offset uint64) ([]entities.Invite, error) {
+	query := `
+SELECT ` + inviteColumns + `
+FROM invites
+WHERE $1::uuid IS NULL OR created_by = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, createdBy, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invites := make([]entities.Invite, 0)
+	for rows.Next() {
+		invite, err := scanInviteRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+func (r postgresInvitesRepository) CountActiveByCreator(ctx context.Context, createdBy uuid.UUID) (int, error) {
+	query := `
+SELECT COUNT(*)
+FROM invites
+WHERE created_by = $1 AND NOT is_revoked AND uses < max_uses AND (expires_at IS NULL OR expires_at > NOW())`
+	var count int
+	err := r.pool.QueryRow(ctx, query, createdBy).Scan(&count)
+	return count, err
+}
+
+func (r postgresInvitesRepository) Use(ctx context.Context, code string) (entities.Invite, error) {
+	query := `
+UPDATE invites
+SET uses = uses + 1
+WHERE code = $1 AND NOT is_revoked AND uses < max_uses AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING ` + inviteColumns
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanInviteRow(conn.QueryRow(ctx, query, code))
+}
+
+func (r postgresInvitesRepository) Revoke(ctx context.Context, code string) error {
+	query := `UPDATE invites SET is_revoked = TRUE WHERE code = $1`
+	tag, err := r.pool.Exec(ctx, query, code)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
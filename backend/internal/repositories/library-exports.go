@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrLibraryExportNotFound = errors.New("library export not found")
+)
+
+type LibraryExports interface {
+	Create(ctx context.Context, export entities.LibraryExport) (entities.LibraryExport, error)
+	GetByID(ctx context.Context, exportID uuid.UUID) (entities.LibraryExport, error)
+	// GetManyByRequester returns the exports requested by the user, newest first.
+	GetManyByRequester(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.LibraryExport, error)
+	// GetByUser returns the exports requested by the user and the exports of the library of the user.
+	GetByUser(ctx context.Context, userID uuid.UUID) ([]entities.LibraryExport, error)
+	// Update stores the status, counters, archive path and timestamps of the export.
+	Update(ctx context.Context, export entities.LibraryExport) error
+	// GetExpired returns completed exports whose archive expired before the given time.
+	GetExpired(ctx context.Context, before time.Time, limit uint64) ([]entities.LibraryExport, error)
+	Delete(ctx context.Context, exportID uuid.UUID) error
+	// FailUnfinished marks pending and running exports as failed and returns how many were marked.
+	FailUnfinished(ctx context.Context, reason string) (int64, error)
+}
+
+const libraryExportColumns = `id, requested_by, user_id, status, books, size, storage_path, error, created_at, finished_at, expires_at`
+
+type postgresLibraryExportsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewLibraryExportsPSQLRepository(pool *pgxpool.Pool) LibraryExports {
+	return postgresLibraryExportsRepository{pool: pool}
+}
+
+func scanLibraryExport(row scannable) (entities.LibraryExport, error) {
+	export := entities.LibraryExport{}
+	err := row.Scan(
+		&export.ID, &export.RequestedBy, &export.UserID, &export.Status, &export.Books, &export.Size,
+		&export.StoragePath, &export.Error, &export.CreatedAt, &export.FinishedAt, &export.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.LibraryExport{}, ErrLibraryExportNotFound
+	}
+	return export, err
+}
+
+func (r postgresLibraryExportsRepository) queryMany(ctx context.Context, query string, args ...any) ([]entities.LibraryExport, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exports := make([]entities.LibraryExport, 0)
+	for rows.Next() {
+		export, err := scanLibraryExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+func (r postgresLibraryExportsRepository) Create(ctx context.Context, export entities.LibraryExport) (entities.LibraryExport, error) {
+	query := `
+INSERT INTO library_exports (id, requested_by, user_id, status)
+VALUES ($1, $2, $3, $4)
+RETURNING ` + libraryExportColumns
+	return scanLibraryExport(r.pool.QueryRow(ctx, query, export.ID, export.RequestedBy, export.UserID, export.Status))
+}
+
+func (r postgresLibraryExportsRepository) GetByID(ctx context.Context, exportID uuid.UUID) (entities.LibraryExport, error) {
+	query := `SELECT ` + libraryExportColumns + ` FROM library_exports WHERE id = $1`
+	return scanLibraryExport(r.pool.QueryRow(ctx, query, exportID))
+}
+
+func (r postgresLibraryExportsRepository) GetManyByRequester(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.LibraryExport, error) {
+	query := `
+SELECT ` + libraryExportColumns + `
+FROM library_exports
+WHERE requested_by = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	return r.queryMany(ctx, query, userID, limit, offset)
+}
+
+func (r postgresLibraryExportsRepository) GetByUser(ctx context.Context, userID uuid.UUID) ([]entities.LibraryExport, error) {
+	query := `
+SELECT ` + libraryExportColumns + `
+FROM library_exports
+WHERE requested_by = $1 OR user_id = $1`
+	return r.queryMany(ctx, query, userID)
+}
+
+func (r postgresLibraryExportsRepository) Update(ctx context.Context, export entities.LibraryExport) error {
+	query := `
+UPDATE library_exports
+SET status = $2,
+    books = $3,
+    size = $4,
+    storage_path = $5,
+    error = $6,
+    finished_at = $7,
+    expires_at = $8
+WHERE id = $1`
+	tag, err := r.pool.Exec(
+		ctx, query, export.ID, export.Status, export.Books, export.Size,
+		export.StoragePath, export.Error, export.FinishedAt, export.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLibraryExportNotFound
+	}
+	return nil
+}
+
+func (r postgresLibraryExportsRepository) GetExpired(ctx context.Context, before time.Time, limit uint64) ([]entities.LibraryExport, error) {
+	query := `
+SELECT ` + libraryExportColumns + `
+FROM library_exports
+WHERE expires_at < $1
+ORDER BY expires_at
+LIMIT $2`
+	return r.queryMany(ctx, query, before, limit)
+}
+
+func (r postgresLibraryExportsRepository) Delete(ctx context.Context, exportID uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM library_exports WHERE id = $1`, exportID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLibraryExportNotFound
+	}
+	return nil
+}
+
+func (r postgresLibraryExportsRepository) FailUnfinished(ctx context.Context, reason string) (int64, error) {
+	query := `
+UPDATE library_exports
+SET status = 'failed', error = $1, finished_at = NOW()
+WHERE status IN ('pending', 'running')`
+	tag, err := r.pool.Exec(ctx, query, reason)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
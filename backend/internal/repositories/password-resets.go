@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+)
+
+type PasswordResets interface {
+	Create(ctx context.Context, token entities.PasswordResetToken) (entities.PasswordResetToken, error)
+	// Use marks an unused and not expired token as used and returns it.
+	Use(ctx context.Context, token string) (entities.PasswordResetToken, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+const passwordResetColumns = `token, user_id, expires_at, used_at, created_at`
+
+type postgresPasswordResetsRepository struct {
+	pool   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
+}
+
+func NewPasswordResetsPSQLRepository(pool *pgxpool.Pool) PasswordResets {
+	return postgresPasswordResetsRepository{
+		pool:   pool,
+		getter: pgxv5.DefaultCtxGetter,
+	}
+}
+
+func scanPasswordResetRow(row scannable) (entities.PasswordResetToken, error) {
+	token := entities.PasswordResetToken{}
+	err := row.Scan(&token.Token, &token.UserID, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.PasswordResetToken{}, ErrPasswordResetTokenNotFound
+	}
+	return token, err
+}
+
+func (r postgresPasswordResetsRepository) Create(ctx context.Context, token entities.PasswordResetToken) (entities.PasswordResetToken, error) {
+	query := `
+INSERT INTO password_reset_tokens (token, user_id, expires_at)
+VALUES ($1, $2, $3)
+RETURNING ` + passwordResetColumns
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanPasswordResetRow(conn.QueryRow(ctx, query, token.Token, token.UserID, token.ExpiresAt))
+}
+
+func (r postgresPasswordResetsRepository) Use(ctx context.Context, token string) (entities.PasswordResetToken, error) {
+	query := `
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING ` + passwordResetColumns
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	return scanPasswordResetRow(conn.QueryRow(ctx, query, token))
+}
+
+func (r postgresPasswordResetsRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	query := `DELETE FROM password_reset_tokens WHERE user_id = $1`
+	conn := r.getter.DefaultTrOrDB(ctx, r.pool)
+	_, err := conn.Exec(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+const pgForeignKeyViolation = "23503"
+
+type Roles interface {
+	GetAll(ctx context.Context) ([]entities.Role, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Role, error)
+	GetPermissionsByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Permission, error)
+	Assign(ctx context.Context, userID uuid.UUID, role string) error
+	Revoke(ctx context.Context, userID uuid.UUID, role string) error
+}
+
+type postgresRolesRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewRolesPSQLRepository(conn *pgxpool.Pool) Roles {
+	return postgresRolesRepository{conn: conn}
+}
+
+func (r postgresRolesRepository) queryRoles(ctx context.Context, query string, args ...any) ([]entities.Role, error) {
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := make([]entities.Role, 0)
+	for rows.Next() {
+		role := entities.Role{}
+		if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt, &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r postgresRolesRepository) GetAll(ctx context.Context) ([]entities.Role, error) {
+	query := `
+SELECT roles.name, roles.description, roles.created_at,
+       COALESCE(ARRAY_AGG(role_permissions.permission) FILTER (WHERE role_permissions.permission IS NOT NULL), '{}')
+FROM roles
+LEFT JOIN role_permissions ON role_permissions.role = roles.name
+GROUP BY roles.name
+ORDER BY roles.name`
+	return r.queryRoles(ctx, query)
+}
+
+func (r postgresRolesRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Role, error) {
+	query := `
+SELECT roles.name, roles.description, roles.created_at,
+       COALESCE(ARRAY_AGG(role_permissions.permission) FILTER (WHERE role_permissions.permission IS NOT NULL), '{}')
+FROM user_roles
+JOIN roles ON roles.name = user_roles.role
+LEFT JOIN role_permissions ON role_permissions.role = roles.name
+WHERE user_roles.user_id = $1
+GROUP BY roles.name
+ORDER BY roles.name`
+	return r.queryRoles(ctx, query, userID)
+}
+
+func (r postgresRolesRepository) GetPermissionsByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Permission, error) {
+	query := `
+SELECT DISTINCT role_permissions.permission
+FROM user_roles
+JOIN role_permissions ON role_permissions.role = user_roles.role
+WHERE user_roles.user_id = $1`
+	rows, err := r.conn.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := make([]entities.Permission, 0)
+	for rows.Next() {
+		var permission entities.Permission
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (r postgresRolesRepository) Assign(ctx context.Context, userID uuid.UUID, role string) error {
+	query := `
+INSERT INTO user_roles (user_id, role)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`
+	_, err := r.conn.Exec(ctx, query, userID, role)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		if pgErr.ConstraintName == "user_roles_role_fkey" {
+			return ErrRoleNotFound
+		}
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r postgresRolesRepository) Revoke(ctx context.Context, userID uuid.UUID, role string) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	_, err := r.conn.Exec(ctx, query, userID, role)
+	return err
+}
@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found")
+)
+
+type ShareLinks interface {
+	Create(ctx context.Context, link entities.ShareLink) (entities.ShareLink, error)
+	GetByID(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error)
+	GetByToken(ctx context.Context, token string) (entities.ShareLink, error)
+	// GetByBookID returns the links of the book, newest first.
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ShareLink, error)
+	// Use atomically counts a download of a link that is not revoked, expired or exhausted.
+	Use(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error)
+	Revoke(ctx context.Context, linkID uuid.UUID) error
+	AddAccess(ctx context.Context, access entities.ShareLinkAccess) error
+	DeleteAccess(ctx context.Context, accessID uuid.UUID) error
+	// CountAccesses counts the accesses of the link with the outcome in the last period.
+	CountAccesses(ctx context.Context, linkID uuid.UUID, outcome entities.ShareLinkAccessOutcome, period time.Duration) (int, error)
+	// GetAccesses returns the accesses of the link, newest first.
+	GetAccesses(ctx context.Context, linkID uuid.UUID, limit, offset uint64) ([]entities.ShareLinkAccess, error)
+}
+
+const shareLinkColumns = `id, token, book_id, created_by, password_hash, expires_at, max_downloads, downloads, is_revoked, created_at`
+
+type postgresShareLinksRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewShareLinksPSQLRepository(pool *pgxpool.Pool) ShareLinks {
+	return postgresShareLinksRepository{pool: pool}
+}
+
+func scanShareLink(row scannable) (entities.ShareLink, error) {
+	link := entities.ShareLink{}
+	err := row.Scan(
+		&link.ID,
+		&link.Token,
+		&link.BookID,
+		&link.CreatedBy,
+		&link.PasswordHash,
+		&link.ExpiresAt,
+		&link.MaxDownloads,
+		&link.Downloads,
+		&link.IsRevoked,
+		&link.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.ShareLink{}, ErrShareLinkNotFound
+	}
+	return link, err
+}
+
+func (r postgresShareLinksRepository) Create(ctx context.Context, link entities.ShareLink) (entities.ShareLink, error) {
+	query := `
+INSERT INTO share_links (id, token, book_id, created_by, password_hash, expires_at, max_downloads)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + shareLinkColumns
+	row := r.pool.QueryRow(
+		ctx,
+		query,
+		link.ID,
+		link.Token,
+		link.BookID,
+		link.CreatedBy,
+		link.PasswordHash,
+		link.ExpiresAt,
+		link.MaxDownloads,
+	)
+	return scanShareLink(row)
+}
+
+func (r postgresShareLinksRepository) GetByID(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE id = $1`
+	return scanShareLink(r.pool.QueryRow(ctx, query, linkID))
+}
+
+func (r postgresShareLinksRepository) GetByToken(ctx context.Context, token string) (entities.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE token = $1`
+	return scanShareLink(r.pool.QueryRow(ctx, query, token))
+}
+
+func (r postgresShareLinksRepository) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE book_id = $1 ORDER BY created_at DESC`
+	rows, err := r.pool.Query(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	links := make([]entities.ShareLink, 0)
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r postgresShareLinksRepository) Use(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error) {
+	query := `
+UPDATE share_links
+SET downloads = downloads + 1
+WHERE id = $1
+  AND NOT is_revoked
+  AND (max_downloads IS NULL OR downloads < max_downloads)
+  AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING ` + shareLinkColumns
+	return scanShareLink(r.pool.QueryRow(ctx, query, linkID))
+}
+
+func (r postgresShareLinksRepository) Revoke(ctx context.Context, linkID uuid.UUID) error {
+	query := `UPDATE share_links SET is_revoked = TRUE WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, linkID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+func (r postgresShareLinksRepository) AddAccess(ctx context.Context, access entities.ShareLinkAccess) error {
+	query := `
+INSERT INTO share_link_accesses (id, link_id, ip, user_agent, outcome)
+VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.pool.Exec(ctx, query, access.ID, access.LinkID, access.IP, access.UserAgent, access.Outcome)
+	return err
+}
+
+func (r postgresShareLinksRepository) DeleteAccess(ctx context.Context, accessID uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM share_link_accesses WHERE id = $1`, accessID)
+	return err
+}
+
+func (r postgresShareLinksRepository) CountAccesses(
+	ctx context.Context,
+	linkID uuid.UUID,
+	outcome entities.ShareLinkAccessOutcome,
+	period time.Duration,
+) (int, error) {
+	query := `
+SELECT COUNT(*)
+FROM share_link_accesses
+WHERE link_id = $1 AND outcome = $2 AND created_at > NOW() - make_interval(secs => $3)`
+	var count int
+	err := r.pool.QueryRow(ctx, query, linkID, outcome, period.Seconds()).Scan(&count)
+	return count, err
+}
+
+func (r postgresShareLinksRepository) GetAccesses(ctx context.Context, linkID uuid.UUID, limit, offset uint64) ([]entities.ShareLinkAccess, error) {
+	query := `
+SELECT id, link_id, ip, user_agent, outcome, created_at
+FROM share_link_accesses
+WHERE link_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, linkID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accesses := make([]entities.ShareLinkAccess, 0)
+	for rows.Next() {
+		access := entities.ShareLinkAccess{}
+		err := rows.Scan(&access.ID, &access.LinkID, &access.IP, &access.UserAgent, &access.Outcome, &access.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
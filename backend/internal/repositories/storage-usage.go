@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// StorageUsage tracks the bytes stored by users. A quota of 0 means the storage is unlimited.
+type StorageUsage interface {
+	// Reserve adds size to the used storage unless the quota would be exceeded.
+	// defaultQuota is applied to users without their own quota.
+	Reserve(ctx context.Context, userID uuid.UUID, size, defaultQuota int64) error
+	Release(ctx context.Context, userID uuid.UUID, size int64) error
+	Get(ctx context.Context, userID uuid.UUID, defaultQuota int64) (entities.StorageUsage, error)
+	// SetQuota sets the quota of the user. nil resets it to the default quota.
+	SetQuota(ctx context.Context, userID uuid.UUID, quota *int64) error
+	// GetUnsizedFiles returns book files without a recorded size, ordered by id and starting after the given id.
+	GetUnsizedFiles(ctx context.Context, after uuid.UUID, limit uint64) ([]entities.UnsizedFile, error)
+	// SetFileSize records the size of an unsized file and adds it to the storage used by its owner.
+	SetFileSize(ctx context.Context, file entities.UnsizedFile, size int64) error
+}
+
+type postgresStorageUsageRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStorageUsagePSQLRepository(pool *pgxpool.Pool) StorageUsage {
+	return postgresStorageUsageRepository{pool: pool}
+}
+
+func (r postgresStorageUsageRepository) Reserve(ctx context.Context, userID uuid.UUID, size, defaultQuota int64) error {
+	query := `
+UPDATE users
+SET storage_used = storage_used + $2
+WHERE id = $1 AND (COALESCE(storage_quota, $3) = 0 OR storage_used + $2 <= COALESCE(storage_quota, $3))`
+	tag, err := r.pool.Exec(ctx, query, userID, size, defaultQuota)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (r postgresStorageUsageRepository) Release(ctx context.Context, userID uuid.UUID, size int64) error {
+	query := `
+UPDATE users
+SET storage_used = GREATEST(storage_used - $2, 0)
+WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, userID, size)
+	return err
+}
+
+func (r postgresStorageUsageRepository) Get(ctx context.Context, userID uuid.UUID, defaultQuota int64) (entities.StorageUsage, error) {
+	query := `
+SELECT storage_used, COALESCE(storage_quota, $2), (SELECT COUNT(*) FROM books WHERE books.uploaded_by = users.id AND books.deleted_at IS NULL)
+FROM users
+WHERE id = $1`
+	usage := entities.StorageUsage{}
+	err := r.pool.QueryRow(ctx, query, userID, defaultQuota).Scan(&usage.Used, &usage.Limit, &usage.BookCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.StorageUsage{}, ErrUserNotFound
+	}
+	return usage, err
+}
+
+func (r postgresStorageUsageRepository) GetUnsizedFiles(ctx context.Context, after uuid.UUID, limit uint64) ([]entities.UnsizedFile, error) {
+	query := `
+SELECT book_files.id, books.uploaded_by, book_files.path
+FROM book_files
+JOIN books ON books.id = book_files.book_id
+WHERE book_files.size = 0 AND book_files.id > $1
+ORDER BY book_files.id
+LIMIT $2`
+	rows, err := r.pool.Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entities.UnsizedFile, error) {
+		file := entities.UnsizedFile{}
+		err := row.Scan(&file.FileID, &file.UserID, &file.StoragePath)
+		return file, err
+	})
+}
+
+func (r postgresStorageUsageRepository) SetFileSize(ctx context.Context, file entities.UnsizedFile, size int64) error {
+	// the size is only added once, when the file still has none
+	query := `
+WITH sized AS (
+    UPDATE book_files SET size = $2 WHERE id = $1 AND size = 0 RETURNING size
+)
+UPDATE users
+SET storage_used = storage_used + sized.size
+FROM sized
+WHERE users.id = $3`
+	_, err := r.pool.Exec(ctx, query, file.FileID, size, file.UserID)
+	return err
+}
+
+func (r postgresStorageUsageRepository) SetQuota(ctx context.Context, userID uuid.UUID, quota *int64) error {
+	query := `UPDATE users SET storage_quota = $2 WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, userID, quota)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
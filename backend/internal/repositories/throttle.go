@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrLockoutNotFound = errors.New("lockout not found")
+)
+
+// FailureStats describes failed login attempts of a single account or IP inside a window.
+type FailureStats struct {
+	Count       int
+	LastAttempt time.Time
+}
+
+type LoginThrottle interface {
+	// RecordFailure records a failed login attempt and returns its id.
+	RecordFailure(ctx context.Context, email, ip string) (int64, error)
+	DeleteFailure(ctx context.Context, id int64) error
+	// FailureStats describes the failures of the key since the time, the failure with the except id is left out.
+	FailureStats(ctx context.Context, kind entities.LockoutKind, key string, since time.Time, except int64) (FailureStats, error)
+	ClearFailures(ctx context.Context, kind entities.LockoutKind, key string) error
+	DeleteFailuresBefore(ctx context.Context, before time.Time) error
+	Lock(ctx context.Context, lockout entities.Lockout) (entities.Lockout, error)
+	GetLockout(ctx context.Context, kind entities.LockoutKind, key string) (entities.Lockout, error)
+	Unlock(ctx context.Context, kind entities.LockoutKind, key string) error
+	UnlockByToken(ctx context.Context, token string) (entities.Lockout, error)
+}
+
+type postgresLoginThrottleRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewLoginThrottlePSQLRepository(conn *pgxpool.Pool) LoginThrottle {
+	return postgresLoginThrottleRepository{conn: conn}
+}
+
+func attemptsColumn(kind entities.LockoutKind) string {
+	if kind == entities.LockoutKindIP {
+		return "ip"
+	}
+	return "email"
+}
+
+func scanLockoutRow(row scannable) (entities.Lockout, error) {
+	lockout := entities.Lockout{}
+	var token *string
+	err := row.Scan(&lockout.Kind, &lockout.Key, &lockout.LockedUntil, &token, &lockout.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Lockout{}, ErrLockoutNotFound
+	}
+	if token != nil {
+		lockout.UnlockToken = *token
+	}
+	return lockout, err
+}
+
+func (r postgresLoginThrottleRepository) RecordFailure(ctx context.Context, email, ip string) (int64, error) {
+	query := `INSERT INTO login_attempts (email, ip) VALUES ($1, $2) RETURNING id`
+	var id int64
+	err := r.conn.QueryRow(ctx, query, email, ip).Scan(&id)
+	return id, err
+}
+
+func (r postgresLoginThrottleRepository) DeleteFailure(ctx context.Context, id int64) error {
+	_, err := r.conn.Exec(ctx, `DELETE FROM login_attempts WHERE id = $1`, id)
+	return err
+}
+
+func (r postgresLoginThrottleRepository) FailureStats(
+	ctx context.Context,
+	kind entities.LockoutKind,
+	key string,
+	since time.Time,
+	except int64,
+) (FailureStats, error) {
+	query := `
+SELECT COUNT(*), COALESCE(MAX(attempted_at), 'epoch'::timestamp)
+FROM login_attempts
+WHERE ` + attemptsColumn(kind) + ` = $1 AND attempted_at > $2 AND id <> $3`
+	stats := FailureStats{}
+	err := r.conn.QueryRow(ctx, query, key, since, except).Scan(&stats.Count, &stats.LastAttempt)
+	return stats, err
+}
+
+func (r postgresLoginThrottleRepository) ClearFailures(ctx context.Context, kind entities.LockoutKind, key string) error {
+	query := `DELETE FROM login_attempts WHERE ` + attemptsColumn(kind) + ` = $1`
+	_, err := r.conn.Exec(ctx, query, key)
+	return err
+}
+
+func (r postgresLoginThrottleRepository) DeleteFailuresBefore(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM login_attempts WHERE attempted_at < $1`
+	_, err := r.conn.Exec(ctx, query, before)
+	return err
+}
+
+func (r postgresLoginThrottleRepository) Lock(ctx context.Context, lockout entities.Lockout) (entities.Lockout, error) {
+	var token *string
+	if lockout.UnlockToken != "" {
+		token = &lockout.UnlockToken
+	}
+	query := `
+INSERT INTO login_lockouts (kind, key, locked_until, unlock_token)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (kind, key) DO UPDATE
+SET locked_until = EXCLUDED.locked_until, unlock_token = EXCLUDED.unlock_token, created_at = NOW()
+RETURNING kind, key, locked_until, unlock_token, created_at`
+	row := r.conn.QueryRow(ctx, query, lockout.Kind, lockout.Key, lockout.LockedUntil, token)
+	return scanLockoutRow(row)
+}
+
+func (r postgresLoginThrottleRepository) GetLockout(ctx context.Context, kind entities.LockoutKind, key string) (entities.Lockout, error) {
+	query := `
+SELECT kind, key, locked_until, unlock_token, created_at
+FROM login_lockouts
+WHERE kind = $1 AND key = $2`
+	return scanLockoutRow(r.conn.QueryRow(ctx, query, kind, key))
+}
+
+func (r postgresLoginThrottleRepository) Unlock(ctx context.Context, kind entities.LockoutKind, key string) error {
+	query := `DELETE FROM login_lockouts WHERE kind = $1 AND key = $2`
+	_, err := r.conn.Exec(ctx, query, kind, key)
+	return err
+}
+
+func (r postgresLoginThrottleRepository) UnlockByToken(ctx context.Context, token string) (entities.Lockout, error) {
+	query := `
+DELETE FROM login_lockouts
+WHERE unlock_token = $1
+RETURNING kind, key, locked_until, unlock_token, created_at`
+	return scanLockoutRow(r.conn.QueryRow(ctx, query, token))
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -19,28 +21,77 @@ type Users interface {
 	Update(ctx context.Context, userID uuid.UUID, fieldValue map[string]any) (entities.User, error)
 	Deactivate(ctx context.Context, id uuid.UUID) (entities.User, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	GetByApprovalStatus(ctx context.Context, status entities.ApprovalStatus, limit, offset uint64) ([]entities.User, error)
+	GetMany(ctx context.Context, filter entities.UsersFilter, limit, offset uint64) ([]entities.UserOverview, error)
+	GetOverview(ctx context.Context, id uuid.UUID) (entities.UserOverview, error)
+	// GetScheduledForDeletion returns users whose deletion is scheduled before the given time.
+	GetScheduledForDeletion(ctx context.Context, before time.Time, limit uint64) ([]entities.User, error)
 }
 
 var (
 	ErrUserNotFound = errors.New("user not found")
 )
 
+// userColumns is the list of columns scanned by scanUserRow. is_admin is derived from the admin role.
+const userColumns = `id, email, username, password, is_active, created_at, approval_status, COALESCE(invite_code, ''), last_login_at,
+deletion_scheduled_at,
+EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id AND user_roles.role = 'admin') AS is_admin`
+
+// userOverviewColumns extends userColumns with the statistics of UserOverview.
+const userOverviewColumns = userColumns + `,
+(SELECT COUNT(*) FROM books WHERE books.uploaded_by = users.id AND books.deleted_at IS NULL) AS books_count`
+
 type postgresUsersRepository struct {
-	conn *pgxpool.Pool
+	conn   *pgxpool.Pool
+	getter *pgxv5.CtxGetter
 }
 
 func NewUsersPSQLRepository(conn *pgxpool.Pool) Users {
-	return postgresUsersRepository{conn}
+	return postgresUsersRepository{
+		conn:   conn,
+		getter: pgxv5.DefaultCtxGetter,
+	}
 }
 
 func (r postgresUsersRepository) scanUserRow(row pgx.Row) (entities.User, error) {
 	user := entities.User{}
-	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.IsActive, &user.CreatedAt, &user.IsAdmin)
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.Password,
+		&user.IsActive,
+		&user.CreatedAt,
+		&user.ApprovalStatus,
+		&user.InviteCode,
+		&user.LastLoginAt,
+		&user.DeletionScheduledAt,
+		&user.IsAdmin,
+	)
 	return user, err
 }
 
+func (r postgresUsersRepository) scanUserOverviewRow(row pgx.Row) (entities.UserOverview, error) {
+	overview := entities.UserOverview{}
+	err := row.Scan(
+		&overview.ID,
+		&overview.Email,
+		&overview.Username,
+		&overview.Password,
+		&overview.IsActive,
+		&overview.CreatedAt,
+		&overview.ApprovalStatus,
+		&overview.InviteCode,
+		&overview.LastLoginAt,
+		&overview.DeletionScheduledAt,
+		&overview.IsAdmin,
+		&overview.BooksCount,
+	)
+	return overview, err
+}
+
 func (r postgresUsersRepository) getByField(ctx context.Context, field string, value any) (entities.User, error) {
-	query := fmt.Sprintf(`SELECT id, email, password, is_active, created_at, is_admin FROM users WHERE %s = $1`, field)
+	query := fmt.Sprintf(`SELECT %s FROM users WHERE %s = $1`, userColumns, field)
 	user, err := r.scanUserRow(r.conn.QueryRow(ctx, query, value))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -61,11 +112,37 @@ func (r postgresUsersRepository) GetByID(ctx context.Context, id uuid.UUID) (ent
 }
 
 func (r postgresUsersRepository) Create(ctx context.Context, user entities.User) (entities.User, error) {
+	if user.ApprovalStatus == "" {
+		user.ApprovalStatus = entities.ApprovalStatusApproved
+	}
+	var inviteCode *string
+	if user.InviteCode != "" {
+		inviteCode = &user.InviteCode
+	}
 	query := `
-INSERT INTO users (id, email, password, is_active, username) 
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, email, password, is_active, created_at, is_admin`
-	row := r.conn.QueryRow(ctx, query, user.ID, user.Email, user.Password, user.IsActive, user.Username)
+WITH created AS (
+    INSERT INTO users (id, email, password, is_active, username, approval_status, invite_code)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING id, email, username, password, is_active, created_at, approval_status, COALESCE(invite_code, '') AS invite_code, last_login_at, deletion_scheduled_at
+), granted AS (
+    INSERT INTO user_roles (user_id, role)
+    SELECT id, $8 FROM created
+)
+SELECT id, email, username, password, is_active, created_at, approval_status, invite_code, last_login_at, deletion_scheduled_at, FALSE
+FROM created`
+	conn := r.getter.DefaultTrOrDB(ctx, r.conn)
+	row := conn.QueryRow(
+		ctx,
+		query,
+		user.ID,
+		user.Email,
+		user.Password,
+		user.IsActive,
+		user.Username,
+		user.ApprovalStatus,
+		inviteCode,
+		entities.RoleUser,
+	)
 	return r.scanUserRow(row)
 }
 
@@ -76,14 +153,18 @@ func (r postgresUsersRepository) Update(ctx context.Context, userID uuid.UUID, f
 	builder := sq.Update("users").
 		SetMap(fieldValue).
 		Where(sq.Eq{"id": userID}).
-		Suffix("RETURNING id, email, password, is_active, created_at, is_admin").
+		Suffix("RETURNING " + userColumns).
 		PlaceholderFormat(sq.Dollar)
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return entities.User{}, err
 	}
-	row := r.conn.QueryRow(ctx, query, args...)
-	return r.scanUserRow(row)
+	conn := r.getter.DefaultTrOrDB(ctx, r.conn)
+	user, err := r.scanUserRow(conn.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.User{}, ErrUserNotFound
+	}
+	return user, err
 }
 
 func (r postgresUsersRepository) Deactivate(ctx context.Context, id uuid.UUID) (entities.User, error) {
@@ -91,7 +172,7 @@ func (r postgresUsersRepository) Deactivate(ctx context.Context, id uuid.UUID) (
 UPDATE users 
 SET is_active = false 
 WHERE id = $1 
-RETURNING id, email, password, is_active, created_at, is_admin`
+RETURNING ` + userColumns
 	row := r.conn.QueryRow(ctx, query, id)
 	return r.scanUserRow(row)
 }
@@ -100,6 +181,112 @@ func (r postgresUsersRepository) Delete(ctx context.Context, id uuid.UUID) error
 	query := `
 DELETE FROM users
 WHERE id = $1`
-	_, err := r.conn.Exec(ctx, query, id)
-	return err
+	conn := r.getter.DefaultTrOrDB(ctx, r.conn)
+	tag, err := conn.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r postgresUsersRepository) GetByApprovalStatus(ctx context.Context, status entities.ApprovalStatus, limit, offset uint64) ([]entities.User, error) {
+	query := `
+SELECT ` + userColumns + `
+FROM users
+WHERE approval_status = $1
+ORDER BY created_at
+LIMIT $2 OFFSET $3`
+	rows, err := r.conn.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]entities.User, 0)
+	for rows.Next() {
+		user, err := r.scanUserRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r postgresUsersRepository) GetMany(ctx context.Context, filter entities.UsersFilter, limit, offset uint64) ([]entities.UserOverview, error) {
+	builder := sq.Select(userOverviewColumns).
+		From("users").
+		OrderBy("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		PlaceholderFormat(sq.Dollar)
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		builder = builder.Where(sq.Or{
+			sq.ILike{"email": pattern},
+			sq.ILike{"username": pattern},
+		})
+	}
+	if filter.IsActive != nil {
+		builder = builder.Where(sq.Eq{"is_active": *filter.IsActive})
+	}
+	if filter.IsAdmin != nil {
+		adminCondition := "EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id AND user_roles.role = ?)"
+		if !*filter.IsAdmin {
+			adminCondition = "NOT " + adminCondition
+		}
+		builder = builder.Where(adminCondition, entities.RoleAdmin)
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]entities.UserOverview, 0)
+	for rows.Next() {
+		user, err := r.scanUserOverviewRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r postgresUsersRepository) GetOverview(ctx context.Context, id uuid.UUID) (entities.UserOverview, error) {
+	query := `SELECT ` + userOverviewColumns + ` FROM users WHERE id = $1`
+	user, err := r.scanUserOverviewRow(r.conn.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.UserOverview{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r postgresUsersRepository) GetScheduledForDeletion(ctx context.Context, before time.Time, limit uint64) ([]entities.User, error) {
+	query := `
+SELECT ` + userColumns + `
+FROM users
+WHERE deletion_scheduled_at <= $1
+ORDER BY deletion_scheduled_at
+LIMIT $2`
+	rows, err := r.conn.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]entities.User, 0)
+	for rows.Next() {
+		user, err := r.scanUserRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
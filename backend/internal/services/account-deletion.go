@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const purgeBatch = 100
+
+var (
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+)
+
+// AccountDeletion deletes accounts after a grace period during which the deletion can be cancelled.
+// Run is a background job that purges accounts whose grace period has passed.
+type AccountDeletion interface {
+	// Schedule schedules the deletion of the account and signs the user out of all other sessions.
+	Schedule(ctx context.Context, userID uuid.UUID, password string, currentSessionID string) (entities.User, error)
+	Cancel(ctx context.Context, userID uuid.UUID) (entities.User, error)
+	// Purge immediately deletes the account with all its data.
+	// Book files are removed by the delete book event pipeline, export archives are deleted right away.
+	Purge(ctx context.Context, userID uuid.UUID) error
+	Run(ctx context.Context) error
+}
+
+type accountDeletionService struct {
+	usersRepo           repositories.Users
+	sessionsRepo        repositories.Session
+	booksRepo           repositories.Books
+	booksEventPublisher BooksEventsPublisher
+	exportsRepo         repositories.LibraryExports
+	storage             FileStorage
+	txManager           *manager.Manager
+	gracePeriod         time.Duration
+	interval            time.Duration
+	timeout             time.Duration
+	logger              *slog.Logger
+}
+
+func NewAccountDeletion(
+	usersRepo repositories.Users,
+	sessionsRepo repositories.Session,
+	booksRepo repositories.Books,
+	booksEventPublisher BooksEventsPublisher,
+	exportsRepo repositories.LibraryExports,
+	storage FileStorage,
+	txManager *manager.Manager,
+	gracePeriod time.Duration,
+	interval time.Duration,
+	timeout time.Duration,
+	logger *slog.Logger,
+) AccountDeletion {
+	return accountDeletionService{
+		usersRepo:           usersRepo,
+		sessionsRepo:        sessionsRepo,
+		booksRepo:           booksRepo,
+		booksEventPublisher: booksEventPublisher,
+		exportsRepo:         exportsRepo,
+		storage:             storage,
+		txManager:           txManager,
+		gracePeriod:         gracePeriod,
+		interval:            interval,
+		timeout:             timeout,
+		logger:              logger,
+	}
+}
+
+func (s accountDeletionService) Schedule(ctx context.Context, userID uuid.UUID, password string, currentSessionID string) (entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	user, err := s.usersRepo.GetByID(c, userID)
+	if err != nil {
+		return entities.User{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return entities.User{}, ErrPasswordsNotMatch
+	}
+	if user.DeletionScheduledAt != nil {
+		return entities.User{}, ErrDeletionAlreadyScheduled
+	}
+	user, err = s.usersRepo.Update(c, userID, map[string]any{
+		"deletion_scheduled_at": time.Now().Add(s.gracePeriod),
+	})
+	if err != nil {
+		return entities.User{}, err
+	}
+	if err := s.sessionsRepo.DeactivateByUserID(c, userID, currentSessionID); err != nil {
+		s.logger.Error("cannot revoke sessions of user scheduled for deletion", "error", err, "user_id", userID)
+	}
+	return user, nil
+}
+
+func (s accountDeletionService) Cancel(ctx context.Context, userID uuid.UUID) (entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	user, err := s.usersRepo.GetByID(c, userID)
+	if err != nil {
+		return entities.User{}, err
+	}
+	if user.DeletionScheduledAt == nil {
+		return entities.User{}, ErrDeletionNotScheduled
+	}
+	return s.usersRepo.Update(c, userID, map[string]any{"deletion_scheduled_at": nil})
+}
+
+func (s accountDeletionService) Purge(ctx context.Context, userID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	books, err := s.booksRepo.GetManyByUserID(c, userID, nil, nil)
+	var trash []entities.Book
+	if err == nil {
+		trash, err = s.booksRepo.GetTrash(c, userID, nil, nil)
+	}
+	// the rows of the exports go with the user, their archives would be left in the storage
+	var exports []entities.LibraryExport
+	if err == nil {
+		exports, err = s.exportsRepo.GetByUser(c, userID)
+	}
+	cancel()
+	if err != nil {
+		return err
+	}
+	books = append(books, trash...)
+	// every book gets its own timeout, a large library would not be deleted in a single one
+	c, cancel = context.WithTimeout(ctx, s.timeout*time.Duration(len(books)+1))
+	defer cancel()
+	// the files are removed from the storage only once the account is gone from the database
+	deleted := make(map[uuid.UUID][]entities.BookFile, len(books))
+	err = s.txManager.Do(c, func(ctx context.Context) error {
+		for _, book := range books {
+			files, err := s.booksRepo.Delete(ctx, book.ID)
+			if err != nil {
+				return err
+			}
+			deleted[book.ID] = files
+		}
+		// sessions, roles, invites and password reset tokens are removed by the database
+		return s.usersRepo.Delete(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		if err := s.booksEventPublisher.PublishDeleteBookEvent(c, book, deleted[book.ID]); err != nil {
+			s.logger.Error("could not publish delete book event", "error", err, "book_id", book.ID)
+		}
+	}
+	for _, export := range exports {
+		if export.StoragePath == "" {
+			continue
+		}
+		if err := s.storage.Delete(c, export.StoragePath); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			s.logger.Error("cannot delete library export archive", "error", err, "export_id", export.ID)
+		}
+	}
+	return nil
+}
+
+func (s accountDeletionService) purgeScheduled(ctx context.Context) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	users, err := s.usersRepo.GetScheduledForDeletion(c, time.Now(), purgeBatch)
+	cancel()
+	if err != nil {
+		s.logger.Error("cannot get accounts scheduled for deletion", "error", err)
+		return
+	}
+	for _, user := range users {
+		if err := s.Purge(ctx, user.ID); err != nil {
+			s.logger.Error("cannot purge account", "error", err, "user_id", user.ID)
+			continue
+		}
+		s.logger.Info("account purged", "user_id", user.ID)
+	}
+}
+
+func (s accountDeletionService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.purgeScheduled(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+)
+
+// AccountExport packages the data of a user into a ZIP archive.
+type AccountExport interface {
+	// Export writes the archive to w. Book files are streamed from the storage one by one.
+	Export(ctx context.Context, user entities.User, w io.Writer) error
+}
+
+type exportProfile struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Username    string     `json:"username"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type exportBook struct {
+	ID         string           `json:"id"`
+	Title      string           `json:"title"`
+	UploadedAt time.Time        `json:"uploaded_at"`
+	Files      []exportBookFile `json:"files"`
+}
+
+type exportBookFile struct {
+	Hash   string `json:"hash"`
+	Format string `json:"format"`
+	Status string `json:"status"`
+	// File is empty when the file has not passed the malware scan and is left out of the archive.
+	File string `json:"file,omitempty"`
+}
+
+type accountExportService struct {
+	booksRepo repositories.Books
+	filesRepo repositories.BookFiles
+	storage   FileStorage
+	logger    *slog.Logger
+}
+
+func NewAccountExport(booksRepo repositories.Books, filesRepo repositories.BookFiles, storage FileStorage, logger *slog.Logger) AccountExport {
+	return accountExportService{
+		booksRepo: booksRepo,
+		filesRepo: filesRepo,
+		storage:   storage,
+		logger:    logger,
+	}
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, payload any) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(payload)
+}
+
+// sanitizeFileName replaces the characters that are not allowed in file names on common file systems.
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// fileParts numbers the files that share their format with other files of the book, the tracks of audiobooks,
+// from 1 in the order of the files. The other files get 0.
+func fileParts(files []entities.BookFile) []int {
+	counts := make(map[entities.BookFormat]int)
+	for _, file := range files {
+		counts[file.Format]++
+	}
+	parts := make([]int, len(files))
+	seen := make(map[entities.BookFormat]int)
+	for i, file := range files {
+		if counts[file.Format] > 1 {
+			seen[file.Format]++
+			parts[i] = seen[file.Format]
+		}
+	}
+	return parts
+}
+
+// exportFileName returns a file name inside the archive that is unique for the book file,
+// part tells apart the files of the book in the same format.
+func exportFileName(book entities.Book, file entities.BookFile, part int) string {
+	name := fmt.Sprintf("%s-%s", book.ID, sanitizeFileName(book.Title))
+	if part > 0 {
+		name += fmt.Sprintf("-%02d", part)
+	}
+	return path.Join("books", name+formats.Extension(file.Format))
+}
+
+func (s accountExportService) Export(ctx context.Context, user entities.User, w io.Writer) error {
+	books, err := s.booksRepo.GetManyByUserID(ctx, user.ID, nil, nil)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(w)
+	err = writeJSONEntry(archive, "profile.json", exportProfile{
+		ID:          user.ID.String(),
+		Email:       user.Email,
+		Username:    user.Username,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLoginAt,
+	})
+	if err != nil {
+		return err
+	}
+	metadata := make([]exportBook, len(books))
+	files := make([][]entities.BookFile, len(books))
+	for i, book := range books {
+		files[i], err = s.filesRepo.GetByBookID(ctx, book.ID)
+		if err != nil {
+			return err
+		}
+		metadata[i] = exportBook{
+			ID:         book.ID.String(),
+			Title:      book.Title,
+			UploadedAt: book.UploadedAt,
+			Files:      make([]exportBookFile, len(files[i])),
+		}
+		parts := fileParts(files[i])
+		for j, file := range files[i] {
+			metadata[i].Files[j] = exportBookFile{
+				Hash:   hex.EncodeToString(file.Hash[:]),
+				Format: string(file.Format),
+				Status: string(file.Status),
+			}
+			if file.Status == entities.BookStatusReady {
+				metadata[i].Files[j].File = exportFileName(book, file, parts[j])
+			}
+		}
+	}
+	if err := writeJSONEntry(archive, "books.json", metadata); err != nil {
+		return err
+	}
+	for i, book := range books {
+		for j, file := range files[i] {
+			// files that have not passed the malware scan are not handed out
+			if file.Status != entities.BookStatusReady {
+				continue
+			}
+			if err := s.copyFile(ctx, archive, metadata[i].Files[j].File, book, file); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
+
+func (s accountExportService) copyFile(ctx context.Context, archive *zip.Writer, name string, book entities.Book, file entities.BookFile) error {
+	content, err := s.storage.Get(ctx, file.StoragePath)
+	if err != nil {
+		s.logger.Error("cannot get book content for export", "error", err, "book_id", book.ID, "file_id", file.ID)
+		return err
+	}
+	defer content.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: file.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
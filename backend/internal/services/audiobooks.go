@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/audio"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+)
+
+var (
+	ErrNotAudiobook       = errors.New("the book is not an audiobook")
+	ErrAudioTrackNotFound = errors.New("track not found")
+)
+
+// AudioTrackContent is the audio of a track. Content is seekable so that it can be served in ranges,
+// each seek starts a new ranged request to the storage.
+type AudioTrackContent struct {
+	Content  io.ReadSeekCloser
+	MIMEType string
+	Size     int64
+	// Version identifies the file of the track.
+	Version string
+}
+
+// AudiobookChapter is a chapter of an audiobook, Start is the time from the start of the first track.
+type AudiobookChapter struct {
+	Title string
+	Start time.Duration
+	// Track is the number of the track the chapter starts in.
+	Track int
+}
+
+// Audiobooks serves the tracks of audiobooks. The tracks are stored when their files are uploaded,
+// audio files that have no track yet are probed and appended when the tracks are first asked for.
+type Audiobooks interface {
+	// Tracks returns the tracks of the audiobook in playing order.
+	Tracks(ctx context.Context, book entities.Book) ([]entities.AudioTrack, error)
+	// Track returns the audio of the track with number n.
+	Track(ctx context.Context, book entities.Book, n int) (AudioTrackContent, error)
+}
+
+type audiobooksService struct {
+	tracksRepo repositories.AudioTracks
+	filesRepo  repositories.BookFiles
+	storage    FileStorage
+	timeout    time.Duration
+	logger     *slog.Logger
+}
+
+func NewAudiobooks(
+	tracksRepo repositories.AudioTracks,
+	filesRepo repositories.BookFiles,
+	storage FileStorage,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Audiobooks {
+	return audiobooksService{
+		tracksRepo: tracksRepo,
+		filesRepo:  filesRepo,
+		storage:    storage,
+		timeout:    timeout,
+		logger:     logger,
+	}
+}
+
+func toAudioTrack(file entities.BookFile, info audio.Info) entities.AudioTrack {
+	return entities.AudioTrack{
+		FileID:   file.ID,
+		BookID:   file.BookID,
+		Title:    info.Title,
+		Duration: info.Duration,
+		Chapters: info.Chapters,
+	}
+}
+
+// AudiobookDuration is the total duration of the tracks.
+func AudiobookDuration(tracks []entities.AudioTrack) time.Duration {
+	var duration time.Duration
+	for _, track := range tracks {
+		duration += track.Duration
+	}
+	return duration
+}
+
+// AudiobookChapters lists the chapters of all tracks. A track without chapter markers is a chapter
+// titled after the track.
+func AudiobookChapters(tracks []entities.AudioTrack) []AudiobookChapter {
+	chapters := make([]AudiobookChapter, 0, len(tracks))
+	var offset time.Duration
+	for _, track := range tracks {
+		if len(track.Chapters) == 0 || track.Chapters[0].Start > 0 {
+			chapters = append(chapters, AudiobookChapter{Title: track.Title, Start: offset, Track: track.Number})
+		}
+		for _, chapter := range track.Chapters {
+			chapters = append(chapters, AudiobookChapter{Title: chapter.Title, Start: offset + chapter.Start, Track: track.Number})
+		}
+		offset += track.Duration
+	}
+	return chapters
+}
+
+func (s audiobooksService) Tracks(ctx context.Context, book entities.Book) ([]entities.AudioTrack, error) {
+	if !audio.IsAudio(book.Format) {
+		return nil, ErrNotAudiobook
+	}
+	l := s.logger.With("book_id", book.ID)
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	tracks, err := s.tracksRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		l.Error("cannot get audio tracks", "error", err)
+		return nil, ErrInternal
+	}
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		l.Error("cannot get book files", "error", err)
+		return nil, ErrInternal
+	}
+	for _, file := range files {
+		if !audio.IsAudio(file.Format) || slices.ContainsFunc(tracks, func(track entities.AudioTrack) bool { return track.FileID == file.ID }) {
+			continue
+		}
+		track, err := s.probe(ctx, file)
+		if err != nil {
+			l.Warn("cannot probe audio file, it is left out of the tracks", "error", err, "file_id", file.ID)
+			continue
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// probe reads the audio file and appends it to the tracks of its book.
+func (s audiobooksService) probe(ctx context.Context, file entities.BookFile) (entities.AudioTrack, error) {
+	r := newStorageReaderAt(ctx, s.storage, file.StoragePath, file.Size)
+	info, err := audio.Probe(file.Format, r, file.Size)
+	if err != nil {
+		return entities.AudioTrack{}, err
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.tracksRepo.Create(c, toAudioTrack(file, info))
+}
+
+func (s audiobooksService) Track(ctx context.Context, book entities.Book, n int) (AudioTrackContent, error) {
+	tracks, err := s.Tracks(ctx, book)
+	if err != nil {
+		return AudioTrackContent{}, err
+	}
+	i := slices.IndexFunc(tracks, func(track entities.AudioTrack) bool { return track.Number == n })
+	if i < 0 {
+		return AudioTrackContent{}, ErrAudioTrackNotFound
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	file, err := s.filesRepo.GetByID(c, tracks[i].FileID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookFileNotFound) {
+			return AudioTrackContent{}, ErrAudioTrackNotFound
+		}
+		s.logger.Error("cannot get audio track file", "error", err, "book_id", book.ID, "file_id", tracks[i].FileID)
+		return AudioTrackContent{}, ErrInternal
+	}
+	// tracks are not handed out before the malware scan
+	if file.Status != entities.BookStatusReady {
+		return AudioTrackContent{}, ErrBookPendingScan
+	}
+	return AudioTrackContent{
+		Content:  &storageReadSeeker{ctx: ctx, storage: s.storage, path: file.StoragePath, size: file.Size},
+		MIMEType: formats.MIMEType(file.Format),
+		Size:     file.Size,
+		Version:  hex.EncodeToString(file.Hash[:]),
+	}, nil
+}
+
+// storageReadSeeker reads an object of the storage from the current position to its end.
+// The request is made on the first read after a seek, so seeking to find the size costs nothing.
+type storageReadSeeker struct {
+	ctx     context.Context
+	storage FileStorage
+	path    string
+	size    int64
+	pos     int64
+	body    io.ReadCloser
+}
+
+func (r *storageReadSeeker) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.storage.GetRange(r.ctx, r.path, r.pos, r.size-r.pos)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *storageReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += r.pos
+	case io.SeekEnd:
+		pos += r.size
+	}
+	if pos < 0 {
+		return 0, errors.New("seek before the start of the object")
+	}
+	if pos != r.pos && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+func (r *storageReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/Shelffy/shelffy/internal/config"
 	entities2 "github.com/Shelffy/shelffy/internal/entities"
 	repositories2 "github.com/Shelffy/shelffy/internal/repositories"
 	"github.com/google/uuid"
@@ -18,14 +19,20 @@ import (
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrSessionIsExpired   = errors.New("session is expired")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrAccountInactive    = errors.New("account is not active")
 )
 
 type Auth interface {
-	Login(ctx context.Context, email, password string) (entities2.User, entities2.Session, error)
+	Login(ctx context.Context, email, password string, client entities2.ClientInfo) (entities2.User, entities2.Session, error)
 	Logout(ctx context.Context, sessionID string) error
 	GetSessionByID(ctx context.Context, id string) (entities2.Session, error)
 	GetSessionByUserID(ctx context.Context, userID uuid.UUID) ([]entities2.Session, error)
 	ValidateSession(ctx context.Context, id string) (entities2.Session, error)
+	// Refresh records that the session was used and rotates its ID when the rotation interval has passed.
+	// Last seen writes are debounced by the last seen interval. The returned session has the actual ID.
+	Refresh(ctx context.Context, session entities2.Session, client entities2.ClientInfo) (entities2.Session, error)
+	RevokeSession(ctx context.Context, userID uuid.UUID, publicID uuid.UUID) error
 	Deactivate(ctx context.Context, id string) error
 	DeactivateByUserID(ctx context.Context, userID uuid.UUID, except ...string) error
 }
@@ -33,18 +40,34 @@ type Auth interface {
 type authService struct {
 	userRepo        repositories2.Users
 	sessionsRepo    repositories2.Session
+	throttler       LoginThrottler
 	timeout         time.Duration
 	sessionLifeTime time.Duration
+	lastSeenAfter   time.Duration
+	sessionsPolicy  config.Sessions
 	logger          *slog.Logger
 	secret          string
 }
 
-func NewAuth(userRepo repositories2.Users, sessionRepo repositories2.Session, timeout time.Duration, sessionLifeTime time.Duration, logger *slog.Logger, secret string) Auth {
+func NewAuth(
+	userRepo repositories2.Users,
+	sessionRepo repositories2.Session,
+	throttler LoginThrottler,
+	timeout time.Duration,
+	sessionLifeTime time.Duration,
+	lastSeenAfter time.Duration,
+	sessionsPolicy config.Sessions,
+	logger *slog.Logger,
+	secret string,
+) Auth {
 	return authService{
 		userRepo:        userRepo,
 		sessionsRepo:    sessionRepo,
+		throttler:       throttler,
 		timeout:         timeout,
 		sessionLifeTime: sessionLifeTime,
+		lastSeenAfter:   lastSeenAfter,
+		sessionsPolicy:  sessionsPolicy,
 		logger:          logger,
 		secret:          secret,
 	}
@@ -61,38 +84,112 @@ func (s authService) ValidateSession(ctx context.Context, id string) (entities2.
 	defer cancel()
 	session, err := s.sessionsRepo.GetByID(c, id)
 	if err != nil {
+		if errors.Is(err, repositories2.ErrSessionNotFound) {
+			return session, ErrSessionNotFound
+		}
 		s.logger.Error("error while getting session", "error", err)
 		return session, err
 	}
-	if !session.IsActive || session.ExpiresAt.Before(time.Now()) {
+	now := time.Now()
+	if !session.IsActive || session.ExpiresAt.Before(now) {
+		return session, ErrSessionIsExpired
+	}
+	if s.sessionsPolicy.IdleTimeout > 0 && now.Sub(session.LastSeenAt) > s.sessionsPolicy.IdleTimeout {
+		return session, ErrSessionIsExpired
+	}
+	if session.ID != id && now.Sub(session.RotatedAt) > s.sessionsPolicy.RotationGracePeriod {
 		return session, ErrSessionIsExpired
 	}
 	return session, nil
 }
 
-func (s authService) Login(ctx context.Context, email, password string) (entities2.User, entities2.Session, error) {
+func (s authService) Login(ctx context.Context, email, password string, client entities2.ClientInfo) (entities2.User, entities2.Session, error) {
+	attempt, err := s.throttler.Check(ctx, email, client.IP)
+	if err != nil {
+		return entities2.User{}, entities2.Session{}, err
+	}
 	c, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 	dbUser, err := s.userRepo.GetByEmail(c, email)
 	if err != nil {
 		s.logger.Error("cannot get user", "error", err)
+		if err := s.throttler.RegisterFailure(ctx, attempt, nil); err != nil {
+			s.logger.Error("cannot register failed login attempt", "error", err)
+		}
 		return entities2.User{}, entities2.Session{}, ErrInvalidCredentials
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(password)); err != nil {
+		if err := s.throttler.RegisterFailure(ctx, attempt, &dbUser); err != nil {
+			s.logger.Error("cannot register failed login attempt", "error", err)
+		}
 		return entities2.User{}, entities2.Session{}, ErrInvalidCredentials
 	}
+	if !dbUser.IsActive {
+		// checked after the password so that the status of an account is not revealed to others,
+		// the attempt stays recorded as a failure
+		return entities2.User{}, entities2.Session{}, ErrAccountInactive
+	}
+	if err := s.throttler.RegisterSuccess(ctx, attempt, dbUser); err != nil {
+		s.logger.Error("cannot register successful login attempt", "error", err)
+	}
 	c, cancel = context.WithTimeout(ctx, s.timeout)
 	defer cancel()
+	if updated, err := s.userRepo.Update(c, dbUser.ID, map[string]any{"last_login_at": time.Now()}); err != nil {
+		s.logger.Error("cannot update last login time", "error", err)
+	} else {
+		dbUser = updated
+	}
 	expiresAt := time.Now().Add(s.sessionLifeTime)
 	session, err := s.sessionsRepo.Create(c, entities2.Session{
-		UserID:    dbUser.ID,
-		ID:        s.generateSessionID(),
-		IsActive:  true,
-		ExpiresAt: expiresAt,
+		UserID:     dbUser.ID,
+		ID:         s.generateSessionID(),
+		IsActive:   true,
+		ExpiresAt:  expiresAt,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		DeviceName: deviceNameFromUserAgent(client.UserAgent),
 	})
 	return dbUser, session, err
 }
 
+func (s authService) Refresh(ctx context.Context, session entities2.Session, client entities2.ClientInfo) (entities2.Session, error) {
+	now := time.Now()
+	if s.sessionsPolicy.RotationInterval > 0 && now.Sub(session.RotatedAt) > s.sessionsPolicy.RotationInterval {
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		rotated, err := s.sessionsRepo.Rotate(c, session.ID, s.generateSessionID())
+		if err != nil {
+			if errors.Is(err, repositories2.ErrSessionNotFound) {
+				// a concurrent request has already rotated the session
+				return session, nil
+			}
+			return session, err
+		}
+		session = rotated
+	}
+	if now.Sub(session.LastSeenAt) < s.lastSeenAfter && session.IP == client.IP {
+		return session, nil
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.sessionsRepo.Touch(c, session.ID, client.IP, now); err != nil {
+		return session, err
+	}
+	session.LastSeenAt = now
+	session.IP = client.IP
+	return session, nil
+}
+
+func (s authService) RevokeSession(ctx context.Context, userID uuid.UUID, publicID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.sessionsRepo.DeactivateByPublicID(c, userID, publicID)
+	if errors.Is(err, repositories2.ErrSessionNotFound) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
 func (s authService) Logout(ctx context.Context, id string) error {
 	c, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/converters"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var ErrConversionNotSupported = errors.New("the book cannot be converted to this format")
+
+// BookConversions converts books to other formats on request and caches the results in the storage next to the book.
+// Conversions run in the events processor, converted copies do not count towards the storage quota.
+type BookConversions interface {
+	// Targets returns the formats the book can be converted to.
+	Targets(book entities.Book) []entities.BookFormat
+	// Request returns the conversion of the book to the format and queues it when it was not requested before.
+	// Failed conversions are returned as they are unless retryFailed is set.
+	Request(ctx context.Context, book entities.Book, format entities.BookFormat, retryFailed bool) (entities.BookConversion, error)
+	GetMany(ctx context.Context, bookID uuid.UUID) ([]entities.BookConversion, error)
+	// Process runs a queued conversion. An error is only returned when the conversion should be retried later.
+	Process(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) error
+}
+
+type bookConversionsService struct {
+	conversionsRepo repositories.BookConversions
+	booksRepo       repositories.Books
+	storage         FileStorage
+	publisher       BooksEventsPublisher
+	converter       converters.Converter
+	tempDir         string
+	// convertTimeout limits a single conversion, timeout limits the other operations.
+	convertTimeout time.Duration
+	timeout        time.Duration
+	logger         *slog.Logger
+}
+
+func NewBookConversions(
+	conversionsRepo repositories.BookConversions,
+	booksRepo repositories.Books,
+	storage FileStorage,
+	publisher BooksEventsPublisher,
+	converter converters.Converter,
+	tempDir string,
+	convertTimeout time.Duration,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookConversions {
+	return bookConversionsService{
+		conversionsRepo: conversionsRepo,
+		booksRepo:       booksRepo,
+		storage:         storage,
+		publisher:       publisher,
+		converter:       converter,
+		tempDir:         tempDir,
+		convertTimeout:  convertTimeout,
+		timeout:         timeout,
+		logger:          logger,
+	}
+}
+
+// conversionPath returns the storage path of the book converted to the format.
+func conversionPath(book entities.Book, format entities.BookFormat) string {
+	return book.StoragePath + "." + string(format)
+}
+
+// conversionPaths returns every storage path a converted copy of the book can have.
+func conversionPaths(book entities.Book) []string {
+	targets := converters.TargetFormats()
+	paths := make([]string, len(targets))
+	for i, format := range targets {
+		paths[i] = conversionPath(book, format)
+	}
+	return paths
+}
+
+func (s bookConversionsService) Targets(book entities.Book) []entities.BookFormat {
+	return converters.Targets(s.converter, book.Format)
+}
+
+func (s bookConversionsService) Request(
+	ctx context.Context,
+	book entities.Book,
+	format entities.BookFormat,
+	retryFailed bool,
+) (entities.BookConversion, error) {
+	if book.Status != entities.BookStatusReady {
+		return entities.BookConversion{}, ErrBookPendingScan
+	}
+	if !slices.Contains(s.Targets(book), format) {
+		return entities.BookConversion{}, ErrConversionNotSupported
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conversion, queued, err := s.conversionsRepo.Queue(c, book.ID, format, retryFailed)
+	if err != nil {
+		s.logger.Error("cannot queue book conversion", "error", err, "book_id", book.ID, "format", format)
+		return entities.BookConversion{}, ErrInternal
+	}
+	if !queued {
+		return conversion, nil
+	}
+	if err := s.publisher.PublishConvertBookEvent(c, book.ID, format); err != nil {
+		s.logger.Error("cannot publish convert book event", "error", err, "book_id", book.ID, "format", format)
+		s.fail(ctx, book.ID, format, ErrInternal.Error())
+		return entities.BookConversion{}, ErrInternal
+	}
+	return conversion, nil
+}
+
+func (s bookConversionsService) GetMany(ctx context.Context, bookID uuid.UUID) ([]entities.BookConversion, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conversions, err := s.conversionsRepo.GetByBookID(c, bookID)
+	if err != nil {
+		s.logger.Error("cannot get book conversions", "error", err, "book_id", bookID)
+		return nil, ErrInternal
+	}
+	return conversions, nil
+}
+
+func (s bookConversionsService) fail(ctx context.Context, bookID uuid.UUID, format entities.BookFormat, reason string) {
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	if err := s.conversionsRepo.Fail(c, bookID, format, reason); err != nil && !errors.Is(err, repositories.ErrBookConversionNotFound) {
+		s.logger.Error("cannot fail book conversion", "error", err, "book_id", bookID, "format", format)
+	}
+}
+
+func (s bookConversionsService) Process(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conversion, err := s.conversionsRepo.Get(c, bookID, format)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookConversionNotFound) {
+			// the book has been deleted since the conversion was requested
+			return nil
+		}
+		s.logger.Error("cannot get book conversion", "error", err, "book_id", bookID, "format", format)
+		return err
+	}
+	// the event is delivered again when the conversion finished but the event could not be acknowledged
+	if conversion.Status != entities.BookConversionStatusPending {
+		return nil
+	}
+	book, err := s.booksRepo.GetByID(c, bookID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			s.fail(ctx, bookID, format, ErrBookNotFound.Error())
+			return nil
+		}
+		s.logger.Error("cannot get book to convert", "error", err, "book_id", bookID)
+		return err
+	}
+	return s.convert(ctx, book, format)
+}
+
+// convert converts the book in a temporary directory and uploads the result.
+// Any failure except a shutdown fails the conversion, it can be retried by requesting it again.
+func (s bookConversionsService) convert(ctx context.Context, book entities.Book, format entities.BookFormat) error {
+	l := s.logger.With("book_id", book.ID, "format", format)
+	storagePath, size, err := s.convertFile(ctx, book, format)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l.Warn("book conversion failed", "error", err)
+		s.fail(ctx, book.ID, format, err.Error())
+		return nil
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.conversionsRepo.Complete(c, book.ID, format, storagePath, size); err != nil {
+		if !errors.Is(err, repositories.ErrBookConversionNotFound) {
+			l.Error("cannot complete book conversion", "error", err)
+			s.fail(ctx, book.ID, format, ErrInternal.Error())
+		}
+		if err := s.storage.Delete(c, storagePath); err != nil {
+			l.Error("cannot delete converted book", "error", err, "path", storagePath)
+		}
+		return nil
+	}
+	l.Info("book converted", "size", size)
+	return nil
+}
+
+// convertFile returns the storage path and size of the converted book.
+// Errors of the converter are returned as they are, they tell the user why the conversion failed.
+func (s bookConversionsService) convertFile(ctx context.Context, book entities.Book, format entities.BookFormat) (string, int64, error) {
+	l := s.logger.With("book_id", book.ID, "format", format)
+	dir, err := os.MkdirTemp(s.tempDir, "convert-*")
+	if err != nil {
+		l.Error("cannot create temporary directory for conversion", "error", err)
+		return "", 0, ErrInternal
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "book"+formats.Extension(book.Format))
+	if err := s.download(ctx, book, src); err != nil {
+		l.Error("cannot download book to convert", "error", err)
+		return "", 0, ErrInternal
+	}
+	dst := filepath.Join(dir, "converted"+formats.Extension(format))
+	c, cancel := context.WithTimeout(ctx, s.convertTimeout)
+	err = s.converter.Convert(c, book.Format, format, src, dst)
+	cancel()
+	if err != nil {
+		return "", 0, err
+	}
+	converted, err := os.Open(dst)
+	if err != nil {
+		l.Error("cannot open converted book", "error", err)
+		return "", 0, ErrInternal
+	}
+	defer converted.Close()
+	info, err := converted.Stat()
+	if err != nil {
+		l.Error("cannot open converted book", "error", err)
+		return "", 0, ErrInternal
+	}
+	storagePath := conversionPath(book, format)
+	if err := s.storage.Upload(ctx, storagePath, info.Size(), converted); err != nil {
+		l.Error("cannot upload converted book", "error", err, "path", storagePath)
+		return "", 0, ErrInternal
+	}
+	return storagePath, info.Size(), nil
+}
+
+func (s bookConversionsService) download(ctx context.Context, book entities.Book, dst string) error {
+	content, err := s.storage.Get(ctx, book.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	return errors.Join(err, file.Close())
+}
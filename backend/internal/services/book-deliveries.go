@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDeviceNotFound       = errors.New("device not found")
+	ErrDeviceExists         = errors.New("a device with this email already exists")
+	ErrInvalidDeviceEmail   = errors.New("invalid device email")
+	ErrInvalidDeviceFormat  = errors.New("unknown book format")
+	ErrAttachmentTooLarge   = errors.New("the book is too large to be sent by email")
+	ErrBookDeliveryNotFound = errors.New("book delivery not found")
+	ErrConversionNotAllowed = errors.New("the book has no file in the format of the device, only its owner can convert it")
+	// errDeliveryNotReady is returned by Process while the book is being converted for the device.
+	errDeliveryNotReady = errors.New("the book is not converted yet")
+)
+
+const maxDeviceNameLength = 100
+
+// BookDeliveries sends books to the devices of their owners by email, such as the Send to Kindle address of a Kindle.
+// The mails are sent by the events processor, books are converted to the format of the device first when needed.
+type BookDeliveries interface {
+	AddDevice(ctx context.Context, device entities.Device) (entities.Device, error)
+	RemoveDevice(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) error
+	GetDevices(ctx context.Context, userID uuid.UUID) ([]entities.Device, error)
+	// Send queues the book to be sent to the device of the user. The book is converted to the format of the device
+	// only if convert is set, otherwise it has to have a file in that format.
+	Send(ctx context.Context, userID uuid.UUID, book entities.Book, deviceID uuid.UUID, convert bool) (entities.BookDelivery, error)
+	GetMany(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.BookDelivery, error)
+	// Process sends a queued delivery. An error is only returned when the delivery should be retried later.
+	Process(ctx context.Context, deliveryID uuid.UUID) error
+	// Abandon fails a queued delivery that is not retried anymore.
+	Abandon(ctx context.Context, deliveryID uuid.UUID)
+}
+
+type bookDeliveriesService struct {
+	devicesRepo    repositories.Devices
+	deliveriesRepo repositories.BookDeliveries
+	booksRepo      repositories.Books
+	filesRepo      repositories.BookFiles
+	conversions    BookConversions
+	storage        FileStorage
+	publisher      BooksEventsPublisher
+	mailer         Mailer
+	// maxAttachmentSize is the size limit of sent books in bytes.
+	maxAttachmentSize int64
+	timeout           time.Duration
+	logger            *slog.Logger
+}
+
+func NewBookDeliveries(
+	devicesRepo repositories.Devices,
+	deliveriesRepo repositories.BookDeliveries,
+	booksRepo repositories.Books,
+	filesRepo repositories.BookFiles,
+	conversions BookConversions,
+	storage FileStorage,
+	publisher BooksEventsPublisher,
+	mailer Mailer,
+	maxAttachmentSize int64,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookDeliveries {
+	return bookDeliveriesService{
+		devicesRepo:       devicesRepo,
+		deliveriesRepo:    deliveriesRepo,
+		booksRepo:         booksRepo,
+		filesRepo:         filesRepo,
+		conversions:       conversions,
+		storage:           storage,
+		publisher:         publisher,
+		mailer:            mailer,
+		maxAttachmentSize: maxAttachmentSize,
+		timeout:           timeout,
+		logger:            logger,
+	}
+}
+
+func (s bookDeliveriesService) AddDevice(ctx context.Context, device entities.Device) (entities.Device, error) {
+	device.Name = strings.TrimSpace(device.Name)
+	if device.Name == "" || len(device.Name) > maxDeviceNameLength {
+		return entities.Device{}, fmt.Errorf("device name must be between 1 and %d characters", maxDeviceNameLength)
+	}
+	address, err := mail.ParseAddress(device.Email)
+	if err != nil || address.Address != device.Email {
+		return entities.Device{}, ErrInvalidDeviceEmail
+	}
+	if device.Format == "" {
+		device.Format = entities.BookFormatEPUB
+	}
+	if !formats.Known(device.Format) {
+		return entities.Device{}, ErrInvalidDeviceFormat
+	}
+	device.ID = uuid.New()
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	created, err := s.devicesRepo.Create(c, device)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDeviceExists) {
+			return entities.Device{}, ErrDeviceExists
+		}
+		s.logger.Error("cannot create device", "error", err, "user_id", device.UserID)
+		return entities.Device{}, ErrInternal
+	}
+	return created, nil
+}
+
+func (s bookDeliveriesService) RemoveDevice(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.devicesRepo.Delete(c, deviceID, userID); err != nil {
+		if errors.Is(err, repositories.ErrDeviceNotFound) {
+			return ErrDeviceNotFound
+		}
+		s.logger.Error("cannot delete device", "error", err, "device_id", deviceID)
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s bookDeliveriesService) GetDevices(ctx context.Context, userID uuid.UUID) ([]entities.Device, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	devices, err := s.devicesRepo.GetByUserID(c, userID)
+	if err != nil {
+		s.logger.Error("cannot get devices", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	return devices, nil
+}
+
+func (s bookDeliveriesService) Send(
+	ctx context.Context,
+	userID uuid.UUID,
+	book entities.Book,
+	deviceID uuid.UUID,
+	convert bool,
+) (entities.BookDelivery, error) {
+	if book.Status != entities.BookStatusReady {
+		return entities.BookDelivery{}, ErrBookPendingScan
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	device, err := s.devicesRepo.GetByID(c, deviceID)
+	if err != nil && !errors.Is(err, repositories.ErrDeviceNotFound) {
+		s.logger.Error("cannot get device", "error", err, "device_id", deviceID)
+		return entities.BookDelivery{}, ErrInternal
+	}
+	if err != nil || device.UserID != userID {
+		return entities.BookDelivery{}, ErrDeviceNotFound
+	}
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		s.logger.Error("cannot get book files", "error", err, "book_id", book.ID)
+		return entities.BookDelivery{}, ErrInternal
+	}
+	// the size of converted books is only known once they are converted, Process checks it again
+	if i := slices.IndexFunc(files, func(file entities.BookFile) bool { return file.Format == device.Format }); i >= 0 {
+		if files[i].Status != entities.BookStatusReady {
+			return entities.BookDelivery{}, ErrBookPendingScan
+		}
+		if s.tooLarge(files[i].Size) {
+			return entities.BookDelivery{}, ErrAttachmentTooLarge
+		}
+	} else if !convert {
+		return entities.BookDelivery{}, ErrConversionNotAllowed
+	} else if _, err := s.conversions.Request(ctx, book, device.Format, true); err != nil {
+		return entities.BookDelivery{}, err
+	}
+	delivery, err := s.deliveriesRepo.Create(c, entities.BookDelivery{
+		ID:       uuid.New(),
+		UserID:   userID,
+		BookID:   book.ID,
+		DeviceID: device.ID,
+		Format:   device.Format,
+		Status:   entities.BookDeliveryStatusPending,
+	})
+	if err != nil {
+		s.logger.Error("cannot create book delivery", "error", err, "book_id", book.ID, "device_id", device.ID)
+		return entities.BookDelivery{}, ErrInternal
+	}
+	if err := s.publisher.PublishSendBookEvent(c, delivery.ID); err != nil {
+		s.logger.Error("cannot publish send book event", "error", err, "delivery_id", delivery.ID)
+		s.fail(ctx, delivery.ID, ErrInternal.Error())
+		return entities.BookDelivery{}, ErrInternal
+	}
+	return delivery, nil
+}
+
+func (s bookDeliveriesService) GetMany(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.BookDelivery, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	deliveries, err := s.deliveriesRepo.GetManyByUserID(c, userID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get book deliveries", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	return deliveries, nil
+}
+
+func (s bookDeliveriesService) tooLarge(size int64) bool {
+	return size > s.maxAttachmentSize
+}
+
+func (s bookDeliveriesService) fail(ctx context.Context, deliveryID uuid.UUID, reason string) {
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	if err := s.deliveriesRepo.Fail(c, deliveryID, reason); err != nil && !errors.Is(err, repositories.ErrBookDeliveryNotFound) {
+		s.logger.Error("cannot fail book delivery", "error", err, "delivery_id", deliveryID)
+	}
+}
+
+func (s bookDeliveriesService) Abandon(ctx context.Context, deliveryID uuid.UUID) {
+	s.logger.Warn("giving up on book delivery", "delivery_id", deliveryID)
+	s.fail(ctx, deliveryID, "the book could not be prepared in time, try sending it again")
+}
+
+func (s bookDeliveriesService) Process(ctx context.Context, deliveryID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	delivery, err := s.deliveriesRepo.GetByID(c, deliveryID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookDeliveryNotFound) {
+			// the book or the device has been deleted since the delivery was queued
+			return nil
+		}
+		s.logger.Error("cannot get book delivery", "error", err, "delivery_id", deliveryID)
+		return err
+	}
+	if delivery.Status != entities.BookDeliveryStatusPending {
+		return nil
+	}
+	device, err := s.devicesRepo.GetByID(c, delivery.DeviceID)
+	var book entities.Book
+	if err == nil {
+		book, err = s.booksRepo.GetByID(c, delivery.BookID)
+	}
+	if errors.Is(err, repositories.ErrDeviceNotFound) || errors.Is(err, repositories.ErrBookNotFound) {
+		return nil
+	} else if err != nil {
+		s.logger.Error("cannot get book delivery target", "error", err, "delivery_id", deliveryID)
+		return err
+	}
+	storagePath, size, err := s.content(ctx, book, delivery.Format)
+	if err != nil {
+		if errors.Is(err, errDeliveryNotReady) || ctx.Err() != nil {
+			return err
+		}
+		s.fail(ctx, delivery.ID, err.Error())
+		return nil
+	}
+	return s.send(ctx, delivery, device, book, storagePath, size)
+}
+
+// content returns the storage path and size of the book in the format. It returns errDeliveryNotReady while
+// the book is being converted, other errors fail the delivery and tell the user why.
+func (s bookDeliveriesService) content(ctx context.Context, book entities.Book, format entities.BookFormat) (string, int64, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		s.logger.Error("cannot get book files", "error", err, "book_id", book.ID)
+		return "", 0, errDeliveryNotReady
+	}
+	if i := slices.IndexFunc(files, func(file entities.BookFile) bool { return file.Format == format }); i >= 0 {
+		if files[i].Status != entities.BookStatusReady {
+			return "", 0, errDeliveryNotReady
+		}
+		return files[i].StoragePath, files[i].Size, nil
+	}
+	conversion, err := s.conversions.Request(ctx, book, format, false)
+	if err != nil {
+		if errors.Is(err, ErrInternal) {
+			return "", 0, errDeliveryNotReady
+		}
+		return "", 0, err
+	}
+	switch conversion.Status {
+	case entities.BookConversionStatusCompleted:
+		return conversion.StoragePath, conversion.Size, nil
+	case entities.BookConversionStatusFailed:
+		return "", 0, fmt.Errorf("conversion failed: %s", conversion.Error)
+	}
+	return "", 0, errDeliveryNotReady
+}
+
+// send mails the book to the device. Mails are not retried automatically, a failed delivery can be sent again by the user.
+func (s bookDeliveriesService) send(
+	ctx context.Context,
+	delivery entities.BookDelivery,
+	device entities.Device,
+	book entities.Book,
+	storagePath string,
+	size int64,
+) error {
+	l := s.logger.With("delivery_id", delivery.ID, "book_id", book.ID, "device_id", device.ID)
+	if s.tooLarge(size) {
+		s.fail(ctx, delivery.ID, ErrAttachmentTooLarge.Error())
+		return nil
+	}
+	content, err := s.storage.Get(ctx, storagePath)
+	if err != nil {
+		l.Error("cannot get book to send", "error", err, "path", storagePath)
+		return err
+	}
+	// the recorded size is not trusted, the mail is built in memory
+	data, err := io.ReadAll(io.LimitReader(content, s.maxAttachmentSize+1))
+	content.Close()
+	if err != nil {
+		l.Error("cannot read book to send", "error", err, "path", storagePath)
+		return err
+	}
+	if s.tooLarge(int64(len(data))) {
+		s.fail(ctx, delivery.ID, ErrAttachmentTooLarge.Error())
+		return nil
+	}
+	err = s.mailer.Send(ctx, Mail{
+		To:      device.Email,
+		Subject: book.Title,
+		Body:    fmt.Sprintf("%s is attached to this mail.", book.Title),
+		Attachments: []Attachment{{
+			Name:        sanitizeFileName(book.Title) + formats.Extension(delivery.Format),
+			ContentType: formats.MIMEType(delivery.Format),
+			Content:     data,
+		}},
+	})
+	if err != nil {
+		l.Warn("cannot send book", "error", err)
+		s.fail(ctx, delivery.ID, "cannot send the mail: "+err.Error())
+		return nil
+	}
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	if err := s.deliveriesRepo.MarkSent(c, delivery.ID, int64(len(data))); err != nil &&
+		!errors.Is(err, repositories.ErrBookDeliveryNotFound) {
+		l.Error("cannot mark book delivery as sent", "error", err)
+	}
+	l.Info("book sent", "size", len(data))
+	return nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrBookVersionConflict = errors.New("book has been changed by someone else, reload it and try again")
+	ErrBookVersionNotFound = errors.New("book version not found")
+	ErrEmptyTitle          = errors.New("title must not be empty")
+	ErrInvalidISBN         = errors.New("isbn must have 10 or 13 digits")
+	ErrInvalidRating       = errors.New("rating must be from 1 to 5")
+)
+
+// Optional is a field of a patch. The value is applied only when Set is true,
+// which allows clearing nullable fields by setting them to nil.
+type Optional[T any] struct {
+	Value T
+	Set   bool
+}
+
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Value: value, Set: true}
+}
+
+func (o Optional[T]) apply(field *T) {
+	if o.Set {
+		*field = o.Value
+	}
+}
+
+type BookMetadataPatch struct {
+	Title         Optional[string]
+	Authors       Optional[[]string]
+	Description   Optional[string]
+	Language      Optional[string]
+	Publisher     Optional[string]
+	PublishedDate Optional[*time.Time]
+	ISBN          Optional[string]
+	Series        Optional[string]
+	SeriesIndex   Optional[*float64]
+	Tags          Optional[[]string]
+	Identifiers   Optional[map[string]string]
+	Rating        Optional[*int]
+}
+
+// BookMetadata edits the metadata of books and keeps the history of the changes.
+// Edits carry the version they are based on and fail with ErrBookVersionConflict if the book has changed since.
+type BookMetadata interface {
+	Update(ctx context.Context, bookID uuid.UUID, editor uuid.UUID, expectedVersion int, patch BookMetadataPatch) (entities.Book, error)
+	History(ctx context.Context, bookID uuid.UUID, limit, offset uint64) ([]entities.BookMetadataVersion, error)
+	// Revert restores the metadata of a past version as a new version.
+	Revert(ctx context.Context, bookID uuid.UUID, editor uuid.UUID, version int, expectedVersion int) (entities.Book, error)
+}
+
+type bookMetadataService struct {
+	booksRepo   repositories.Books
+	historyRepo repositories.BookHistory
+	txManager   *manager.Manager
+	timeout     time.Duration
+	logger      *slog.Logger
+}
+
+func NewBookMetadata(
+	booksRepo repositories.Books,
+	historyRepo repositories.BookHistory,
+	txManager *manager.Manager,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookMetadata {
+	return bookMetadataService{
+		booksRepo:   booksRepo,
+		historyRepo: historyRepo,
+		txManager:   txManager,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+// normalizeISBN strips separators and checks the length, an empty ISBN is allowed.
+func normalizeISBN(isbn string) (string, error) {
+	isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+	if isbn == "" {
+		return "", nil
+	}
+	for i, r := range isbn {
+		if (r < '0' || r > '9') && !(r == 'X' && i == len(isbn)-1) {
+			return "", ErrInvalidISBN
+		}
+	}
+	if len(isbn) != 10 && len(isbn) != 13 {
+		return "", ErrInvalidISBN
+	}
+	return isbn, nil
+}
+
+func applyPatch(title string, metadata entities.BookMetadata, patch BookMetadataPatch) (string, entities.BookMetadata, error) {
+	patch.Title.apply(&title)
+	patch.Authors.apply(&metadata.Authors)
+	patch.Description.apply(&metadata.Description)
+	patch.Language.apply(&metadata.Language)
+	patch.Publisher.apply(&metadata.Publisher)
+	patch.PublishedDate.apply(&metadata.PublishedDate)
+	patch.ISBN.apply(&metadata.ISBN)
+	patch.Series.apply(&metadata.Series)
+	patch.SeriesIndex.apply(&metadata.SeriesIndex)
+	patch.Tags.apply(&metadata.Tags)
+	patch.Identifiers.apply(&metadata.Identifiers)
+	patch.Rating.apply(&metadata.Rating)
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", entities.BookMetadata{}, ErrEmptyTitle
+	}
+	isbn, err := normalizeISBN(metadata.ISBN)
+	if err != nil {
+		return "", entities.BookMetadata{}, err
+	}
+	metadata.ISBN = isbn
+	if metadata.Rating != nil && (*metadata.Rating < 1 || *metadata.Rating > 5) {
+		return "", entities.BookMetadata{}, ErrInvalidRating
+	}
+	return title, metadata, nil
+}
+
+func equalPointers[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// changedFields lists the names of the fields that differ between the two states.
+func changedFields(oldTitle string, before entities.BookMetadata, newTitle string, after entities.BookMetadata) []string {
+	var fields []string
+	add := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	add("title", oldTitle != newTitle)
+	add("authors", !slices.Equal(before.Authors, after.Authors))
+	add("description", before.Description != after.Description)
+	add("language", before.Language != after.Language)
+	add("publisher", before.Publisher != after.Publisher)
+	add("published_date", !equalPointers(before.PublishedDate, after.PublishedDate))
+	add("isbn", before.ISBN != after.ISBN)
+	add("series", before.Series != after.Series)
+	add("series_index", !equalPointers(before.SeriesIndex, after.SeriesIndex))
+	add("tags", !slices.Equal(before.Tags, after.Tags))
+	add("identifiers", !maps.Equal(before.Identifiers, after.Identifiers))
+	add("rating", !equalPointers(before.Rating, after.Rating))
+	return fields
+}
+
+func (s bookMetadataService) update(ctx context.Context, bookID uuid.UUID, editor uuid.UUID, expectedVersion int, patch BookMetadataPatch) (entities.Book, error) {
+	var updated entities.Book
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		book, err := s.booksRepo.GetByID(ctx, bookID)
+		if err != nil {
+			return err
+		}
+		if book.Version != expectedVersion {
+			return repositories.ErrBookVersionConflict
+		}
+		title, metadata, err := applyPatch(book.Title, book.Metadata, patch)
+		if err != nil {
+			return err
+		}
+		fields := changedFields(book.Title, book.Metadata, title, metadata)
+		if len(fields) == 0 {
+			updated = book
+			return nil
+		}
+		// the state before the first edit has no history entry yet
+		err = s.historyRepo.Add(ctx, entities.BookMetadataVersion{
+			BookID:    book.ID,
+			Version:   book.Version,
+			Title:     book.Title,
+			Metadata:  book.Metadata,
+			ChangedBy: &book.UploadedBy,
+			ChangedAt: book.UploadedAt,
+		})
+		if err != nil {
+			return err
+		}
+		updated, err = s.booksRepo.UpdateMetadata(ctx, book.ID, expectedVersion, title, metadata)
+		if err != nil {
+			return err
+		}
+		return s.historyRepo.Add(ctx, entities.BookMetadataVersion{
+			BookID:        updated.ID,
+			Version:       updated.Version,
+			Title:         updated.Title,
+			Metadata:      updated.Metadata,
+			ChangedFields: fields,
+			ChangedBy:     &editor,
+			ChangedAt:     time.Now(),
+		})
+	})
+	switch {
+	case err == nil:
+		return updated, nil
+	case errors.Is(err, repositories.ErrBookNotFound):
+		return entities.Book{}, ErrBookNotFound
+	case errors.Is(err, repositories.ErrBookVersionConflict):
+		return entities.Book{}, ErrBookVersionConflict
+	case errors.Is(err, ErrEmptyTitle), errors.Is(err, ErrInvalidISBN), errors.Is(err, ErrInvalidRating):
+		return entities.Book{}, err
+	}
+	s.logger.Error("cannot update book metadata", "error", err, "book_id", bookID)
+	return entities.Book{}, ErrInternal
+}
+
+func (s bookMetadataService) Update(ctx context.Context, bookID uuid.UUID, editor uuid.UUID, expectedVersion int, patch BookMetadataPatch) (entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.update(c, bookID, editor, expectedVersion, patch)
+}
+
+func (s bookMetadataService) History(ctx context.Context, bookID uuid.UUID, limit, offset uint64) ([]entities.BookMetadataVersion, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	versions, err := s.historyRepo.GetMany(c, bookID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get book metadata history", "error", err, "book_id", bookID)
+		return nil, ErrInternal
+	}
+	return versions, nil
+}
+
+func (s bookMetadataService) Revert(ctx context.Context, bookID uuid.UUID, editor uuid.UUID, version int, expectedVersion int) (entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	past, err := s.historyRepo.Get(c, bookID, version)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookVersionNotFound) {
+			return entities.Book{}, ErrBookVersionNotFound
+		}
+		s.logger.Error("cannot get book metadata version", "error", err, "book_id", bookID)
+		return entities.Book{}, ErrInternal
+	}
+	return s.update(c, bookID, editor, expectedVersion, BookMetadataPatch{
+		Title:         Some(past.Title),
+		Authors:       Some(past.Metadata.Authors),
+		Description:   Some(past.Metadata.Description),
+		Language:      Some(past.Metadata.Language),
+		Publisher:     Some(past.Metadata.Publisher),
+		PublishedDate: Some(past.Metadata.PublishedDate),
+		ISBN:          Some(past.Metadata.ISBN),
+		Series:        Some(past.Metadata.Series),
+		SeriesIndex:   Some(past.Metadata.SeriesIndex),
+		Tags:          Some(past.Metadata.Tags),
+		Identifiers:   Some(past.Metadata.Identifiers),
+		Rating:        Some(past.Metadata.Rating),
+	})
+}
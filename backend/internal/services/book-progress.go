@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/audio"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrBookProgressNotFound = errors.New("the book has not been opened yet")
+	ErrInvalidPercentage    = errors.New("percentage must be between 0 and 1")
+	ErrInvalidPosition      = errors.New("invalid listening position")
+	ErrInvalidLocator       = errors.New("locator is too long")
+)
+
+// maxLocatorLength limits the reader locators, EPUB CFIs are a few hundred characters long.
+const maxLocatorLength = 2048
+
+// BookProgress keeps how far users have got in their books, read or listened to.
+type BookProgress interface {
+	// Get returns ErrBookProgressNotFound when the user has not saved a position in the book.
+	Get(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.BookProgress, error)
+	// Save stores the position of the user in the book. The percentage of audiobooks is computed
+	// from the listening position and the duration of the tracks.
+	Save(ctx context.Context, book entities.Book, progress entities.BookProgress) (entities.BookProgress, error)
+}
+
+type bookProgressService struct {
+	progressRepo repositories.BookProgress
+	audiobooks   Audiobooks
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+func NewBookProgress(
+	progressRepo repositories.BookProgress,
+	audiobooks Audiobooks,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookProgress {
+	return bookProgressService{
+		progressRepo: progressRepo,
+		audiobooks:   audiobooks,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+func (s bookProgressService) Get(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.BookProgress, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	progress, err := s.progressRepo.Get(c, userID, bookID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookProgressNotFound) {
+			return entities.BookProgress{}, ErrBookProgressNotFound
+		}
+		s.logger.Error("cannot get book progress", "error", err, "user_id", userID, "book_id", bookID)
+		return entities.BookProgress{}, ErrInternal
+	}
+	return progress, nil
+}
+
+func (s bookProgressService) Save(ctx context.Context, book entities.Book, progress entities.BookProgress) (entities.BookProgress, error) {
+	if progress.Percentage < 0 || progress.Percentage > 1 {
+		return entities.BookProgress{}, ErrInvalidPercentage
+	}
+	if len(progress.Locator) > maxLocatorLength {
+		return entities.BookProgress{}, ErrInvalidLocator
+	}
+	if progress.Position < 0 {
+		return entities.BookProgress{}, ErrInvalidPosition
+	}
+	if audio.IsAudio(book.Format) {
+		tracks, err := s.audiobooks.Tracks(ctx, book)
+		if err != nil {
+			return entities.BookProgress{}, err
+		}
+		if duration := AudiobookDuration(tracks); duration > 0 {
+			if progress.Position > duration {
+				return entities.BookProgress{}, ErrInvalidPosition
+			}
+			progress.Percentage = float64(progress.Position) / float64(duration)
+		}
+	} else if progress.Position != 0 {
+		// only audiobooks have a listening position
+		return entities.BookProgress{}, ErrInvalidPosition
+	}
+	progress.BookID = book.ID
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	saved, err := s.progressRepo.Save(c, progress)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			return entities.BookProgress{}, ErrBookNotFound
+		}
+		s.logger.Error("cannot save book progress", "error", err, "user_id", progress.UserID, "book_id", book.ID)
+		return entities.BookProgress{}, ErrInternal
+	}
+	return saved, nil
+}
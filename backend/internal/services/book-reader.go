@@ -0,0 +1,260 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/epub"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+)
+
+var (
+	ErrBookNotReadable        = errors.New("the book has no epub file to read")
+	ErrReaderResourceNotFound = errors.New("resource not found in the book")
+)
+
+const (
+	// readerBlockSize is the size of the ranged reads of the zip directory and the small entries.
+	readerBlockSize = 64 << 10
+	// readerCachedBlocks is how many blocks are kept while a request reads the archive.
+	readerCachedBlocks = 16
+)
+
+// ReaderResource is a file inside the EPUB of a book.
+type ReaderResource struct {
+	Content   io.ReadCloser
+	MediaType string
+	Size      int64
+	// Version identifies the EPUB file the resource comes from, it changes when the file is replaced.
+	Version string
+}
+
+// BookReader serves EPUB books to the web reader resource by resource. Only the zip directory
+// and the requested entries are downloaded from the storage.
+type BookReader interface {
+	// Open returns the manifest, the reading order and the table of contents of the book
+	// together with the version of its EPUB file.
+	Open(ctx context.Context, book entities.Book) (epub.Publication, string, error)
+	// Resource returns a resource of the book by its path inside the archive. Content documents are sanitized.
+	Resource(ctx context.Context, book entities.Book, name string) (ReaderResource, error)
+}
+
+type bookReaderService struct {
+	filesRepo repositories.BookFiles
+	storage   FileStorage
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+func NewBookReader(
+	filesRepo repositories.BookFiles,
+	storage FileStorage,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookReader {
+	return bookReaderService{
+		filesRepo: filesRepo,
+		storage:   storage,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// epubFile returns the EPUB file of the book, the primary file when it is an EPUB.
+func (s bookReaderService) epubFile(ctx context.Context, book entities.Book) (entities.BookFile, error) {
+	if book.Status != entities.BookStatusReady {
+		return entities.BookFile{}, ErrBookPendingScan
+	}
+	if book.Format == entities.BookFormatEPUB {
+		return entities.BookFile{
+			BookID:      book.ID,
+			Format:      book.Format,
+			Size:        book.Size,
+			Hash:        book.Hash,
+			StoragePath: book.StoragePath,
+			Status:      book.Status,
+		}, nil
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		s.logger.Error("cannot get book files", "error", err, "book_id", book.ID)
+		return entities.BookFile{}, ErrInternal
+	}
+	i := slices.IndexFunc(files, func(file entities.BookFile) bool {
+		return file.Format == entities.BookFormatEPUB && file.Status == entities.BookStatusReady
+	})
+	if i < 0 {
+		return entities.BookFile{}, ErrBookNotReadable
+	}
+	return files[i], nil
+}
+
+func (s bookReaderService) open(ctx context.Context, book entities.Book) (*epub.Book, *storageReaderAt, entities.BookFile, error) {
+	file, err := s.epubFile(ctx, book)
+	if err != nil {
+		return nil, nil, entities.BookFile{}, err
+	}
+	r := newStorageReaderAt(ctx, s.storage, file.StoragePath, file.Size)
+	opened, err := epub.Open(r, file.Size)
+	if err != nil {
+		if errors.Is(err, epub.ErrInvalid) {
+			return nil, nil, entities.BookFile{}, formats.ErrCorruptFile
+		}
+		s.logger.Error("cannot read epub", "error", err, "book_id", book.ID, "path", file.StoragePath)
+		return nil, nil, entities.BookFile{}, ErrInternal
+	}
+	return opened, r, file, nil
+}
+
+func (s bookReaderService) Open(ctx context.Context, book entities.Book) (epub.Publication, string, error) {
+	opened, _, file, err := s.open(ctx, book)
+	if err != nil {
+		return epub.Publication{}, "", err
+	}
+	return opened.Publication, hex.EncodeToString(file.Hash[:]), nil
+}
+
+func (s bookReaderService) Resource(ctx context.Context, book entities.Book, name string) (ReaderResource, error) {
+	opened, r, file, err := s.open(ctx, book)
+	if err != nil {
+		return ReaderResource{}, err
+	}
+	entry, item, err := opened.Resource(name)
+	if err != nil {
+		return ReaderResource{}, ErrReaderResourceNotFound
+	}
+	l := s.logger.With("book_id", book.ID, "resource", name)
+	content, err := s.entryContent(r, entry)
+	if err != nil {
+		l.Error("cannot read epub resource", "error", err)
+		return ReaderResource{}, ErrInternal
+	}
+	resource := ReaderResource{
+		Content:   content,
+		MediaType: item.MediaType,
+		Size:      int64(entry.UncompressedSize64),
+		Version:   hex.EncodeToString(file.Hash[:]),
+	}
+	if resource.MediaType == "" {
+		resource.MediaType = mime.TypeByExtension(path.Ext(name))
+	}
+	if resource.MediaType != epub.XHTMLMediaType && resource.MediaType != "text/html" {
+		return resource, nil
+	}
+	defer content.Close()
+	sanitized := bytes.Buffer{}
+	if err := epub.Sanitize(&sanitized, content); err != nil {
+		l.Error("cannot sanitize epub content document", "error", err)
+		return ReaderResource{}, ErrInternal
+	}
+	resource.Content = io.NopCloser(&sanitized)
+	resource.Size = int64(sanitized.Len())
+	return resource, nil
+}
+
+// entryContent streams the entry with a single ranged request instead of reading it block by block.
+func (s bookReaderService) entryContent(r *storageReaderAt, entry *zip.File) (io.ReadCloser, error) {
+	if entry.Method != zip.Store && entry.Method != zip.Deflate {
+		return entry.Open()
+	}
+	if entry.CompressedSize64 == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := s.storage.GetRange(r.ctx, r.path, offset, int64(entry.CompressedSize64))
+	if err != nil {
+		return nil, err
+	}
+	if entry.Method == zip.Store {
+		return raw, nil
+	}
+	return inflater{ReadCloser: flate.NewReader(raw), raw: raw}, nil
+}
+
+// inflater closes the compressed stream together with the decompressor.
+type inflater struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (i inflater) Close() error {
+	return errors.Join(i.ReadCloser.Close(), i.raw.Close())
+}
+
+// storageReaderAt reads an object of the storage with ranged requests of readerBlockSize bytes
+// and keeps the last blocks, the zip reader makes many small reads close to each other.
+// It is used by a single request and is not safe for concurrent use.
+type storageReaderAt struct {
+	ctx     context.Context
+	storage FileStorage
+	path    string
+	size    int64
+	blocks  map[int64][]byte
+	order   []int64
+}
+
+func newStorageReaderAt(ctx context.Context, storage FileStorage, path string, size int64) *storageReaderAt {
+	return &storageReaderAt{
+		ctx:     ctx,
+		storage: storage,
+		path:    path,
+		size:    size,
+		blocks:  make(map[int64][]byte),
+	}
+}
+
+func (r *storageReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		block, err := r.block(pos / readerBlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos%readerBlockSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *storageReaderAt) block(i int64) ([]byte, error) {
+	if block, ok := r.blocks[i]; ok {
+		return block, nil
+	}
+	offset := i * readerBlockSize
+	block := make([]byte, min(readerBlockSize, r.size-offset))
+	content, err := r.storage.GetRange(r.ctx, r.path, offset, int64(len(block)))
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	if _, err := io.ReadFull(content, block); err != nil {
+		return nil, err
+	}
+	if len(r.order) == readerCachedBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[i] = block
+	r.order = append(r.order, i)
+	return block, nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+)
+
+const (
+	// staleScanAge is how long a file waits for the scan before its upload event is considered lost,
+	// it is longer than the retries of a scan take.
+	staleScanAge        = time.Hour
+	scanRequeueInterval = 15 * time.Minute
+	scanRequeueBatch    = 100
+)
+
+// BookScans runs the malware scan of uploaded books.
+type BookScans interface {
+	// Scan marks the clean files of the book as ready. An infected primary file deletes the whole book,
+	// other infected files are deleted from it, the uploader is notified in both cases.
+	// Books that are gone and files that are already scanned are skipped.
+	Scan(ctx context.Context, bookID uuid.UUID) error
+	// Abandon marks the files of the book that still wait for the scan as failed once the scan is not retried anymore.
+	Abandon(ctx context.Context, bookID uuid.UUID)
+	// Run publishes the upload events of files that wait for the scan for too long again,
+	// the events are lost when publishing them after the upload fails.
+	Run(ctx context.Context) error
+}
+
+type bookScansService struct {
+	booksRepo           repositories.Books
+	filesRepo           repositories.BookFiles
+	usersRepo           repositories.Users
+	storage             FileStorage
+	scanner             Scanner
+	booksEventPublisher BooksEventsPublisher
+	txManager           *manager.Manager
+	mailer              Mailer
+	timeout             time.Duration
+	logger              *slog.Logger
+}
+
+func NewBookScans(
+	booksRepo repositories.Books,
+	filesRepo repositories.BookFiles,
+	usersRepo repositories.Users,
+	storage FileStorage,
+	scanner Scanner,
+	booksEventPublisher BooksEventsPublisher,
+	txManager *manager.Manager,
+	mailer Mailer,
+	timeout time.Duration,
+	logger *slog.Logger,
+) BookScans {
+	return bookScansService{
+		booksRepo:           booksRepo,
+		filesRepo:           filesRepo,
+		usersRepo:           usersRepo,
+		storage:             storage,
+		scanner:             scanner,
+		booksEventPublisher: booksEventPublisher,
+		txManager:           txManager,
+		mailer:              mailer,
+		timeout:             timeout,
+		logger:              logger,
+	}
+}
+
+func (s bookScansService) Scan(ctx context.Context, bookID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	book, err := s.booksRepo.GetByID(c, bookID)
+	var files []entities.BookFile
+	if err == nil {
+		files, err = s.filesRepo.GetByBookID(c, bookID)
+	}
+	cancel()
+	if errors.Is(err, repositories.ErrBookNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, file := range files {
+		if file.Status != entities.BookStatusPendingScan {
+			continue
+		}
+		result, err := s.scan(ctx, file)
+		if err != nil {
+			return err
+		}
+		if !result.Infected {
+			c, cancel := context.WithTimeout(ctx, s.timeout)
+			err := s.filesRepo.SetStatus(c, file.ID, entities.BookStatusReady)
+			cancel()
+			if err != nil && !errors.Is(err, repositories.ErrBookFileNotFound) {
+				return err
+			}
+			continue
+		}
+		s.logger.Warn(
+			"infected book file found",
+			"book_id", book.ID, "file_id", file.ID, "user_id", book.UploadedBy, "signature", result.Signature,
+		)
+		// the files are ordered by age, the first one is the primary file
+		if i == 0 {
+			return s.deleteBook(ctx, book, result)
+		}
+		if err := s.deleteFile(ctx, book, file, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s bookScansService) Abandon(ctx context.Context, bookID uuid.UUID) {
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	s.logger.Warn("giving up on book scan", "book_id", bookID)
+	if err := s.filesRepo.FailPendingScans(c, bookID); err != nil {
+		s.logger.Error("cannot fail book scan", "error", err, "book_id", bookID)
+	}
+}
+
+func (s bookScansService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(scanRequeueInterval)
+	defer ticker.Stop()
+	for {
+		s.requeueStale(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s bookScansService) requeueStale(ctx context.Context) {
+	before := time.Now().Add(-staleScanAge)
+	requeued := 0
+	after := uuid.Nil
+	for {
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		bookIDs, err := s.filesRepo.GetBooksPendingScan(c, before, after, scanRequeueBatch)
+		cancel()
+		if err != nil {
+			s.logger.Error("cannot get books pending scan", "error", err)
+			return
+		}
+		for _, bookID := range bookIDs {
+			c, cancel := context.WithTimeout(ctx, s.timeout)
+			err := s.booksEventPublisher.PublishUploadBookEvent(c, entities.Book{ID: bookID})
+			cancel()
+			if err != nil {
+				s.logger.Error("cannot publish upload book event", "error", err, "book_id", bookID)
+				continue
+			}
+			requeued++
+		}
+		if len(bookIDs) < scanRequeueBatch {
+			break
+		}
+		after = bookIDs[len(bookIDs)-1]
+	}
+	if requeued > 0 {
+		s.logger.Info("requeued stale book scans", "books", requeued)
+	}
+}
+
+func (s bookScansService) deleteBook(ctx context.Context, book entities.Book, result ScanResult) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var files []entities.BookFile
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		var err error
+		files, err = s.booksRepo.Delete(ctx, book.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the scan of a deleted book is not repeated, so a lost event leaves the infected files in the storage
+	if err := s.booksEventPublisher.PublishDeleteBookEvent(c, book, files); err != nil {
+		s.logger.Error("cannot publish delete book event for infected book", "error", err, "book_id", book.ID)
+	}
+	s.notifyUploader(c, book, fmt.Sprintf(
+		"The book %q you uploaded was found to contain malware (%s) and has been deleted.\n",
+		book.Title,
+		result.Signature,
+	))
+	return nil
+}
+
+func (s bookScansService) deleteFile(ctx context.Context, book entities.Book, file entities.BookFile, result ScanResult) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.filesRepo.Delete(c, file.ID)
+	if errors.Is(err, repositories.ErrBookFileNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.booksEventPublisher.PublishDeleteBookFileEvent(c, book, file); err != nil {
+		s.logger.Error("cannot publish delete book file event for infected file", "error", err, "file_id", file.ID)
+	}
+	s.notifyUploader(c, book, fmt.Sprintf(
+		"The %s file you added to the book %q was found to contain malware (%s) and has been deleted.\n",
+		formats.Extension(file.Format),
+		book.Title,
+		result.Signature,
+	))
+	return nil
+}
+
+func (s bookScansService) scan(ctx context.Context, file entities.BookFile) (ScanResult, error) {
+	content, err := s.storage.Get(ctx, file.StoragePath)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer content.Close()
+	return s.scanner.Scan(ctx, content)
+}
+
+func (s bookScansService) notifyUploader(ctx context.Context, book entities.Book, body string) {
+	user, err := s.usersRepo.GetByID(ctx, book.UploadedBy)
+	if err != nil {
+		s.logger.Error("cannot get uploader of infected book", "error", err, "user_id", book.UploadedBy)
+		return
+	}
+	err = s.mailer.Send(ctx, Mail{
+		To:      user.Email,
+		Subject: "Your upload was removed",
+		Body:    body,
+	})
+	if err != nil {
+		s.logger.Error("cannot notify uploader of infected book", "error", err, "user_id", user.ID)
+	}
+}
@@ -1,60 +1,156 @@
 package services
 
 import (
+	"bufio"
 	"context"
 	"crypto/sha256"
 	"errors"
 	"io"
 	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/Shelffy/shelffy/internal/audio"
+	"github.com/Shelffy/shelffy/internal/comics"
+	"github.com/Shelffy/shelffy/internal/config"
 	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/natsort"
 	"github.com/Shelffy/shelffy/internal/repositories"
 	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrBookNotFound = errors.New("book not found")
+	ErrBookNotFound         = errors.New("book not found")
+	ErrFileTooLarge         = errors.New("file is too large")
+	ErrUnsupportedMediaType = errors.New("unsupported file type")
+	ErrBookPendingScan      = errors.New("book is not available until the malware scan completes")
+	ErrBookFileNotFound     = errors.New("book file not found")
+	ErrBookFileExists       = errors.New("the book already has a file in this format")
+	ErrPrimaryBookFile      = errors.New("the file the book was uploaded with cannot be deleted, delete the book instead")
+	ErrNoAudioTracks        = errors.New("an audiobook needs at least one track")
+	ErrInvalidCover         = errors.New("cover must be a JPEG, PNG, GIF or WebP image")
+	// ErrDuplicateBook is returned by Upload together with the book of the user that already has the file.
+	ErrDuplicateBook = errors.New("the book is already in the library")
 )
 
+// coverTypes are the image types accepted as covers, as detected by http.DetectContentType.
+var coverTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// audioExtensions are the names of the files of an audiobook folder that are uploaded as tracks.
+var audioExtensions = []string{".mp3", ".m4b", ".m4a"}
+
+// FileUpload is a file of a multi-file upload.
+type FileUpload struct {
+	Name    string
+	Size    int64
+	Content io.Reader
+}
+
 type Books interface {
+	// Upload creates a book from the file. When the user already has a book with the same file,
+	// that book is returned with ErrDuplicateBook and nothing is stored.
 	Upload(ctx context.Context, book entities.Book, contentLength int64, content io.Reader) (entities.Book, error)
 	Delete(ctx context.Context, bookID uuid.UUID) error
 	GetByID(ctx context.Context, bookID uuid.UUID) (entities.Book, error)
 	GetManyByUserID(ctx context.Context, bookID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+	// GetLibrary returns the books of the user together with the books shared with the households of the user,
+	// as far as the tag restrictions of the user allow.
+	GetLibrary(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
 	GetByTitleAndUserID(ctx context.Context, title string, userID uuid.UUID) (entities.Book, error)
 	GetBookContentByID(ctx context.Context, bookID uuid.UUID) (io.Reader, error)
+	// UploadAudiobook creates an audiobook from the tracks of a folder, they are played in the order of their names.
+	UploadAudiobook(ctx context.Context, book entities.Book, tracks []FileUpload) (entities.Book, error)
+	// AddFile attaches a file in another format to the book. The file waits for the malware scan like a new book.
+	// Audio files added to an audiobook become its next track.
+	AddFile(ctx context.Context, book entities.Book, contentLength int64, content io.Reader) (entities.BookFile, error)
+	// GetFiles returns the files of the book, the primary file first.
+	GetFiles(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error)
+	// DeleteFile deletes a file of the book other than the primary one.
+	DeleteFile(ctx context.Context, book entities.Book, fileID uuid.UUID) error
+	// SetCover stores the cover image of the book in place of the current one.
+	SetCover(ctx context.Context, book entities.Book, size int64, cover io.Reader) (entities.Book, error)
 }
 
 type booksService struct {
 	booksRepository     repositories.Books
+	filesRepository     repositories.BookFiles
+	pagesRepository     repositories.ComicPages
+	tracksRepository    repositories.AudioTracks
 	storageService      FileStorage
 	timeout             time.Duration
 	logger              *slog.Logger
 	booksEventPublisher BooksEventsPublisher
 	txManager           *manager.Manager
+	quotas              Quotas
+	uploads             config.Uploads
 }
 
 func NewBookService(
 	booksRepo repositories.Books,
+	filesRepo repositories.BookFiles,
+	pagesRepo repositories.ComicPages,
+	tracksRepo repositories.AudioTracks,
 	storage FileStorage,
 	timeout time.Duration,
 	booksEventPublisher BooksEventsPublisher,
 	txManager *manager.Manager,
+	quotas Quotas,
+	uploads config.Uploads,
 	logger *slog.Logger,
 ) Books {
 	return booksService{
 		booksRepository:     booksRepo,
+		filesRepository:     filesRepo,
+		pagesRepository:     pagesRepo,
+		tracksRepository:    tracksRepo,
 		storageService:      storage,
 		timeout:             timeout,
 		logger:              logger,
 		booksEventPublisher: booksEventPublisher,
 		txManager:           txManager,
+		quotas:              quotas,
+		uploads:             uploads,
 	}
 }
 
+// spool copies the content into a temporary file while hashing it, so the file can be validated before it is stored.
+// The caller must close and remove the returned file.
+func (s booksService) spool(content io.Reader) (*os.File, int64, entities.BookHash, error) {
+	file, err := os.CreateTemp(s.uploads.TempDir, "upload-*")
+	if err != nil {
+		return nil, 0, entities.BookHash{}, err
+	}
+	hash := sha256.New()
+	reader := content
+	if s.uploads.MaxFileSize > 0 {
+		reader = io.LimitReader(content, s.uploads.MaxFileSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	return file, size, entities.BookHash(hash.Sum(nil)), err
+}
+
+// detectFormat validates the file and checks its format against the allowed types.
+func (s booksService) detectFormat(file io.ReaderAt, size int64) (entities.BookFormat, string, error) {
+	format, err := formats.Detect(file, size)
+	if err != nil {
+		return "", "", err
+	}
+	mimeType := formats.MIMEType(format)
+	if len(s.uploads.AllowedMIMETypes) > 0 && !slices.Contains(s.uploads.AllowedMIMETypes, mimeType) {
+		return "", "", ErrUnsupportedMediaType
+	}
+	return format, mimeType, nil
+}
+
 func (s booksService) createStoragePath(ownerUsername string, title string) string {
 	builder := strings.Builder{}
 	builder.Grow(len(ownerUsername) + len(title) + 1)
@@ -64,51 +160,365 @@ func (s booksService) createStoragePath(ownerUsername string, title string) stri
 	return builder.String()
 }
 
+// upload is a validated file that has not been stored yet.
+type upload struct {
+	file     *os.File
+	size     int64
+	hash     entities.BookHash
+	format   entities.BookFormat
+	mimeType string
+}
+
+// close removes the spooled file.
+func (u upload) close() {
+	if u.file != nil {
+		u.file.Close()
+		os.Remove(u.file.Name())
+	}
+}
+
+// receive spools and validates an uploaded file. The caller must close the returned upload, even on errors.
+func (s booksService) receive(contentLength int64, content io.Reader) (upload, error) {
+	l := s.logger.WithGroup("receive")
+	if s.uploads.MaxFileSize > 0 && contentLength > s.uploads.MaxFileSize {
+		return upload{}, ErrFileTooLarge
+	}
+	file, size, hash, err := s.spool(content)
+	u := upload{file: file, size: size, hash: hash}
+	if err != nil {
+		l.Error("could not spool upload to a temporary file", "error", err.Error())
+		return u, ErrInternal
+	}
+	if s.uploads.MaxFileSize > 0 && size > s.uploads.MaxFileSize {
+		return u, ErrFileTooLarge
+	}
+	u.format, u.mimeType, err = s.detectFormat(file, size)
+	if err != nil {
+		if !errors.Is(err, formats.ErrUnsupportedFormat) && !errors.Is(err, formats.ErrCorruptFile) && !errors.Is(err, ErrUnsupportedMediaType) {
+			l.Error("could not detect book format", "error", err.Error())
+			return u, ErrInternal
+		}
+		return u, err
+	}
+	return u, nil
+}
+
+// store uploads the file to the storage and charges it to the quota of the owner.
+func (s booksService) store(ctx context.Context, ownerID uuid.UUID, u upload) (entities.BookFile, error) {
+	l := s.logger.WithGroup("store")
+	if err := s.quotas.Reserve(ctx, ownerID, u.size); err != nil {
+		if !errors.Is(err, ErrQuotaExceeded) {
+			l.Error("could not reserve storage quota", "error", err.Error())
+			return entities.BookFile{}, ErrInternal
+		}
+		return entities.BookFile{}, err
+	}
+	file := entities.BookFile{
+		ID:          uuid.New(),
+		Format:      u.format,
+		MIMEType:    u.mimeType,
+		Size:        u.size,
+		Hash:        u.hash,
+		StoragePath: s.createStoragePath(ownerID.String(), uuid.New().String()),
+		Status:      entities.BookStatusPendingScan,
+	}
+	if err := s.storageService.Upload(ctx, file.StoragePath, u.size, u.file); err != nil {
+		l.Error("could not upload file to storage", "error", err.Error(), "path", file.StoragePath)
+		if err := s.quotas.Release(ctx, ownerID, u.size); err != nil {
+			l.Error("could not release storage quota", "error", err.Error())
+		}
+		return entities.BookFile{}, ErrInternal
+	}
+	return file, nil
+}
+
 func (s booksService) Upload(ctx context.Context, book entities.Book, contentLength int64, content io.Reader) (entities.Book, error) {
 	l := s.logger.WithGroup("Upload")
-	book.StoragePath = s.createStoragePath(book.UploadedBy.String(), uuid.New().String())
-	hash := sha256.New()
-	reader := io.TeeReader(content, hash)
-	if err := s.storageService.Upload(ctx, book.StoragePath, contentLength, reader); err != nil {
-		l.Error("could not upload file to storage", "error", err.Error(), "path", book.StoragePath)
-		return entities.Book{}, ErrInternal
+	u, err := s.receive(contentLength, content)
+	defer u.close()
+	if err != nil {
+		return entities.Book{}, err
+	}
+	existing, err := s.duplicateOf(ctx, book.UploadedBy, u.hash)
+	if err != nil {
+		return entities.Book{}, err
+	}
+	if existing != nil {
+		return *existing, ErrDuplicateBook
+	}
+	if ext := path.Ext(book.Title); strings.EqualFold(ext, formats.Extension(u.format)) {
+		book.Title = strings.TrimSuffix(book.Title, ext)
+	}
+	var index comics.Index
+	var track audio.Info
+	switch {
+	case comics.IsComic(u.format):
+		index, err = comics.ReadIndex(u.format, u.file, u.size)
+		if err != nil {
+			return entities.Book{}, formats.ErrCorruptFile
+		}
+		if index.Info != nil {
+			book.Metadata = mergeMetadata(book.Metadata, index.Info.Metadata())
+		}
+	case audio.IsAudio(u.format):
+		if track, err = audio.Probe(u.format, u.file, u.size); err != nil {
+			return entities.Book{}, formats.ErrCorruptFile
+		}
+		// the album is the title of the audiobook, the tracks are named after the chapters
+		if track.Album != "" {
+			book.Title = track.Album
+		}
+		book.Metadata = mergeMetadata(book.Metadata, entities.BookMetadata{Authors: track.Artists})
+	}
+	file, err := s.store(ctx, book.UploadedBy, u)
+	if err != nil {
+		return entities.Book{}, err
 	}
-	book.Hash = entities.BookHash(hash.Sum(nil))
 	book.ID = uuid.New()
+	book.StoragePath = file.StoragePath
+	book.Hash = file.Hash
+	book.Size = file.Size
+	book.Format = file.Format
+	book.MIMEType = file.MIMEType
+	book.Status = file.Status
 	// TODO: it is still not proper way to do this
 	createdBook, err := s.booksRepository.Create(ctx, book)
 	if err != nil {
 		l.Error("cannot create book in book's repository", "error", err.Error())
-		if err := s.booksEventPublisher.PublishDeleteBookEvent(ctx, book.StoragePath); err != nil {
-			l.Error("cannot create publish delete book event", "error", err.Error(), "ack")
+		if err := s.booksEventPublisher.PublishDeleteBookEvent(ctx, book, []entities.BookFile{file}); err != nil {
+			l.Error("cannot create publish delete book event", "error", err.Error())
 		}
 		return entities.Book{}, ErrInternal
 	}
+	if len(index.Pages) > 0 {
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		if err := s.pagesRepository.Replace(c, createdBook.ID, toComicPages(createdBook, index)); err != nil {
+			// the pages are indexed again when they are first read
+			l.Error("cannot store comic pages", "error", err.Error(), "book_id", createdBook.ID)
+		}
+	}
+	if audio.IsAudio(createdBook.Format) {
+		if files, err := s.GetFiles(ctx, createdBook.ID); err == nil {
+			s.addTrack(ctx, files[0], track)
+		}
+	}
+	if err := s.booksEventPublisher.PublishUploadBookEvent(ctx, createdBook); err != nil {
+		l.Error("cannot publish upload book event, the book stays pending scan", "error", err.Error(), "book_id", createdBook.ID)
+	}
 	return createdBook, nil
 }
 
-func (s booksService) Delete(ctx context.Context, bookID uuid.UUID) error {
-	l := s.logger.WithGroup("Delete")
-	return s.txManager.Do(ctx, func(ctx context.Context) error {
-		book, err := s.booksRepository.GetByID(ctx, bookID)
-		if err != nil {
-			if !errors.Is(err, repositories.ErrBookNotFound) {
-				l.Error("cannot get book from book's repository", "error", err.Error(), "book", book)
-				return ErrBookNotFound
-			}
+// duplicateOf returns the book of the user that has a file with the hash.
+func (s booksService) duplicateOf(ctx context.Context, userID uuid.UUID, hash entities.BookHash) (*entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepository.GetByHash(c, hash)
+	if err != nil {
+		s.logger.Error("cannot look up books by hash", "error", err.Error(), "user_id", userID)
+		return nil, ErrInternal
+	}
+	for _, book := range books {
+		if book.UploadedBy == userID {
+			return &book, nil
+		}
+	}
+	return nil, nil
+}
+
+// addTrack appends the audio file to the tracks of its book. Files left without a track
+// are probed again when the tracks are first read.
+func (s booksService) addTrack(ctx context.Context, file entities.BookFile, info audio.Info) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.tracksRepository.Create(c, toAudioTrack(file, info)); err != nil {
+		s.logger.Error("cannot store audio track", "error", err.Error(), "book_id", file.BookID, "file_id", file.ID)
+	}
+}
+
+func (s booksService) UploadAudiobook(ctx context.Context, book entities.Book, tracks []FileUpload) (entities.Book, error) {
+	// folders of audiobooks often come with covers, cue sheets and playlists
+	tracks = slices.DeleteFunc(slices.Clone(tracks), func(track FileUpload) bool {
+		return !slices.Contains(audioExtensions, strings.ToLower(path.Ext(track.Name)))
+	})
+	if len(tracks) == 0 {
+		return entities.Book{}, ErrNoAudioTracks
+	}
+	slices.SortStableFunc(tracks, func(a, b FileUpload) int { return natsort.Compare(a.Name, b.Name) })
+	book.Title = strings.TrimSuffix(tracks[0].Name, path.Ext(tracks[0].Name))
+	created, err := s.Upload(ctx, book, tracks[0].Size, tracks[0].Content)
+	if err != nil {
+		// a duplicate comes with the audiobook the user already has
+		return created, err
+	}
+	if !audio.IsAudio(created.Format) {
+		err = ErrNotAudiobook
+	}
+	for i := 1; err == nil && i < len(tracks); i++ {
+		_, err = s.AddFile(ctx, created, tracks[i].Size, tracks[i].Content)
+	}
+	if err != nil {
+		// the tracks uploaded so far are removed with the book, it never shows up in the trash
+		var files []entities.BookFile
+		purge := func(ctx context.Context) error {
+			var err error
+			files, err = s.booksRepository.Delete(ctx, created.ID)
 			return err
 		}
-		if err := s.booksRepository.Delete(ctx, bookID); err != nil {
-			l.Error("cannot delete book from book's repository", "error", err.Error(), "book", book)
-			return ErrInternal
+		if err := s.txManager.Do(context.WithoutCancel(ctx), purge); err != nil {
+			s.logger.Error("cannot delete partially uploaded audiobook", "error", err.Error(), "book_id", created.ID)
+		} else if err := s.booksEventPublisher.PublishDeleteBookEvent(context.WithoutCancel(ctx), created, files); err != nil {
+			s.logger.Error("cannot publish delete book event", "error", err.Error(), "book_id", created.ID)
 		}
-		err = s.booksEventPublisher.PublishDeleteBookEvent(ctx, book.StoragePath)
-		if err != nil {
-			l.Error("could not publish delete book event", "error", err.Error())
-			return ErrInternal
+		return entities.Book{}, err
+	}
+	return created, nil
+}
+
+func (s booksService) AddFile(ctx context.Context, book entities.Book, contentLength int64, content io.Reader) (entities.BookFile, error) {
+	l := s.logger.WithGroup("AddFile")
+	u, err := s.receive(contentLength, content)
+	defer u.close()
+	if err != nil {
+		return entities.BookFile{}, err
+	}
+	files, err := s.GetFiles(ctx, book.ID)
+	if err != nil {
+		return entities.BookFile{}, err
+	}
+	isTrack := audio.IsAudio(book.Format) && audio.IsAudio(u.format)
+	if !isTrack && slices.ContainsFunc(files, func(file entities.BookFile) bool { return file.Format == u.format }) {
+		return entities.BookFile{}, ErrBookFileExists
+	}
+	var track audio.Info
+	if isTrack {
+		if track, err = audio.Probe(u.format, u.file, u.size); err != nil {
+			return entities.BookFile{}, formats.ErrCorruptFile
+		}
+	}
+	file, err := s.store(ctx, book.UploadedBy, u)
+	if err != nil {
+		return entities.BookFile{}, err
+	}
+	file.BookID = book.ID
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	createdFile, err := s.filesRepository.Create(c, file)
+	if err != nil {
+		// the uploaded content is removed and the quota released by the delete event
+		if err := s.booksEventPublisher.PublishDeleteBookFileEvent(ctx, book, file); err != nil {
+			l.Error("cannot publish delete book file event", "error", err.Error())
+		}
+		switch {
+		case errors.Is(err, repositories.ErrBookFileExists):
+			return entities.BookFile{}, ErrBookFileExists
+		case errors.Is(err, repositories.ErrBookNotFound):
+			return entities.BookFile{}, ErrBookNotFound
 		}
-		return nil
+		l.Error("cannot create book file", "error", err.Error(), "book_id", book.ID)
+		return entities.BookFile{}, ErrInternal
+	}
+	if isTrack {
+		s.addTrack(ctx, createdFile, track)
+	}
+	if err := s.booksEventPublisher.PublishUploadBookEvent(ctx, book); err != nil {
+		l.Error("cannot publish upload book event, the file stays pending scan", "error", err.Error(), "book_id", book.ID)
+	}
+	return createdFile, nil
+}
+
+func (s booksService) GetFiles(ctx context.Context, bookID uuid.UUID) ([]entities.BookFile, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	files, err := s.filesRepository.GetByBookID(c, bookID)
+	if err != nil {
+		s.logger.Error("cannot get book files", "error", err.Error(), "book_id", bookID)
+		return nil, ErrInternal
+	}
+	return files, nil
+}
+
+func (s booksService) DeleteFile(ctx context.Context, book entities.Book, fileID uuid.UUID) error {
+	l := s.logger.WithGroup("DeleteFile")
+	files, err := s.GetFiles(ctx, book.ID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(files, func(file entities.BookFile) bool { return file.ID == fileID })
+	if i < 0 {
+		return ErrBookFileNotFound
+	}
+	if i == 0 {
+		return ErrPrimaryBookFile
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err = s.txManager.Do(c, func(ctx context.Context) error {
+		if err := s.filesRepository.Delete(ctx, fileID); err != nil {
+			return err
+		}
+		return s.booksEventPublisher.PublishDeleteBookFileEvent(ctx, book, files[i])
 	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookFileNotFound) {
+			return ErrBookFileNotFound
+		}
+		l.Error("cannot delete book file", "error", err.Error(), "book_id", book.ID, "file_id", fileID)
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s booksService) SetCover(ctx context.Context, book entities.Book, size int64, cover io.Reader) (entities.Book, error) {
+	l := s.logger.WithGroup("SetCover")
+	reader := bufio.NewReader(cover)
+	head, _ := reader.Peek(512)
+	if !slices.Contains(coverTypes, http.DetectContentType(head)) {
+		return entities.Book{}, ErrInvalidCover
+	}
+	storagePath := book.StoragePath + "-cover"
+	if err := s.storageService.Upload(ctx, storagePath, size, reader); err != nil {
+		l.Error("cannot upload cover", "error", err.Error(), "book_id", book.ID)
+		return entities.Book{}, ErrInternal
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.booksRepository.SetCover(c, book.ID, storagePath); err != nil {
+		// the upload replaced the current cover when the book had one, it is kept for the book to use
+		if book.CoverPath == "" {
+			if err := s.storageService.Delete(ctx, storagePath); err != nil {
+				l.Error("cannot delete cover", "error", err.Error(), "path", storagePath)
+			}
+		}
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			return entities.Book{}, ErrBookNotFound
+		}
+		l.Error("cannot set cover", "error", err.Error(), "book_id", book.ID)
+		return entities.Book{}, ErrInternal
+	}
+	// covers taken over from merged books are stored at the path of the book they came from
+	if book.CoverPath != "" && book.CoverPath != storagePath {
+		if err := s.storageService.Delete(ctx, book.CoverPath); err != nil {
+			l.Error("cannot delete replaced cover", "error", err.Error(), "path", book.CoverPath)
+		}
+	}
+	book.CoverPath = storagePath
+	return book, nil
+}
+
+// Delete moves the book to the trash, the file is removed when the trash is purged.
+func (s booksService) Delete(ctx context.Context, bookID uuid.UUID) error {
+	l := s.logger.WithGroup("Delete")
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.booksRepository.SoftDelete(c, bookID); err != nil {
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			return ErrBookNotFound
+		}
+		l.Error("cannot move book to trash", "error", err.Error(), "book_id", bookID)
+		return ErrInternal
+	}
+	return nil
 }
 
 func (s booksService) GetByID(ctx context.Context, bookID uuid.UUID) (entities.Book, error) {
@@ -152,6 +562,9 @@ func (s booksService) GetBookContentByID(ctx context.Context, bookID uuid.UUID)
 		}
 		return nil, ErrBookNotFound
 	}
+	if book.Status != entities.BookStatusReady {
+		return nil, ErrBookPendingScan
+	}
 	content, err := s.storageService.Get(ctx, book.StoragePath)
 	if err != nil {
 		l.Error("cannot get book from storage service", "error", err.Error(), "path", book.StoragePath)
@@ -160,6 +573,17 @@ func (s booksService) GetBookContentByID(ctx context.Context, bookID uuid.UUID)
 	return content, nil
 }
 
+func (s booksService) GetLibrary(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepository.GetLibrary(c, userID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get library of user", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	return books, nil
+}
+
 func (s booksService) GetManyByUserID(ctx context.Context, userID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
 	l := s.logger.WithGroup("GetManyByUserID")
 	c, cancel := context.WithTimeout(ctx, s.timeout)
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Shelffy/shelffy/internal/calibre"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+)
+
+// calibreFormats is the order in which the formats of a Calibre book are preferred.
+// A single file is imported per book.
+var calibreFormats = []entities.BookFormat{
+	entities.BookFormatEPUB,
+	entities.BookFormatAZW3,
+	entities.BookFormatMOBI,
+	entities.BookFormatPDF,
+	entities.BookFormatFB2,
+	entities.BookFormatCBZ,
+	entities.BookFormatCBR,
+	entities.BookFormatCB7,
+}
+
+var (
+	ErrNotACalibreLibrary = errors.New("directory is not a calibre library")
+	errNoSupportedFormat  = errors.New("book has no file in a supported format")
+	errBookFileMissing    = errors.New("book file is missing from the library")
+)
+
+func (s importsService) QueueCalibreLibrary(ctx context.Context, ownerID uuid.UUID, dir string) (entities.ImportJob, error) {
+	files, err := s.calibreFiles(ctx, dir)
+	if err != nil {
+		return entities.ImportJob{}, err
+	}
+	return s.enqueue(ctx, ownerID, entities.ImportSourceCalibre, dir, files, func() {})
+}
+
+func (s importsService) ImportCalibreLibrary(ctx context.Context, ownerID uuid.UUID, dir string) (entities.ImportJob, error) {
+	files, err := s.calibreFiles(ctx, dir)
+	if err != nil {
+		return entities.ImportJob{}, err
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	job, err := s.createJob(c, ownerID, entities.ImportSourceCalibre, dir, len(files))
+	cancel()
+	if err != nil {
+		return entities.ImportJob{}, err
+	}
+	s.process(ctx, importTask{job: job, files: files, cleanup: func() {}})
+	return s.GetJob(context.WithoutCancel(ctx), job.ID)
+}
+
+// calibreFiles reads the books of the library. The files are read when the job is processed.
+func (s importsService) calibreFiles(ctx context.Context, dir string) ([]importFile, error) {
+	library, err := calibre.Open(dir)
+	if err != nil {
+		if errors.Is(err, calibre.ErrNotALibrary) {
+			return nil, ErrNotACalibreLibrary
+		}
+		s.logger.Error("cannot open calibre library", "error", err, "dir", dir)
+		return nil, ErrInternal
+	}
+	defer library.Close()
+	books, err := library.Books(ctx)
+	if err != nil {
+		s.logger.Error("cannot read calibre library", "error", err, "dir", dir)
+		return nil, ErrInternal
+	}
+	files := make([]importFile, len(books))
+	for i, book := range books {
+		files[i] = calibreFile(library, book)
+	}
+	return files, nil
+}
+
+func calibreFile(library *calibre.Library, book calibre.Book) importFile {
+	metadata := entities.BookMetadata{
+		Authors:       book.Authors,
+		Description:   book.Description,
+		Language:      book.Language,
+		Publisher:     book.Publisher,
+		PublishedDate: book.PublishedDate,
+		Series:        book.Series,
+		SeriesIndex:   book.SeriesIndex,
+		Tags:          book.Tags,
+		Identifiers:   book.Identifiers,
+		Rating:        book.Rating,
+	}
+	if isbn, err := normalizeISBN(book.Identifiers["isbn"]); err == nil && isbn != "" {
+		metadata.ISBN = isbn
+		delete(metadata.Identifiers, "isbn")
+	}
+	file := importFile{
+		name: fmt.Sprintf("%s (%d)", book.Title, book.ID),
+		book: entities.Book{Title: book.Title, Metadata: metadata},
+	}
+	var relative string
+	for _, format := range calibreFormats {
+		if path, ok := book.Files[string(format)]; ok {
+			relative = path
+			break
+		}
+	}
+	if relative == "" {
+		file.unavailable = errNoSupportedFormat
+		return file
+	}
+	file.name = relative
+	filePath := library.Path(relative)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		file.unavailable = errBookFileMissing
+		return file
+	}
+	file.size = info.Size()
+	file.open = func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	}
+	if book.CoverPath != "" {
+		file.coverPath = library.Path(book.CoverPath)
+	}
+	return file
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/comics"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+)
+
+var (
+	ErrNotComic          = errors.New("the book is not a comic")
+	ErrComicPageNotFound = errors.New("page not found")
+	ErrInvalidPageWidth  = errors.New("invalid page width")
+)
+
+const (
+	// MaxComicPageWidth is the largest width pages are resized to.
+	MaxComicPageWidth = 4096
+	// maxResizedPageSize limits the pages that are read into memory to be resized, larger ones are served as they are.
+	maxResizedPageSize = 64 << 20
+)
+
+// ComicPage is the image of a page.
+type ComicPage struct {
+	Content     io.ReadCloser
+	ContentType string
+	// Size is -1 when it is not known up front.
+	Size int64
+}
+
+// Comics serves comic books page by page. The page index of a book is stored when the book is uploaded,
+// books uploaded before are indexed when their pages are first asked for.
+type Comics interface {
+	// Pages returns the pages of the comic in reading order.
+	Pages(ctx context.Context, book entities.Book) ([]entities.ComicPage, error)
+	// Page returns the image of page number n. The image is scaled down to width pixels when width is positive
+	// and the image is wider.
+	Page(ctx context.Context, book entities.Book, n int, width int) (ComicPage, error)
+}
+
+type comicsService struct {
+	pagesRepo repositories.ComicPages
+	storage   FileStorage
+	tempDir   string
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+func NewComics(
+	pagesRepo repositories.ComicPages,
+	storage FileStorage,
+	tempDir string,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Comics {
+	return comicsService{
+		pagesRepo: pagesRepo,
+		storage:   storage,
+		tempDir:   tempDir,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// toComicPages numbers the pages of the index.
+func toComicPages(book entities.Book, index comics.Index) []entities.ComicPage {
+	pages := make([]entities.ComicPage, len(index.Pages))
+	for i, page := range index.Pages {
+		pages[i] = entities.ComicPage{BookID: book.ID, Number: i + 1, Name: page.Name, Size: page.Size}
+	}
+	return pages
+}
+
+// mergeMetadata fills the empty fields of metadata with the ones found in the file.
+func mergeMetadata(metadata entities.BookMetadata, found entities.BookMetadata) entities.BookMetadata {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	if len(metadata.Authors) == 0 {
+		metadata.Authors = found.Authors
+	}
+	fill(&metadata.Description, found.Description)
+	fill(&metadata.Language, found.Language)
+	fill(&metadata.Publisher, found.Publisher)
+	fill(&metadata.Series, found.Series)
+	if metadata.SeriesIndex == nil {
+		metadata.SeriesIndex = found.SeriesIndex
+	}
+	if metadata.PublishedDate == nil {
+		metadata.PublishedDate = found.PublishedDate
+	}
+	if len(metadata.Tags) == 0 {
+		metadata.Tags = found.Tags
+	}
+	return metadata
+}
+
+func (s comicsService) Pages(ctx context.Context, book entities.Book) ([]entities.ComicPage, error) {
+	if !comics.IsComic(book.Format) {
+		return nil, ErrNotComic
+	}
+	if book.Status != entities.BookStatusReady {
+		return nil, ErrBookPendingScan
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	pages, err := s.pagesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		s.logger.Error("cannot get comic pages", "error", err, "book_id", book.ID)
+		return nil, ErrInternal
+	}
+	if len(pages) > 0 {
+		return pages, nil
+	}
+	return s.index(ctx, book)
+}
+
+// index downloads the comic and stores its page index.
+func (s comicsService) index(ctx context.Context, book entities.Book) ([]entities.ComicPage, error) {
+	l := s.logger.With("book_id", book.ID)
+	file, err := os.CreateTemp(s.tempDir, "comic-*")
+	if err != nil {
+		l.Error("cannot create temporary file for comic", "error", err)
+		return nil, ErrInternal
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	content, err := s.storage.Get(ctx, book.StoragePath)
+	if err != nil {
+		l.Error("cannot get comic from storage", "error", err, "path", book.StoragePath)
+		return nil, ErrInternal
+	}
+	size, err := io.Copy(file, content)
+	content.Close()
+	if err != nil {
+		l.Error("cannot download comic", "error", err, "path", book.StoragePath)
+		return nil, ErrInternal
+	}
+	index, err := comics.ReadIndex(book.Format, file, size)
+	if err != nil {
+		l.Warn("cannot index comic", "error", err)
+		return nil, ErrNotComic
+	}
+	pages := toComicPages(book, index)
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.pagesRepo.Replace(c, book.ID, pages); err != nil {
+		// the index is built again on the next request
+		l.Error("cannot store comic pages", "error", err)
+	}
+	return pages, nil
+}
+
+func (s comicsService) Page(ctx context.Context, book entities.Book, n int, width int) (ComicPage, error) {
+	if width < 0 || width > MaxComicPageWidth {
+		return ComicPage{}, ErrInvalidPageWidth
+	}
+	pages, err := s.Pages(ctx, book)
+	if err != nil {
+		return ComicPage{}, err
+	}
+	if n < 1 || n > len(pages) {
+		return ComicPage{}, ErrComicPageNotFound
+	}
+	page := pages[n-1]
+	l := s.logger.With("book_id", book.ID, "page", n)
+	content, err := s.openPage(ctx, book, page.Name)
+	if err != nil {
+		if errors.Is(err, comics.ErrPageNotFound) {
+			return ComicPage{}, ErrComicPageNotFound
+		}
+		l.Error("cannot open comic page", "error", err)
+		return ComicPage{}, ErrInternal
+	}
+	result := ComicPage{
+		Content:     content,
+		ContentType: mime.TypeByExtension(path.Ext(page.Name)),
+		Size:        page.Size,
+	}
+	if result.ContentType == "" {
+		result.ContentType = "application/octet-stream"
+	}
+	if width == 0 || page.Size > maxResizedPageSize {
+		return result, nil
+	}
+	defer content.Close()
+	original, err := io.ReadAll(content)
+	if err != nil {
+		l.Error("cannot read comic page", "error", err)
+		return ComicPage{}, ErrInternal
+	}
+	result.Content = io.NopCloser(bytes.NewReader(original))
+	result.Size = int64(len(original))
+	if resized, contentType, ok := comics.Resize(original, width); ok {
+		result.Content = io.NopCloser(bytes.NewReader(resized))
+		result.ContentType = contentType
+		result.Size = int64(len(resized))
+	}
+	return result, nil
+}
+
+// openPage reads a page of a CBZ or CB7 with ranged requests. RAR archives can only be read in order,
+// so a CBR is streamed from the start up to the page.
+func (s comicsService) openPage(ctx context.Context, book entities.Book, name string) (io.ReadCloser, error) {
+	if book.Format != entities.BookFormatCBR {
+		r := newStorageReaderAt(ctx, s.storage, book.StoragePath, book.Size)
+		return comics.OpenPage(book.Format, r, book.Size, name)
+	}
+	content, err := s.storage.Get(ctx, book.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+	page, err := comics.OpenRARPage(content, name)
+	if err != nil {
+		content.Close()
+		return nil, err
+	}
+	return inflater{ReadCloser: page, raw: content}, nil
+}
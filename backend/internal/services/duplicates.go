@@ -0,0 +1,289 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidDuplicates = errors.New("duplicates must be different books of the same owner")
+
+// copySuffix matches the " (1)" the database appends to the title of a book the owner already has a book titled so.
+var copySuffix = regexp.MustCompile(`\s\([0-9]+\)$`)
+
+// DuplicateReason tells why books are thought to be copies of the same book.
+type DuplicateReason string
+
+const (
+	// DuplicateReasonHash is given to books that have the same file.
+	DuplicateReasonHash DuplicateReason = "hash"
+	// DuplicateReasonISBN is given to books with the same ISBN, ISBN-10 and ISBN-13 compare equal.
+	DuplicateReasonISBN DuplicateReason = "isbn"
+	// DuplicateReasonTitle is given to books with the same words in the title and the names of the authors,
+	// regardless of case, punctuation, diacritics and the order of the names.
+	DuplicateReasonTitle DuplicateReason = "title"
+)
+
+// DuplicateGroup is a set of books of a user that look like copies of the same book, oldest first.
+type DuplicateGroup struct {
+	Reasons []DuplicateReason
+	Books   []entities.Book
+}
+
+// Duplicates finds books a user has several copies of and resolves them.
+// Exact copies are refused by Books.Upload, the report finds those uploaded before and near-duplicates.
+type Duplicates interface {
+	// Report groups the books of the user that look like copies of the same book.
+	// Books kept with KeepBoth are not grouped together.
+	Report(ctx context.Context, userID uuid.UUID) ([]DuplicateGroup, error)
+	// Merge moves the files and the reading data of the books to the target and deletes the books.
+	// Files in a format the target already has are deleted with them.
+	Merge(ctx context.Context, target entities.Book, books []entities.Book) (entities.Book, error)
+	// KeepBoth records that the books are different books, they are no longer reported as duplicates of each other.
+	KeepBoth(ctx context.Context, books []entities.Book) error
+}
+
+type duplicatesService struct {
+	duplicatesRepo      repositories.Duplicates
+	booksRepo           repositories.Books
+	booksEventPublisher BooksEventsPublisher
+	txManager           *manager.Manager
+	timeout             time.Duration
+	logger              *slog.Logger
+}
+
+func NewDuplicates(
+	duplicatesRepo repositories.Duplicates,
+	booksRepo repositories.Books,
+	booksEventPublisher BooksEventsPublisher,
+	txManager *manager.Manager,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Duplicates {
+	return duplicatesService{
+		duplicatesRepo:      duplicatesRepo,
+		booksRepo:           booksRepo,
+		booksEventPublisher: booksEventPublisher,
+		txManager:           txManager,
+		timeout:             timeout,
+		logger:              logger,
+	}
+}
+
+// bookPair is a pair of books ordered by id.
+func bookPair(a, b uuid.UUID) [2]uuid.UUID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return [2]uuid.UUID{a, b}
+}
+
+// titleKey is the title and the authors of the book reduced to their words. Authors are compared by the sorted
+// words of their names, so "Hugo, Victor" matches "Victor Hugo".
+func titleKey(book entities.Book) string {
+	title := matchWords(copySuffix.ReplaceAllString(book.Title, ""))
+	if len(title) == 0 {
+		return ""
+	}
+	authors := make([]string, 0, len(book.Metadata.Authors))
+	for _, author := range book.Metadata.Authors {
+		words := matchWords(author)
+		slices.Sort(words)
+		if len(words) > 0 {
+			authors = append(authors, strings.Join(words, " "))
+		}
+	}
+	slices.Sort(authors)
+	return strings.Join(title, " ") + "\x00" + strings.Join(authors, ";")
+}
+
+func (s duplicatesService) Report(ctx context.Context, userID uuid.UUID) ([]DuplicateGroup, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepo.GetManyByUserID(c, userID, nil, nil)
+	if err != nil {
+		s.logger.Error("cannot get books of user", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	pairs, err := s.duplicatesRepo.GetDismissed(c, userID)
+	if err != nil {
+		s.logger.Error("cannot get dismissed duplicates", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	dismissed := make(map[[2]uuid.UUID]struct{}, len(pairs))
+	for _, pair := range pairs {
+		dismissed[pair] = struct{}{}
+	}
+	slices.SortStableFunc(books, func(a, b entities.Book) int { return a.UploadedAt.Compare(b.UploadedAt) })
+
+	// books with the same key are joined into a group unless the owner kept them apart
+	parent := make([]int, len(books))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	reasons := make(map[int][]DuplicateReason)
+	join := func(reason DuplicateReason, keys map[string][]int) {
+		for _, group := range keys {
+			for x, i := range group {
+				for _, j := range group[x+1:] {
+					if _, ok := dismissed[bookPair(books[i].ID, books[j].ID)]; ok {
+						continue
+					}
+					ri, rj := root(i), root(j)
+					if ri != rj {
+						parent[rj] = ri
+						reasons[ri] = append(reasons[ri], reasons[rj]...)
+						delete(reasons, rj)
+					}
+					if !slices.Contains(reasons[ri], reason) {
+						reasons[ri] = append(reasons[ri], reason)
+					}
+				}
+			}
+		}
+	}
+	hashes := make(map[string][]int)
+	isbns := make(map[string][]int)
+	titles := make(map[string][]int)
+	for i, book := range books {
+		hashes[string(book.Hash[:])] = append(hashes[string(book.Hash[:])], i)
+		if isbn := isbn13(book.Metadata.ISBN); isbn != "" {
+			isbns[isbn] = append(isbns[isbn], i)
+		}
+		if key := titleKey(book); key != "" {
+			titles[key] = append(titles[key], i)
+		}
+	}
+	join(DuplicateReasonHash, hashes)
+	join(DuplicateReasonISBN, isbns)
+	join(DuplicateReasonTitle, titles)
+
+	groups := make([]DuplicateGroup, 0)
+	index := make(map[int]int)
+	for i, book := range books {
+		r := root(i)
+		if _, ok := reasons[r]; !ok {
+			continue
+		}
+		g, ok := index[r]
+		if !ok {
+			g = len(groups)
+			index[r] = g
+			groups = append(groups, DuplicateGroup{Reasons: reasons[r]})
+		}
+		groups[g].Books = append(groups[g].Books, book)
+	}
+	// the strongest reason comes first
+	order := []DuplicateReason{DuplicateReasonHash, DuplicateReasonISBN, DuplicateReasonTitle}
+	for _, group := range groups {
+		slices.SortFunc(group.Reasons, func(a, b DuplicateReason) int { return slices.Index(order, a) - slices.Index(order, b) })
+	}
+	return groups, nil
+}
+
+// checkDuplicates checks that the books are different books of the owner.
+func checkDuplicates(ownerID uuid.UUID, books []entities.Book) error {
+	seen := make(map[uuid.UUID]struct{}, len(books))
+	for _, book := range books {
+		if _, ok := seen[book.ID]; ok || book.UploadedBy != ownerID {
+			return ErrInvalidDuplicates
+		}
+		seen[book.ID] = struct{}{}
+	}
+	return nil
+}
+
+func (s duplicatesService) Merge(ctx context.Context, target entities.Book, books []entities.Book) (entities.Book, error) {
+	if len(books) == 0 {
+		return entities.Book{}, ErrInvalidDuplicates
+	}
+	if err := checkDuplicates(target.UploadedBy, append([]entities.Book{target}, books...)); err != nil {
+		return entities.Book{}, err
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var merged entities.Book
+	// the files are removed from the storage only once the merge is committed
+	removed := make([]entities.Book, 0, len(books))
+	deleted := make(map[uuid.UUID][]entities.BookFile, len(books))
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		removed = removed[:0]
+		for _, book := range books {
+			if err := s.duplicatesRepo.Merge(ctx, target.ID, book.ID); err != nil {
+				return err
+			}
+			// the target takes over the cover when it has none
+			if target.CoverPath == "" && book.CoverPath != "" {
+				if err := s.booksRepo.SetCover(ctx, target.ID, book.CoverPath); err != nil {
+					return err
+				}
+				target.CoverPath, book.CoverPath = book.CoverPath, ""
+			}
+			files, err := s.booksRepo.Delete(ctx, book.ID)
+			if err != nil {
+				return err
+			}
+			removed = append(removed, book)
+			deleted[book.ID] = files
+		}
+		var err error
+		merged, err = s.booksRepo.GetByID(ctx, target.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			return entities.Book{}, ErrBookNotFound
+		}
+		s.logger.Error("cannot merge duplicates", "error", err, "book_id", target.ID)
+		return entities.Book{}, ErrInternal
+	}
+	for _, book := range removed {
+		if err := s.booksEventPublisher.PublishDeleteBookEvent(c, book, deleted[book.ID]); err != nil {
+			s.logger.Error("cannot publish delete book event", "error", err, "book_id", book.ID)
+		}
+	}
+	return merged, nil
+}
+
+func (s duplicatesService) KeepBoth(ctx context.Context, books []entities.Book) error {
+	if len(books) < 2 {
+		return ErrInvalidDuplicates
+	}
+	if err := checkDuplicates(books[0].UploadedBy, books); err != nil {
+		return err
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		for i, book := range books {
+			for _, other := range books[i+1:] {
+				if err := s.duplicatesRepo.Dismiss(ctx, book.ID, other.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("cannot keep duplicates", "error", err, "book_id", books[0].ID)
+		return ErrInternal
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -21,22 +22,69 @@ const (
 	deleteBookDurableName = "books-deleter"
 	deleteBookBatch       = 100
 	deleteBookMaxWait     = time.Minute
+	// deleteBookRetryDelay is how long the files of an event wait for the next attempt when some were not deleted.
+	deleteBookRetryDelay = time.Minute
+	deleteBookMaxDeliver = 30
+
+	scanBookDurableName = "books-scanner"
+	scanBookBatch       = 10
+	scanBookMaxWait     = time.Minute
+	// scanBookRetryDelay is how long a book waits for the next attempt when the scan failed.
+	scanBookRetryDelay = time.Minute
+	scanBookMaxDeliver = 30
+
+	convertBookDurableName = "books-converter"
+	convertBookBatch       = 1
+	convertBookMaxWait     = time.Minute
+	convertBookRetryDelay  = time.Minute
+	// convertBookAckWait is how long a conversion may run before its event is delivered again.
+	convertBookAckWait = 15 * time.Minute
+
+	sendBookDurableName = "books-sender"
+	sendBookBatch       = 10
+	sendBookMaxWait     = time.Minute
+	// sendBookRetryDelay is how long a delivery waits for the conversion of the book before it is tried again.
+	sendBookRetryDelay = 30 * time.Second
+	// sendBookMaxDeliver gives a delivery an hour, longer than a conversion may run.
+	sendBookMaxDeliver = 120
 )
 
 type natsEventProcessor struct {
-	js      jetstream.JetStream
-	storage FileStorage
-	logger  *slog.Logger
+	js          jetstream.JetStream
+	storage     FileStorage
+	quotas      Quotas
+	scans       BookScans
+	conversions BookConversions
+	deliveries  BookDeliveries
+	logger      *slog.Logger
 }
 
-func NewNATSEventProcessor(js jetstream.JetStream, storage FileStorage, logger *slog.Logger) EventsProcessor {
+func NewNATSEventProcessor(
+	js jetstream.JetStream,
+	storage FileStorage,
+	quotas Quotas,
+	scans BookScans,
+	conversions BookConversions,
+	deliveries BookDeliveries,
+	logger *slog.Logger,
+) EventsProcessor {
 	return &natsEventProcessor{
-		js:      js,
-		storage: storage,
-		logger:  logger,
+		js:          js,
+		storage:     storage,
+		quotas:      quotas,
+		scans:       scans,
+		conversions: conversions,
+		deliveries:  deliveries,
+		logger:      logger,
 	}
 }
 
+// lastDelivery reports whether the message will not be delivered again when it is not acknowledged.
+func lastDelivery(msg jetstream.Msg, maxDeliver int) bool {
+	meta, err := msg.Metadata()
+	return err == nil && meta.NumDelivered >= uint64(maxDeliver)
+}
+
 func (ep *natsEventProcessor) handleDeleteBookEvents(ctx context.Context, cons jetstream.Consumer) error {
 	for {
 		select {
@@ -51,25 +99,196 @@ func (ep *natsEventProcessor) handleDeleteBookEvents(ctx context.Context, cons j
 				if errors.Is(err, nats.ErrTimeout) {
 					continue
 				}
-				ep.logger.Error("fetch error: %w", err)
+				ep.logger.Error("fetch error", "error", err)
+				continue
 			}
 			msgs := msgBatch.Messages()
 			paths := make([]string, 0)
+			received := make([]jetstream.Msg, 0)
+			events := make([]DeleteBookEvent, 0)
 			for msg := range msgs {
 				e, err := FromJSON[DeleteBookEvent](msg.Data())
 				if err != nil {
 					return err
 				}
-				paths = append(paths, e.Path)
-			}
-			notDeleted, err := ep.storage.BatchDelete(ctx, paths...)
-			if err != nil {
-				ep.logger.Error("error while batch deleting books", "error", err)
+				paths = append(paths, e.paths()...)
+				received = append(received, msg)
+				events = append(events, e)
 			}
-			if notDeleted != nil {
+			failed := make(map[string]bool)
+			if len(paths) > 0 {
+				notDeleted, err := ep.storage.BatchDelete(ctx, paths...)
+				if err != nil && len(notDeleted) == 0 {
+					// nothing is known to be deleted, so the whole batch is tried again
+					ep.logger.Error("error while batch deleting books", "error", err)
+					for _, path := range paths {
+						failed[path] = true
+					}
+				}
 				for _, nd := range notDeleted {
-					// TODO: need to handle it better
 					ep.logger.Error("error deleting book from storage", "path", nd.Path, "cause", nd.Cause)
+					failed[nd.Path] = true
+				}
+			}
+			for i, msg := range received {
+				e := events[i]
+				if slices.ContainsFunc(e.paths(), func(path string) bool { return failed[path] }) {
+					if lastDelivery(msg, deleteBookMaxDeliver) {
+						ep.logger.Error("giving up on deleting book files", "paths", e.paths(), "user_id", e.UserID)
+						if err := msg.Term(); err != nil {
+							ep.logger.Error("cannot terminate delete book event", "error", err)
+						}
+						continue
+					}
+					if err := msg.NakWithDelay(deleteBookRetryDelay); err != nil {
+						ep.logger.Error("cannot nak delete book event", "error", err)
+					}
+					continue
+				}
+				// the book is already gone from the database, so its size no longer counts towards the quota
+				if e.Size != 0 {
+					if err := ep.quotas.Release(ctx, e.UserID, e.Size); err != nil {
+						ep.logger.Error("cannot release storage quota", "error", err, "user_id", e.UserID)
+					}
+				}
+				if err := msg.Ack(); err != nil {
+					ep.logger.Error("cannot ack delete book event", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (ep *natsEventProcessor) handleUploadBookEvents(ctx context.Context, cons jetstream.Consumer) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			msgBatch, err := cons.Fetch(
+				scanBookBatch,
+				jetstream.FetchMaxWait(scanBookMaxWait),
+			)
+			if err != nil {
+				if errors.Is(err, nats.ErrTimeout) {
+					continue
+				}
+				ep.logger.Error("fetch error", "error", err)
+				continue
+			}
+			for msg := range msgBatch.Messages() {
+				e, err := FromJSON[UploadBookEvent](msg.Data())
+				if err != nil {
+					ep.logger.Error("invalid upload book event", "error", err)
+					if err := msg.Term(); err != nil {
+						ep.logger.Error("cannot terminate upload book event", "error", err)
+					}
+					continue
+				}
+				if err := ep.scans.Scan(ctx, e.BookID); err != nil {
+					ep.logger.Error("cannot scan book", "error", err, "book_id", e.BookID)
+					if lastDelivery(msg, scanBookMaxDeliver) {
+						ep.scans.Abandon(ctx, e.BookID)
+						if err := msg.Term(); err != nil {
+							ep.logger.Error("cannot terminate upload book event", "error", err)
+						}
+						continue
+					}
+					if err := msg.NakWithDelay(scanBookRetryDelay); err != nil {
+						ep.logger.Error("cannot nak upload book event", "error", err)
+					}
+					continue
+				}
+				if err := msg.Ack(); err != nil {
+					ep.logger.Error("cannot ack upload book event", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (ep *natsEventProcessor) handleConvertBookEvents(ctx context.Context, cons jetstream.Consumer) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// conversions are slow, so they are fetched one by one to keep the others available for redelivery
+			msgBatch, err := cons.Fetch(
+				convertBookBatch,
+				jetstream.FetchMaxWait(convertBookMaxWait),
+			)
+			if err != nil {
+				if errors.Is(err, nats.ErrTimeout) {
+					continue
+				}
+				ep.logger.Error("fetch error", "error", err)
+				continue
+			}
+			for msg := range msgBatch.Messages() {
+				e, err := FromJSON[ConvertBookEvent](msg.Data())
+				if err != nil {
+					ep.logger.Error("invalid convert book event", "error", err)
+					if err := msg.Term(); err != nil {
+						ep.logger.Error("cannot terminate convert book event", "error", err)
+					}
+					continue
+				}
+				if err := ep.conversions.Process(ctx, e.BookID, e.Format); err != nil {
+					if err := msg.NakWithDelay(convertBookRetryDelay); err != nil {
+						ep.logger.Error("cannot nak convert book event", "error", err)
+					}
+					continue
+				}
+				if err := msg.Ack(); err != nil {
+					ep.logger.Error("cannot ack convert book event", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (ep *natsEventProcessor) handleSendBookEvents(ctx context.Context, cons jetstream.Consumer) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			msgBatch, err := cons.Fetch(
+				sendBookBatch,
+				jetstream.FetchMaxWait(sendBookMaxWait),
+			)
+			if err != nil {
+				if errors.Is(err, nats.ErrTimeout) {
+					continue
+				}
+				ep.logger.Error("fetch error", "error", err)
+				continue
+			}
+			for msg := range msgBatch.Messages() {
+				e, err := FromJSON[SendBookEvent](msg.Data())
+				if err != nil {
+					ep.logger.Error("invalid send book event", "error", err)
+					if err := msg.Term(); err != nil {
+						ep.logger.Error("cannot terminate send book event", "error", err)
+					}
+					continue
+				}
+				if err := ep.deliveries.Process(ctx, e.DeliveryID); err != nil {
+					if lastDelivery(msg, sendBookMaxDeliver) {
+						ep.deliveries.Abandon(ctx, e.DeliveryID)
+						if err := msg.Term(); err != nil {
+							ep.logger.Error("cannot terminate send book event", "error", err)
+						}
+						continue
+					}
+					if err := msg.NakWithDelay(sendBookRetryDelay); err != nil {
+						ep.logger.Error("cannot nak send book event", "error", err)
+					}
+					continue
+				}
+				if err := msg.Ack(); err != nil {
+					ep.logger.Error("cannot ack send book event", "error", err)
 				}
 			}
 		}
@@ -92,6 +311,46 @@ func (ep *natsEventProcessor) Run(ctx context.Context) error {
 			Durable:       deleteBookDurableName,
 			DeliverPolicy: jetstream.DeliverAllPolicy,
 			FilterSubject: SubjDeleteBook,
+			MaxDeliver:    deleteBookMaxDeliver,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("pull subscribe error: %w", err)
+	}
+	scanBookCons, err := ep.js.CreateOrUpdateConsumer(
+		ctx,
+		booksStreamName,
+		jetstream.ConsumerConfig{
+			Durable:       scanBookDurableName,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			FilterSubject: SubjUploadBook,
+			MaxDeliver:    scanBookMaxDeliver,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("pull subscribe error: %w", err)
+	}
+	convertBookCons, err := ep.js.CreateOrUpdateConsumer(
+		ctx,
+		booksStreamName,
+		jetstream.ConsumerConfig{
+			Durable:       convertBookDurableName,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			FilterSubject: SubjConvertBook,
+			AckWait:       convertBookAckWait,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("pull subscribe error: %w", err)
+	}
+	sendBookCons, err := ep.js.CreateOrUpdateConsumer(
+		ctx,
+		booksStreamName,
+		jetstream.ConsumerConfig{
+			Durable:       sendBookDurableName,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			FilterSubject: SubjSendBook,
+			MaxDeliver:    sendBookMaxDeliver,
 		},
 	)
 	if err != nil {
@@ -102,6 +361,21 @@ func (ep *natsEventProcessor) Run(ctx context.Context) error {
 			log.Printf("handler error: %v", err)
 		}
 	}()
+	go func() {
+		if err := ep.handleUploadBookEvents(ctx, scanBookCons); err != nil {
+			log.Printf("handler error: %v", err)
+		}
+	}()
+	go func() {
+		if err := ep.handleConvertBookEvents(ctx, convertBookCons); err != nil {
+			log.Printf("handler error: %v", err)
+		}
+	}()
+	go func() {
+		if err := ep.handleSendBookEvents(ctx, sendBookCons); err != nil {
+			log.Printf("handler error: %v", err)
+		}
+	}()
 	<-ctx.Done()
 	return nil
 }
@@ -4,23 +4,54 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
 const (
-	SubjBooksBase  = "books"
-	SubjDeleteBook = SubjBooksBase + ".delete"
+	SubjBooksBase   = "books"
+	SubjDeleteBook  = SubjBooksBase + ".delete"
+	SubjUploadBook  = SubjBooksBase + ".upload"
+	SubjConvertBook = SubjBooksBase + ".convert"
+	SubjSendBook    = SubjBooksBase + ".send"
 )
 
 type EventType int
 
 const (
 	EventTypeDeleteBook EventType = iota
+	EventTypeUploadBook
+	EventTypeConvertBook
+	EventTypeSendBook
 )
 
+// DeleteBookEvent is published when a book or one of its files has been deleted from the database.
+// UserID and Size are used to release the storage quota of the owner.
+// ConversionPaths are the paths converted copies of the book may be stored at.
 type DeleteBookEvent struct {
-	Path string `json:"path"`
+	// Paths are the paths of the deleted files.
+	Paths []string `json:"paths,omitempty"`
+	// Path is only set by events published before books had several files.
+	Path            string    `json:"path,omitempty"`
+	CoverPath       string    `json:"cover_path,omitempty"`
+	ConversionPaths []string  `json:"conversion_paths,omitempty"`
+	UserID          uuid.UUID `json:"user_id,omitempty"`
+	Size            int64     `json:"size,omitempty"`
+}
+
+// paths returns the storage paths of everything the event deletes.
+func (e DeleteBookEvent) paths() []string {
+	paths := slices.Clone(e.Paths)
+	if e.Path != "" {
+		paths = append(paths, e.Path)
+	}
+	if e.CoverPath != "" {
+		paths = append(paths, e.CoverPath)
+	}
+	return append(paths, e.ConversionPaths...)
 }
 
 func (e *DeleteBookEvent) ToJSON() []byte {
@@ -28,8 +59,45 @@ func (e *DeleteBookEvent) ToJSON() []byte {
 	return d
 }
 
+// UploadBookEvent is published when a book or a file of it has been uploaded and waits for the malware scan.
+type UploadBookEvent struct {
+	BookID uuid.UUID `json:"book_id"`
+}
+
+func (e *UploadBookEvent) ToJSON() []byte {
+	d, _ := json.Marshal(*e)
+	return d
+}
+
+// ConvertBookEvent is published when a conversion of a book has been requested.
+type ConvertBookEvent struct {
+	BookID uuid.UUID           `json:"book_id"`
+	Format entities.BookFormat `json:"format"`
+}
+
+func (e *ConvertBookEvent) ToJSON() []byte {
+	d, _ := json.Marshal(*e)
+	return d
+}
+
+// SendBookEvent is published when a book has been queued to be sent to a device.
+type SendBookEvent struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+func (e *SendBookEvent) ToJSON() []byte {
+	d, _ := json.Marshal(*e)
+	return d
+}
+
 type BooksEventsPublisher interface {
-	PublishDeleteBookEvent(ctx context.Context, storagePath string) error
+	// PublishDeleteBookEvent removes the files of a deleted book together with its cover and conversions.
+	PublishDeleteBookEvent(ctx context.Context, book entities.Book, files []entities.BookFile) error
+	// PublishDeleteBookFileEvent removes a file deleted from a book that is kept.
+	PublishDeleteBookFileEvent(ctx context.Context, book entities.Book, file entities.BookFile) error
+	PublishUploadBookEvent(ctx context.Context, book entities.Book) error
+	PublishConvertBookEvent(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) error
+	PublishSendBookEvent(ctx context.Context, deliveryID uuid.UUID) error
 }
 
 type natsBooksEventPublisher struct {
@@ -40,11 +108,59 @@ func NewNATSBooksEventPublisher(js jetstream.JetStream) BooksEventsPublisher {
 	return &natsBooksEventPublisher{js: js}
 }
 
-func (ep *natsBooksEventPublisher) PublishDeleteBookEvent(ctx context.Context, storagePath string) error {
-	event := DeleteBookEvent{Path: storagePath}
+func (ep *natsBooksEventPublisher) PublishDeleteBookEvent(ctx context.Context, book entities.Book, files []entities.BookFile) error {
+	event := DeleteBookEvent{
+		Paths:           make([]string, len(files)),
+		CoverPath:       book.CoverPath,
+		ConversionPaths: conversionPaths(book),
+		UserID:          book.UploadedBy,
+	}
+	for i, file := range files {
+		event.Paths[i] = file.StoragePath
+		event.Size += file.Size
+	}
+	return ep.publishDeleteBookEvent(ctx, event)
+}
+
+func (ep *natsBooksEventPublisher) PublishDeleteBookFileEvent(ctx context.Context, book entities.Book, file entities.BookFile) error {
+	return ep.publishDeleteBookEvent(ctx, DeleteBookEvent{
+		Paths:  []string{file.StoragePath},
+		UserID: book.UploadedBy,
+		Size:   file.Size,
+	})
+}
+
+func (ep *natsBooksEventPublisher) publishDeleteBookEvent(ctx context.Context, event DeleteBookEvent) error {
 	ack, err := ep.js.Publish(ctx, SubjDeleteBook, event.ToJSON())
 	if err != nil {
 		return fmt.Errorf("%s, ack=%v", err.Error(), ack)
 	}
 	return nil
 }
+
+func (ep *natsBooksEventPublisher) PublishUploadBookEvent(ctx context.Context, book entities.Book) error {
+	event := UploadBookEvent{BookID: book.ID}
+	ack, err := ep.js.Publish(ctx, SubjUploadBook, event.ToJSON())
+	if err != nil {
+		return fmt.Errorf("%s, ack=%v", err.Error(), ack)
+	}
+	return nil
+}
+
+func (ep *natsBooksEventPublisher) PublishConvertBookEvent(ctx context.Context, bookID uuid.UUID, format entities.BookFormat) error {
+	event := ConvertBookEvent{BookID: bookID, Format: format}
+	ack, err := ep.js.Publish(ctx, SubjConvertBook, event.ToJSON())
+	if err != nil {
+		return fmt.Errorf("%s, ack=%v", err.Error(), ack)
+	}
+	return nil
+}
+
+func (ep *natsBooksEventPublisher) PublishSendBookEvent(ctx context.Context, deliveryID uuid.UUID) error {
+	event := SendBookEvent{DeliveryID: deliveryID}
+	ack, err := ep.js.Publish(ctx, SubjSendBook, event.ToJSON())
+	if err != nil {
+		return fmt.Errorf("%s, ack=%v", err.Error(), ack)
+	}
+	return nil
+}
@@ -16,6 +16,10 @@ import (
 type FileStorage interface {
 	Upload(ctx context.Context, path string, contentLength int64, bookContent io.Reader) error
 	Get(ctx context.Context, path string) (io.ReadCloser, error)
+	// GetRange returns length bytes of the object starting at offset.
+	GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+	// Size returns the size of the object in bytes.
+	Size(ctx context.Context, path string) (int64, error)
 	Delete(ctx context.Context, path string) error
 	BatchDelete(ctx context.Context, paths ...string) ([]NotDeleted, error)
 }
@@ -61,6 +65,37 @@ func (s s3storage) Get(ctx context.Context, path string) (io.ReadCloser, error)
 	return out.Body, nil
 }
 
+func (s s3storage) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	out, err := s.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(path),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "NotFound" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s s3storage) Size(ctx context.Context, path string) (int64, error) {
+	out, err := s.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return 0, ErrObjectNotFound
+		}
+		return 0, err
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
 func (s s3storage) Delete(ctx context.Context, path string) error {
 	_, err := s.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucketName),
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrHouseholdNotFound       = errors.New("household not found")
+	ErrHouseholdMemberNotFound = errors.New("household member not found")
+	ErrHouseholdMemberExists   = errors.New("the user is already a member of the household")
+	ErrHouseholdBookNotFound   = errors.New("the book is not shared with the household")
+	ErrNotHouseholdOwner       = errors.New("only owners can manage the household")
+	ErrLastHouseholdOwner      = errors.New("the household must keep at least one owner")
+	ErrInvalidHouseholdRole    = errors.New("unknown household role")
+	ErrNotBookOwner            = errors.New("only the owner of the book can share it")
+	ErrHouseholdInviteNotFound = errors.New("household invite not found")
+	ErrInvalidInviteEmail      = errors.New("invalid invite email")
+)
+
+const maxHouseholdNameLength = 100
+
+// Households groups users, such as a family, that read the books they share with each other.
+// Members are identified by the household, errors hide households the user is not a member of.
+type Households interface {
+	// Create creates a household with the user as its owner.
+	Create(ctx context.Context, userID uuid.UUID, name string) (entities.Household, error)
+	Delete(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) error
+	// GetByUserID returns the households of the user.
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Household, error)
+	// GetByBook returns the households the book is shared with, only the owner of the book may ask.
+	GetByBook(ctx context.Context, userID uuid.UUID, book entities.Book) ([]entities.Household, error)
+	GetMembers(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) ([]entities.HouseholdMember, error)
+	// InviteMember invites the email to the household with the role and the allowed tags of the invite,
+	// replacing a pending invite of the email. The result does not depend on whether the email is registered.
+	InviteMember(ctx context.Context, userID uuid.UUID, invite entities.HouseholdInvite) (entities.HouseholdInvite, error)
+	// GetInvites returns the pending invites to the email of the user.
+	GetInvites(ctx context.Context, userID uuid.UUID) ([]entities.HouseholdInvite, error)
+	// GetHouseholdInvites returns the pending invites of the household, only owners may ask.
+	GetHouseholdInvites(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) ([]entities.HouseholdInvite, error)
+	// AcceptInvite adds the user to the household of an invite to the email of the user.
+	AcceptInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) (entities.Household, error)
+	// DeclineInvite deletes an invite to the email of the user.
+	DeclineInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) error
+	// CancelInvite deletes a pending invite, only owners of the household may do it.
+	CancelInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) error
+	// UpdateMember changes the role and the allowed tags of the member.
+	UpdateMember(ctx context.Context, userID uuid.UUID, member entities.HouseholdMember) (entities.HouseholdMember, error)
+	// RemoveMember removes a member, members can remove themselves. The books of the member are no longer shared.
+	RemoveMember(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, memberID uuid.UUID) error
+	// ShareBook shares a book of the user with a household of the user.
+	ShareBook(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, book entities.Book) error
+	// UnshareBook stops sharing the book, either the owner of the book or an owner of the household may do it.
+	UnshareBook(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, book entities.Book) error
+	// GetBooks returns the books shared with the household that the user can read, oldest first.
+	GetBooks(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, limit, offset *uint64) ([]entities.Book, error)
+	// CanRead tells if the book is shared with a household of the user and passes the tag restrictions of the user.
+	CanRead(ctx context.Context, userID uuid.UUID, book entities.Book) (bool, error)
+}
+
+type householdsService struct {
+	householdsRepo repositories.Households
+	usersRepo      repositories.Users
+	booksRepo      repositories.Books
+	txManager      *manager.Manager
+	timeout        time.Duration
+	logger         *slog.Logger
+}
+
+func NewHouseholds(
+	householdsRepo repositories.Households,
+	usersRepo repositories.Users,
+	booksRepo repositories.Books,
+	txManager *manager.Manager,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Households {
+	return householdsService{
+		householdsRepo: householdsRepo,
+		usersRepo:      usersRepo,
+		booksRepo:      booksRepo,
+		txManager:      txManager,
+		timeout:        timeout,
+		logger:         logger,
+	}
+}
+
+// normalizeAllowedTags trims and lowercases the tags and drops empty and repeated ones.
+func normalizeAllowedTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+func checkHouseholdMember(member entities.HouseholdMember) error {
+	if member.Role != entities.HouseholdRoleOwner && member.Role != entities.HouseholdRoleMember {
+		return ErrInvalidHouseholdRole
+	}
+	return nil
+}
+
+// householdError maps repository errors to service errors, unexpected errors are logged.
+func (s householdsService) householdError(err error, msg string, args ...any) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repositories.ErrHouseholdNotFound):
+		return ErrHouseholdNotFound
+	case errors.Is(err, repositories.ErrHouseholdMemberNotFound):
+		return ErrHouseholdMemberNotFound
+	case errors.Is(err, repositories.ErrHouseholdMemberExists):
+		return ErrHouseholdMemberExists
+	case errors.Is(err, repositories.ErrHouseholdBookNotFound):
+		return ErrHouseholdBookNotFound
+	case errors.Is(err, repositories.ErrHouseholdInviteNotFound):
+		return ErrHouseholdInviteNotFound
+	case errors.Is(err, ErrNotHouseholdOwner), errors.Is(err, ErrLastHouseholdOwner):
+		return err
+	}
+	s.logger.Error(msg, append([]any{"error", err}, args...)...)
+	return ErrInternal
+}
+
+// member returns the membership of the user, ErrHouseholdNotFound when the user is not a member.
+func (s householdsService) member(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) (entities.HouseholdMember, error) {
+	member, err := s.householdsRepo.GetMember(ctx, householdID, userID)
+	if errors.Is(err, repositories.ErrHouseholdMemberNotFound) {
+		return entities.HouseholdMember{}, repositories.ErrHouseholdNotFound
+	}
+	return member, err
+}
+
+// owner returns the membership of the user, ErrNotHouseholdOwner when the user is not an owner.
+func (s householdsService) owner(ctx context.Context, householdID uuid.UUID, userID uuid.UUID) (entities.HouseholdMember, error) {
+	member, err := s.member(ctx, householdID, userID)
+	if err != nil {
+		return entities.HouseholdMember{}, err
+	}
+	if member.Role != entities.HouseholdRoleOwner {
+		return entities.HouseholdMember{}, ErrNotHouseholdOwner
+	}
+	return member, nil
+}
+
+// keepOwner fails when the household has no owner left.
+func (s householdsService) keepOwner(ctx context.Context, householdID uuid.UUID) error {
+	owners, err := s.householdsRepo.CountOwners(ctx, householdID)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastHouseholdOwner
+	}
+	return nil
+}
+
+func (s householdsService) Create(ctx context.Context, userID uuid.UUID, name string) (entities.Household, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxHouseholdNameLength {
+		return entities.Household{}, fmt.Errorf("household name must be between 1 and %d characters", maxHouseholdNameLength)
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var household entities.Household
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		var err error
+		household, err = s.householdsRepo.Create(ctx, entities.Household{ID: uuid.New(), Name: name})
+		if err != nil {
+			return err
+		}
+		return s.householdsRepo.AddMember(ctx, entities.HouseholdMember{
+			HouseholdID: household.ID,
+			UserID:      userID,
+			Role:        entities.HouseholdRoleOwner,
+			AllowedTags: []string{},
+		})
+	})
+	if err != nil {
+		return entities.Household{}, s.householdError(err, "cannot create household", "user_id", userID)
+	}
+	return household, nil
+}
+
+func (s householdsService) Delete(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		if _, err := s.owner(ctx, householdID, userID); err != nil {
+			return err
+		}
+		return s.householdsRepo.Delete(ctx, householdID)
+	})
+	return s.householdError(err, "cannot delete household", "household_id", householdID)
+}
+
+func (s householdsService) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Household, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	households, err := s.householdsRepo.GetByUserID(c, userID)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get households", "user_id", userID)
+	}
+	return households, nil
+}
+
+func (s householdsService) GetByBook(ctx context.Context, userID uuid.UUID, book entities.Book) ([]entities.Household, error) {
+	if book.UploadedBy != userID {
+		return nil, ErrNotBookOwner
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	households, err := s.householdsRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get households of book", "book_id", book.ID)
+	}
+	return households, nil
+}
+
+func (s householdsService) GetMembers(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) ([]entities.HouseholdMember, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.member(c, householdID, userID); err != nil {
+		return nil, s.householdError(err, "cannot get household member", "household_id", householdID)
+	}
+	members, err := s.householdsRepo.GetMembers(c, householdID)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get household members", "household_id", householdID)
+	}
+	return members, nil
+}
+
+func (s householdsService) InviteMember(
+	ctx context.Context,
+	userID uuid.UUID,
+	invite entities.HouseholdInvite,
+) (entities.HouseholdInvite, error) {
+	invite.Email = normalizeEmail(invite.Email)
+	address, err := mail.ParseAddress(invite.Email)
+	if err != nil || address.Address != invite.Email {
+		return entities.HouseholdInvite{}, ErrInvalidInviteEmail
+	}
+	if err := checkHouseholdMember(entities.HouseholdMember{Role: invite.Role}); err != nil {
+		return entities.HouseholdInvite{}, err
+	}
+	invite.ID = uuid.New()
+	invite.InvitedBy = userID
+	invite.AllowedTags = normalizeAllowedTags(invite.AllowedTags)
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err = s.txManager.Do(c, func(ctx context.Context) error {
+		if _, err := s.owner(ctx, invite.HouseholdID, userID); err != nil {
+			return err
+		}
+		// the owner sees the emails of the members anyway, so this tells nothing about other users
+		isMember, err := s.householdsRepo.HasMemberWithEmail(ctx, invite.HouseholdID, invite.Email)
+		if err != nil {
+			return err
+		}
+		if isMember {
+			return repositories.ErrHouseholdMemberExists
+		}
+		invite, err = s.householdsRepo.SaveInvite(ctx, invite)
+		return err
+	})
+	if err != nil {
+		return entities.HouseholdInvite{}, s.householdError(err, "cannot invite household member", "household_id", invite.HouseholdID)
+	}
+	return invite, nil
+}
+
+func (s householdsService) GetInvites(ctx context.Context, userID uuid.UUID) ([]entities.HouseholdInvite, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	user, err := s.usersRepo.GetByID(c, userID)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get user", "user_id", userID)
+	}
+	invites, err := s.householdsRepo.GetInvitesByEmail(c, normalizeEmail(user.Email))
+	if err != nil {
+		return nil, s.householdError(err, "cannot get household invites", "user_id", userID)
+	}
+	return invites, nil
+}
+
+func (s householdsService) GetHouseholdInvites(ctx context.Context, userID uuid.UUID, householdID uuid.UUID) ([]entities.HouseholdInvite, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.owner(c, householdID, userID); err != nil {
+		return nil, s.householdError(err, "cannot get household member", "household_id", householdID)
+	}
+	invites, err := s.householdsRepo.GetInvitesByHousehold(c, householdID)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get household invites", "household_id", householdID)
+	}
+	return invites, nil
+}
+
+// invitation returns the invite when it is addressed to the user, ErrHouseholdInviteNotFound otherwise.
+func (s householdsService) invitation(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) (entities.HouseholdInvite, error) {
+	invite, err := s.householdsRepo.GetInvite(ctx, inviteID)
+	if err != nil {
+		return entities.HouseholdInvite{}, err
+	}
+	user, err := s.usersRepo.GetByID(ctx, userID)
+	if err != nil {
+		return entities.HouseholdInvite{}, err
+	}
+	if normalizeEmail(user.Email) != invite.Email {
+		return entities.HouseholdInvite{}, repositories.ErrHouseholdInviteNotFound
+	}
+	return invite, nil
+}
+
+func (s householdsService) AcceptInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) (entities.Household, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var household entities.Household
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		invite, err := s.invitation(ctx, userID, inviteID)
+		if err != nil {
+			return err
+		}
+		if err := s.householdsRepo.DeleteInvite(ctx, invite.ID); err != nil {
+			return err
+		}
+		err = s.householdsRepo.AddMember(ctx, entities.HouseholdMember{
+			HouseholdID: invite.HouseholdID,
+			UserID:      userID,
+			Role:        invite.Role,
+			AllowedTags: invite.AllowedTags,
+		})
+		if err != nil {
+			return err
+		}
+		household, err = s.householdsRepo.GetByID(ctx, invite.HouseholdID)
+		return err
+	})
+	if err != nil {
+		return entities.Household{}, s.householdError(err, "cannot accept household invite", "invite_id", inviteID)
+	}
+	return household, nil
+}
+
+func (s householdsService) DeclineInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		if _, err := s.invitation(ctx, userID, inviteID); err != nil {
+			return err
+		}
+		return s.householdsRepo.DeleteInvite(ctx, inviteID)
+	})
+	return s.householdError(err, "cannot decline household invite", "invite_id", inviteID)
+}
+
+func (s householdsService) CancelInvite(ctx context.Context, userID uuid.UUID, inviteID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		invite, err := s.householdsRepo.GetInvite(ctx, inviteID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.owner(ctx, invite.HouseholdID, userID); err != nil {
+			// the invite is as hidden as its household
+			if errors.Is(err, repositories.ErrHouseholdNotFound) {
+				return repositories.ErrHouseholdInviteNotFound
+			}
+			return err
+		}
+		return s.householdsRepo.DeleteInvite(ctx, inviteID)
+	})
+	return s.householdError(err, "cannot cancel household invite", "invite_id", inviteID)
+}
+
+func (s householdsService) UpdateMember(ctx context.Context, userID uuid.UUID, member entities.HouseholdMember) (entities.HouseholdMember, error) {
+	if err := checkHouseholdMember(member); err != nil {
+		return entities.HouseholdMember{}, err
+	}
+	member.AllowedTags = normalizeAllowedTags(member.AllowedTags)
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		if _, err := s.owner(ctx, member.HouseholdID, userID); err != nil {
+			return err
+		}
+		if err := s.householdsRepo.UpdateMember(ctx, member); err != nil {
+			return err
+		}
+		if err := s.keepOwner(ctx, member.HouseholdID); err != nil {
+			return err
+		}
+		var err error
+		member, err = s.householdsRepo.GetMember(ctx, member.HouseholdID, member.UserID)
+		return err
+	})
+	if err != nil {
+		return entities.HouseholdMember{}, s.householdError(err, "cannot update household member", "household_id", member.HouseholdID)
+	}
+	return member, nil
+}
+
+func (s householdsService) RemoveMember(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, memberID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		if memberID == userID {
+			if _, err := s.member(ctx, householdID, userID); err != nil {
+				return err
+			}
+		} else if _, err := s.owner(ctx, householdID, userID); err != nil {
+			return err
+		}
+		if err := s.householdsRepo.RemoveMember(ctx, householdID, memberID); err != nil {
+			return err
+		}
+		return s.keepOwner(ctx, householdID)
+	})
+	return s.householdError(err, "cannot remove household member", "household_id", householdID)
+}
+
+func (s householdsService) ShareBook(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, book entities.Book) error {
+	if book.UploadedBy != userID {
+		return ErrNotBookOwner
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.member(c, householdID, userID); err != nil {
+		return s.householdError(err, "cannot get household member", "household_id", householdID)
+	}
+	err := s.householdsRepo.ShareBook(c, householdID, book.ID)
+	return s.householdError(err, "cannot share book with household", "household_id", householdID, "book_id", book.ID)
+}
+
+func (s householdsService) UnshareBook(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, book entities.Book) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	member, err := s.member(c, householdID, userID)
+	if err != nil {
+		return s.householdError(err, "cannot get household member", "household_id", householdID)
+	}
+	if book.UploadedBy != userID && member.Role != entities.HouseholdRoleOwner {
+		return ErrNotHouseholdOwner
+	}
+	err = s.householdsRepo.UnshareBook(c, householdID, book.ID)
+	return s.householdError(err, "cannot unshare book from household", "household_id", householdID, "book_id", book.ID)
+}
+
+func (s householdsService) GetBooks(ctx context.Context, userID uuid.UUID, householdID uuid.UUID, limit, offset *uint64) ([]entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.member(c, householdID, userID); err != nil {
+		return nil, s.householdError(err, "cannot get household member", "household_id", householdID)
+	}
+	books, err := s.booksRepo.GetManyByHousehold(c, householdID, userID, limit, offset)
+	if err != nil {
+		return nil, s.householdError(err, "cannot get books of household", "household_id", householdID)
+	}
+	return books, nil
+}
+
+func (s householdsService) CanRead(ctx context.Context, userID uuid.UUID, book entities.Book) (bool, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	ok, err := s.householdsRepo.CanRead(c, userID, book.ID)
+	if err != nil {
+		s.logger.Error("cannot check household access to book", "error", err, "book_id", book.ID, "user_id", userID)
+		return false, ErrInternal
+	}
+	return ok, nil
+}
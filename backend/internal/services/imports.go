@@ -0,0 +1,426 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/config"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+const (
+	importQueueSize = 16
+	// watchSettleTime is how long a file must stay unmodified before it is imported from the watch folder,
+	// so files that are still being copied there are not picked up.
+	watchSettleTime  = 30 * time.Second
+	watchImportedDir = ".imported"
+	watchFailedDir   = ".failed"
+)
+
+var (
+	ErrImportJobNotFound = errors.New("import job not found")
+	ErrInvalidArchive    = errors.New("file is not a valid zip archive")
+	ErrEmptyArchive      = errors.New("archive contains no files")
+	ErrArchiveTooLarge   = errors.New("archive is too large")
+	ErrImportQueueFull   = errors.New("too many imports in progress, try again later")
+)
+
+// Imports imports many books at once from ZIP archives, Calibre libraries and the watch folder.
+// Every file goes through Books.Upload, files the user already has are skipped as duplicates.
+// Jobs are processed one at a time by Run, which also scans the watch folder.
+type Imports interface {
+	// ImportArchive spools the archive to a temporary file and enqueues its files as an import job of the user.
+	ImportArchive(ctx context.Context, userID uuid.UUID, name string, content io.Reader) (entities.ImportJob, error)
+	// QueueCalibreLibrary enqueues the books of the Calibre library in dir as an import job of the owner.
+	QueueCalibreLibrary(ctx context.Context, ownerID uuid.UUID, dir string) (entities.ImportJob, error)
+	// ImportCalibreLibrary imports the Calibre library in dir before it returns the finished job.
+	// It is meant for the CLI, where Run does not process the queue.
+	ImportCalibreLibrary(ctx context.Context, ownerID uuid.UUID, dir string) (entities.ImportJob, error)
+	GetJob(ctx context.Context, jobID uuid.UUID) (entities.ImportJob, error)
+	GetJobs(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.ImportJob, error)
+	GetItems(ctx context.Context, jobID uuid.UUID, limit, offset uint64) ([]entities.ImportItem, error)
+	Run(ctx context.Context) error
+}
+
+type importFile struct {
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
+	// done is called with the outcome once the file is processed.
+	done func(status entities.ImportItemStatus)
+	// book holds the title and metadata of the created book, the file name is the title when it is empty.
+	book entities.Book
+	// coverPath is a local cover image uploaded together with the book.
+	coverPath string
+	// unavailable fails the file without reading it.
+	unavailable error
+}
+
+type importTask struct {
+	job   entities.ImportJob
+	files []importFile
+	// cleanup releases the resources of the task once it is processed.
+	cleanup func()
+}
+
+type importsService struct {
+	importsRepo repositories.Imports
+	usersRepo   repositories.Users
+	books       Books
+	queue       chan importTask
+	config      config.Imports
+	tempDir     string
+	timeout     time.Duration
+	logger      *slog.Logger
+}
+
+func NewImports(
+	importsRepo repositories.Imports,
+	usersRepo repositories.Users,
+	books Books,
+	cfg config.Imports,
+	tempDir string,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Imports {
+	return importsService{
+		importsRepo: importsRepo,
+		usersRepo:   usersRepo,
+		books:       books,
+		queue:       make(chan importTask, importQueueSize),
+		config:      cfg,
+		tempDir:     tempDir,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+func (s importsService) ImportArchive(ctx context.Context, userID uuid.UUID, name string, content io.Reader) (entities.ImportJob, error) {
+	file, err := os.CreateTemp(s.tempDir, "import-*.zip")
+	if err != nil {
+		s.logger.Error("cannot create temporary file for archive", "error", err)
+		return entities.ImportJob{}, ErrInternal
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	reader := content
+	if s.config.MaxArchiveSize > 0 {
+		reader = io.LimitReader(content, s.config.MaxArchiveSize+1)
+	}
+	size, err := io.Copy(file, reader)
+	if err != nil {
+		cleanup()
+		s.logger.Error("cannot spool archive to a temporary file", "error", err, "user_id", userID)
+		return entities.ImportJob{}, ErrInternal
+	}
+	if s.config.MaxArchiveSize > 0 && size > s.config.MaxArchiveSize {
+		cleanup()
+		return entities.ImportJob{}, ErrArchiveTooLarge
+	}
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		cleanup()
+		return entities.ImportJob{}, ErrInvalidArchive
+	}
+	files := archiveFiles(archive)
+	if len(files) == 0 {
+		cleanup()
+		return entities.ImportJob{}, ErrEmptyArchive
+	}
+	return s.enqueue(ctx, userID, entities.ImportSourceArchive, name, files, cleanup)
+}
+
+// enqueue creates the job and queues its files for Run. cleanup is called when the job cannot be queued.
+func (s importsService) enqueue(
+	ctx context.Context,
+	userID uuid.UUID,
+	source entities.ImportSource,
+	name string,
+	files []importFile,
+	cleanup func(),
+) (entities.ImportJob, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	job, err := s.createJob(c, userID, source, name, len(files))
+	if err != nil {
+		cleanup()
+		return entities.ImportJob{}, err
+	}
+	select {
+	case s.queue <- importTask{job: job, files: files, cleanup: cleanup}:
+		return job, nil
+	default:
+		cleanup()
+		if err := s.importsRepo.SetStatus(c, job.ID, entities.ImportJobStatusFailed, ErrImportQueueFull.Error()); err != nil {
+			s.logger.Error("cannot fail import job", "error", err, "job_id", job.ID)
+		}
+		return entities.ImportJob{}, ErrImportQueueFull
+	}
+}
+
+// archiveFiles lists the files of the archive, skipping directories and hidden files.
+func archiveFiles(archive *zip.Reader) []importFile {
+	files := make([]importFile, 0, len(archive.File))
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		files = append(files, importFile{
+			name: f.Name,
+			size: int64(f.UncompressedSize64),
+			open: f.Open,
+		})
+	}
+	return files
+}
+
+func (s importsService) createJob(ctx context.Context, userID uuid.UUID, source entities.ImportSource, name string, total int) (entities.ImportJob, error) {
+	job, err := s.importsRepo.Create(ctx, entities.ImportJob{
+		ID:     uuid.New(),
+		UserID: userID,
+		Source: source,
+		Name:   name,
+		Status: entities.ImportJobStatusPending,
+		Total:  total,
+	})
+	if err != nil {
+		s.logger.Error("cannot create import job", "error", err, "user_id", userID)
+		return entities.ImportJob{}, ErrInternal
+	}
+	return job, nil
+}
+
+func (s importsService) GetJob(ctx context.Context, jobID uuid.UUID) (entities.ImportJob, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	job, err := s.importsRepo.GetByID(c, jobID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrImportJobNotFound) {
+			return entities.ImportJob{}, ErrImportJobNotFound
+		}
+		s.logger.Error("cannot get import job", "error", err, "job_id", jobID)
+		return entities.ImportJob{}, ErrInternal
+	}
+	return job, nil
+}
+
+func (s importsService) GetJobs(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.ImportJob, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	jobs, err := s.importsRepo.GetManyByUserID(c, userID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get import jobs", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	return jobs, nil
+}
+
+func (s importsService) GetItems(ctx context.Context, jobID uuid.UUID, limit, offset uint64) ([]entities.ImportItem, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	items, err := s.importsRepo.GetItems(c, jobID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get import items", "error", err, "job_id", jobID)
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+func (s importsService) Run(ctx context.Context) error {
+	// temporary files of jobs queued before a restart are gone, so the jobs cannot be resumed
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	if n, err := s.importsRepo.FailUnfinished(c, "interrupted by a restart"); err != nil {
+		s.logger.Error("cannot fail unfinished import jobs", "error", err)
+	} else if n > 0 {
+		s.logger.Warn("unfinished import jobs failed", "count", n)
+	}
+	cancel()
+	var watch <-chan time.Time
+	if s.config.WatchDir != "" {
+		ticker := time.NewTicker(s.config.WatchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain()
+			return nil
+		case task := <-s.queue:
+			s.process(ctx, task)
+		case <-watch:
+			s.scanWatchDir(ctx)
+		}
+	}
+}
+
+// drain releases the tasks left in the queue on shutdown.
+func (s importsService) drain() {
+	for {
+		select {
+		case task := <-s.queue:
+			task.cleanup()
+		default:
+			return
+		}
+	}
+}
+
+func (s importsService) setStatus(ctx context.Context, jobID uuid.UUID, status entities.ImportJobStatus, reason string) {
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	if err := s.importsRepo.SetStatus(c, jobID, status, reason); err != nil {
+		s.logger.Error("cannot set import job status", "error", err, "job_id", jobID, "status", status)
+	}
+}
+
+func (s importsService) process(ctx context.Context, task importTask) {
+	defer task.cleanup()
+	s.setStatus(ctx, task.job.ID, entities.ImportJobStatusRunning, "")
+	for _, file := range task.files {
+		if ctx.Err() != nil {
+			s.setStatus(ctx, task.job.ID, entities.ImportJobStatusFailed, "interrupted by a shutdown")
+			return
+		}
+		item := s.importFile(ctx, task.job.UserID, file)
+		item.JobID = task.job.ID
+		if file.done != nil {
+			file.done(item.Status)
+		}
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		err := s.importsRepo.AddItem(c, item)
+		cancel()
+		if err != nil {
+			s.logger.Error("cannot record import item", "error", err, "job_id", task.job.ID, "name", item.Name)
+		}
+	}
+	s.setStatus(ctx, task.job.ID, entities.ImportJobStatusCompleted, "")
+}
+
+// importFile uploads the file unless the user already has a book with the same content.
+func (s importsService) importFile(ctx context.Context, userID uuid.UUID, file importFile) entities.ImportItem {
+	item := entities.ImportItem{Name: file.name}
+	fail := func(err error) entities.ImportItem {
+		item.Status = entities.ImportItemStatusFailed
+		item.Error = err.Error()
+		return item
+	}
+	if file.unavailable != nil {
+		return fail(file.unavailable)
+	}
+	content, err := file.open()
+	if err != nil {
+		return fail(err)
+	}
+	defer content.Close()
+	book := file.book
+	if book.Title == "" {
+		book.Title = path.Base(file.name)
+	}
+	book.UploadedBy = userID
+	book, err = s.books.Upload(ctx, book, file.size, content)
+	if errors.Is(err, ErrDuplicateBook) {
+		item.Status = entities.ImportItemStatusDuplicate
+		item.BookID = &book.ID
+		return item
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if file.coverPath != "" {
+		s.attachCover(ctx, book, file.coverPath)
+	}
+	item.Status = entities.ImportItemStatusImported
+	item.BookID = &book.ID
+	return item
+}
+
+// attachCover uploads the cover of an imported book. The book is kept without a cover when it fails.
+func (s importsService) attachCover(ctx context.Context, book entities.Book, coverPath string) {
+	cover, err := os.Open(coverPath)
+	if err != nil {
+		s.logger.Warn("cannot open cover of imported book", "error", err, "path", coverPath)
+		return
+	}
+	defer cover.Close()
+	info, err := cover.Stat()
+	if err != nil {
+		s.logger.Warn("cannot open cover of imported book", "error", err, "path", coverPath)
+		return
+	}
+	if _, err := s.books.SetCover(ctx, book, info.Size(), cover); err != nil {
+		s.logger.Warn("cannot set cover of imported book", "error", err, "book_id", book.ID)
+	}
+}
+
+// scanWatchDir imports the files of the watch folder as a single job and moves them out of it.
+func (s importsService) scanWatchDir(ctx context.Context) {
+	entries, err := os.ReadDir(s.config.WatchDir)
+	if err != nil {
+		s.logger.Error("cannot read watch folder", "error", err, "dir", s.config.WatchDir)
+		return
+	}
+	files := make([]importFile, 0, len(entries))
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < watchSettleTime {
+			continue
+		}
+		filePath := filepath.Join(s.config.WatchDir, entry.Name())
+		files = append(files, importFile{
+			name: entry.Name(),
+			size: info.Size(),
+			open: func() (io.ReadCloser, error) {
+				return os.Open(filePath)
+			},
+			done: func(status entities.ImportItemStatus) {
+				s.moveWatchedFile(filePath, status)
+			},
+		})
+	}
+	if len(files) == 0 {
+		return
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	owner, err := s.usersRepo.GetByEmail(c, s.config.WatchOwner)
+	if err != nil {
+		s.logger.Error("cannot get owner of watch folder imports", "error", err, "email", s.config.WatchOwner)
+		return
+	}
+	job, err := s.createJob(c, owner.ID, entities.ImportSourceWatchFolder, s.config.WatchDir, len(files))
+	if err != nil {
+		return
+	}
+	s.process(ctx, importTask{job: job, files: files, cleanup: func() {}})
+}
+
+func (s importsService) moveWatchedFile(filePath string, status entities.ImportItemStatus) {
+	dir := filepath.Join(s.config.WatchDir, watchImportedDir)
+	if status == entities.ImportItemStatusFailed {
+		dir = filepath.Join(s.config.WatchDir, watchFailedDir)
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err == nil {
+		err = os.Rename(filePath, filepath.Join(dir, filepath.Base(filePath)))
+	}
+	if err != nil {
+		s.logger.Error("cannot move file out of watch folder", "error", err, "path", filePath)
+	}
+}
@@ -0,0 +1,548 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/calibre"
+	"github.com/Shelffy/shelffy/internal/config"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/formats"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+const (
+	exportQueueSize   = 16
+	exportPurgeBatch  = 100
+	exportUsersPage   = 100
+	exportsStorageDir = "exports"
+)
+
+var (
+	ErrLibraryExportNotFound = errors.New("library export not found")
+	ErrLibraryExportNotReady = errors.New("library export is not finished")
+	ErrInvalidDownloadLink   = errors.New("download link is invalid or expired")
+	ErrExportQueueFull       = errors.New("too many exports in progress, try again later")
+	ErrExportLinksDisabled   = errors.New("download links are disabled until the secret is configured")
+)
+
+// LibraryExports writes libraries in the folder layout of Calibre: "Author/Title (id)/" folders holding
+// the book file, metadata.opf and cover.jpg. Exports of the whole instance have a folder per user on top.
+// Queued exports are archived by Run and kept in the storage, they are downloaded with signed links.
+type LibraryExports interface {
+	// Queue enqueues an export of the library of the user, or of the whole instance when userID is nil.
+	Queue(ctx context.Context, requestedBy uuid.UUID, userID *uuid.UUID) (entities.LibraryExport, error)
+	Get(ctx context.Context, exportID uuid.UUID) (entities.LibraryExport, error)
+	// GetMany returns the exports requested by the user, newest first.
+	GetMany(ctx context.Context, requestedBy uuid.UUID, limit, offset uint64) ([]entities.LibraryExport, error)
+	// DownloadURL returns a signed link to the archive of a completed export.
+	// Links are disabled, and Download rejects every link, when the service has no secret.
+	DownloadURL(export entities.LibraryExport) (string, error)
+	// Download checks the signature of a download link and returns the archive of the export.
+	Download(ctx context.Context, exportID uuid.UUID, expires int64, signature string) (entities.LibraryExport, io.ReadCloser, error)
+	// WriteZip and WriteDir export the library synchronously and return the number of exported books.
+	// They are meant for the CLI, where Run does not process the queue.
+	WriteZip(ctx context.Context, userID *uuid.UUID, w io.Writer) (int, error)
+	WriteDir(ctx context.Context, userID *uuid.UUID, dir string) (int, error)
+	Run(ctx context.Context) error
+}
+
+// exportTarget receives the files of an export, names are slash separated.
+type exportTarget interface {
+	writeFile(name string, modified time.Time, content io.Reader) error
+}
+
+type zipTarget struct {
+	archive *zip.Writer
+}
+
+func (t zipTarget) writeFile(name string, modified time.Time, content io.Reader) error {
+	// book files and covers are already compressed
+	entry, err := t.archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+type dirTarget struct {
+	root string
+}
+
+func (t dirTarget) writeFile(name string, modified time.Time, content io.Reader) error {
+	relative := filepath.FromSlash(name)
+	if !filepath.IsLocal(relative) {
+		return fmt.Errorf("export file %q is outside of the export directory", name)
+	}
+	filePath := filepath.Join(t.root, relative)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	if err := errors.Join(err, file.Close()); err != nil {
+		return err
+	}
+	return os.Chtimes(filePath, modified, modified)
+}
+
+type libraryExportsService struct {
+	exportsRepo repositories.LibraryExports
+	booksRepo   repositories.Books
+	filesRepo   repositories.BookFiles
+	usersRepo   repositories.Users
+	storage     FileStorage
+	queue       chan entities.LibraryExport
+	config      config.Exports
+	secret      string
+	publicURL   string
+	tempDir     string
+	timeout     time.Duration
+	logger      *slog.Logger
+}
+
+func NewLibraryExports(
+	exportsRepo repositories.LibraryExports,
+	booksRepo repositories.Books,
+	filesRepo repositories.BookFiles,
+	usersRepo repositories.Users,
+	storage FileStorage,
+	cfg config.Exports,
+	secret string,
+	publicURL string,
+	tempDir string,
+	timeout time.Duration,
+	logger *slog.Logger,
+) LibraryExports {
+	return libraryExportsService{
+		exportsRepo: exportsRepo,
+		booksRepo:   booksRepo,
+		filesRepo:   filesRepo,
+		usersRepo:   usersRepo,
+		storage:     storage,
+		queue:       make(chan entities.LibraryExport, exportQueueSize),
+		config:      cfg,
+		secret:      secret,
+		publicURL:   publicURL,
+		tempDir:     tempDir,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+func (s libraryExportsService) Queue(ctx context.Context, requestedBy uuid.UUID, userID *uuid.UUID) (entities.LibraryExport, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	export, err := s.exportsRepo.Create(c, entities.LibraryExport{
+		ID:          uuid.New(),
+		RequestedBy: requestedBy,
+		UserID:      userID,
+		Status:      entities.LibraryExportStatusPending,
+	})
+	if err != nil {
+		s.logger.Error("cannot create library export", "error", err, "user_id", requestedBy)
+		return entities.LibraryExport{}, ErrInternal
+	}
+	select {
+	case s.queue <- export:
+		return export, nil
+	default:
+		s.finish(c, export, ErrExportQueueFull)
+		return entities.LibraryExport{}, ErrExportQueueFull
+	}
+}
+
+func (s libraryExportsService) Get(ctx context.Context, exportID uuid.UUID) (entities.LibraryExport, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	export, err := s.exportsRepo.GetByID(c, exportID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLibraryExportNotFound) {
+			return entities.LibraryExport{}, ErrLibraryExportNotFound
+		}
+		s.logger.Error("cannot get library export", "error", err, "export_id", exportID)
+		return entities.LibraryExport{}, ErrInternal
+	}
+	return export, nil
+}
+
+func (s libraryExportsService) GetMany(ctx context.Context, requestedBy uuid.UUID, limit, offset uint64) ([]entities.LibraryExport, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	exports, err := s.exportsRepo.GetManyByRequester(c, requestedBy, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get library exports", "error", err, "user_id", requestedBy)
+		return nil, ErrInternal
+	}
+	return exports, nil
+}
+
+// sign returns the signature of a download link of the export that is valid until expires.
+func (s libraryExportsService) sign(exportID uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	fmt.Fprintf(mac, "library-export:%s:%d", exportID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s libraryExportsService) DownloadURL(export entities.LibraryExport) (string, error) {
+	if s.secret == "" {
+		return "", ErrExportLinksDisabled
+	}
+	if export.Status != entities.LibraryExportStatusCompleted || export.ExpiresAt == nil {
+		return "", ErrLibraryExportNotReady
+	}
+	expires := time.Now().Add(s.config.LinkTTL)
+	if export.ExpiresAt.Before(expires) {
+		expires = *export.ExpiresAt
+	}
+	downloadURL, err := url.JoinPath(s.publicURL, "/api", "/v1", "/exports", export.ID.String(), "/download")
+	if err != nil {
+		s.logger.Error("cannot build download url of library export", "error", err, "export_id", export.ID)
+		return "", ErrInternal
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.sign(export.ID, expires.Unix()))
+	return downloadURL + "?" + query.Encode(), nil
+}
+
+func (s libraryExportsService) Download(
+	ctx context.Context,
+	exportID uuid.UUID,
+	expires int64,
+	signature string,
+) (entities.LibraryExport, io.ReadCloser, error) {
+	valid := s.secret != "" && hmac.Equal([]byte(signature), []byte(s.sign(exportID, expires)))
+	if !valid || time.Now().Unix() > expires {
+		return entities.LibraryExport{}, nil, ErrInvalidDownloadLink
+	}
+	export, err := s.Get(ctx, exportID)
+	if err != nil {
+		return entities.LibraryExport{}, nil, err
+	}
+	if export.Status != entities.LibraryExportStatusCompleted {
+		return entities.LibraryExport{}, nil, ErrLibraryExportNotReady
+	}
+	content, err := s.storage.Get(ctx, export.StoragePath)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return entities.LibraryExport{}, nil, ErrLibraryExportNotFound
+		}
+		s.logger.Error("cannot get library export archive", "error", err, "export_id", exportID)
+		return entities.LibraryExport{}, nil, ErrInternal
+	}
+	return export, content, nil
+}
+
+func (s libraryExportsService) WriteZip(ctx context.Context, userID *uuid.UUID, w io.Writer) (int, error) {
+	archive := zip.NewWriter(w)
+	count, err := s.write(ctx, userID, zipTarget{archive: archive})
+	if err != nil {
+		return count, err
+	}
+	return count, archive.Close()
+}
+
+func (s libraryExportsService) WriteDir(ctx context.Context, userID *uuid.UUID, dir string) (int, error) {
+	return s.write(ctx, userID, dirTarget{root: dir})
+}
+
+// owners returns the users whose libraries are exported.
+func (s libraryExportsService) owners(ctx context.Context, userID *uuid.UUID) ([]entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if userID != nil {
+		user, err := s.usersRepo.GetByID(c, *userID)
+		if err != nil {
+			return nil, err
+		}
+		return []entities.User{user}, nil
+	}
+	users := make([]entities.User, 0)
+	for offset := uint64(0); ; offset += exportUsersPage {
+		page, err := s.usersRepo.GetMany(c, entities.UsersFilter{}, exportUsersPage, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range page {
+			users = append(users, user.User)
+		}
+		if len(page) < exportUsersPage {
+			return users, nil
+		}
+	}
+}
+
+// ownerDir returns the folder of the user in an export of the whole instance.
+func ownerDir(user entities.User) string {
+	name := strings.Trim(sanitizeFileName(user.Username), " .")
+	if name == "" {
+		return user.ID.String()
+	}
+	return name
+}
+
+func (s libraryExportsService) write(ctx context.Context, userID *uuid.UUID, target exportTarget) (int, error) {
+	owners, err := s.owners(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, owner := range owners {
+		prefix := ""
+		if userID == nil {
+			prefix = ownerDir(owner)
+		}
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		books, err := s.booksRepo.GetManyByUserID(c, owner.ID, nil, nil)
+		cancel()
+		if err != nil {
+			return count, err
+		}
+		for _, book := range books {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+			written, err := s.writeBook(ctx, target, prefix, count+1, book)
+			if err != nil {
+				return count, err
+			}
+			if written {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// writeBook writes the book files with its cover and metadata.opf to the folder of the book.
+// Books without a file that can be exported are skipped.
+func (s libraryExportsService) writeBook(ctx context.Context, target exportTarget, prefix string, id int, book entities.Book) (bool, error) {
+	metadata := book.Metadata
+	identifiers := maps.Clone(metadata.Identifiers)
+	if identifiers == nil {
+		identifiers = make(map[string]string)
+	}
+	if metadata.ISBN != "" {
+		identifiers["isbn"] = metadata.ISBN
+	}
+	calibreBook := calibre.Book{
+		ID:            int64(id),
+		Title:         book.Title,
+		Authors:       metadata.Authors,
+		Series:        metadata.Series,
+		SeriesIndex:   metadata.SeriesIndex,
+		Tags:          metadata.Tags,
+		Identifiers:   identifiers,
+		Rating:        metadata.Rating,
+		Publisher:     metadata.Publisher,
+		PublishedDate: metadata.PublishedDate,
+		Language:      metadata.Language,
+		Description:   metadata.Description,
+	}
+	dir := path.Join(prefix, calibre.BookDir(calibreBook))
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	written := 0
+	parts := fileParts(files)
+	for i, file := range files {
+		// files that have not passed the malware scan are not handed out
+		if file.Status != entities.BookStatusReady {
+			continue
+		}
+		content, err := s.storage.Get(ctx, file.StoragePath)
+		if err != nil {
+			if errors.Is(err, ErrObjectNotFound) {
+				s.logger.Warn("book file is missing, skipping it in the export", "book_id", book.ID, "file_id", file.ID)
+				continue
+			}
+			return false, err
+		}
+		format := strings.TrimPrefix(formats.Extension(file.Format), ".")
+		if parts[i] > 0 {
+			// Calibre keeps a file per format, the tracks of audiobooks are numbered
+			format = fmt.Sprintf("%02d.%s", parts[i], format)
+		}
+		err = target.writeFile(path.Join(dir, calibre.FileName(calibreBook, format)), file.CreatedAt, content)
+		content.Close()
+		if err != nil {
+			return false, err
+		}
+		written++
+	}
+	if written == 0 {
+		return false, nil
+	}
+	if book.CoverPath != "" {
+		cover, err := s.storage.Get(ctx, book.CoverPath)
+		switch {
+		case errors.Is(err, ErrObjectNotFound):
+			s.logger.Warn("book cover is missing, exporting the book without it", "book_id", book.ID)
+		case err != nil:
+			return false, err
+		default:
+			err = target.writeFile(path.Join(dir, calibre.CoverFile), book.UploadedAt, cover)
+			cover.Close()
+			if err != nil {
+				return false, err
+			}
+			calibreBook.CoverPath = path.Join(dir, calibre.CoverFile)
+		}
+	}
+	opf := bytes.Buffer{}
+	if err := calibre.WriteOPF(&opf, calibreBook); err != nil {
+		return false, err
+	}
+	return true, target.writeFile(path.Join(dir, calibre.OPFFile), book.UploadedAt, &opf)
+}
+
+func (s libraryExportsService) Run(ctx context.Context) error {
+	// queued exports are kept in memory only, so they cannot be resumed after a restart
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	if n, err := s.exportsRepo.FailUnfinished(c, "interrupted by a restart"); err != nil {
+		s.logger.Error("cannot fail unfinished library exports", "error", err)
+	} else if n > 0 {
+		s.logger.Warn("unfinished library exports failed", "count", n)
+	}
+	cancel()
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case export := <-s.queue:
+			s.process(ctx, export)
+		case <-ticker.C:
+			s.purgeExpired(ctx)
+		}
+	}
+}
+
+// finish stores the outcome of the export, the archive expires after the retention period.
+func (s libraryExportsService) finish(ctx context.Context, export entities.LibraryExport, exportErr error) {
+	now := time.Now()
+	export.FinishedAt = &now
+	if exportErr != nil {
+		export.Status = entities.LibraryExportStatusFailed
+		export.Error = exportErr.Error()
+	} else {
+		expiresAt := now.Add(s.config.Retention)
+		export.Status = entities.LibraryExportStatusCompleted
+		export.ExpiresAt = &expiresAt
+	}
+	s.update(ctx, export)
+}
+
+func (s libraryExportsService) update(ctx context.Context, export entities.LibraryExport) {
+	c, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	err := s.exportsRepo.Update(c, export)
+	if errors.Is(err, repositories.ErrLibraryExportNotFound) && export.StoragePath != "" {
+		// the account was purged while the export was running, nothing would ever delete the archive
+		if err := s.storage.Delete(c, export.StoragePath); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			s.logger.Error("cannot delete library export archive", "error", err, "export_id", export.ID)
+		}
+		return
+	}
+	if err != nil {
+		s.logger.Error("cannot update library export", "error", err, "export_id", export.ID, "status", export.Status)
+	}
+}
+
+func (s libraryExportsService) process(ctx context.Context, export entities.LibraryExport) {
+	export.Status = entities.LibraryExportStatusRunning
+	s.update(ctx, export)
+	err := s.archive(ctx, &export)
+	switch {
+	case ctx.Err() != nil:
+		err = errors.New("interrupted by a shutdown")
+	case err != nil:
+		s.logger.Error("cannot export library", "error", err, "export_id", export.ID)
+		err = ErrInternal
+	}
+	s.finish(ctx, export, err)
+}
+
+// archive writes the export to a temporary ZIP file and uploads it to the storage.
+func (s libraryExportsService) archive(ctx context.Context, export *entities.LibraryExport) error {
+	file, err := os.CreateTemp(s.tempDir, "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	count, err := s.WriteZip(ctx, export.UserID, file)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	storagePath := path.Join(exportsStorageDir, export.ID.String()+".zip")
+	if err := s.storage.Upload(ctx, storagePath, size, file); err != nil {
+		return err
+	}
+	export.Books = count
+	export.Size = size
+	export.StoragePath = storagePath
+	return nil
+}
+
+func (s libraryExportsService) purgeExpired(ctx context.Context) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	exports, err := s.exportsRepo.GetExpired(c, time.Now(), exportPurgeBatch)
+	if err != nil {
+		s.logger.Error("cannot get expired library exports", "error", err)
+		return
+	}
+	purged := 0
+	for _, export := range exports {
+		if err := s.storage.Delete(c, export.StoragePath); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			s.logger.Error("cannot delete library export archive", "error", err, "export_id", export.ID)
+			continue
+		}
+		if err := s.exportsRepo.Delete(c, export.ID); err != nil {
+			s.logger.Error("cannot delete library export", "error", err, "export_id", export.ID)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		s.logger.Info("expired library exports purged", "count", purged)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+type Mail struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a mail. The content is encoded in base64, which makes it a third larger.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+type smtpMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return smtpMailer{
+		addr: net.JoinHostPort(host, port),
+		host: host,
+		auth: auth,
+		from: from,
+	}
+}
+
+// NewLogMailer returns a mailer that only logs messages. It is used when SMTP is not configured.
+func NewLogMailer(logger *slog.Logger) Mailer {
+	return logMailer{logger: logger}
+}
+
+func (m smtpMailer) buildMessage(mail Mail) []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	body := strings.ReplaceAll(mail.Body, "\n", "\r\n")
+	if len(mail.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("\r\n")
+		buf.WriteString(body)
+		return buf.Bytes()
+	}
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: %s\r\n", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": parts.Boundary()}))
+	buf.WriteString("\r\n")
+	// writes to a bytes.Buffer do not fail
+	text, _ := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	io.WriteString(text, body)
+	for _, attachment := range mail.Attachments {
+		part, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64Lines(part, attachment.Content)
+	}
+	parts.Close()
+	return buf.Bytes()
+}
+
+// writeBase64Lines encodes the content in lines of 76 characters as required for MIME bodies.
+func writeBase64Lines(w io.Writer, content []byte) {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > lineLength {
+		io.WriteString(w, encoded[:lineLength]+"\r\n")
+		encoded = encoded[lineLength:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+func (m smtpMailer) Send(ctx context.Context, mail Mail) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, m.buildMessage(mail))
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+type logMailer struct {
+	logger *slog.Logger
+}
+
+func (m logMailer) Send(_ context.Context, mail Mail) error {
+	attachments := make([]string, len(mail.Attachments))
+	for i, attachment := range mail.Attachments {
+		attachments[i] = fmt.Sprintf("%s (%d bytes)", attachment.Name, len(attachment.Content))
+	}
+	// the body is left out, it can hold unlock and password reset tokens
+	m.logger.Info(
+		"mail is not configured, message is only logged",
+		"to", mail.To, "subject", mail.Subject, "attachments", attachments,
+	)
+	return nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts a single mail on a local port and answers the end of the data with dataReply.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	dataReply string
+	received  chan []byte
+}
+
+func newFakeSMTPServer(t *testing.T, dataReply string) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &fakeSMTPServer{listener: listener, dataReply: dataReply, received: make(chan []byte, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *fakeSMTPServer) serve() {
+	nc, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer nc.Close()
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+	conn := textproto.NewConn(nc)
+	conn.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch command {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250 localhost")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.received <- data
+			conn.PrintfLine("%s", s.dataReply)
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			conn.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSendsAttachments(t *testing.T) {
+	server := newFakeSMTPServer(t, "250 OK")
+	mailer := NewSMTPMailer("127.0.0.1", server.port(), "", "", "shelffy@example.com")
+	content := bytes.Repeat([]byte("book content "), 100)
+
+	err := mailer.Send(context.Background(), Mail{
+		To:      "reader@kindle.com",
+		Subject: "Über den Fluss",
+		Body:    "Über den Fluss is attached to this mail.",
+		Attachments: []Attachment{{
+			Name:        "Über den Fluss.epub",
+			ContentType: "application/epub+zip",
+			Content:     content,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(<-server.received))
+	if err != nil {
+		t.Fatalf("cannot read the sent message: %v", err)
+	}
+	if to := msg.Header.Get("To"); to != "reader@kindle.com" {
+		t.Errorf("To = %q, want %q", to, "reader@kindle.com")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Über den Fluss" {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, "Über den Fluss")
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/mixed", msg.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	if _, err := parts.NextPart(); err != nil {
+		t.Fatalf("cannot read the text part: %v", err)
+	}
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("cannot read the attachment: %v", err)
+	}
+	if name := attachment.FileName(); name != "Über den Fluss.epub" {
+		t.Errorf("attachment name = %q, want %q", name, "Über den Fluss.epub")
+	}
+	// multipart strips the transfer encoding only for quoted-printable
+	got, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if err != nil {
+		t.Fatalf("cannot decode the attachment: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("attachment content differs, got %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestSMTPMailerReturnsRejection(t *testing.T) {
+	server := newFakeSMTPServer(t, "552 message size exceeds fixed limit")
+	mailer := NewSMTPMailer("127.0.0.1", server.port(), "", "", "shelffy@example.com")
+
+	err := mailer.Send(context.Background(), Mail{
+		To:          "reader@kindle.com",
+		Subject:     "Book",
+		Attachments: []Attachment{{Name: "book.epub", ContentType: "application/epub+zip", Content: []byte("book")}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "552") {
+		t.Fatalf("Send() error = %v, want the 552 rejection", err)
+	}
+}
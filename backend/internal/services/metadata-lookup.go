@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/google/uuid"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxMetadataCandidates is the number of candidates suggested for a book.
+const maxMetadataCandidates = 10
+
+var (
+	ErrMetadataProviderUnavailable = errors.New("metadata catalogue is unavailable, try again later")
+	ErrMetadataCandidateNotFound   = errors.New("metadata candidate not found")
+	ErrUnknownMetadataField        = errors.New("unknown metadata field")
+	ErrCoverNotFound               = errors.New("the candidate has no cover")
+	ErrCoverTooLarge               = errors.New("cover is too large")
+)
+
+// MetadataField names a field applied from a candidate, the names are those of the metadata history.
+type MetadataField string
+
+const (
+	MetadataFieldTitle         MetadataField = "title"
+	MetadataFieldAuthors       MetadataField = "authors"
+	MetadataFieldDescription   MetadataField = "description"
+	MetadataFieldLanguage      MetadataField = "language"
+	MetadataFieldPublisher     MetadataField = "publisher"
+	MetadataFieldPublishedDate MetadataField = "published_date"
+	MetadataFieldISBN          MetadataField = "isbn"
+	MetadataFieldSeries        MetadataField = "series"
+	MetadataFieldTags          MetadataField = "tags"
+	MetadataFieldIdentifiers   MetadataField = "identifiers"
+	MetadataFieldCover         MetadataField = "cover"
+)
+
+// MetadataQuery finds a book by ISBN, or by title and authors when the ISBN is empty.
+type MetadataQuery struct {
+	ISBN    string
+	Title   string
+	Authors []string
+}
+
+// MetadataCandidate is a book of an external catalogue that may be the book of the library.
+// Confidence is from 0 to 1 and is set by MetadataLookup.
+type MetadataCandidate struct {
+	ID         string
+	Provider   string
+	Title      string
+	Metadata   entities.BookMetadata
+	CoverURL   string
+	Confidence float64
+}
+
+// MetadataProvider looks books up in an external catalogue.
+type MetadataProvider interface {
+	// Lookup returns the books matching the query, a book that is not in the catalogue is not an error.
+	Lookup(ctx context.Context, query MetadataQuery) ([]MetadataCandidate, error)
+	// Get returns the candidate with the id returned by Lookup.
+	Get(ctx context.Context, id string) (MetadataCandidate, error)
+	// Cover downloads the cover image of the candidate, covers larger than maxSize bytes fail with ErrCoverTooLarge.
+	Cover(ctx context.Context, candidate MetadataCandidate, maxSize int64) ([]byte, error)
+}
+
+type noopMetadataProvider struct{}
+
+// NewNoopMetadataProvider returns a provider that finds nothing. It is used when no catalogue is configured.
+func NewNoopMetadataProvider() MetadataProvider {
+	return noopMetadataProvider{}
+}
+
+func (noopMetadataProvider) Lookup(context.Context, MetadataQuery) ([]MetadataCandidate, error) {
+	return []MetadataCandidate{}, nil
+}
+
+func (noopMetadataProvider) Get(context.Context, string) (MetadataCandidate, error) {
+	return MetadataCandidate{}, ErrMetadataCandidateNotFound
+}
+
+func (noopMetadataProvider) Cover(context.Context, MetadataCandidate, int64) ([]byte, error) {
+	return nil, ErrCoverNotFound
+}
+
+// MetadataLookup suggests metadata for books from a catalogue and applies the fields the user picks.
+type MetadataLookup interface {
+	// Suggest looks the book up by its ISBN, then by its title and authors, best matches first.
+	Suggest(ctx context.Context, book entities.Book) ([]MetadataCandidate, error)
+	// Apply copies the fields of the candidate to the book as a metadata edit based on expectedVersion.
+	// Empty fields of the candidate are skipped, its tags and identifiers are added to those of the book.
+	Apply(
+		ctx context.Context,
+		book entities.Book,
+		editor uuid.UUID,
+		expectedVersion int,
+		candidateID string,
+		fields []MetadataField,
+	) (entities.Book, error)
+}
+
+type metadataLookupService struct {
+	provider     MetadataProvider
+	books        Books
+	metadata     BookMetadata
+	maxCoverSize int64
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+func NewMetadataLookup(
+	provider MetadataProvider,
+	books Books,
+	metadata BookMetadata,
+	maxCoverSize int64,
+	timeout time.Duration,
+	logger *slog.Logger,
+) MetadataLookup {
+	return metadataLookupService{
+		provider:     provider,
+		books:        books,
+		metadata:     metadata,
+		maxCoverSize: maxCoverSize,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+func (s metadataLookupService) providerError(err error, msg string, args ...any) error {
+	switch {
+	case errors.Is(err, ErrMetadataCandidateNotFound), errors.Is(err, ErrCoverNotFound), errors.Is(err, ErrCoverTooLarge):
+		return err
+	case errors.Is(err, ErrMetadataProviderUnavailable):
+		s.logger.Warn(msg, append(args, "error", err)...)
+		return ErrMetadataProviderUnavailable
+	}
+	s.logger.Error(msg, append(args, "error", err)...)
+	return ErrInternal
+}
+
+func (s metadataLookupService) Suggest(ctx context.Context, book entities.Book) ([]MetadataCandidate, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var candidates []MetadataCandidate
+	if book.Metadata.ISBN != "" {
+		var err error
+		candidates, err = s.provider.Lookup(c, MetadataQuery{ISBN: book.Metadata.ISBN})
+		if err != nil {
+			return nil, s.providerError(err, "cannot look book up by isbn", "book_id", book.ID)
+		}
+	}
+	if len(candidates) == 0 {
+		var err error
+		candidates, err = s.provider.Lookup(c, MetadataQuery{Title: book.Title, Authors: book.Metadata.Authors})
+		if err != nil {
+			return nil, s.providerError(err, "cannot look book up by title", "book_id", book.ID)
+		}
+	}
+	for i := range candidates {
+		candidates[i].Confidence = matchConfidence(book, candidates[i])
+	}
+	slices.SortStableFunc(candidates, func(a, b MetadataCandidate) int { return cmp.Compare(b.Confidence, a.Confidence) })
+	return candidates[:min(len(candidates), maxMetadataCandidates)], nil
+}
+
+func (s metadataLookupService) Apply(
+	ctx context.Context,
+	book entities.Book,
+	editor uuid.UUID,
+	expectedVersion int,
+	candidateID string,
+	fields []MetadataField,
+) (entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	// the candidate is fetched again rather than taken from the client, so the cover comes from the catalogue
+	candidate, err := s.provider.Get(c, candidateID)
+	if err != nil {
+		return entities.Book{}, s.providerError(err, "cannot get metadata candidate", "book_id", book.ID, "candidate_id", candidateID)
+	}
+	patch, err := metadataPatch(book, candidate, fields)
+	if err != nil {
+		return entities.Book{}, err
+	}
+	// the cover is downloaded first, so a missing cover leaves the book unchanged
+	var cover []byte
+	if slices.Contains(fields, MetadataFieldCover) {
+		cover, err = s.provider.Cover(c, candidate, s.maxCoverSize)
+		if err != nil {
+			return entities.Book{}, s.providerError(err, "cannot download cover", "book_id", book.ID, "candidate_id", candidateID)
+		}
+	}
+	updated, err := s.metadata.Update(ctx, book.ID, editor, expectedVersion, patch)
+	if err != nil {
+		return entities.Book{}, err
+	}
+	if cover != nil {
+		return s.books.SetCover(ctx, updated, int64(len(cover)), bytes.NewReader(cover))
+	}
+	return updated, nil
+}
+
+// metadataPatch builds the edit applying the fields of the candidate to the book.
+func metadataPatch(book entities.Book, candidate MetadataCandidate, fields []MetadataField) (BookMetadataPatch, error) {
+	var patch BookMetadataPatch
+	setString := func(field *Optional[string], value string) {
+		if value != "" {
+			*field = Some(value)
+		}
+	}
+	for _, field := range fields {
+		switch field {
+		case MetadataFieldTitle:
+			setString(&patch.Title, candidate.Title)
+		case MetadataFieldAuthors:
+			if len(candidate.Metadata.Authors) > 0 {
+				patch.Authors = Some(candidate.Metadata.Authors)
+			}
+		case MetadataFieldDescription:
+			setString(&patch.Description, candidate.Metadata.Description)
+		case MetadataFieldLanguage:
+			setString(&patch.Language, candidate.Metadata.Language)
+		case MetadataFieldPublisher:
+			setString(&patch.Publisher, candidate.Metadata.Publisher)
+		case MetadataFieldPublishedDate:
+			if candidate.Metadata.PublishedDate != nil {
+				patch.PublishedDate = Some(candidate.Metadata.PublishedDate)
+			}
+		case MetadataFieldISBN:
+			setString(&patch.ISBN, candidate.Metadata.ISBN)
+		case MetadataFieldSeries:
+			setString(&patch.Series, candidate.Metadata.Series)
+		case MetadataFieldTags:
+			tags := slices.Clone(book.Metadata.Tags)
+			for _, tag := range candidate.Metadata.Tags {
+				if !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+					tags = append(tags, tag)
+				}
+			}
+			patch.Tags = Some(tags)
+		case MetadataFieldIdentifiers:
+			identifiers := maps.Clone(book.Metadata.Identifiers)
+			if identifiers == nil {
+				identifiers = make(map[string]string, len(candidate.Metadata.Identifiers))
+			}
+			maps.Copy(identifiers, candidate.Metadata.Identifiers)
+			patch.Identifiers = Some(identifiers)
+		case MetadataFieldCover:
+		default:
+			return BookMetadataPatch{}, ErrUnknownMetadataField
+		}
+	}
+	return patch, nil
+}
+
+// matchConfidence scores how well the candidate matches the book. The same ISBN is a certain match,
+// otherwise the words of the titles and of the authors are compared.
+func matchConfidence(book entities.Book, candidate MetadataCandidate) float64 {
+	if isbn := isbn13(book.Metadata.ISBN); isbn != "" && isbn == isbn13(candidate.Metadata.ISBN) {
+		return 1
+	}
+	title := wordSimilarity(matchWords(book.Title), matchWords(candidate.Title))
+	if len(book.Metadata.Authors) == 0 || len(candidate.Metadata.Authors) == 0 {
+		return roundConfidence(title * 0.8)
+	}
+	var authors float64
+	for _, a := range book.Metadata.Authors {
+		for _, b := range candidate.Metadata.Authors {
+			authors = max(authors, wordSimilarity(matchWords(a), matchWords(b)))
+		}
+	}
+	return roundConfidence(title*0.7 + authors*0.3)
+}
+
+func roundConfidence(confidence float64) float64 {
+	return float64(int(confidence*100+0.5)) / 100
+}
+
+// matchWords splits the text into lower case words without diacritics, so "Les Misérables" matches "les miserables".
+func matchWords(text string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		folded = text
+	}
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordSimilarity is the Dice coefficient of the sets of words, from 0 for no common word to 1 for the same words.
+func wordSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	setA := make(map[string]struct{}, len(a))
+	for _, word := range a {
+		setA[word] = struct{}{}
+	}
+	setB := make(map[string]struct{}, len(b))
+	for _, word := range b {
+		setB[word] = struct{}{}
+	}
+	common := 0
+	for word := range setA {
+		if _, ok := setB[word]; ok {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(setA)+len(setB))
+}
+
+// isbn13 converts a valid ISBN-10 to the ISBN-13 with the 978 prefix, so both forms of an ISBN compare equal.
+// Invalid ISBNs are returned empty.
+func isbn13(isbn string) string {
+	isbn, err := normalizeISBN(isbn)
+	if err != nil || len(isbn) != 10 {
+		return isbn
+	}
+	isbn = "978" + isbn[:9]
+	sum := 0
+	for i, r := range isbn {
+		digit := int(r - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return isbn + string(rune('0'+(10-sum%10)%10))
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"golang.org/x/text/language"
+)
+
+const (
+	openLibraryName = "openlibrary"
+	// openLibrarySearchLimit is the number of search results asked for, the best matches come first.
+	openLibrarySearchLimit = 10
+	// openLibraryMaxAuthors limits the author records fetched for an edition.
+	openLibraryMaxAuthors = 5
+	// openLibraryMaxSubjects limits the subjects taken as tags, works often have dozens of them.
+	openLibraryMaxSubjects = 10
+	// openLibraryMaxResponseSize limits the JSON documents read from Open Library.
+	openLibraryMaxResponseSize = 4 << 20
+	openLibrarySearchFields    = "key,title,author_name,first_publish_year,publisher,isbn,language,cover_i,subject,cover_edition_key,edition_key"
+)
+
+var (
+	// openLibraryEditionID matches the keys of editions, such as OL7353617M.
+	openLibraryEditionID = regexp.MustCompile(`^OL[0-9]+M$`)
+	publishYear          = regexp.MustCompile(`(?:^|[^0-9])([0-9]{4})(?:[^0-9]|$)`)
+	publishDateLayouts   = []string{"2006-01-02", "January 2, 2006", "Jan 2, 2006", "January 2006", "Jan 2006", "2 January 2006", "2006"}
+	// marcBibliographicLanguages maps the MARC codes that differ from the ISO 639-2 terminology codes.
+	marcBibliographicLanguages = map[string]string{
+		"alb": "sqi", "arm": "hye", "baq": "eus", "bur": "mya", "chi": "zho",
+		"cze": "ces", "dut": "nld", "fre": "fra", "geo": "kat", "ger": "deu",
+		"gre": "ell", "ice": "isl", "mac": "mkd", "mao": "mri", "may": "msa",
+		"per": "fas", "rum": "ron", "slo": "slk", "tib": "bod", "wel": "cym",
+	}
+)
+
+type openLibraryProvider struct {
+	baseURL   string
+	coversURL string
+	client    *http.Client
+}
+
+// NewOpenLibraryProvider returns a provider that looks books up in the JSON API of Open Library at baseURL
+// and downloads covers from coversURL. Both can point to a local server with recorded responses.
+func NewOpenLibraryProvider(baseURL, coversURL string, timeout time.Duration) MetadataProvider {
+	return openLibraryProvider{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		coversURL: strings.TrimSuffix(coversURL, "/"),
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// openLibraryText is a text field that is either a string or an object with the text in value.
+type openLibraryText string
+
+func (t *openLibraryText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = openLibraryText(text)
+		return nil
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	*t = openLibraryText(typed.Value)
+	return nil
+}
+
+type openLibraryKey struct {
+	Key string `json:"key"`
+}
+
+type openLibraryEdition struct {
+	Key         string           `json:"key"`
+	Title       string           `json:"title"`
+	Subtitle    string           `json:"subtitle"`
+	Authors     []openLibraryKey `json:"authors"`
+	Publishers  []string         `json:"publishers"`
+	PublishDate string           `json:"publish_date"`
+	ISBN10      []string         `json:"isbn_10"`
+	ISBN13      []string         `json:"isbn_13"`
+	Covers      []int            `json:"covers"`
+	Languages   []openLibraryKey `json:"languages"`
+	Works       []openLibraryKey `json:"works"`
+	Series      []string         `json:"series"`
+	Description openLibraryText  `json:"description"`
+	Subjects    []string         `json:"subjects"`
+}
+
+type openLibraryWork struct {
+	Description openLibraryText `json:"description"`
+	Subjects    []string        `json:"subjects"`
+	Covers      []int           `json:"covers"`
+	Authors     []struct {
+		Author openLibraryKey `json:"author"`
+	} `json:"authors"`
+}
+
+type openLibraryAuthor struct {
+	Name string `json:"name"`
+}
+
+type openLibrarySearchResult struct {
+	Docs []struct {
+		Title            string   `json:"title"`
+		AuthorName       []string `json:"author_name"`
+		FirstPublishYear int      `json:"first_publish_year"`
+		Publisher        []string `json:"publisher"`
+		ISBN             []string `json:"isbn"`
+		Language         []string `json:"language"`
+		CoverID          int      `json:"cover_i"`
+		Subject          []string `json:"subject"`
+		CoverEditionKey  string   `json:"cover_edition_key"`
+		EditionKey       []string `json:"edition_key"`
+	} `json:"docs"`
+}
+
+// get decodes the JSON document at path into v and reports false when it does not exist.
+func (p openLibraryProvider) get(ctx context.Context, path string, query url.Values, v any) (bool, error) {
+	u := p.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMetadataProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("%w: %s returned %s", ErrMetadataProviderUnavailable, path, res.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, openLibraryMaxResponseSize)).Decode(v); err != nil {
+		return false, fmt.Errorf("%w: cannot decode %s: %w", ErrMetadataProviderUnavailable, path, err)
+	}
+	return true, nil
+}
+
+func (p openLibraryProvider) Lookup(ctx context.Context, query MetadataQuery) ([]MetadataCandidate, error) {
+	if query.ISBN != "" {
+		candidate, err := p.edition(ctx, "/isbn/"+url.PathEscape(query.ISBN)+".json")
+		switch {
+		case errors.Is(err, ErrMetadataCandidateNotFound):
+			return []MetadataCandidate{}, nil
+		case err != nil:
+			return nil, err
+		}
+		return []MetadataCandidate{candidate}, nil
+	}
+	return p.search(ctx, query)
+}
+
+func (p openLibraryProvider) Get(ctx context.Context, id string) (MetadataCandidate, error) {
+	if !openLibraryEditionID.MatchString(id) {
+		return MetadataCandidate{}, ErrMetadataCandidateNotFound
+	}
+	return p.edition(ctx, "/books/"+id+".json")
+}
+
+func (p openLibraryProvider) Cover(ctx context.Context, candidate MetadataCandidate, maxSize int64) ([]byte, error) {
+	if candidate.CoverURL == "" {
+		return nil, ErrCoverNotFound
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, candidate.CoverURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMetadataProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrCoverNotFound
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: cover returned %s", ErrMetadataProviderUnavailable, res.Status)
+	}
+	cover, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMetadataProviderUnavailable, err)
+	}
+	if int64(len(cover)) > maxSize {
+		return nil, ErrCoverTooLarge
+	}
+	return cover, nil
+}
+
+func (p openLibraryProvider) search(ctx context.Context, query MetadataQuery) ([]MetadataCandidate, error) {
+	params := url.Values{
+		"title":  {query.Title},
+		"fields": {openLibrarySearchFields},
+		"limit":  {strconv.Itoa(openLibrarySearchLimit)},
+	}
+	if len(query.Authors) > 0 {
+		params.Set("author", query.Authors[0])
+	}
+	var result openLibrarySearchResult
+	if _, err := p.get(ctx, "/search.json", params, &result); err != nil {
+		return nil, err
+	}
+	candidates := make([]MetadataCandidate, 0, len(result.Docs))
+	for _, doc := range result.Docs {
+		// candidates are editions, works without any are left out
+		id := doc.CoverEditionKey
+		if id == "" && len(doc.EditionKey) > 0 {
+			id = doc.EditionKey[0]
+		}
+		if !openLibraryEditionID.MatchString(id) {
+			continue
+		}
+		candidate := MetadataCandidate{
+			ID:       id,
+			Provider: openLibraryName,
+			Title:    doc.Title,
+			Metadata: entities.BookMetadata{
+				Authors:     nonNil(doc.AuthorName),
+				Publisher:   first(doc.Publisher),
+				ISBN:        preferISBN13(doc.ISBN),
+				Tags:        limitSubjects(doc.Subject),
+				Identifiers: map[string]string{openLibraryName: id},
+			},
+			CoverURL: p.coverURL(doc.CoverID),
+		}
+		if len(doc.Language) > 0 {
+			candidate.Metadata.Language = marcLanguage(doc.Language[0])
+		}
+		if doc.FirstPublishYear > 0 {
+			published := time.Date(doc.FirstPublishYear, time.January, 1, 0, 0, 0, 0, time.UTC)
+			candidate.Metadata.PublishedDate = &published
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// edition reads the edition at path together with its authors. The description and the subjects
+// usually belong to the work of the edition and are taken from it when the edition has none.
+func (p openLibraryProvider) edition(ctx context.Context, path string) (MetadataCandidate, error) {
+	var edition openLibraryEdition
+	found, err := p.get(ctx, path, nil, &edition)
+	if err != nil {
+		return MetadataCandidate{}, err
+	}
+	if !found {
+		return MetadataCandidate{}, ErrMetadataCandidateNotFound
+	}
+	id := strings.TrimPrefix(edition.Key, "/books/")
+	title := edition.Title
+	if edition.Subtitle != "" {
+		title += ": " + edition.Subtitle
+	}
+	candidate := MetadataCandidate{
+		ID:       id,
+		Provider: openLibraryName,
+		Title:    title,
+		Metadata: entities.BookMetadata{
+			Authors:     make([]string, 0, len(edition.Authors)),
+			Description: string(edition.Description),
+			Publisher:   first(edition.Publishers),
+			ISBN:        preferISBN13(append(edition.ISBN13, edition.ISBN10...)),
+			Series:      first(edition.Series),
+			Tags:        limitSubjects(edition.Subjects),
+			Identifiers: map[string]string{openLibraryName: id},
+		},
+		CoverURL: p.coverURL(first(edition.Covers)),
+	}
+	if len(edition.Languages) > 0 {
+		candidate.Metadata.Language = marcLanguage(strings.TrimPrefix(edition.Languages[0].Key, "/languages/"))
+	}
+	candidate.Metadata.PublishedDate = parsePublishDate(edition.PublishDate)
+	authors := edition.Authors
+	if len(edition.Works) > 0 {
+		var work openLibraryWork
+		found, err := p.get(ctx, edition.Works[0].Key+".json", nil, &work)
+		if err != nil {
+			return MetadataCandidate{}, err
+		}
+		if found {
+			if candidate.Metadata.Description == "" {
+				candidate.Metadata.Description = string(work.Description)
+			}
+			if len(candidate.Metadata.Tags) == 0 {
+				candidate.Metadata.Tags = limitSubjects(work.Subjects)
+			}
+			if candidate.CoverURL == "" {
+				candidate.CoverURL = p.coverURL(first(work.Covers))
+			}
+			if len(authors) == 0 {
+				for _, author := range work.Authors {
+					authors = append(authors, author.Author)
+				}
+			}
+		}
+	}
+	for _, key := range authors[:min(len(authors), openLibraryMaxAuthors)] {
+		var author openLibraryAuthor
+		found, err := p.get(ctx, key.Key+".json", nil, &author)
+		if err != nil {
+			return MetadataCandidate{}, err
+		}
+		if found && author.Name != "" {
+			candidate.Metadata.Authors = append(candidate.Metadata.Authors, author.Name)
+		}
+	}
+	return candidate, nil
+}
+
+// coverURL returns the URL of the large cover image, Open Library answers 404 instead of a blank image
+// when default=false.
+func (p openLibraryProvider) coverURL(coverID int) string {
+	// negative ids mark deleted covers
+	if coverID <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/b/id/%d-L.jpg?default=false", p.coversURL, coverID)
+}
+
+func first[T any](values []T) T {
+	var zero T
+	if len(values) == 0 {
+		return zero
+	}
+	return values[0]
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return make([]string, 0)
+	}
+	return values
+}
+
+func preferISBN13(isbns []string) string {
+	for _, isbn := range isbns {
+		if normalized, err := normalizeISBN(isbn); err == nil && len(normalized) == 13 {
+			return normalized
+		}
+	}
+	for _, isbn := range isbns {
+		if normalized, err := normalizeISBN(isbn); err == nil && normalized != "" {
+			return normalized
+		}
+	}
+	return ""
+}
+
+func limitSubjects(subjects []string) []string {
+	return nonNil(subjects[:min(len(subjects), openLibraryMaxSubjects)])
+}
+
+// marcLanguage converts a MARC language code to the two letter code used in book metadata when there is one.
+func marcLanguage(code string) string {
+	if terminology, ok := marcBibliographicLanguages[code]; ok {
+		code = terminology
+	}
+	base, err := language.ParseBase(code)
+	if err != nil {
+		return code
+	}
+	return base.String()
+}
+
+// parsePublishDate parses the free-form publish dates of Open Library, falling back to the first day of the year.
+func parsePublishDate(date string) *time.Time {
+	date = strings.TrimSpace(date)
+	for _, layout := range publishDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return &t
+		}
+	}
+	match := publishYear.FindStringSubmatch(date)
+	if match == nil {
+		return nil
+	}
+	year, _ := strconv.Atoi(match[1])
+	t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return &t
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+)
+
+// PasswordResets resets passwords with single-use tokens sent by email.
+type PasswordResets interface {
+	// Force invalidates the current password of the user, revokes all sessions
+	// and mails a reset token to the user.
+	Force(ctx context.Context, userID uuid.UUID) error
+	Reset(ctx context.Context, token, newPassword string) error
+}
+
+type passwordResetsService struct {
+	usersRepo    repositories.Users
+	sessionsRepo repositories.Session
+	resetsRepo   repositories.PasswordResets
+	mailer       Mailer
+	txManager    *manager.Manager
+	tokenTTL     time.Duration
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+func NewPasswordResets(
+	usersRepo repositories.Users,
+	sessionsRepo repositories.Session,
+	resetsRepo repositories.PasswordResets,
+	mailer Mailer,
+	txManager *manager.Manager,
+	tokenTTL time.Duration,
+	timeout time.Duration,
+	logger *slog.Logger,
+) PasswordResets {
+	return passwordResetsService{
+		usersRepo:    usersRepo,
+		sessionsRepo: sessionsRepo,
+		resetsRepo:   resetsRepo,
+		mailer:       mailer,
+		txManager:    txManager,
+		tokenTTL:     tokenTTL,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+func (s passwordResetsService) Force(ctx context.Context, userID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var (
+		user  entities.User
+		token entities.PasswordResetToken
+	)
+	err := s.txManager.Do(c, func(ctx context.Context) error {
+		var err error
+		// a random value is not a valid bcrypt hash, so no password matches it
+		user, err = s.usersRepo.Update(ctx, userID, map[string]any{"password": generateToken(32)})
+		if err != nil {
+			return err
+		}
+		if err := s.resetsRepo.DeleteByUserID(ctx, userID); err != nil {
+			return err
+		}
+		token, err = s.resetsRepo.Create(ctx, entities.PasswordResetToken{
+			Token:     generateToken(32),
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(s.tokenTTL),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.sessionsRepo.DeactivateByUserID(c, userID); err != nil {
+		s.logger.Error("cannot revoke sessions after password reset", "error", err, "user_id", userID)
+	}
+	err = s.mailer.Send(c, Mail{
+		To:      user.Email,
+		Subject: "Reset your Shelffy password",
+		Body: fmt.Sprintf(
+			"An administrator has requested a password reset for your account and you have been signed out.\n\n"+
+				"Use the code below to set a new password. It expires in %s.\n%s\n",
+			s.tokenTTL, token.Token,
+		),
+	})
+	if err != nil {
+		s.logger.Error("cannot send password reset mail", "error", err, "user_id", userID)
+	}
+	return nil
+}
+
+func (s passwordResetsService) Reset(ctx context.Context, token, newPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.txManager.Do(c, func(ctx context.Context) error {
+		resetToken, err := s.resetsRepo.Use(ctx, token)
+		if errors.Is(err, repositories.ErrPasswordResetTokenNotFound) {
+			return ErrInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+		_, err = s.usersRepo.Update(ctx, resetToken.UserID, map[string]any{"password": string(hash)})
+		return err
+	})
+}
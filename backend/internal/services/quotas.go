@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// Quotas keeps track of the storage used by users and enforces their quotas.
+type Quotas interface {
+	Usage(ctx context.Context, userID uuid.UUID) (entities.StorageUsage, error)
+	// Reserve claims size bytes of the user's quota before a file is stored.
+	Reserve(ctx context.Context, userID uuid.UUID, size int64) error
+	Release(ctx context.Context, userID uuid.UUID, size int64) error
+	// SetQuota overrides the default quota of the user. nil restores the default one.
+	SetQuota(ctx context.Context, userID uuid.UUID, quota *int64) error
+	// Backfill records the sizes of files stored before sizes were tracked and counts them against the quotas
+	// of their owners. It reads the sizes from the storage and returns once every file is sized.
+	Backfill(ctx context.Context) error
+}
+
+// backfillBatchSize is the number of files sized at once by Backfill.
+const backfillBatchSize = 100
+
+type quotasService struct {
+	repository   repositories.StorageUsage
+	storage      FileStorage
+	defaultQuota int64
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+func NewQuotas(
+	repo repositories.StorageUsage,
+	storage FileStorage,
+	defaultQuota int64,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Quotas {
+	return quotasService{
+		repository:   repo,
+		storage:      storage,
+		defaultQuota: defaultQuota,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+func (s quotasService) Usage(ctx context.Context, userID uuid.UUID) (entities.StorageUsage, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.Get(c, userID, s.defaultQuota)
+}
+
+func (s quotasService) Reserve(ctx context.Context, userID uuid.UUID, size int64) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.repository.Reserve(c, userID, size, s.defaultQuota)
+	if errors.Is(err, repositories.ErrQuotaExceeded) {
+		return ErrQuotaExceeded
+	}
+	return err
+}
+
+func (s quotasService) Release(ctx context.Context, userID uuid.UUID, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.Release(c, userID, size)
+}
+
+func (s quotasService) Backfill(ctx context.Context) error {
+	var after uuid.UUID
+	sized := 0
+	for {
+		c, cancel := context.WithTimeout(ctx, s.timeout)
+		files, err := s.repository.GetUnsizedFiles(c, after, backfillBatchSize)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			after = file.FileID
+			if s.backfill(ctx, file) {
+				sized++
+			}
+		}
+		if len(files) < backfillBatchSize {
+			break
+		}
+	}
+	if sized > 0 {
+		s.logger.Info("storage usage backfilled", "files", sized)
+	}
+	return nil
+}
+
+// backfill records the size of the file, files missing from the storage are skipped.
+func (s quotasService) backfill(ctx context.Context, file entities.UnsizedFile) bool {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	size, err := s.storage.Size(c, file.StoragePath)
+	if err != nil {
+		s.logger.Warn("cannot get size of stored file", "error", err, "file_id", file.FileID)
+		return false
+	}
+	if size == 0 {
+		return false
+	}
+	if err := s.repository.SetFileSize(c, file, size); err != nil {
+		s.logger.Error("cannot record size of file", "error", err, "file_id", file.FileID)
+		return false
+	}
+	return true
+}
+
+func (s quotasService) SetQuota(ctx context.Context, userID uuid.UUID, quota *int64) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.SetQuota(c, userID, quota)
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/config"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrInviteRequired      = errors.New("invite code is required")
+	ErrInvalidInvite       = errors.New("invite code is invalid or expired")
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrInviteQuotaExceeded = errors.New("invite quota exceeded")
+	ErrUserNotPending      = errors.New("user is not pending approval")
+)
+
+type RegisterInput struct {
+	Email      string
+	Username   string
+	Password   string
+	InviteCode string
+}
+
+type CreateInviteInput struct {
+	MaxUses   int
+	ExpiresAt *time.Time
+}
+
+// Registration creates accounts according to the configured registration mode
+// and manages invites and pending approvals.
+type Registration interface {
+	Mode() config.RegistrationMode
+	// Register returns ErrEmailTaken if the email is already registered.
+	// Callers must not reveal that to the client.
+	Register(ctx context.Context, input RegisterInput) (entities.User, error)
+	GetPendingUsers(ctx context.Context, limit, offset uint64) ([]entities.User, error)
+	Approve(ctx context.Context, userID uuid.UUID) (entities.User, error)
+	Reject(ctx context.Context, userID uuid.UUID) (entities.User, error)
+	// CreateInvite creates an invite on behalf of creator.
+	// Quota is not applied when unlimited is set.
+	CreateInvite(ctx context.Context, creator uuid.UUID, unlimited bool, input CreateInviteInput) (entities.Invite, error)
+	// GetInvites returns invites created by createdBy or all invites when it is nil.
+	GetInvites(ctx context.Context, createdBy *uuid.UUID, limit, offset uint64) ([]entities.Invite, error)
+	GetInvite(ctx context.Context, code string) (entities.Invite, error)
+	RevokeInvite(ctx context.Context, code string) error
+}
+
+type registrationService struct {
+	usersRepo   repositories.Users
+	invitesRepo repositories.Invites
+	txManager   *manager.Manager
+	policy      config.Registration
+	timeout     time.Duration
+	logger      *slog.Logger
+}
+
+func NewRegistration(
+	usersRepo repositories.Users,
+	invitesRepo repositories.Invites,
+	txManager *manager.Manager,
+	policy config.Registration,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Registration {
+	if policy.Mode == "" {
+		policy.Mode = config.RegistrationModeOpen
+	}
+	return registrationService{
+		usersRepo:   usersRepo,
+		invitesRepo: invitesRepo,
+		txManager:   txManager,
+		policy:      policy,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+func (s registrationService) Mode() config.RegistrationMode {
+	return s.policy.Mode
+}
+
+func (s registrationService) Register(ctx context.Context, input RegisterInput) (entities.User, error) {
+	if s.policy.Mode == config.RegistrationModeInvite && input.InviteCode == "" {
+		return entities.User{}, ErrInviteRequired
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	_, err := s.usersRepo.GetByEmail(c, input.Email)
+	if err == nil {
+		return entities.User{}, ErrEmailTaken
+	} else if !errors.Is(err, repositories.ErrUserNotFound) {
+		return entities.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return entities.User{}, err
+	}
+	user := entities.User{
+		ID:             uuid.New(),
+		Email:          input.Email,
+		Username:       input.Username,
+		Password:       string(hash),
+		IsActive:       true,
+		ApprovalStatus: entities.ApprovalStatusApproved,
+	}
+	if s.policy.Mode == config.RegistrationModeApproval {
+		user.IsActive = false
+		user.ApprovalStatus = entities.ApprovalStatusPending
+	}
+	err = s.txManager.Do(c, func(ctx context.Context) error {
+		if s.policy.Mode == config.RegistrationModeInvite {
+			invite, err := s.invitesRepo.Use(ctx, input.InviteCode)
+			if errors.Is(err, repositories.ErrInviteNotFound) {
+				return ErrInvalidInvite
+			} else if err != nil {
+				return err
+			}
+			user.InviteCode = invite.Code
+		}
+		user, err = s.usersRepo.Create(ctx, user)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvalidInvite) {
+			s.logger.Error("failed to register user", "error", err)
+		}
+		return entities.User{}, err
+	}
+	return user, nil
+}
+
+func (s registrationService) GetPendingUsers(ctx context.Context, limit, offset uint64) ([]entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.usersRepo.GetByApprovalStatus(c, entities.ApprovalStatusPending, limit, offset)
+}
+
+func (s registrationService) setApprovalStatus(ctx context.Context, userID uuid.UUID, status entities.ApprovalStatus) (entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	user, err := s.usersRepo.GetByID(c, userID)
+	if err != nil {
+		return entities.User{}, err
+	}
+	if user.ApprovalStatus != entities.ApprovalStatusPending {
+		return entities.User{}, ErrUserNotPending
+	}
+	return s.usersRepo.Update(c, userID, map[string]any{
+		"approval_status": status,
+		"is_active":       status == entities.ApprovalStatusApproved,
+	})
+}
+
+func (s registrationService) Approve(ctx context.Context, userID uuid.UUID) (entities.User, error) {
+	return s.setApprovalStatus(ctx, userID, entities.ApprovalStatusApproved)
+}
+
+func (s registrationService) Reject(ctx context.Context, userID uuid.UUID) (entities.User, error) {
+	return s.setApprovalStatus(ctx, userID, entities.ApprovalStatusRejected)
+}
+
+func (s registrationService) CreateInvite(ctx context.Context, creator uuid.UUID, unlimited bool, input CreateInviteInput) (entities.Invite, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if !unlimited {
+		active, err := s.invitesRepo.CountActiveByCreator(c, creator)
+		if err != nil {
+			return entities.Invite{}, err
+		}
+		if active >= s.policy.UserInviteQuota {
+			return entities.Invite{}, ErrInviteQuotaExceeded
+		}
+	}
+	if input.MaxUses <= 0 {
+		input.MaxUses = 1
+	}
+	if input.ExpiresAt == nil && s.policy.InviteTTL > 0 {
+		expiresAt := time.Now().Add(s.policy.InviteTTL)
+		input.ExpiresAt = &expiresAt
+	}
+	return s.invitesRepo.Create(c, entities.Invite{
+		Code:      generateToken(16),
+		CreatedBy: creator,
+		MaxUses:   input.MaxUses,
+		ExpiresAt: input.ExpiresAt,
+	})
+}
+
+func (s registrationService) GetInvites(ctx context.Context, createdBy *uuid.UUID, limit, offset uint64) ([]entities.Invite, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.invitesRepo.GetMany(c, createdBy, limit, offset)
+}
+
+func (s registrationService) GetInvite(ctx context.Context, code string) (entities.Invite, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	invite, err := s.invitesRepo.GetByCode(c, code)
+	if errors.Is(err, repositories.ErrInviteNotFound) {
+		return entities.Invite{}, ErrInviteNotFound
+	}
+	return invite, err
+}
+
+func (s registrationService) RevokeInvite(ctx context.Context, code string) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.invitesRepo.Revoke(c, code)
+	if errors.Is(err, repositories.ErrInviteNotFound) {
+		return ErrInviteNotFound
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+type Roles interface {
+	GetAll(ctx context.Context) ([]entities.Role, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Role, error)
+	GetPermissions(ctx context.Context, userID uuid.UUID) (entities.Permissions, error)
+	Assign(ctx context.Context, userID uuid.UUID, role string) error
+	Revoke(ctx context.Context, userID uuid.UUID, role string) error
+}
+
+type rolesService struct {
+	repository repositories.Roles
+	timeout    time.Duration
+	logger     *slog.Logger
+}
+
+func NewRoles(repo repositories.Roles, timeout time.Duration, logger *slog.Logger) Roles {
+	return rolesService{
+		repository: repo,
+		timeout:    timeout,
+		logger:     logger,
+	}
+}
+
+func (s rolesService) GetAll(ctx context.Context) ([]entities.Role, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.GetAll(c)
+}
+
+func (s rolesService) GetByUserID(ctx context.Context, userID uuid.UUID) ([]entities.Role, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.GetByUserID(c, userID)
+}
+
+func (s rolesService) GetPermissions(ctx context.Context, userID uuid.UUID) (entities.Permissions, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	permissions, err := s.repository.GetPermissionsByUserID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	return entities.NewPermissions(permissions...), nil
+}
+
+func (s rolesService) Assign(ctx context.Context, userID uuid.UUID, role string) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.repository.Assign(c, userID, role)
+	if errors.Is(err, repositories.ErrRoleNotFound) {
+		return ErrRoleNotFound
+	}
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		s.logger.Error("cannot assign role", "error", err, "user_id", userID, "role", role)
+	}
+	return err
+}
+
+func (s rolesService) Revoke(ctx context.Context, userID uuid.UUID, role string) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.repository.Revoke(c, userID, role)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd. It must not exceed StreamMaxLength of clamd.
+const clamdChunkSize = 64 << 10
+
+var ErrScannerUnavailable = errors.New("malware scanner is unavailable")
+
+// ScanResult is the verdict of a Scanner. Signature names the detected malware.
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks book files for malware.
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (ScanResult, error)
+}
+
+type noopScanner struct{}
+
+// NewNoopScanner returns a scanner that reports every file as clean. It is used when no scanner is configured.
+func NewNoopScanner() Scanner {
+	return noopScanner{}
+}
+
+func (noopScanner) Scan(_ context.Context, content io.Reader) (ScanResult, error) {
+	return ScanResult{}, nil
+}
+
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner returns a scanner that streams files to clamd with the INSTREAM command.
+// network is "tcp" or "unix".
+func NewClamdScanner(network, address string, timeout time.Duration) Scanner {
+	return clamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (s clamdScanner) Scan(ctx context.Context, content io.Reader) (ScanResult, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(c, s.network, s.address)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("%w: %w", ErrScannerUnavailable, err)
+	}
+	defer conn.Close()
+	if deadline, ok := c.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return ScanResult{}, err
+		}
+	}
+	if err := s.stream(conn, content); err != nil {
+		return ScanResult{}, err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("cannot read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// stream sends the content as length-prefixed chunks terminated by a zero-length chunk.
+func (s clamdScanner) stream(conn net.Conn, content io.Reader) error {
+	writer := bufio.NewWriter(conn)
+	if _, err := writer.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	chunk := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := io.ReadFull(content, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := writer.Write(size); err != nil {
+				return err
+			}
+			if _, err := writer.Write(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := writer.Write(size); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// parseClamdReply parses replies like "stream: OK" and "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (ScanResult, error) {
+	verdict, ok := strings.CutPrefix(reply, "stream: ")
+	if !ok {
+		return ScanResult{}, fmt.Errorf("clamd error: %s", reply)
+	}
+	switch {
+	case verdict == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return ScanResult{
+			Infected:  true,
+			Signature: strings.TrimSuffix(verdict, " FOUND"),
+		}, nil
+	}
+	return ScanResult{}, fmt.Errorf("clamd error: %s", strings.TrimSuffix(verdict, " ERROR"))
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts a single INSTREAM command on a local port, records the streamed content and answers with reply.
+type fakeClamd struct {
+	listener net.Listener
+	reply    string
+	received chan []byte
+}
+
+func newFakeClamd(t *testing.T, reply string) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	d := &fakeClamd{listener: listener, reply: reply, received: make(chan []byte, 1)}
+	go d.serve()
+	return d
+}
+
+func (d *fakeClamd) serve() {
+	conn, err := d.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		return
+	}
+	content := bytes.Buffer{}
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+			return
+		}
+	}
+	d.received <- content.Bytes()
+	io.WriteString(conn, d.reply+"\x00")
+}
+
+func TestClamdScanner(t *testing.T) {
+	// larger than a chunk, so the content is streamed in several of them
+	content := bytes.Repeat([]byte("0123456789abcdef"), clamdChunkSize/8)
+	tests := []struct {
+		name    string
+		reply   string
+		want    ScanResult
+		wantErr bool
+	}{
+		{name: "clean", reply: "stream: OK", want: ScanResult{}},
+		{
+			name:  "infected",
+			reply: "stream: Win.Test.EICAR_HDB-1 FOUND",
+			want:  ScanResult{Infected: true, Signature: "Win.Test.EICAR_HDB-1"},
+		},
+		{name: "scan error", reply: "stream: Can't allocate memory ERROR", wantErr: true},
+		{name: "command error", reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamd := newFakeClamd(t, tt.reply)
+			scanner := NewClamdScanner("tcp", clamd.listener.Addr().String(), 5*time.Second)
+
+			got, err := scanner.Scan(context.Background(), bytes.NewReader(content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+			if received := <-clamd.received; !bytes.Equal(received, content) {
+				t.Errorf("clamd received %d bytes, want %d", len(received), len(content))
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	scanner := NewClamdScanner("tcp", address, 5*time.Second)
+
+	_, err = scanner.Scan(context.Background(), bytes.NewReader([]byte("book")))
+	if !errors.Is(err, ErrScannerUnavailable) {
+		t.Fatalf("Scan() error = %v, want %v", err, ErrScannerUnavailable)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/repositories"
+)
+
+var (
+	activeSessionsMetric = expvar.NewInt("sessions_active")
+	purgedSessionsMetric = expvar.NewInt("sessions_purged_total")
+)
+
+type SessionJanitor interface {
+	Run(ctx context.Context) error
+}
+
+type sessionJanitor struct {
+	repo        repositories.Session
+	interval    time.Duration
+	idleTimeout time.Duration
+	timeout     time.Duration
+	logger      *slog.Logger
+}
+
+// NewSessionJanitor returns a job that periodically purges expired, idle and deactivated sessions
+// and publishes the number of active sessions.
+func NewSessionJanitor(repo repositories.Session, interval, idleTimeout, timeout time.Duration, logger *slog.Logger) SessionJanitor {
+	return sessionJanitor{
+		repo:        repo,
+		interval:    interval,
+		idleTimeout: idleTimeout,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+func (j sessionJanitor) cleanup(ctx context.Context) {
+	c, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+	lastSeenAfter := time.Time{}
+	if j.idleTimeout > 0 {
+		lastSeenAfter = time.Now().Add(-j.idleTimeout)
+	}
+	purged, err := j.repo.DeleteStale(c, lastSeenAfter)
+	if err != nil {
+		j.logger.Error("cannot delete stale sessions", "error", err)
+	} else {
+		purgedSessionsMetric.Add(purged)
+		j.logger.Debug("stale sessions deleted", "count", purged)
+	}
+	active, err := j.repo.CountActive(c, lastSeenAfter)
+	if err != nil {
+		j.logger.Error("cannot count active sessions", "error", err)
+		return
+	}
+	activeSessionsMetric.Set(active)
+}
+
+func (j sessionJanitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareLinkNotFound    = errors.New("share link not found")
+	ErrShareLinkUnavailable = errors.New("the share link has expired, reached its download limit or was revoked")
+	// ErrSharePasswordRequired is returned when a link with a password is opened without one,
+	// clients are expected to ask for the password and try again.
+	ErrSharePasswordRequired        = errors.New("the share link is protected by a password")
+	ErrInvalidSharePassword         = errors.New("invalid share link password")
+	ErrTooManySharePasswordAttempts = errors.New("too many wrong passwords, try again later")
+	ErrInvalidShareExpiry           = errors.New("the expiry of the share link must be in the future")
+	ErrInvalidDownloadLimit         = errors.New("the download limit must be positive")
+	ErrSharePasswordTooLong         = errors.New("the share link password must be at most 72 bytes")
+)
+
+const (
+	// sharePasswordAttempts wrong passwords in sharePasswordPeriod lock the link for the rest of the period.
+	sharePasswordAttempts = 10
+	sharePasswordPeriod   = 15 * time.Minute
+)
+
+type CreateShareLinkInput struct {
+	// Password is optional, anyone with the link can download the book when it is empty.
+	Password     string
+	ExpiresAt    *time.Time
+	MaxDownloads *int
+}
+
+// ShareLinks gives people without an account access to single books through links with random tokens.
+// Every attempt to download a book through a link is recorded.
+type ShareLinks interface {
+	Create(ctx context.Context, bookID uuid.UUID, creator uuid.UUID, input CreateShareLinkInput) (entities.ShareLink, error)
+	Get(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error)
+	GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ShareLink, error)
+	Revoke(ctx context.Context, linkID uuid.UUID) error
+	// Open returns the link of the token after checking that it can be used and the password matches.
+	// It does not count a download, Download does once the content is about to be sent.
+	Open(ctx context.Context, token string, password string, client entities.ClientInfo) (entities.ShareLink, error)
+	Download(ctx context.Context, link entities.ShareLink, client entities.ClientInfo) (entities.ShareLink, error)
+	GetAccesses(ctx context.Context, linkID uuid.UUID, limit, offset uint64) ([]entities.ShareLinkAccess, error)
+}
+
+type shareLinksService struct {
+	linksRepo repositories.ShareLinks
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+func NewShareLinks(
+	linksRepo repositories.ShareLinks,
+	timeout time.Duration,
+	logger *slog.Logger,
+) ShareLinks {
+	return shareLinksService{
+		linksRepo: linksRepo,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+func (s shareLinksService) Create(ctx context.Context, bookID uuid.UUID, creator uuid.UUID, input CreateShareLinkInput) (entities.ShareLink, error) {
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return entities.ShareLink{}, ErrInvalidShareExpiry
+	}
+	if input.MaxDownloads != nil && *input.MaxDownloads <= 0 {
+		return entities.ShareLink{}, ErrInvalidDownloadLimit
+	}
+	link := entities.ShareLink{
+		ID:           uuid.New(),
+		Token:        generateToken(32),
+		BookID:       bookID,
+		CreatedBy:    creator,
+		ExpiresAt:    input.ExpiresAt,
+		MaxDownloads: input.MaxDownloads,
+	}
+	if input.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return entities.ShareLink{}, ErrSharePasswordTooLong
+		} else if err != nil {
+			s.logger.Error("cannot hash share link password", "error", err)
+			return entities.ShareLink{}, ErrInternal
+		}
+		link.PasswordHash = string(hash)
+	}
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	created, err := s.linksRepo.Create(c, link)
+	if err != nil {
+		s.logger.Error("cannot create share link", "error", err, "book_id", bookID)
+		return entities.ShareLink{}, ErrInternal
+	}
+	return created, nil
+}
+
+func (s shareLinksService) Get(ctx context.Context, linkID uuid.UUID) (entities.ShareLink, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	link, err := s.linksRepo.GetByID(c, linkID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrShareLinkNotFound) {
+			return entities.ShareLink{}, ErrShareLinkNotFound
+		}
+		s.logger.Error("cannot get share link", "error", err, "link_id", linkID)
+		return entities.ShareLink{}, ErrInternal
+	}
+	return link, nil
+}
+
+func (s shareLinksService) GetByBookID(ctx context.Context, bookID uuid.UUID) ([]entities.ShareLink, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	links, err := s.linksRepo.GetByBookID(c, bookID)
+	if err != nil {
+		s.logger.Error("cannot get share links", "error", err, "book_id", bookID)
+		return nil, ErrInternal
+	}
+	return links, nil
+}
+
+func (s shareLinksService) Revoke(ctx context.Context, linkID uuid.UUID) error {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.linksRepo.Revoke(c, linkID); err != nil {
+		if errors.Is(err, repositories.ErrShareLinkNotFound) {
+			return ErrShareLinkNotFound
+		}
+		s.logger.Error("cannot revoke share link", "error", err, "link_id", linkID)
+		return ErrInternal
+	}
+	return nil
+}
+
+// logAccess records an access to the link, a failure does not stop the download.
+func (s shareLinksService) logAccess(ctx context.Context, linkID uuid.UUID, client entities.ClientInfo, outcome entities.ShareLinkAccessOutcome) {
+	err := s.linksRepo.AddAccess(ctx, entities.ShareLinkAccess{
+		ID:        uuid.New(),
+		LinkID:    linkID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Outcome:   outcome,
+	})
+	if err != nil {
+		s.logger.Error("cannot log share link access", "error", err, "link_id", linkID, "outcome", outcome)
+	}
+}
+
+func (s shareLinksService) Open(ctx context.Context, token string, password string, client entities.ClientInfo) (entities.ShareLink, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	link, err := s.linksRepo.GetByToken(c, token)
+	if err != nil {
+		if errors.Is(err, repositories.ErrShareLinkNotFound) {
+			return entities.ShareLink{}, ErrShareLinkNotFound
+		}
+		s.logger.Error("cannot get share link", "error", err)
+		return entities.ShareLink{}, ErrInternal
+	}
+	var outcome entities.ShareLinkAccessOutcome
+	switch {
+	case link.IsRevoked:
+		outcome = entities.ShareLinkAccessRevoked
+	case link.IsExpired(time.Now()):
+		outcome = entities.ShareLinkAccessExpired
+	case link.IsExhausted():
+		outcome = entities.ShareLinkAccessExhausted
+	}
+	if outcome != "" {
+		s.logAccess(c, link.ID, client, outcome)
+		return entities.ShareLink{}, ErrShareLinkUnavailable
+	}
+	if !link.HasPassword() {
+		return link, nil
+	}
+	if password == "" {
+		return entities.ShareLink{}, ErrSharePasswordRequired
+	}
+	// the attempt is recorded as a wrong password before it is counted, so every attempt running at the same time
+	// counts the others and no more than sharePasswordAttempts of them get to the comparison
+	attempt := entities.ShareLinkAccess{
+		ID:        uuid.New(),
+		LinkID:    link.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Outcome:   entities.ShareLinkAccessWrongPassword,
+	}
+	if err := s.linksRepo.AddAccess(c, attempt); err != nil {
+		s.logger.Error("cannot log share link access", "error", err, "link_id", link.ID, "outcome", attempt.Outcome)
+		return entities.ShareLink{}, ErrInternal
+	}
+	failures, err := s.linksRepo.CountAccesses(c, link.ID, entities.ShareLinkAccessWrongPassword, sharePasswordPeriod)
+	if err != nil {
+		s.logger.Error("cannot count wrong share link passwords", "error", err, "link_id", link.ID)
+		return entities.ShareLink{}, ErrInternal
+	}
+	if failures > sharePasswordAttempts {
+		s.dropAttempt(c, attempt)
+		return entities.ShareLink{}, ErrTooManySharePasswordAttempts
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)); err != nil {
+		return entities.ShareLink{}, ErrInvalidSharePassword
+	}
+	s.dropAttempt(c, attempt)
+	return link, nil
+}
+
+// dropAttempt removes a password attempt that turned out not to be a wrong password.
+func (s shareLinksService) dropAttempt(ctx context.Context, attempt entities.ShareLinkAccess) {
+	if err := s.linksRepo.DeleteAccess(ctx, attempt.ID); err != nil {
+		s.logger.Error("cannot delete share link access", "error", err, "link_id", attempt.LinkID)
+	}
+}
+
+func (s shareLinksService) Download(ctx context.Context, link entities.ShareLink, client entities.ClientInfo) (entities.ShareLink, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	used, err := s.linksRepo.Use(c, link.ID)
+	if err != nil {
+		// the link was revoked or its last download was taken after it was opened
+		if errors.Is(err, repositories.ErrShareLinkNotFound) {
+			return entities.ShareLink{}, ErrShareLinkUnavailable
+		}
+		s.logger.Error("cannot count share link download", "error", err, "link_id", link.ID)
+		return entities.ShareLink{}, ErrInternal
+	}
+	s.logAccess(c, link.ID, client, entities.ShareLinkAccessDownloaded)
+	return used, nil
+}
+
+func (s shareLinksService) GetAccesses(ctx context.Context, linkID uuid.UUID, limit, offset uint64) ([]entities.ShareLinkAccess, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	accesses, err := s.linksRepo.GetAccesses(c, linkID, limit, offset)
+	if err != nil {
+		s.logger.Error("cannot get share link accesses", "error", err, "link_id", linkID)
+		return nil, ErrInternal
+	}
+	return accesses, nil
+}
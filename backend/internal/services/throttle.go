@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/config"
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many login attempts")
+	ErrAccountLocked   = errors.New("account is temporarily locked")
+	ErrInvalidToken    = errors.New("invalid or expired token")
+)
+
+// ThrottledError is returned when a login attempt is rejected by the throttler.
+// It wraps either ErrTooManyAttempts or ErrAccountLocked.
+type ThrottledError struct {
+	Cause      error
+	RetryAfter time.Duration
+}
+
+func (e ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Cause.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e ThrottledError) Unwrap() error {
+	return e.Cause
+}
+
+// LoginAttempt is a login attempt that passed the throttler. It is recorded as a failure until it is registered
+// as a success.
+type LoginAttempt struct {
+	ID    int64
+	Email string
+	IP    string
+}
+
+type LoginThrottler interface {
+	// Check records a login attempt for the email from the ip and returns ThrottledError if it must be rejected.
+	// The attempt is recorded as a failure before it is checked, so attempts made at the same time delay each other.
+	Check(ctx context.Context, email, ip string) (LoginAttempt, error)
+	// RegisterFailure locks the address and the email once they have failed too often.
+	RegisterFailure(ctx context.Context, attempt LoginAttempt, user *entities.User) error
+	RegisterSuccess(ctx context.Context, attempt LoginAttempt, user entities.User) error
+	UnlockByToken(ctx context.Context, token string) error
+	UnlockAccount(ctx context.Context, email string) error
+	AuditLog(ctx context.Context, email string, limit, offset uint64) ([]entities.AuditEntry, error)
+}
+
+type loginThrottler struct {
+	repo      repositories.LoginThrottle
+	auditLog  repositories.AuditLog
+	mailer    Mailer
+	policy    config.Throttle
+	publicURL string
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+func NewLoginThrottler(
+	repo repositories.LoginThrottle,
+	auditLog repositories.AuditLog,
+	mailer Mailer,
+	policy config.Throttle,
+	publicURL string,
+	timeout time.Duration,
+	logger *slog.Logger,
+) LoginThrottler {
+	return loginThrottler{
+		repo:      repo,
+		auditLog:  auditLog,
+		mailer:    mailer,
+		policy:    policy,
+		publicURL: publicURL,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func generateToken(size int) string {
+	tokenBytes := make([]byte, size)
+	_, _ = rand.Read(tokenBytes)
+	return hex.EncodeToString(tokenBytes)
+}
+
+// delayFor returns how long a client has to wait after its last failure.
+// The delay doubles for every failure above the free attempts.
+func (t loginThrottler) delayFor(failures int) time.Duration {
+	over := failures - t.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := t.policy.BaseDelay
+	for i := 1; i < over && delay < t.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.policy.MaxDelay)
+}
+
+func (t loginThrottler) audit(ctx context.Context, userID *uuid.UUID, email, ip string, event entities.AuditEvent, details string) {
+	err := t.auditLog.Create(ctx, entities.AuditEntry{
+		UserID:  userID,
+		Email:   email,
+		IP:      ip,
+		Event:   event,
+		Details: details,
+	})
+	if err != nil {
+		t.logger.Error("cannot write audit entry", "error", err, "event", event)
+	}
+}
+
+func (t loginThrottler) checkKey(ctx context.Context, attempt LoginAttempt, kind entities.LockoutKind, key string) error {
+	lockout, err := t.repo.GetLockout(ctx, kind, key)
+	if err != nil && !errors.Is(err, repositories.ErrLockoutNotFound) {
+		return err
+	}
+	now := time.Now()
+	if err == nil && lockout.LockedUntil.After(now) {
+		cause := ErrTooManyAttempts
+		if kind == entities.LockoutKindAccount {
+			cause = ErrAccountLocked
+		}
+		return ThrottledError{Cause: cause, RetryAfter: lockout.LockedUntil.Sub(now)}
+	}
+	// the delay depends on the failures before this attempt
+	stats, err := t.repo.FailureStats(ctx, kind, key, now.Add(-t.policy.Window), attempt.ID)
+	if err != nil {
+		return err
+	}
+	if wait := stats.LastAttempt.Add(t.delayFor(stats.Count)).Sub(now); wait > 0 {
+		return ThrottledError{Cause: ErrTooManyAttempts, RetryAfter: wait}
+	}
+	return nil
+}
+
+func (t loginThrottler) Check(ctx context.Context, email, ip string) (LoginAttempt, error) {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	attempt := LoginAttempt{Email: normalizeEmail(email), IP: ip}
+	id, err := t.repo.RecordFailure(c, attempt.Email, ip)
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+	attempt.ID = id
+	// the address is checked first, so a throttled client is told about its own lockout before the account's
+	checks := []struct {
+		kind entities.LockoutKind
+		key  string
+	}{
+		{entities.LockoutKindIP, ip},
+		{entities.LockoutKindAccount, attempt.Email},
+	}
+	for _, check := range checks {
+		if err := t.checkKey(c, attempt, check.kind, check.key); err != nil {
+			// a rejected attempt never gets to the password, so it is not a failure
+			if err := t.repo.DeleteFailure(c, attempt.ID); err != nil {
+				t.logger.Error("cannot delete rejected login attempt", "error", err)
+			}
+			var throttled ThrottledError
+			if errors.As(err, &throttled) {
+				t.audit(c, nil, attempt.Email, ip, entities.AuditEventLoginThrottled, throttled.Error())
+			}
+			return LoginAttempt{}, err
+		}
+	}
+	return attempt, nil
+}
+
+func (t loginThrottler) sendUnlockMail(ctx context.Context, user entities.User, token string) {
+	unlockURL, err := url.JoinPath(t.publicURL, "/api", "/v1", "/auth", "/unlock")
+	if err != nil {
+		t.logger.Error("cannot build unlock url", "error", err)
+		return
+	}
+	err = t.mailer.Send(ctx, Mail{
+		To:      user.Email,
+		Subject: "Your Shelffy account has been locked",
+		Body: fmt.Sprintf(
+			"We noticed too many failed login attempts for your account, so it has been locked for %s.\n\n"+
+				"If it was you, you can unlock the account right away by opening the link below:\n%s?token=%s\n",
+			t.policy.LockoutDuration, unlockURL, token,
+		),
+	})
+	if err != nil {
+		t.logger.Error("cannot send unlock mail", "error", err, "user_id", user.ID)
+	}
+}
+
+func (t loginThrottler) RegisterFailure(ctx context.Context, attempt LoginAttempt, user *entities.User) error {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	email, ip := attempt.Email, attempt.IP
+	var userID *uuid.UUID
+	if user != nil {
+		userID = &user.ID
+	}
+	now := time.Now()
+	if err := t.repo.DeleteFailuresBefore(c, now.Add(-t.policy.Window)); err != nil {
+		return err
+	}
+	t.audit(c, userID, email, ip, entities.AuditEventLoginFailed, "")
+	since := now.Add(-t.policy.Window)
+	ipStats, err := t.repo.FailureStats(c, entities.LockoutKindIP, ip, since, 0)
+	if err != nil {
+		return err
+	}
+	if t.policy.IPLockoutThreshold > 0 && ipStats.Count >= t.policy.IPLockoutThreshold {
+		_, err := t.repo.Lock(c, entities.Lockout{
+			Kind:        entities.LockoutKindIP,
+			Key:         ip,
+			LockedUntil: now.Add(t.policy.LockoutDuration),
+		})
+		if err != nil {
+			return err
+		}
+		t.audit(c, userID, email, ip, entities.AuditEventIPLocked, fmt.Sprintf("%d failures", ipStats.Count))
+	}
+	// unknown emails are locked like accounts, so a lockout does not reveal whether the account exists
+	accountStats, err := t.repo.FailureStats(c, entities.LockoutKindAccount, email, since, 0)
+	if err != nil {
+		return err
+	}
+	if t.policy.AccountLockoutThreshold > 0 && accountStats.Count >= t.policy.AccountLockoutThreshold {
+		lockout, err := t.repo.Lock(c, entities.Lockout{
+			Kind:        entities.LockoutKindAccount,
+			Key:         email,
+			LockedUntil: now.Add(t.policy.LockoutDuration),
+			UnlockToken: generateToken(32),
+		})
+		if err != nil {
+			return err
+		}
+		t.audit(c, userID, email, ip, entities.AuditEventAccountLocked, fmt.Sprintf("%d failures", accountStats.Count))
+		if user != nil {
+			t.sendUnlockMail(c, *user, lockout.UnlockToken)
+		}
+	}
+	return nil
+}
+
+func (t loginThrottler) RegisterSuccess(ctx context.Context, attempt LoginAttempt, user entities.User) error {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	if err := t.repo.DeleteFailure(c, attempt.ID); err != nil {
+		return err
+	}
+	email := normalizeEmail(user.Email)
+	if err := t.repo.ClearFailures(c, entities.LockoutKindAccount, email); err != nil {
+		return err
+	}
+	t.audit(c, &user.ID, email, attempt.IP, entities.AuditEventLoginSucceeded, "")
+	return nil
+}
+
+func (t loginThrottler) UnlockByToken(ctx context.Context, token string) error {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	lockout, err := t.repo.UnlockByToken(c, token)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLockoutNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	if err := t.repo.ClearFailures(c, lockout.Kind, lockout.Key); err != nil {
+		return err
+	}
+	t.audit(c, nil, lockout.Key, "", entities.AuditEventAccountUnlocked, "unlocked by email")
+	return nil
+}
+
+func (t loginThrottler) UnlockAccount(ctx context.Context, email string) error {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	email = normalizeEmail(email)
+	if err := t.repo.Unlock(c, entities.LockoutKindAccount, email); err != nil {
+		return err
+	}
+	if err := t.repo.ClearFailures(c, entities.LockoutKindAccount, email); err != nil {
+		return err
+	}
+	t.audit(c, nil, email, "", entities.AuditEventAccountUnlocked, "unlocked by admin")
+	return nil
+}
+
+func (t loginThrottler) AuditLog(ctx context.Context, email string, limit, offset uint64) ([]entities.AuditEntry, error) {
+	c, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.auditLog.GetByEmail(c, normalizeEmail(email), limit, offset)
+}
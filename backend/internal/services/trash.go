@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/google/uuid"
+)
+
+const trashPurgeBatch = 100
+
+// Trash keeps deleted books for a retention period during which they can be restored.
+// Run is a background job that purges books whose retention period has passed.
+// Book files are removed from the storage only when a book is purged.
+type Trash interface {
+	GetMany(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.Book, error)
+	Restore(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.Book, error)
+	// Empty purges all books in the trash of the user and returns how many were purged.
+	Empty(ctx context.Context, userID uuid.UUID) (int, error)
+	Run(ctx context.Context) error
+}
+
+type trashService struct {
+	booksRepo           repositories.Books
+	filesRepo           repositories.BookFiles
+	booksEventPublisher BooksEventsPublisher
+	txManager           *manager.Manager
+	retention           time.Duration
+	interval            time.Duration
+	timeout             time.Duration
+	logger              *slog.Logger
+}
+
+func NewTrash(
+	booksRepo repositories.Books,
+	filesRepo repositories.BookFiles,
+	booksEventPublisher BooksEventsPublisher,
+	txManager *manager.Manager,
+	retention time.Duration,
+	interval time.Duration,
+	timeout time.Duration,
+	logger *slog.Logger,
+) Trash {
+	return trashService{
+		booksRepo:           booksRepo,
+		filesRepo:           filesRepo,
+		booksEventPublisher: booksEventPublisher,
+		txManager:           txManager,
+		retention:           retention,
+		interval:            interval,
+		timeout:             timeout,
+		logger:              logger,
+	}
+}
+
+func (s trashService) GetMany(ctx context.Context, userID uuid.UUID, limit, offset uint64) ([]entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepo.GetTrash(c, userID, &limit, &offset)
+	if err != nil {
+		s.logger.Error("cannot get books from trash", "error", err, "user_id", userID)
+		return nil, ErrInternal
+	}
+	return books, nil
+}
+
+func (s trashService) Restore(ctx context.Context, userID uuid.UUID, bookID uuid.UUID) (entities.Book, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	book, err := s.booksRepo.Restore(c, bookID, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBookNotFound) {
+			return entities.Book{}, ErrBookNotFound
+		}
+		s.logger.Error("cannot restore book", "error", err, "book_id", bookID)
+		return entities.Book{}, ErrInternal
+	}
+	// the scan skips books in the trash, so it has to be requested again
+	files, err := s.filesRepo.GetByBookID(c, book.ID)
+	if err != nil {
+		s.logger.Error("cannot get files of restored book", "error", err, "book_id", book.ID)
+		return book, nil
+	}
+	pending := slices.ContainsFunc(files, func(file entities.BookFile) bool {
+		return file.Status == entities.BookStatusPendingScan
+	})
+	if pending {
+		if err := s.booksEventPublisher.PublishUploadBookEvent(c, book); err != nil {
+			s.logger.Error("cannot publish upload book event for restored book", "error", err, "book_id", book.ID)
+		}
+	}
+	return book, nil
+}
+
+// purge deletes the books for good, each in its own transaction, and returns how many were purged.
+func (s trashService) purge(ctx context.Context, books []entities.Book) int {
+	purged := 0
+	for _, book := range books {
+		var files []entities.BookFile
+		err := s.txManager.Do(ctx, func(ctx context.Context) error {
+			var err error
+			files, err = s.booksRepo.Delete(ctx, book.ID)
+			return err
+		})
+		if err != nil {
+			s.logger.Error("cannot purge book", "error", err, "book_id", book.ID)
+			continue
+		}
+		// the files are removed from the storage only once the book is gone from the database
+		if err := s.booksEventPublisher.PublishDeleteBookEvent(ctx, book, files); err != nil {
+			s.logger.Error("cannot publish delete book event", "error", err, "book_id", book.ID)
+		}
+		purged++
+	}
+	return purged
+}
+
+func (s trashService) Empty(ctx context.Context, userID uuid.UUID) (int, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepo.GetTrash(c, userID, nil, nil)
+	if err != nil {
+		s.logger.Error("cannot get books from trash", "error", err, "user_id", userID)
+		return 0, ErrInternal
+	}
+	purged := s.purge(c, books)
+	if purged < len(books) {
+		return purged, ErrInternal
+	}
+	return purged, nil
+}
+
+func (s trashService) purgeExpired(ctx context.Context) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	books, err := s.booksRepo.GetDeletedBefore(c, time.Now().Add(-s.retention), trashPurgeBatch)
+	if err != nil {
+		s.logger.Error("cannot get expired books from trash", "error", err)
+		return
+	}
+	if purged := s.purge(c, books); purged > 0 {
+		s.logger.Info("expired books purged from trash", "count", purged)
+	}
+}
+
+func (s trashService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.purgeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Shelffy/shelffy/internal/entities"
+	"github.com/Shelffy/shelffy/internal/repositories"
+	"github.com/google/uuid"
+)
+
+// UserAdmin manages accounts on behalf of administrators.
+type UserAdmin interface {
+	GetMany(ctx context.Context, filter entities.UsersFilter, limit, offset uint64) ([]entities.UserOverview, error)
+	GetOverview(ctx context.Context, userID uuid.UUID) (entities.UserOverview, error)
+	// SetActive activates or deactivates an account. Deactivation revokes all sessions of the user.
+	SetActive(ctx context.Context, userID uuid.UUID, active bool) (entities.User, error)
+	SetAdmin(ctx context.Context, userID uuid.UUID, admin bool) (entities.User, error)
+	// Delete immediately removes the account together with its books.
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
+
+type userAdminService struct {
+	usersRepo    repositories.Users
+	sessionsRepo repositories.Session
+	rolesRepo    repositories.Roles
+	deletion     AccountDeletion
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+func NewUserAdmin(
+	usersRepo repositories.Users,
+	sessionsRepo repositories.Session,
+	rolesRepo repositories.Roles,
+	deletion AccountDeletion,
+	timeout time.Duration,
+	logger *slog.Logger,
+) UserAdmin {
+	return userAdminService{
+		usersRepo:    usersRepo,
+		sessionsRepo: sessionsRepo,
+		rolesRepo:    rolesRepo,
+		deletion:     deletion,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+func (s userAdminService) GetMany(ctx context.Context, filter entities.UsersFilter, limit, offset uint64) ([]entities.UserOverview, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.usersRepo.GetMany(c, filter, limit, offset)
+}
+
+func (s userAdminService) GetOverview(ctx context.Context, userID uuid.UUID) (entities.UserOverview, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.usersRepo.GetOverview(c, userID)
+}
+
+func (s userAdminService) SetActive(ctx context.Context, userID uuid.UUID, active bool) (entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	user, err := s.usersRepo.Update(c, userID, map[string]any{"is_active": active})
+	if err != nil {
+		return entities.User{}, err
+	}
+	if !active {
+		if err := s.sessionsRepo.DeactivateByUserID(c, userID); err != nil {
+			s.logger.Error("cannot revoke sessions of deactivated user", "error", err, "user_id", userID)
+			return entities.User{}, err
+		}
+	}
+	return user, nil
+}
+
+func (s userAdminService) SetAdmin(ctx context.Context, userID uuid.UUID, admin bool) (entities.User, error) {
+	c, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var err error
+	if admin {
+		err = s.rolesRepo.Assign(c, userID, entities.RoleAdmin)
+	} else {
+		err = s.rolesRepo.Revoke(c, userID, entities.RoleAdmin)
+	}
+	if err != nil {
+		return entities.User{}, err
+	}
+	return s.usersRepo.GetByID(c, userID)
+}
+
+func (s userAdminService) Delete(ctx context.Context, userID uuid.UUID) error {
+	return s.deletion.Purge(ctx, userID)
+}
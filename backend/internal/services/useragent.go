@@ -0,0 +1,58 @@
+package services
+
+import "strings"
+
+type userAgentToken struct {
+	marker string
+	name   string
+}
+
+// Order matters: many browsers mention the engines of the others in their user agent.
+var (
+	userAgentBrowsers = []userAgentToken{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"YaBrowser/", "Yandex Browser"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentSystems = []userAgentToken{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+func findUserAgentToken(userAgent string, tokens []userAgentToken) string {
+	for _, token := range tokens {
+		if strings.Contains(userAgent, token.marker) {
+			return token.name
+		}
+	}
+	return ""
+}
+
+// deviceNameFromUserAgent builds a friendly name like "Firefox on Linux" from a User-Agent header.
+func deviceNameFromUserAgent(userAgent string) string {
+	browser := findUserAgentToken(userAgent, userAgentBrowsers)
+	system := findUserAgentToken(userAgent, userAgentSystems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS login_attempts(
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    attempted_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+CREATE INDEX IF NOT EXISTS login_attempts_email_idx ON login_attempts(email, attempted_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_idx ON login_attempts(ip, attempted_at);
+
+CREATE TABLE IF NOT EXISTS login_lockouts(
+    kind TEXT NOT NULL,
+    key TEXT NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    unlock_token VARCHAR(128) UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE TABLE IF NOT EXISTS auth_audit_log(
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    event TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+CREATE INDEX IF NOT EXISTS auth_audit_log_user_idx ON auth_audit_log(user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS auth_audit_log;
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts;
+-- +goose StatementEnd
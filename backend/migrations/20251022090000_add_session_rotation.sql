@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS previous_id VARCHAR(128) UNIQUE,
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS sessions_expires_at_idx;
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS previous_id,
+    DROP COLUMN IF EXISTS rotated_at;
+-- +goose StatementEnd
@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS roles(
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+    role VARCHAR(64) REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles(
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    role VARCHAR(64) REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE NOT NULL,
+    granted_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access to the instance'),
+    ('user', 'Regular library user')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'books:upload'),
+    ('admin', 'books:read:any'),
+    ('admin', 'books:delete:any'),
+    ('admin', 'users:manage'),
+    ('admin', 'library:share'),
+    ('user', 'books:upload'),
+    ('user', 'library:share')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'user' FROM users
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'admin' FROM users WHERE is_admin
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT FALSE;
+UPDATE users SET is_admin = TRUE
+WHERE id IN (SELECT user_id FROM user_roles WHERE role = 'admin');
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
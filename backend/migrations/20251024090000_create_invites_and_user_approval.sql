@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS invites(
+    code VARCHAR(64) PRIMARY KEY,
+    created_by UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    max_uses INT NOT NULL DEFAULT 1,
+    uses INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    is_revoked BOOL NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+CREATE INDEX IF NOT EXISTS invites_created_by_idx ON invites(created_by);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS approval_status VARCHAR(16) NOT NULL DEFAULT 'approved',
+    ADD COLUMN IF NOT EXISTS invite_code VARCHAR(64) REFERENCES invites(code) ON DELETE SET NULL;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'invites:create'),
+    ('user', 'invites:create')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DELETE FROM role_permissions WHERE permission = 'invites:create';
+ALTER TABLE users
+    DROP COLUMN IF EXISTS invite_code,
+    DROP COLUMN IF EXISTS approval_status;
+DROP TABLE IF EXISTS invites;
+-- +goose StatementEnd
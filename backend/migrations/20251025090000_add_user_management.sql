@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users(created_at);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens(
+    token VARCHAR(128) PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id_idx ON password_reset_tokens(user_id);
+
+ALTER TABLE sessions
+    DROP CONSTRAINT IF EXISTS sessions_user_id_fkey,
+    ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE sessions
+    DROP CONSTRAINT IF EXISTS sessions_user_id_fkey,
+    ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP INDEX IF EXISTS users_created_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS last_login_at;
+-- +goose StatementEnd
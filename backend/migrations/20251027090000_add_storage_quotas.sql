@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE books ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS storage_used BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS storage_quota BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE users
+    DROP COLUMN IF EXISTS storage_quota,
+    DROP COLUMN IF EXISTS storage_used;
+ALTER TABLE books DROP COLUMN IF EXISTS size;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS mime_type VARCHAR(128) NOT NULL DEFAULT 'application/octet-stream';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE books
+    DROP COLUMN IF EXISTS mime_type,
+    DROP COLUMN IF EXISTS format;
+-- +goose StatementEnd
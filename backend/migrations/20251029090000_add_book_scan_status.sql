@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- books uploaded before scanning was introduced are considered clean
+ALTER TABLE books ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'ready';
+ALTER TABLE books ALTER COLUMN status SET DEFAULT 'pending_scan';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE books DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS authors TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS language VARCHAR(35) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS publisher TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS published_date DATE,
+    ADD COLUMN IF NOT EXISTS isbn VARCHAR(13) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS series_index DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS book_metadata_history(
+    book_id UUID REFERENCES books(id) ON DELETE CASCADE NOT NULL,
+    version INT NOT NULL,
+    title TEXT NOT NULL,
+    metadata JSONB NOT NULL,
+    changed_fields TEXT[] NOT NULL DEFAULT '{}',
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (book_id, version)
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'books:edit:any')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DELETE FROM role_permissions WHERE permission = 'books:edit:any';
+DROP TABLE IF EXISTS book_metadata_history;
+ALTER TABLE books
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS series_index,
+    DROP COLUMN IF EXISTS series,
+    DROP COLUMN IF EXISTS isbn,
+    DROP COLUMN IF EXISTS published_date,
+    DROP COLUMN IF EXISTS publisher,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS authors;
+-- +goose StatementEnd
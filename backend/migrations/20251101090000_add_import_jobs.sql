@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS import_jobs
+(
+    id          UUID PRIMARY KEY,
+    user_id     UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    source      TEXT      NOT NULL,
+    name        TEXT      NOT NULL,
+    status      TEXT      NOT NULL DEFAULT 'pending',
+    total       INT       NOT NULL DEFAULT 0,
+    imported    INT       NOT NULL DEFAULT 0,
+    duplicates  INT       NOT NULL DEFAULT 0,
+    failed      INT       NOT NULL DEFAULT 0,
+    error       TEXT      NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS import_items
+(
+    job_id     UUID      NOT NULL REFERENCES import_jobs (id) ON DELETE CASCADE,
+    name       TEXT      NOT NULL,
+    status     TEXT      NOT NULL,
+    book_id    UUID      REFERENCES books (id) ON DELETE SET NULL,
+    error      TEXT      NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS import_items_job_id_idx ON import_items (job_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS import_items;
+DROP TABLE IF EXISTS import_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS identifiers JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+    ADD COLUMN IF NOT EXISTS cover_path TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE books
+    DROP COLUMN IF EXISTS identifiers,
+    DROP COLUMN IF EXISTS rating,
+    DROP COLUMN IF EXISTS cover_path;
+-- +goose StatementEnd
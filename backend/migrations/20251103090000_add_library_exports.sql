@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS library_exports
+(
+    id           UUID PRIMARY KEY,
+    requested_by UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_id      UUID      REFERENCES users (id) ON DELETE CASCADE,
+    status       TEXT      NOT NULL DEFAULT 'pending',
+    books        INT       NOT NULL DEFAULT 0,
+    size         BIGINT    NOT NULL DEFAULT 0,
+    storage_path TEXT      NOT NULL DEFAULT '',
+    error        TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at  TIMESTAMP,
+    expires_at   TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS library_exports_requested_by_idx ON library_exports (requested_by, created_at);
+CREATE INDEX IF NOT EXISTS library_exports_expires_at_idx ON library_exports (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS library_exports;
+-- +goose StatementEnd
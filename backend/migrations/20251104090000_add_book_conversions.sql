@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS book_conversions
+(
+    book_id      UUID      NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    format       TEXT      NOT NULL,
+    status       TEXT      NOT NULL DEFAULT 'pending',
+    storage_path TEXT      NOT NULL DEFAULT '',
+    size         BIGINT    NOT NULL DEFAULT 0,
+    error        TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, format)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS book_conversions;
+-- +goose StatementEnd
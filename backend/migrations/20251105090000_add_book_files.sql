@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS book_files
+(
+    id         UUID PRIMARY KEY,
+    book_id    UUID         NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    format     VARCHAR(16)  NOT NULL DEFAULT '',
+    mime_type  VARCHAR(128) NOT NULL DEFAULT 'application/octet-stream',
+    size       BIGINT       NOT NULL DEFAULT 0,
+    hash       BYTEA        NOT NULL, -- SHA-256
+    path       TEXT         NOT NULL,
+    status     VARCHAR(16)  NOT NULL DEFAULT 'pending_scan',
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW(),
+    UNIQUE (book_id, format)
+);
+CREATE INDEX IF NOT EXISTS book_files_hash_idx ON book_files (hash);
+
+-- the file a book was uploaded with becomes its primary file, the oldest one
+INSERT INTO book_files (id, book_id, format, mime_type, size, hash, path, status, created_at)
+SELECT gen_random_uuid(), id, format, mime_type, size, hash, path, status, COALESCE(uploaded_at, NOW())
+FROM books;
+
+ALTER TABLE books
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS format,
+    DROP COLUMN IF EXISTS mime_type,
+    DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS hash BYTEA,
+    ADD COLUMN IF NOT EXISTS path TEXT,
+    ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS mime_type VARCHAR(128) NOT NULL DEFAULT 'application/octet-stream',
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'pending_scan';
+
+-- only the primary files are kept, the other files of a book are lost
+UPDATE books
+SET hash = f.hash, path = f.path, size = f.size, format = f.format, mime_type = f.mime_type, status = f.status
+FROM (
+    SELECT DISTINCT ON (book_id) *
+    FROM book_files
+    ORDER BY book_id, created_at, id
+) AS f
+WHERE f.book_id = books.id;
+
+ALTER TABLE books
+    ALTER COLUMN hash SET NOT NULL,
+    ALTER COLUMN path SET NOT NULL;
+DROP TABLE IF EXISTS book_files;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS devices
+(
+    id         UUID PRIMARY KEY,
+    user_id    UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT         NOT NULL,
+    email      TEXT         NOT NULL,
+    format     VARCHAR(16)  NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS book_deliveries
+(
+    id         UUID PRIMARY KEY,
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id    UUID        NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    device_id  UUID        NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+    format     VARCHAR(16) NOT NULL,
+    status     VARCHAR(16) NOT NULL DEFAULT 'pending',
+    size       BIGINT      NOT NULL DEFAULT 0,
+    error      TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS book_deliveries_user_id_idx ON book_deliveries (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS book_deliveries;
+DROP TABLE IF EXISTS devices;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS comic_pages
+(
+    book_id UUID    NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    number  INTEGER NOT NULL,
+    name    TEXT    NOT NULL,
+    size    BIGINT  NOT NULL,
+    PRIMARY KEY (book_id, number)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS comic_pages;
+-- +goose StatementEnd
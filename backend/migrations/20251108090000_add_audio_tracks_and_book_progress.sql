@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- audiobooks have a file per track, the other formats stay limited to a file per book
+ALTER TABLE book_files
+    DROP CONSTRAINT IF EXISTS book_files_book_id_format_key;
+CREATE UNIQUE INDEX IF NOT EXISTS book_files_book_id_format_key ON book_files (book_id, format)
+    WHERE format NOT IN ('m4b', 'mp3');
+
+CREATE TABLE IF NOT EXISTS audio_tracks
+(
+    file_id  UUID PRIMARY KEY REFERENCES book_files (id) ON DELETE CASCADE,
+    book_id  UUID    NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    number   INTEGER NOT NULL,
+    title    TEXT    NOT NULL DEFAULT '',
+    duration BIGINT  NOT NULL DEFAULT 0, -- milliseconds
+    chapters JSONB   NOT NULL DEFAULT '[]',
+    UNIQUE (book_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS book_progress
+(
+    user_id    UUID             NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id    UUID             NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    percentage DOUBLE PRECISION NOT NULL DEFAULT 0,
+    locator    TEXT             NOT NULL DEFAULT '',
+    position   BIGINT           NOT NULL DEFAULT 0, -- milliseconds
+    updated_at TIMESTAMP        NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, book_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS book_progress;
+DROP TABLE IF EXISTS audio_tracks;
+
+-- only the first track of an audiobook is kept, the content of the others stays in the storage
+DELETE FROM book_files AS f
+USING book_files AS first
+WHERE f.book_id = first.book_id
+  AND f.format = first.format
+  AND (f.created_at, f.id) > (first.created_at, first.id);
+DROP INDEX IF EXISTS book_files_book_id_format_key;
+ALTER TABLE book_files
+    ADD CONSTRAINT book_files_book_id_format_key UNIQUE (book_id, format);
+-- +goose StatementEnd
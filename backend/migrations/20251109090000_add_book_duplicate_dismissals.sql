@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- pairs of books the owner kept as different books, they are left out of the duplicates report
+CREATE TABLE IF NOT EXISTS book_duplicate_dismissals
+(
+    book_id       UUID      NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    other_book_id UUID      NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, other_book_id),
+    CHECK (book_id < other_book_id)
+);
+CREATE INDEX IF NOT EXISTS book_duplicate_dismissals_other_book_id_idx ON book_duplicate_dismissals (other_book_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS book_duplicate_dismissals;
+-- +goose StatementEnd
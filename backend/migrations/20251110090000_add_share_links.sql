@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS share_links
+(
+    id            UUID PRIMARY KEY,
+    token         VARCHAR(64) NOT NULL UNIQUE,
+    book_id       UUID        NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    created_by    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password_hash TEXT        NOT NULL DEFAULT '',
+    expires_at    TIMESTAMP,
+    max_downloads INT,
+    downloads     INT         NOT NULL DEFAULT 0,
+    is_revoked    BOOL        NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS share_links_book_id_idx ON share_links (book_id, created_at);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses
+(
+    id         UUID PRIMARY KEY,
+    link_id    UUID        NOT NULL REFERENCES share_links (id) ON DELETE CASCADE,
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    outcome    VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS share_link_accesses_link_id_idx ON share_link_accesses (link_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS share_link_accesses;
+DROP TABLE IF EXISTS share_links;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS households
+(
+    id         UUID PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS household_members
+(
+    household_id UUID        NOT NULL REFERENCES households (id) ON DELETE CASCADE,
+    user_id      UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role         VARCHAR(16) NOT NULL,
+    allowed_tags TEXT[]      NOT NULL DEFAULT '{}',
+    joined_at    TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (household_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS household_members_user_id_idx ON household_members (user_id);
+
+CREATE TABLE IF NOT EXISTS household_books
+(
+    household_id UUID      NOT NULL REFERENCES households (id) ON DELETE CASCADE,
+    book_id      UUID      NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    shared_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (household_id, book_id)
+);
+CREATE INDEX IF NOT EXISTS household_books_book_id_idx ON household_books (book_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS household_books;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- books uploaded before quotas were introduced were not counted, their file sizes are filled in
+-- from the storage by the quotas service on start and added to the usage then
+UPDATE users
+SET storage_used = COALESCE((
+    SELECT SUM(book_files.size)
+    FROM book_files
+    JOIN books ON books.id = book_files.book_id
+    WHERE books.uploaded_by = users.id
+), 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS household_invites
+(
+    id           UUID PRIMARY KEY,
+    household_id UUID        NOT NULL REFERENCES households (id) ON DELETE CASCADE,
+    email        TEXT        NOT NULL,
+    role         VARCHAR(16) NOT NULL,
+    allowed_tags TEXT[]      NOT NULL DEFAULT '{}',
+    invited_by   UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at   TIMESTAMP   NOT NULL DEFAULT NOW(),
+    UNIQUE (household_id, email)
+);
+CREATE INDEX IF NOT EXISTS household_invites_email_idx ON household_invites (email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS household_invites;
+-- +goose StatementEnd